@@ -0,0 +1,97 @@
+package main
+
+// refcounter generates the markdown documentation of the binary format of
+// refcounter files. The layout is computed by reflecting on
+// proto.RefCounterFileFormat, which keeps the documentation in sync with the
+// code. It is invoked through the go:generate directive in
+// modules/renter/proto/refcounter.go.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+
+	"go.sia.tech/siad/modules/renter/proto"
+)
+
+const (
+	// docHeader is written before the layout table.
+	docHeader = `<!-- Code generated by cmd/gendocs/refcounter. DO NOT EDIT. -->
+
+# Refcounter Binary Format
+
+A refcounter file consists of a fixed size header followed by one counter per
+sector of the contract. All offsets and sizes are in bytes. Fields with an
+offset containing ` + "`i`" + ` are repeated for every sector ` + "`i`" + ` of
+the contract.
+
+`
+)
+
+// layoutRow is a single row of the layout table.
+type layoutRow struct {
+	offset      uintptr
+	size        uintptr
+	name        string
+	description string
+	repeated    bool
+}
+
+// layoutRows returns the rows of all fields of t. Nested structs are flattened
+// and their fields are prefixed with the name of the struct field.
+func layoutRows(t reflect.Type, base uintptr, prefix string, repeated bool) []layoutRow {
+	var rows []layoutRow
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := prefix + f.Name
+		rep := repeated || f.Tag.Get("layout") == "repeated"
+		if f.Type.Kind() == reflect.Struct {
+			rows = append(rows, layoutRows(f.Type, base+f.Offset, name+".", rep)...)
+			continue
+		}
+		rows = append(rows, layoutRow{
+			offset:      base + f.Offset,
+			size:        f.Type.Size(),
+			name:        name,
+			description: f.Tag.Get("doc"),
+			repeated:    rep,
+		})
+	}
+	return rows
+}
+
+// generate returns the markdown documentation of the layout described by t.
+func generate(t reflect.Type) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(docHeader)
+	buf.WriteString("| Offset | Size | Field | Description |\n")
+	buf.WriteString("| ------ | ---- | ----- | ----------- |\n")
+	for _, row := range layoutRows(t, 0, "", false) {
+		offset := fmt.Sprint(row.offset)
+		if row.repeated {
+			offset = fmt.Sprintf("%d + %d*i", row.offset, row.size)
+		}
+		fmt.Fprintf(&buf, "| %v | %v | %v | %v |\n", offset, row.size, row.name, row.description)
+	}
+	return buf.Bytes()
+}
+
+func main() {
+	out := flag.String("o", "", "output file, defaults to stdout")
+	flag.Parse()
+
+	doc := generate(reflect.TypeOf(proto.RefCounterFileFormat{}))
+	if *out == "" {
+		if _, err := os.Stdout.Write(doc); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(*out, doc, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
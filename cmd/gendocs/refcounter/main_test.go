@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.sia.tech/siad/modules/renter/proto"
+)
+
+// TestGenerateUpToDate checks that the committed refcounter format
+// documentation matches the generated one.
+func TestGenerateUpToDate(t *testing.T) {
+	committed, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "modules", "renter", "proto", "refcounterformat.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, generate(reflect.TypeOf(proto.RefCounterFileFormat{}))) {
+		t.Fatal("refcounterformat.md is out of date, run go generate in modules/renter/proto")
+	}
+}
+
+// TestLayoutRows checks the offsets and sizes of the generated rows.
+func TestLayoutRows(t *testing.T) {
+	rows := layoutRows(reflect.TypeOf(proto.RefCounterFileFormat{}), 0, "", false)
+	expected := []layoutRow{
+		{offset: 0, size: 7, name: "Header.Version"},
+		{offset: 7, size: 1, name: "Header.Mode"},
+		{offset: 8, size: 2, name: "Count", repeated: true},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %v rows, got %v", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		if row.description == "" {
+			t.Errorf("row %v has no description", row.name)
+		}
+		row.description = ""
+		if row != expected[i] {
+			t.Errorf("row %v: expected %+v, got %+v", i, expected[i], row)
+		}
+	}
+}
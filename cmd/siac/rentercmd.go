@@ -2036,13 +2036,18 @@ func renterfilesuploadcmd(source, path string) {
 		} else if len(files) == 0 {
 			die("Nothing to upload.")
 		}
+		// Parse the SiaPath of the folder.
+		prefix := modules.RootSiaPath()
+		if path != "" {
+			prefix, err = modules.NewSiaPath(path)
+			if err != nil {
+				die("Couldn't parse SiaPath:", err)
+			}
+		}
 		failed := 0
 		for _, file := range files {
-			fpath, _ := filepath.Rel(source, file)
-			fpath = filepath.Join(path, fpath)
-			fpath = filepath.ToSlash(fpath)
 			// Parse SiaPath.
-			fSiaPath, err := modules.NewSiaPath(fpath)
+			fSiaPath, err := modules.SiaPathFromLocal(source, file, prefix)
 			if err != nil {
 				die("Couldn't parse SiaPath:", err)
 			}
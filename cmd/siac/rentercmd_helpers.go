@@ -115,7 +115,11 @@ func downloadDir(siaPath modules.SiaPath, destination string) (tfs []trackedFile
 	// Download files.
 	for _, file := range rd.Files {
 		// Skip files that already exist.
-		dst := filepath.Join(destination, file.SiaPath.Name())
+		var dst string
+		dst, err = modules.LocalPathFromSiaPath(destination, file.SiaPath, siaPath)
+		if err != nil {
+			return
+		}
 		if _, err = os.Stat(dst); err == nil {
 			skipped = append(skipped, dst)
 			continue
@@ -143,7 +147,12 @@ func downloadDir(siaPath modules.SiaPath, destination string) (tfs []trackedFile
 	// Call downloadDir on all subdirs.
 	for i := 1; i < len(rd.Directories); i++ {
 		subDir := rd.Directories[i]
-		rtfs, rskipped, totalSubSize, rerr := downloadDir(subDir.SiaPath, filepath.Join(destination, subDir.SiaPath.Name()))
+		subDst, rerr := modules.LocalPathFromSiaPath(destination, subDir.SiaPath, siaPath)
+		if rerr != nil {
+			err = errors.Compose(err, rerr)
+			continue
+		}
+		rtfs, rskipped, totalSubSize, rerr := downloadDir(subDir.SiaPath, subDst)
 		tfs = append(tfs, rtfs...)
 		skipped = append(skipped, rskipped...)
 		totalSize += totalSubSize
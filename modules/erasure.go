@@ -65,6 +65,11 @@ type (
 		// recover the original data.
 		MinPieces() int
 
+		// ChunkSize returns the size of the data that is encoded into pieces
+		// of the given size. Chunk sizes should never be computed from
+		// MinPieces directly.
+		ChunkSize(pieceSize uint64) uint64
+
 		// Encode splits data into equal-length pieces, with some pieces
 		// containing parity data.
 		Encode(data []byte) ([][]byte, error)
@@ -181,6 +186,12 @@ func (rs *RSCode) NumPieces() int { return rs.numPieces }
 // recover the original data.
 func (rs *RSCode) MinPieces() int { return rs.dataPieces }
 
+// ChunkSize returns the size of the data that is encoded into pieces of the
+// given size.
+func (rs *RSCode) ChunkSize(pieceSize uint64) uint64 {
+	return pieceSize * uint64(rs.dataPieces)
+}
+
 // Encode splits data into equal-length pieces, some containing the original
 // data and some containing parity data.
 func (rs *RSCode) Encode(data []byte) ([][]byte, error) {
@@ -479,6 +490,12 @@ func (pec *PassthroughErasureCoder) MinPieces() int {
 	return 1
 }
 
+// ChunkSize returns the size of the data that is encoded into pieces of the
+// given size. For the passthrough this is the piece size.
+func (pec *PassthroughErasureCoder) ChunkSize(pieceSize uint64) uint64 {
+	return pieceSize
+}
+
 // Encode splits data into equal-length pieces, with some pieces containing
 // parity data. For the passthrough this is a no-op.
 func (pec *PassthroughErasureCoder) Encode(data []byte) ([][]byte, error) {
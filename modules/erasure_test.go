@@ -14,6 +14,7 @@ import (
 // erasure code interface, as defined in erasure.go.
 func TestErasureCode(t *testing.T) {
 	t.Run("RSCode", testRSCode)
+	t.Run("RSCodeMissingDataPieces", testRSCodeMissingDataPieces)
 	t.Run("RSSubCode", testRSSubCode)
 	t.Run("Passthrough", testPassthrough)
 	t.Run("UniqueIdentifier", testUniqueIdentifier)
@@ -69,6 +70,42 @@ func testRSCode(t *testing.T) {
 	}
 }
 
+// testRSCodeMissingDataPieces checks that data can be recovered from parity
+// pieces when data pieces are missing, e.g. because the hosts storing them are
+// offline.
+func testRSCodeMissingDataPieces(t *testing.T) {
+	rsc, err := NewRSCode(2, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(777)
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop all data pieces and all but MinPieces parity pieces.
+	for i := 0; i < rsc.NumPieces()-rsc.MinPieces(); i++ {
+		pieces[i] = nil
+	}
+	buf := new(bytes.Buffer)
+	err = rsc.Recover(pieces, uint64(len(data)), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+
+	// Recovering from less than MinPieces pieces fails.
+	for i := 0; i < rsc.NumPieces()-rsc.MinPieces()+1; i++ {
+		pieces[i] = nil
+	}
+	if err := rsc.Recover(pieces, uint64(len(data)), ioutil.Discard); err == nil {
+		t.Fatal("expected recovery from too few pieces to fail")
+	}
+}
+
 // testRSSubCode checks that individual segments of an encoded piece can be
 // recovered using the RSSub Code.
 func testRSSubCode(t *testing.T) {
@@ -391,6 +391,9 @@ func (h *Host) managedUpdatePriceTable() {
 		// TxnFee related fields.
 		TxnFeeMinRecommended: minRecommended,
 		TxnFeeMaxRecommended: maxRecommended,
+
+		// MDM related fields.
+		SupportedInstructions: modules.MDMSupportedInstructions,
 	}
 	// update the pricetable
 	h.staticPriceTables.managedSetCurrent(priceTable)
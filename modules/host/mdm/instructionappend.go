@@ -1,7 +1,6 @@
 package mdm
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"go.sia.tech/siad/crypto"
@@ -31,14 +30,19 @@ func (p *program) staticDecodeAppendInstruction(instruction modules.Instruction)
 			modules.RPCIAppendLen, len(instruction.Args))
 	}
 	// Read args.
-	dataOffset := binary.LittleEndian.Uint64(instruction.Args[:8])
+	var b [modules.RPCIAppendLen]byte
+	copy(b[:], instruction.Args)
+	args, err := modules.DecodeAppendArgs(b)
+	if err != nil {
+		return nil, err
+	}
 	return &instructionAppend{
 		commonInstruction: commonInstruction{
 			staticData:        p.staticData,
-			staticMerkleProof: instruction.Args[8] == 1,
+			staticMerkleProof: args.ProofRequired,
 			staticState:       p.staticProgramState,
 		},
-		dataOffset: dataOffset,
+		dataOffset: args.DataOffset,
 	}, nil
 }
 
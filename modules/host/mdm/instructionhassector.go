@@ -1,7 +1,6 @@
 package mdm
 
 import (
-	"encoding/binary"
 	"fmt"
 
 	"go.sia.tech/siad/modules"
@@ -30,14 +29,16 @@ func (p *program) staticDecodeHasSectorInstruction(instruction modules.Instructi
 			modules.RPCIHasSectorLen, len(instruction.Args))
 	}
 	// Read args.
-	rootOffset := binary.LittleEndian.Uint64(instruction.Args[:8])
+	var b [modules.RPCIHasSectorLen]byte
+	copy(b[:], instruction.Args)
+	args := modules.DecodeHasSectorArgs(b)
 	return &instructionHasSector{
 		commonInstruction: commonInstruction{
 			staticData:        p.staticData,
 			staticMerkleProof: false,
 			staticState:       p.staticProgramState,
 		},
-		merkleRootOffset: rootOffset,
+		merkleRootOffset: args.MerkleRootOffset,
 	}, nil
 }
 
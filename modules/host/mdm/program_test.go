@@ -3,6 +3,7 @@ package mdm
 import (
 	"bytes"
 	"context"
+	"strings"
 	"testing"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -133,3 +134,15 @@ func TestNewProgramLowCollateralBudget(t *testing.T) {
 		t.Fatal("shouldn't be able to finalize program")
 	}
 }
+
+// TestSupportedInstructions makes sure that all instructions advertised as
+// supported in the price table can be decoded by the MDM.
+func TestSupportedInstructions(t *testing.T) {
+	t.Parallel()
+	for _, specifier := range modules.MDMSupportedInstructions {
+		_, err := decodeInstruction(&program{}, modules.Instruction{Specifier: modules.InstructionSpecifier(specifier)})
+		if err != nil && strings.Contains(err.Error(), "unknown instruction specifier") {
+			t.Fatal("supported instruction can't be decoded", err)
+		}
+	}
+}
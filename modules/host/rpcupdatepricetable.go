@@ -187,7 +187,7 @@ func (h *Host) staticReadPriceTableID(stream siamux.Stream) (*modules.RPCPriceTa
 	}
 
 	// make sure the table isn't expired.
-	if time.Now().After(pt.Expiry()) {
+	if time.Now().After(pt.Expiry()) || h.dependencies.Disrupt("HostExpirePriceTable") {
 		return nil, errors.AddContext(modules.ErrPriceTableExpired, fmt.Sprint(uid))
 	}
 	return &pt.RPCPriceTable, nil
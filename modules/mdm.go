@@ -2,6 +2,7 @@ package modules
 
 import (
 	"encoding/binary"
+	"fmt"
 	"sync"
 	"time"
 
@@ -213,6 +214,25 @@ var (
 	// instruction.
 	SpecifierReadRegistryEID = InstructionSpecifier{'R', 'e', 'a', 'd', 'R', 'e', 'g', 'i', 's', 't', 'r', 'y', 'S', 'I', 'D'}
 
+	// MDMSupportedInstructions are the specifiers of all instructions
+	// supported by the MDM.
+	MDMSupportedInstructions = []types.Specifier{
+		types.Specifier(SpecifierAppend),
+		types.Specifier(SpecifierDropSectors),
+		types.Specifier(SpecifierHasSector),
+		types.Specifier(SpecifierReadOffset),
+		types.Specifier(SpecifierReadSector),
+		types.Specifier(SpecifierRevision),
+		types.Specifier(SpecifierSwapSector),
+		types.Specifier(SpecifierUpdateRegistry),
+		types.Specifier(SpecifierReadRegistry),
+		types.Specifier(SpecifierReadRegistryEID),
+	}
+
+	// ErrUnsupportedInstruction is returned by ValidateProgram if a program
+	// contains an instruction that is not supported by the host.
+	ErrUnsupportedInstruction = errors.New("instruction is not supported by the host")
+
 	// ErrInsufficientBandwidthBudget is returned when bandwidth can no longer
 	// be paid for with the provided budget.
 	ErrInsufficientBandwidthBudget = errors.New("insufficient budget for bandwidth")
@@ -225,6 +245,10 @@ var (
 	// collateral budget of an MDM program is not sufficient to execute the next
 	// instruction.
 	ErrMDMInsufficientCollateralBudget = errors.New("remaining collateral budget is insufficient")
+
+	// ErrInvalidAppendProofFlag is returned when the merkle proof flag of an
+	// 'Append' instruction is neither 0 nor 1.
+	ErrInvalidAppendProofFlag = errors.New("invalid merkle proof flag in append args")
 )
 
 type (
@@ -237,6 +261,23 @@ type (
 	// RegistryEntryID is a hash derived from the public key and tweak that a
 	// renter would like to subscribe to.
 	RegistryEntryID crypto.Hash
+
+	// MDMHasSectorArgs are the arguments of a 'HasSector' instruction.
+	MDMHasSectorArgs struct {
+		// MerkleRootOffset is the offset of the sector's merkle root within
+		// the program data.
+		MerkleRootOffset uint64
+	}
+
+	// MDMAppendArgs are the arguments of an 'Append' instruction.
+	MDMAppendArgs struct {
+		// DataOffset is the offset of the sector's data within the program
+		// data.
+		DataOffset uint64
+		// ProofRequired indicates whether the host should return a merkle
+		// proof for the appended sector.
+		ProofRequired bool
+	}
 )
 
 // DeriveRegistryEntryID is a helper to derive an entry id for a registry key value
@@ -245,14 +286,44 @@ func DeriveRegistryEntryID(pubKey types.SiaPublicKey, tweak crypto.Hash) Registr
 	return RegistryEntryID(crypto.HashAll(pubKey, tweak))
 }
 
+// EncodeHasSectorArgs encodes the arguments of a 'HasSector' instruction.
+func EncodeHasSectorArgs(a MDMHasSectorArgs) [RPCIHasSectorLen]byte {
+	var b [RPCIHasSectorLen]byte
+	binary.LittleEndian.PutUint64(b[:8], a.MerkleRootOffset)
+	return b
+}
+
+// DecodeHasSectorArgs decodes the arguments of a 'HasSector' instruction.
+func DecodeHasSectorArgs(b [RPCIHasSectorLen]byte) MDMHasSectorArgs {
+	return MDMHasSectorArgs{
+		MerkleRootOffset: binary.LittleEndian.Uint64(b[:8]),
+	}
+}
+
+// EncodeAppendArgs encodes the arguments of an 'Append' instruction.
+func EncodeAppendArgs(a MDMAppendArgs) [RPCIAppendLen]byte {
+	var b [RPCIAppendLen]byte
+	binary.LittleEndian.PutUint64(b[:8], a.DataOffset)
+	if a.ProofRequired {
+		b[8] = 1
+	}
+	return b
+}
+
+// DecodeAppendArgs decodes the arguments of an 'Append' instruction.
+func DecodeAppendArgs(b [RPCIAppendLen]byte) (MDMAppendArgs, error) {
+	if b[8] > 1 {
+		return MDMAppendArgs{}, ErrInvalidAppendProofFlag
+	}
+	return MDMAppendArgs{
+		DataOffset:    binary.LittleEndian.Uint64(b[:8]),
+		ProofRequired: b[8] == 1,
+	}, nil
+}
+
 // RPCHasSectorInstruction creates an Instruction from arguments.
 func RPCHasSectorInstruction(merkleRootOffset uint64) Instruction {
-	i := Instruction{
-		Specifier: SpecifierHasSector,
-		Args:      make([]byte, RPCIHasSectorLen),
-	}
-	binary.LittleEndian.PutUint64(i.Args[:8], merkleRootOffset)
-	return i
+	return NewHasSectorInstruction(merkleRootOffset)
 }
 
 // RPCIReadSector is a convenience method to create an Instruction of type 'ReadSector'.
@@ -270,6 +341,35 @@ func RPCIReadSector(rootOff, offsetOff, lengthOff uint64, merkleProof bool) Inst
 	}
 }
 
+// ValidateProgram checks that all instructions of the program are supported by
+// the host according to its price table. If the price table doesn't list the
+// supported instructions, the program is considered valid.
+func ValidateProgram(pt *RPCPriceTable, p Program) error {
+	if len(pt.SupportedInstructions) == 0 {
+		return nil
+	}
+	supported := make(map[types.Specifier]struct{}, len(pt.SupportedInstructions))
+	for _, specifier := range pt.SupportedInstructions {
+		supported[specifier] = struct{}{}
+	}
+	for i, instruction := range p {
+		if _, ok := supported[types.Specifier(instruction.Specifier)]; !ok {
+			return errors.AddContext(ErrUnsupportedInstruction, fmt.Sprintf("instruction %v (%v)", i, types.Specifier(instruction.Specifier)))
+		}
+	}
+	return nil
+}
+
+// MDMVerifyBudget checks whether the budget is sufficient to pay for a program
+// with the given total cost. If it isn't, ErrMDMInsufficientBudget is returned
+// together with the shortfall.
+func MDMVerifyBudget(budget, totalCost types.Currency) error {
+	if budget.Cmp(totalCost) < 0 {
+		return errors.AddContext(ErrMDMInsufficientBudget, fmt.Sprintf("budget %v is %v short of the program's cost %v", budget, totalCost.Sub(budget), totalCost))
+	}
+	return nil
+}
+
 // MDMAppendCost is the cost of executing an 'Append' instruction.
 func MDMAppendCost(pt *RPCPriceTable, duration types.BlockHeight) (types.Currency, types.Currency) {
 	// Cost for writing the Data.
@@ -365,6 +465,28 @@ func MDMWriteCost(pt *RPCPriceTable, writeLength uint64) types.Currency {
 	return writeCost
 }
 
+// MDMWriteStorageCost is the cost of executing a write-type instruction of a
+// certain length for a contract with the given remaining duration. Writes that
+// overwrite existing storage don't add any storage to the contract, so the
+// refundable storeCost is zero. Writes that target new storage are charged
+// like an 'Append' and the storeCost is refundable.
+func MDMWriteStorageCost(pt *RPCPriceTable, writeLength uint64, duration types.BlockHeight, newStorage bool) (types.Currency, types.Currency) {
+	writeCost := MDMWriteCost(pt, writeLength)
+	if !newStorage {
+		return writeCost, types.ZeroCurrency
+	}
+	storeCost := pt.WriteStoreCost.Mul64(writeLength).Mul64(uint64(duration))
+	return writeCost.Add(storeCost), storeCost
+}
+
+// MDMWriteTargetsNewStorage returns whether a write of writeLength bytes at the
+// given offset extends beyond the contractSize and therefore targets new
+// storage. It is used to determine the default for MDMWriteStorageCost from
+// the offset encoded in an instruction's args.
+func MDMWriteTargetsNewStorage(offset, writeLength, contractSize uint64) bool {
+	return offset+writeLength > contractSize
+}
+
 // MDMSwapCost is the cost of executing a 'Swap' instruction.
 func MDMSwapCost(pt *RPCPriceTable, contractSize uint64) types.Currency {
 	return types.SiacoinPrecision // TODO: figure out good cost
@@ -0,0 +1,22 @@
+//go:build go1.18
+// +build go1.18
+
+package modules
+
+import "testing"
+
+// FuzzHasSectorArgsDecode verifies that decoding arbitrary HasSector args
+// doesn't panic and that the args survive a round trip.
+func FuzzHasSectorArgsDecode(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{255, 255, 255, 255, 255, 255, 255, 255})
+	f.Add([]byte{8, 7, 6, 5, 4, 3, 2, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var b [RPCIHasSectorLen]byte
+		copy(b[:], data)
+		args := DecodeHasSectorArgs(b)
+		if EncodeHasSectorArgs(args) != b {
+			t.Fatal("round trip failed")
+		}
+	})
+}
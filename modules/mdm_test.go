@@ -1,9 +1,12 @@
 package modules
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/types"
 )
 
@@ -240,3 +243,236 @@ func TestRequiresReadonlyAndSnapshot(t *testing.T) {
 		}
 	}
 }
+
+// TestMDMWriteStorageCost tests that MDMWriteStorageCost only returns a
+// refundable storeCost for writes that target new storage.
+func TestMDMWriteStorageCost(t *testing.T) {
+	t.Parallel()
+
+	pt := &RPCPriceTable{
+		WriteBaseCost:   types.NewCurrency64(1),
+		WriteLengthCost: types.NewCurrency64(2),
+		WriteStoreCost:  types.NewCurrency64(3),
+	}
+	duration := types.BlockHeight(10)
+
+	// Overwriting existing storage shouldn't be refundable.
+	if MDMWriteTargetsNewStorage(0, SectorSize, 2*SectorSize) {
+		t.Fatal("write within contract should target existing storage")
+	}
+	cost, refund := MDMWriteStorageCost(pt, SectorSize, duration, false)
+	if !cost.Equals(MDMWriteCost(pt, SectorSize)) {
+		t.Fatal("wrong cost", cost)
+	}
+	if !refund.IsZero() {
+		t.Fatal("expected zero refund", refund)
+	}
+
+	// Writing to new storage should mirror the cost of an append.
+	if !MDMWriteTargetsNewStorage(2*SectorSize, SectorSize, 2*SectorSize) {
+		t.Fatal("write past the end of the contract should target new storage")
+	}
+	cost, refund = MDMWriteStorageCost(pt, SectorSize, duration, true)
+	appendCost, appendRefund := MDMAppendCost(pt, duration)
+	if !cost.Equals(appendCost) {
+		t.Fatalf("expected cost %v but got %v", appendCost, cost)
+	}
+	if refund.IsZero() || !refund.Equals(appendRefund) {
+		t.Fatalf("expected refund %v but got %v", appendRefund, refund)
+	}
+
+	// A shorter write to new storage is only charged for the written bytes.
+	length := SectorSize / 4
+	cost, refund = MDMWriteStorageCost(pt, length, duration, true)
+	expectedRefund := pt.WriteStoreCost.Mul64(length).Mul64(uint64(duration))
+	if !refund.Equals(expectedRefund) {
+		t.Fatalf("expected refund %v but got %v", expectedRefund, refund)
+	}
+	if !cost.Equals(MDMWriteCost(pt, length).Add(expectedRefund)) {
+		t.Fatal("wrong cost", cost)
+	}
+}
+
+// TestHasSectorArgs tests encoding and decoding MDMHasSectorArgs.
+func TestHasSectorArgs(t *testing.T) {
+	t.Parallel()
+
+	args := MDMHasSectorArgs{MerkleRootOffset: 0x0102030405060708}
+	b := EncodeHasSectorArgs(args)
+	if b != [RPCIHasSectorLen]byte{8, 7, 6, 5, 4, 3, 2, 1} {
+		t.Fatal("unexpected encoding", b)
+	}
+	if decoded := DecodeHasSectorArgs(b); decoded != args {
+		t.Fatal("args don't match", decoded, args)
+	}
+	// The program builder should use the same encoding.
+	i := NewHasSectorInstruction(args.MerkleRootOffset)
+	if !bytes.Equal(i.Args, b[:]) {
+		t.Fatal("instruction args don't match encoding")
+	}
+}
+
+// TestAppendArgs tests encoding and decoding MDMAppendArgs.
+func TestAppendArgs(t *testing.T) {
+	t.Parallel()
+
+	for _, proof := range []bool{true, false} {
+		args := MDMAppendArgs{DataOffset: 0x0102030405060708, ProofRequired: proof}
+		b := EncodeAppendArgs(args)
+		expected := [RPCIAppendLen]byte{8, 7, 6, 5, 4, 3, 2, 1, 0}
+		if proof {
+			expected[8] = 1
+		}
+		if b != expected {
+			t.Fatal("unexpected encoding", b)
+		}
+		decoded, err := DecodeAppendArgs(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != args {
+			t.Fatal("args don't match", decoded, args)
+		}
+		// The program builder should use the same encoding.
+		i := NewAppendInstruction(args.DataOffset, args.ProofRequired)
+		if !bytes.Equal(i.Args, b[:]) {
+			t.Fatal("instruction args don't match encoding")
+		}
+	}
+
+	// Proof flags other than 0 and 1 are invalid.
+	b := [RPCIAppendLen]byte{8: 2}
+	if _, err := DecodeAppendArgs(b); !errors.Contains(err, ErrInvalidAppendProofFlag) {
+		t.Fatal("expected ErrInvalidAppendProofFlag", err)
+	}
+}
+
+// TestValidateProgram tests that ValidateProgram rejects programs with
+// instructions that the host doesn't support.
+func TestValidateProgram(t *testing.T) {
+	t.Parallel()
+
+	program := Program{
+		RPCHasSectorInstruction(0),
+		{Specifier: SpecifierSwapSector},
+	}
+
+	// A price table without supported instructions accepts everything.
+	var pt RPCPriceTable
+	if err := ValidateProgram(&pt, program); err != nil {
+		t.Fatal(err)
+	}
+
+	// A host supporting all instructions accepts the program.
+	pt.SupportedInstructions = MDMSupportedInstructions
+	if err := ValidateProgram(&pt, program); err != nil {
+		t.Fatal(err)
+	}
+
+	// A host without support for SwapSector doesn't.
+	pt.SupportedInstructions = []types.Specifier{types.Specifier(SpecifierHasSector)}
+	err := ValidateProgram(&pt, program)
+	if !errors.Contains(err, ErrUnsupportedInstruction) {
+		t.Fatal("expected ErrUnsupportedInstruction, got", err)
+	}
+	if !strings.Contains(err.Error(), "SwapSector") {
+		t.Fatal("error doesn't name the unsupported instruction", err)
+	}
+}
+
+// TestMDMVerifyBudget tests verifying the budget of programs whose cost is
+// below, at and above the budget.
+func TestMDMVerifyBudget(t *testing.T) {
+	t.Parallel()
+
+	pt := &RPCPriceTable{
+		InitBaseCost:      types.NewCurrency64(10),
+		MemoryTimeCost:    types.NewCurrency64(1),
+		HasSectorBaseCost: types.NewCurrency64(100),
+		ReadBaseCost:      types.NewCurrency64(1000),
+		ReadLengthCost:    types.NewCurrency64(1),
+	}
+	pb := NewProgramBuilder(pt, 0)
+	pb.AddHasSectorInstruction(crypto.Hash{})
+	pb.AddReadSectorInstruction(SectorSize, 0, crypto.Hash{}, true)
+	cost, _, _ := pb.Cost(true)
+	if cost.IsZero() {
+		t.Fatal("program shouldn't be free")
+	}
+
+	// A budget above or exactly at the cost is sufficient.
+	if err := pb.VerifyBudget(cost.Add64(1), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pb.VerifyBudget(cost, true); err != nil {
+		t.Fatal(err)
+	}
+	// A budget below the cost isn't.
+	err := pb.VerifyBudget(cost.Sub64(3), true)
+	if !errors.Contains(err, ErrMDMInsufficientBudget) {
+		t.Fatal("expected ErrMDMInsufficientBudget, got", err)
+	}
+	if !strings.Contains(err.Error(), "is 3 short") {
+		t.Fatal("error doesn't contain the shortfall", err)
+	}
+	if err := MDMVerifyBudget(types.ZeroCurrency, cost); !errors.Contains(err, ErrMDMInsufficientBudget) {
+		t.Fatal("expected ErrMDMInsufficientBudget, got", err)
+	}
+}
+
+// TestMDMRegistryMemoryTimeCost makes sure that registry instructions are
+// charged for the memory they use over their execution time like all other
+// instructions. The memory-time cost is added by the program builder and the
+// host's program execution, so it must not be part of the instructions' cost
+// functions.
+func TestMDMRegistryMemoryTimeCost(t *testing.T) {
+	t.Parallel()
+
+	pt := &RPCPriceTable{
+		MemoryTimeCost: types.NewCurrency64(1),
+	}
+	rv := NewSignedRegistryValue(crypto.Hash{}, nil, 0, crypto.Signature{}, RegistryTypeWithoutPubkey)
+	tests := []struct {
+		name   string
+		add    func(pb *ProgramBuilder) error
+		cost   func(pt *RPCPriceTable) (types.Currency, types.Currency)
+		memory uint64
+		time   uint64
+	}{
+		{
+			name:   "UpdateRegistry",
+			add:    func(pb *ProgramBuilder) error { return pb.AddUpdateRegistryInstruction(types.SiaPublicKey{}, rv) },
+			cost:   MDMUpdateRegistryCost,
+			memory: MDMUpdateRegistryMemory(),
+			time:   MDMTimeUpdateRegistry,
+		},
+		{
+			name: "ReadRegistry",
+			add: func(pb *ProgramBuilder) error {
+				_, err := pb.AddReadRegistryInstruction(types.SiaPublicKey{}, crypto.Hash{}, ReadRegistryVersionWithType)
+				return err
+			},
+			cost:   MDMReadRegistryCost,
+			memory: MDMReadRegistryMemory(),
+			time:   MDMTimeReadRegistry,
+		},
+	}
+	for _, test := range tests {
+		// The cost functions don't include memory-time costs.
+		cost, _ := test.cost(pt)
+		if !cost.IsZero() {
+			t.Fatalf("%v: cost function should only contain memory-independent costs, got %v", test.name, cost)
+		}
+		// The program builder adds them.
+		pb := NewProgramBuilder(pt, 0)
+		if err := test.add(pb); err != nil {
+			t.Fatal(err)
+		}
+		programCost, _, _ := pb.Cost(false)
+		initCost := MDMInitCost(pt, uint64(pb.programData.Len()), 1)
+		expected := initCost.Add(MDMMemoryCost(pt, MDMInitMemory()+test.memory, test.time))
+		if !programCost.Equals(expected) {
+			t.Fatalf("%v: expected program cost %v, got %v", test.name, expected, programCost)
+		}
+	}
+}
@@ -435,6 +435,14 @@ func (pb *ProgramBuilder) Cost(finalized bool) (cost, storage, collateral types.
 	return cost, pb.additionalStorage, pb.riskedCollateral
 }
 
+// VerifyBudget checks whether the budget is sufficient to pay for the program
+// being built by the builder. It should be called before executing the program
+// to avoid running out of budget during the execution.
+func (pb *ProgramBuilder) VerifyBudget(budget types.Currency, finalized bool) error {
+	cost, _, _ := pb.Cost(finalized)
+	return MDMVerifyBudget(budget, cost)
+}
+
 // Program returns the built program and programData.
 func (pb *ProgramBuilder) Program() (Program, ProgramData) {
 	return pb.program, pb.programData.Bytes()
@@ -456,15 +464,14 @@ func (pb *ProgramBuilder) addInstruction(collateral, cost, storage types.Currenc
 
 // NewAppendInstruction creates an Instruction from arguments.
 func NewAppendInstruction(dataOffset uint64, merkleProof bool) Instruction {
-	i := Instruction{
+	args := EncodeAppendArgs(MDMAppendArgs{
+		DataOffset:    dataOffset,
+		ProofRequired: merkleProof,
+	})
+	return Instruction{
 		Specifier: SpecifierAppend,
-		Args:      make([]byte, RPCIAppendLen),
-	}
-	binary.LittleEndian.PutUint64(i.Args[:8], dataOffset)
-	if merkleProof {
-		i.Args[8] = 1
+		Args:      args[:],
 	}
-	return i
 }
 
 // NewUpdateRegistryInstruction creates an Instruction from arguments.
@@ -538,12 +545,13 @@ func NewDropSectorsInstruction(numSectorsOffset uint64, merkleProof bool) Instru
 
 // NewHasSectorInstruction creates a modules.Instruction from arguments.
 func NewHasSectorInstruction(merkleRootOffset uint64) Instruction {
-	i := Instruction{
+	args := EncodeHasSectorArgs(MDMHasSectorArgs{
+		MerkleRootOffset: merkleRootOffset,
+	})
+	return Instruction{
 		Specifier: SpecifierHasSector,
-		Args:      make([]byte, RPCIHasSectorLen),
+		Args:      args[:],
 	}
-	binary.LittleEndian.PutUint64(i.Args[:8], merkleRootOffset)
-	return i
 }
 
 // NewReadOffsetInstruction creates a modules.Instruction from arguments.
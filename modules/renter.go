@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -61,14 +62,39 @@ var (
 	ErrHostFault = errors.New("host has returned an error")
 
 	// ErrDownloadCancelled is the error set when a download was cancelled
-	// manually by the user.
+	// manually by the user or interrupted by a shutdown.
 	ErrDownloadCancelled = errors.New("download was cancelled")
 
+	// ErrFileNotFound is the error set when the file of a download doesn't
+	// exist.
+	ErrFileNotFound = errors.New("file not found")
+
+	// ErrInsufficientHosts is the error set when a download failed because not
+	// enough of the hosts storing the file's pieces were usable, e.g. because
+	// they were offline or on cooldown.
+	ErrInsufficientHosts = errors.New("not enough hosts available to download the file")
+
+	// ErrInsufficientRedundancy is the error set when a download failed
+	// because the file's pieces are stored on too few hosts to recover it.
+	ErrInsufficientRedundancy = errors.New("file does not have enough redundancy to be downloaded")
+
+	// ErrBudgetExhausted is the error set when a download failed because the
+	// renter's funds didn't cover the hosts' prices.
+	ErrBudgetExhausted = errors.New("budget exhausted")
+
+	// ErrDestinationWrite is the error set when a download failed because the
+	// downloaded data couldn't be written to its destination.
+	ErrDestinationWrite = errors.New("unable to write to download destination")
+
 	// ErrNotEnoughWorkersInWorkerPool is an error that is returned whenever an
 	// operation expects a certain number of workers but there aren't that many
 	// available.
 	ErrNotEnoughWorkersInWorkerPool = errors.New("not enough workers in worker pool")
 
+	// ErrInvalidDirUploadDefaults is returned if the upload defaults of a
+	// directory are invalid.
+	ErrInvalidDirUploadDefaults = errors.New("invalid directory upload defaults")
+
 	// PriceEstimationScope is the number of hosts that get queried by the
 	// renter when providing price estimates. Especially for the 'Standard'
 	// variable, there should be congruence with the number of contracts being
@@ -378,6 +404,13 @@ type DirectoryInfo struct {
 	StuckHealth         float64     `json:"stuckhealth"`
 	StuckSize           uint64      `json:"stucksize"`
 	UID                 uint64      `json:"uid"`
+
+	// UploadDefaults are the upload defaults set on the siadir itself.
+	// EffectiveUploadDefaults also include the defaults inherited from the
+	// siadir's ancestors and are the defaults used for uploads into the
+	// siadir.
+	UploadDefaults          DirUploadDefaults `json:"uploaddefaults"`
+	EffectiveUploadDefaults DirUploadDefaults `json:"effectiveuploaddefaults"`
 }
 
 // Name implements os.FileInfo.
@@ -398,11 +431,127 @@ func (d DirectoryInfo) IsDir() bool { return true }
 // Sys implements os.FileInfo.
 func (d DirectoryInfo) Sys() interface{} { return nil }
 
+// UploadConflictMode determines how an upload handles a SiaPath that is
+// already in use.
+type UploadConflictMode string
+
+const (
+	// UploadConflictModeFail fails the upload if the SiaPath is in use.
+	UploadConflictModeFail UploadConflictMode = "fail"
+
+	// UploadConflictModeOverwrite deletes the existing file before uploading.
+	UploadConflictModeOverwrite UploadConflictMode = "overwrite"
+)
+
+// DirUploadDefaults are the upload parameters of a siadir that are inherited
+// by the files uploaded beneath it. Uploads use the defaults of the nearest
+// ancestor that sets a field, unless the field is set explicitly for the
+// upload. Zero values are unset.
+type DirUploadDefaults struct {
+	DataPieces      int                `json:"datapieces"`
+	ParityPieces    int                `json:"paritypieces"`
+	RepairThreshold float64            `json:"repairthreshold"`
+	ConflictMode    UploadConflictMode `json:"conflictmode"`
+}
+
+// ErasureCode returns the erasure coder specified by the defaults or nil if
+// no erasure code is set.
+func (d DirUploadDefaults) ErasureCode() (ErasureCoder, error) {
+	if d.DataPieces == 0 && d.ParityPieces == 0 {
+		return nil, nil
+	}
+	return NewRSSubCode(d.DataPieces, d.ParityPieces, crypto.SegmentSize)
+}
+
+// Inherit returns a copy of the defaults in which every unset field is set to
+// the value of the parent's defaults.
+func (d DirUploadDefaults) Inherit(parent DirUploadDefaults) DirUploadDefaults {
+	if d.DataPieces == 0 && d.ParityPieces == 0 {
+		d.DataPieces, d.ParityPieces = parent.DataPieces, parent.ParityPieces
+	}
+	if d.RepairThreshold == 0 {
+		d.RepairThreshold = parent.RepairThreshold
+	}
+	if d.ConflictMode == "" {
+		d.ConflictMode = parent.ConflictMode
+	}
+	return d
+}
+
+// Validate checks that the set fields of the defaults are valid.
+func (d DirUploadDefaults) Validate() error {
+	if _, err := d.ErasureCode(); err != nil {
+		return errors.Compose(ErrInvalidDirUploadDefaults, err)
+	}
+	if d.RepairThreshold != 0 && !(d.RepairThreshold > 1) {
+		return errors.AddContext(ErrInvalidDirUploadDefaults, "repair threshold needs to be greater than 1")
+	}
+	switch d.ConflictMode {
+	case "", UploadConflictModeFail, UploadConflictModeOverwrite:
+	default:
+		return errors.AddContext(ErrInvalidDirUploadDefaults, fmt.Sprintf("unknown conflict mode '%v'", d.ConflictMode))
+	}
+	return nil
+}
+
+// DownloadErrorCategory is a machine readable category of the error of a
+// failed download.
+type DownloadErrorCategory string
+
+const (
+	// DownloadErrorCategoryFileNotFound is the category of ErrFileNotFound.
+	DownloadErrorCategoryFileNotFound DownloadErrorCategory = "filenotfound"
+
+	// DownloadErrorCategoryInsufficientHosts is the category of
+	// ErrInsufficientHosts.
+	DownloadErrorCategoryInsufficientHosts DownloadErrorCategory = "insufficienthosts"
+
+	// DownloadErrorCategoryInsufficientRedundancy is the category of
+	// ErrInsufficientRedundancy.
+	DownloadErrorCategoryInsufficientRedundancy DownloadErrorCategory = "insufficientredundancy"
+
+	// DownloadErrorCategoryCancelled is the category of ErrDownloadCancelled.
+	DownloadErrorCategoryCancelled DownloadErrorCategory = "cancelled"
+
+	// DownloadErrorCategoryBudgetExhausted is the category of
+	// ErrBudgetExhausted.
+	DownloadErrorCategoryBudgetExhausted DownloadErrorCategory = "budgetexhausted"
+
+	// DownloadErrorCategoryDestinationWrite is the category of
+	// ErrDestinationWrite.
+	DownloadErrorCategoryDestinationWrite DownloadErrorCategory = "destinationwrite"
+)
+
+// downloadErrorCategories maps the errors which categorize download failures
+// to their categories.
+var downloadErrorCategories = []struct {
+	err      error
+	category DownloadErrorCategory
+}{
+	{ErrFileNotFound, DownloadErrorCategoryFileNotFound},
+	{ErrInsufficientHosts, DownloadErrorCategoryInsufficientHosts},
+	{ErrInsufficientRedundancy, DownloadErrorCategoryInsufficientRedundancy},
+	{ErrDownloadCancelled, DownloadErrorCategoryCancelled},
+	{ErrBudgetExhausted, DownloadErrorCategoryBudgetExhausted},
+	{ErrDestinationWrite, DownloadErrorCategoryDestinationWrite},
+}
+
+// ClassifyDownloadError returns the category of a download error. The empty
+// category is returned if the error is nil or doesn't belong to a category.
+func ClassifyDownloadError(err error) DownloadErrorCategory {
+	for _, c := range downloadErrorCategories {
+		if errors.Contains(err, c.err) {
+			return c.category
+		}
+	}
+	return ""
+}
+
 // DownloadInfo provides information about a file that has been requested for
 // download.
 type DownloadInfo struct {
 	Destination     string  `json:"destination"`     // The destination of the download.
-	DestinationType string  `json:"destinationtype"` // Can be "file", "memory buffer", or "http stream".
+	DestinationType string  `json:"destinationtype"` // Can be "file", "memory buffer", "http stream", or "discard".
 	Length          uint64  `json:"length"`          // The length requested for the download.
 	Offset          uint64  `json:"offset"`          // The offset within the siafile requested for the download.
 	SiaPath         SiaPath `json:"siapath"`         // The siapath of the file used for the download.
@@ -414,6 +563,51 @@ type DownloadInfo struct {
 	StartTime            time.Time `json:"starttime"`            // The time when the download was started.
 	StartTimeUnix        int64     `json:"starttimeunix"`        // The time when the download was started in unix format.
 	TotalDataTransferred uint64    `json:"totaldatatransferred"` // Total amount of data transferred, including negotiation, etc.
+
+	ErrorCategory DownloadErrorCategory `json:"errorcategory"` // The category of Error, empty if there was no error.
+
+	// Provenance describes which pieces were used to recover the data. It is
+	// only set when a single download is requested by its UID.
+	Provenance *DownloadProvenance `json:"provenance,omitempty"`
+}
+
+// DownloadProvenance describes where the data of a download came from. Hosts
+// are stored once per download and referenced by their index to keep the
+// provenance compact.
+type DownloadProvenance struct {
+	Hosts  []types.SiaPublicKey      `json:"hosts"`
+	Chunks []DownloadChunkProvenance `json:"chunks"`
+}
+
+// DownloadChunkProvenance describes the pieces which were used to recover a
+// chunk of a download.
+type DownloadChunkProvenance struct {
+	ChunkIndex uint64 `json:"chunkindex"` // The index of the chunk within the file.
+
+	// FromDisk is true if the chunk was read from the local copy of the file
+	// instead of being recovered from pieces.
+	FromDisk bool `json:"fromdisk"`
+
+	// OverdriveDiscarded is true if pieces were fetched for the chunk but
+	// discarded because enough pieces had already been fetched.
+	OverdriveDiscarded bool `json:"overdrivediscarded"`
+
+	// Pieces are the pieces which were passed to the erasure coder to recover
+	// the chunk.
+	Pieces []DownloadPieceProvenance `json:"pieces"`
+}
+
+// DownloadPieceProvenance describes a piece which was used to recover a chunk.
+type DownloadPieceProvenance struct {
+	// HostIndex is the index of the host within the hosts of the download's
+	// provenance which served the piece. It is -1 for pieces which were taken
+	// from the piece cache of the download.
+	HostIndex int `json:"hostindex"`
+
+	PieceIndex    uint64      `json:"pieceindex"`    // The index of the piece within the chunk.
+	SectorRoot    crypto.Hash `json:"sectorroot"`    // The Merkle root of the sector which contains the piece.
+	FetchTime     time.Time   `json:"fetchtime"`     // The time when the piece was fetched.
+	ProofVerified bool        `json:"proofverified"` // Whether the piece was verified with a Merkle proof from the host.
 }
 
 // FileUploadParams contains the information used by the Renter to upload a
@@ -434,6 +628,12 @@ type FileUploadParams struct {
 	// to create a CipherKey with the given CipherType. This value override
 	// CipherType if it is set.
 	CipherKey crypto.CipherKey
+
+	// RepairThreshold and ConflictMode are optional. If they are left blank,
+	// the renter will use the upload defaults of the directory. Setting Force
+	// is equivalent to UploadConflictModeOverwrite.
+	RepairThreshold float64
+	ConflictMode    UploadConflictMode
 }
 
 // FileInfo provides information about a file.
@@ -485,6 +685,102 @@ func (f FileInfo) IsDir() bool { return false }
 // Sys implements os.FileInfo.
 func (f FileInfo) Sys() interface{} { return nil }
 
+// FileManifest is a deterministic list of the SHA-256 hashes of a file's
+// plaintext, both per chunk and for the whole file. It allows for verifying
+// data mirrored out of Sia using standard tools.
+//
+// NOTE: the format of the manifest, both the JSON and the text form, must be
+// kept stable across releases.
+type FileManifest struct {
+	SiaPath   SiaPath             `json:"siapath"`
+	Filesize  uint64              `json:"filesize"`
+	ChunkSize uint64              `json:"chunksize"`
+	SHA256    string              `json:"sha256"`
+	Chunks    []FileManifestChunk `json:"chunks"`
+}
+
+// FileManifestChunk contains the hash of a single chunk of a file. The offset
+// and length describe the range of the plaintext that was hashed.
+type FileManifestChunk struct {
+	Index  uint64 `json:"index"`
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+	SHA256 string `json:"sha256"`
+}
+
+// SHA256Sums returns the manifest in a format that is compatible with the
+// "sha256sum --check" command. The first line is the hash of the whole file,
+// followed by one line per chunk. Chunks are named after the file with the
+// chunk index appended, e.g. "file.chunk0".
+func (fm FileManifest) SHA256Sums() string {
+	name := fm.SiaPath.Name()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s  %s\n", fm.SHA256, name))
+	for _, chunk := range fm.Chunks {
+		sb.WriteString(fmt.Sprintf("%s  %s.chunk%d\n", chunk.SHA256, name, chunk.Index))
+	}
+	return sb.String()
+}
+
+// FileLayoutVersion is the version of the FileLayout schema. It is increased
+// whenever the JSON format of the layout changes.
+const FileLayoutVersion = 1
+
+// FileLayout describes how a file is stored on the hosts. It maps every chunk
+// of the file to the pieces storing it, which allows tools to fetch and decode
+// the file directly from the hosts.
+//
+// A chunk is split into DataPieces pieces of PieceSize bytes which are erasure
+// coded into DataPieces+ParityPieces pieces. The final chunk is padded with
+// FinalChunkPadding zero bytes before erasure coding. Every piece is padded
+// with zeros to SectorSize bytes, encrypted with the key that is derived from
+// the file's master key using the chunk index and piece index, and stored in a
+// sector of its own. The encryption key is not part of the layout.
+//
+// NOTE: the JSON format of the layout must be kept stable for a given Version.
+type FileLayout struct {
+	Version           uint64                `json:"version"`
+	SiaPath           SiaPath               `json:"siapath"`
+	Filesize          uint64                `json:"filesize"`
+	ChunkSize         uint64                `json:"chunksize"`
+	PieceSize         uint64                `json:"piecesize"`
+	SectorSize        uint64                `json:"sectorsize"`
+	FinalChunkPadding uint64                `json:"finalchunkpadding"`
+	CipherType        string                `json:"ciphertype"`
+	ErasureCode       FileLayoutErasureCode `json:"erasurecode"`
+	Chunks            []FileLayoutChunk     `json:"chunks"`
+}
+
+// FileLayoutErasureCode contains the erasure code parameters of a file. Type
+// is 1 for the plain Reed-Solomon code and 2 for the Reed-Solomon code which
+// encodes the chunk in segments of SegmentSize bytes.
+type FileLayoutErasureCode struct {
+	Type         uint32 `json:"type"`
+	DataPieces   uint64 `json:"datapieces"`
+	ParityPieces uint64 `json:"paritypieces"`
+	SegmentSize  uint64 `json:"segmentsize"`
+}
+
+// FileLayoutChunk contains the pieces of a single chunk of a file. The offset
+// and length describe the range of the file that is stored in the chunk.
+type FileLayoutChunk struct {
+	Index  uint64            `json:"index"`
+	Offset uint64            `json:"offset"`
+	Length uint64            `json:"length"`
+	Pieces []FileLayoutPiece `json:"pieces"`
+}
+
+// FileLayoutPiece describes where a piece of a chunk is stored. The same piece
+// might be stored on multiple hosts. The host's public key is encoded in the
+// same way as in the hostdb endpoints, e.g. "ed25519:<hex>". Offset is the
+// offset of the piece within its sector.
+type FileLayoutPiece struct {
+	PieceIndex    uint64      `json:"pieceindex"`
+	HostPublicKey string      `json:"hostpublickey"`
+	SectorRoot    crypto.Hash `json:"sectorroot"`
+	Offset        uint64      `json:"offset"`
+}
+
 // A HostDBEntry represents one host entry in the Renter's host DB. It
 // aggregates the host's external settings and metrics with its public key.
 type HostDBEntry struct {
@@ -612,6 +908,18 @@ type RenterPriceEstimation struct {
 	UploadTerabyte types.Currency `json:"uploadterabyte"`
 }
 
+// RenterMetrics contains the renter's upload and download throughput
+// counters. The totals count the bytes transferred to and from hosts since the
+// renter was started. The bandwidth is averaged over the last 60 seconds.
+type RenterMetrics struct {
+	TotalBytesUploaded   uint64  `json:"totalbytesuploaded"`
+	TotalBytesDownloaded uint64  `json:"totalbytesdownloaded"`
+	ActiveUploads        uint64  `json:"activeuploads"`
+	ActiveDownloads      uint64  `json:"activedownloads"`
+	UploadBandwidthBps   float64 `json:"uploadbandwidthbps"`
+	DownloadBandwidthBps float64 `json:"downloadbandwidthbps"`
+}
+
 // RenterSettings control the behavior of the Renter.
 type RenterSettings struct {
 	Allowance        Allowance     `json:"allowance"`
@@ -619,6 +927,13 @@ type RenterSettings struct {
 	MaxUploadSpeed   int64         `json:"maxuploadspeed"`
 	MaxDownloadSpeed int64         `json:"maxdownloadspeed"`
 	UploadsStatus    UploadsStatus `json:"uploadsstatus"`
+
+	// The download concurrency settings are applied to download chunks when
+	// they are scheduled. A limit of 0 means that there is no limit apart
+	// from the renter's download memory.
+	DownloadOverdrive           int `json:"downloadoverdrive"`
+	MaxConcurrentDownloadChunks int `json:"maxconcurrentdownloadchunks"`
+	MaxDownloadWorkersPerChunk  int `json:"maxdownloadworkersperchunk"`
 }
 
 // UploadsStatus contains information about the Renter's Uploads
@@ -896,6 +1211,8 @@ type (
 		UploadOnCoolDown    bool          `json:"uploadoncooldown"`
 		UploadQueueSize     int           `json:"uploadqueuesize"`
 		UploadTerminated    bool          `json:"uploadterminated"`
+		UploadPacerRate     float64       `json:"uploadpacerrate"`
+		UploadThrottledTime time.Duration `json:"uploadthrottledtime"`
 
 		// Maintenance Cooldown information
 		MaintenanceOnCooldown    bool          `json:"maintenanceoncooldown"`
@@ -1136,6 +1453,32 @@ type Renter interface {
 	// FileHosts returns a list of hosts that are storing the file data.
 	FileHosts(SiaPath) ([]HostDBEntry, error)
 
+	// FileManifest returns the checksum manifest of a file. The file needs
+	// to be downloaded to compute the hashes of its plaintext, which only
+	// happens if stream is true.
+	FileManifest(siaPath SiaPath, stream bool) (FileManifest, error)
+
+	// FileLayout returns the layout of a file which maps the file's chunks
+	// to the pieces and sectors storing them.
+	FileLayout(siaPath SiaPath) (FileLayout, error)
+
+	// Metrics returns the renter's upload and download throughput counters.
+	Metrics() (RenterMetrics, error)
+
+	// ExportSiaFile writes the metadata and piece table of a file to w in
+	// the portable share format. If includeKey is set, the share also
+	// contains the file's encryption key.
+	ExportSiaFile(siaPath SiaPath, w io.Writer, includeKey bool) error
+
+	// ImportSiaFile adds the file contained in a share to the renter. Shares
+	// without an encryption key need to be imported using
+	// ImportSiaFileWithKey.
+	ImportSiaFile(r io.Reader, destSiaPath SiaPath) error
+
+	// ImportSiaFileWithKey adds the file contained in a share to the renter
+	// using the provided encryption key.
+	ImportSiaFileWithKey(r io.Reader, destSiaPath SiaPath, key crypto.CipherKey) error
+
 	// Filter returns the renter's hostdb's filterMode and filteredHosts
 	Filter() (FilterMode, map[string]types.SiaPublicKey, []string, error)
 
@@ -1179,6 +1522,36 @@ type Renter interface {
 	// SetSettings sets the Renter's settings.
 	SetSettings(RenterSettings) error
 
+	// AddToBlacklist adds a host to the renter's blacklist. Blacklisted hosts
+	// are not used for uploads and downloads.
+	AddToBlacklist(spk types.SiaPublicKey) error
+
+	// Blacklist returns the hosts on the renter's blacklist.
+	Blacklist() ([]types.SiaPublicKey, error)
+
+	// RemoveFromBlacklist removes a host from the renter's blacklist.
+	RemoveFromBlacklist(spk types.SiaPublicKey) error
+
+	// SetDefaultRepairThreshold sets the repair threshold, expressed as a
+	// redundancy multiplier, that is applied to new files.
+	SetDefaultRepairThreshold(threshold float64) error
+
+	// SetFileRepairThreshold sets the repair threshold of a file, expressed
+	// as a redundancy multiplier.
+	SetFileRepairThreshold(siaPath SiaPath, threshold float64) error
+
+	// SetDefaultErasureCode sets the erasure code parameters which are used
+	// for uploads that don't specify an erasure code.
+	SetDefaultErasureCode(dataPieces, parityPieces int) error
+
+	// DefaultErasureCode returns the erasure code which is used for uploads
+	// that don't specify an erasure code.
+	DefaultErasureCode() (ErasureCoder, error)
+
+	// SetDirUploadDefaults sets the upload defaults of a directory which are
+	// inherited by files uploaded beneath it.
+	SetDirUploadDefaults(siaPath SiaPath, defaults DirUploadDefaults) error
+
 	// SetFileTrackingPath sets the on-disk location of an uploaded file to a
 	// new value. Useful if files need to be moved on disk.
 	SetFileTrackingPath(siaPath SiaPath, newPath string) error
@@ -1254,6 +1627,31 @@ type RenterDownloadParameters struct {
 	SiaPath          SiaPath
 	Destination      string
 	DisableDiskFetch bool
+
+	// Discard causes the downloaded data to be recovered but not written
+	// anywhere. It is used to verify that a file can be recovered without
+	// storing it. Can't be used together with Httpwriter or Destination.
+	// Discarded downloads are never fetched from disk.
+	Discard bool
+
+	// PieceCache is an optional local store of the file's pieces. It is
+	// checked before pieces are fetched from hosts and pieces fetched from
+	// hosts are added to it.
+	PieceCache PieceCache
+}
+
+// PieceCache is a local store of pieces that were previously downloaded from
+// hosts. A PieceCache only holds the pieces of a single file. The pieces are
+// stored decrypted and padded to the size of a sector. Implementations need to
+// be safe for concurrent use.
+type PieceCache interface {
+	// Get returns the piece with the given index of the chunk with the given
+	// index and whether it was found.
+	Get(chunkIndex, pieceIndex uint64) ([]byte, bool)
+
+	// Put adds the piece with the given index of the chunk with the given
+	// index to the cache. The cache takes ownership of the piece.
+	Put(chunkIndex, pieceIndex uint64, piece []byte)
 }
 
 // HealthPercentage returns the health in a more human understandable format out
@@ -4,10 +4,13 @@ import (
 	"container/list"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siadir"
 )
 
 // Bubble is the process of updating the filesystem metadata for the renter. It
@@ -16,6 +19,14 @@ import (
 // root directory is reached. This results in any changes in metadata being
 // "bubbled" to the top so that the root directory's metadata reflects the
 // status of the entire filesystem.
+//
+// The bubbled metadata is not written to disk right away. Instead it is queued
+// in the filesystem and flushed once all queued bubbles are processed, or once
+// the metadata was held back for bubbleFlushInterval. That way a directory is
+// written only once per flush, even if many of its children were bubbled, and
+// all the directories of a flush are updated with a single WAL transaction.
+// The complete channel of a bubble update is closed once its metadata is
+// flushed.
 
 // bubbleStatus indicates the status of a bubble being executed on a
 // directory
@@ -41,6 +52,10 @@ type (
 	// for managing the number of concurrent bubble updates as well as ensuring
 	// that all bubble updates are processed.
 	bubbleScheduler struct {
+		// atomicDirWrites is the number of times the metadata of a directory
+		// was written to disk by a bubble.
+		atomicDirWrites uint64
+
 		// bubbleNeeded is a channel used to signal the bubbleScheduler that a bubble
 		// is needed
 		bubbleNeeded chan struct{}
@@ -51,6 +66,16 @@ type (
 		// fifo is a First In Fist Out queue of bubble updates
 		fifo *bubbleQueue
 
+		// unflushed contains the complete channels of the bubble updates whose
+		// metadata wasn't flushed yet and unflushedSince is the time the
+		// oldest of them was completed.
+		unflushed      []chan struct{}
+		unflushedSince time.Time
+
+		// unflushedRoot is the bubbled metadata of the root directory if it
+		// wasn't flushed yet.
+		unflushedRoot *siadir.Metadata
+
 		// Utilities
 		mu           sync.Mutex
 		staticRenter *Renter
@@ -171,8 +196,13 @@ func (bs *bubbleScheduler) callThreadedProcessBubbleUpdates() {
 				bs.staticRenter.log.Printf("WARN: error performing bubble on '%v': %v", siaPath, err)
 			}
 
-			// Complete the bubble
-			bs.managedCompleteBubbleUpdate(siaPath)
+			// Complete the bubble. Unless batching is disabled, the complete
+			// channel is closed once the metadata is flushed.
+			if bs.staticRenter.deps.Disrupt("DisableBubbleBatching") {
+				bs.managedCompleteBubbleUpdate(siaPath)
+			} else {
+				bs.managedCompleteBubbleUpdateUnflushed(siaPath)
+			}
 
 			// Queue a bubble on the parent directory
 			err = bs.managedQueueParent(siaPath)
@@ -218,25 +248,60 @@ func (bs *bubbleScheduler) callThreadedProcessBubbleUpdates() {
 		// Close the chan and wait for the worker threads to close
 		close(bubbleChan)
 		wg.Wait()
+
+		// Flush the bubbled metadata if there are no more bubbles to process
+		// or if it was held back for too long.
+		if !bs.managedNeedsFlush() {
+			continue
+		}
+		_, err = bs.managedFlush()
+		if err != nil {
+			bs.staticRenter.log.Println("WARN: error flushing bubbled metadata:", err)
+		}
 	}
 }
 
 // managedCompleteBubbleUpdate will complete the bubble update and update the
 // status and the bubble map accordingly.
 func (bs *bubbleScheduler) managedCompleteBubbleUpdate(siaPath modules.SiaPath) {
+	bs.mu.Lock()
+	complete := bs.completeBubbleUpdate(siaPath)
+	bs.mu.Unlock()
+
+	// Signal that a bubble has been completed to release any blocking calls.
+	if complete != nil {
+		close(complete)
+	}
+}
+
+// managedCompleteBubbleUpdateUnflushed completes the bubble update like
+// managedCompleteBubbleUpdate but doesn't close the complete channel until the
+// bubbled metadata is flushed.
+func (bs *bubbleScheduler) managedCompleteBubbleUpdateUnflushed(siaPath modules.SiaPath) {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
+	complete := bs.completeBubbleUpdate(siaPath)
+	if complete == nil {
+		return
+	}
+	if len(bs.unflushed) == 0 {
+		bs.unflushedSince = time.Now()
+	}
+	bs.unflushed = append(bs.unflushed, complete)
+}
 
+// completeBubbleUpdate will complete the bubble update and update the status
+// and the bubble map accordingly. It returns the complete channel which needs
+// to be closed to signal the completion.
+func (bs *bubbleScheduler) completeBubbleUpdate(siaPath modules.SiaPath) chan struct{} {
 	// Grab the bubble update from the map
 	bu, ok := bs.bubbleUpdates[siaPath]
 	if !ok {
 		str := fmt.Sprintf("bubble update for '%v' not found in map when complete is called", siaPath)
 		build.Critical(str)
-		return
+		return nil
 	}
-
-	// Signal that a bubble has been completed to release any blocking calls.
-	close(bu.complete)
+	complete := bu.complete
 
 	// Complete based on the status of the update
 	switch bu.status {
@@ -245,13 +310,13 @@ func (bs *bubbleScheduler) managedCompleteBubbleUpdate(siaPath modules.SiaPath)
 		str := fmt.Sprintf("bubbleQueue status for '%v' found during complete call", siaPath)
 		build.Critical(str)
 		delete(bs.bubbleUpdates, siaPath)
-		return
+		return complete
 	case bubbleActive:
 		// If the status is still bubbleActive it means no other bubble requests
 		// were made while the bubble was in progress. The bubble update is complete
 		// so we can remove it from the map.
 		delete(bs.bubbleUpdates, siaPath)
-		return
+		return complete
 	case bubblePending:
 		// If the status is bubblePending it means a bubble request was made while
 		// the current bubble was in progress. In this case we add the update back
@@ -259,13 +324,13 @@ func (bs *bubbleScheduler) managedCompleteBubbleUpdate(siaPath modules.SiaPath)
 		bu.status = bubbleQueued
 		bu.complete = make(chan struct{})
 		bs.fifo.Push(bu)
-		return
+		return complete
 	default:
 		// Error was found, remove from map to try and clean up the error
 		str := fmt.Sprintf("bubbleError status for '%v' found during complete call", siaPath)
 		build.Critical(str)
 		delete(bs.bubbleUpdates, siaPath)
-		return
+		return complete
 	}
 }
 
@@ -291,6 +356,19 @@ func (bs *bubbleScheduler) managedPerformBubbleUpdate(siaPath modules.SiaPath) (
 		return errors.AddContext(err, e)
 	}
 
+	// Unless batching is disabled, queue the metadata to be flushed with the
+	// metadata of other directories. The repair loops are signaled once the
+	// root directory's metadata is flushed.
+	if !r.deps.Disrupt("DisableBubbleBatching") {
+		r.staticFileSystem.QueueBubbledMetadata(siaPath, metadata)
+		if siaPath.IsRoot() {
+			bs.mu.Lock()
+			bs.unflushedRoot = &metadata
+			bs.mu.Unlock()
+		}
+		return nil
+	}
+
 	// Update directory metadata with the health information. Don't return here
 	// to avoid skipping the repairNeeded and stuckChunkFound signals.
 	siaDir, err := r.staticFileSystem.OpenSiaDir(siaPath)
@@ -305,6 +383,8 @@ func (bs *bubbleScheduler) managedPerformBubbleUpdate(siaPath modules.SiaPath) (
 		if err != nil {
 			e := fmt.Sprintf("could not update the metadata of the directory %v", siaPath.String())
 			err = errors.AddContext(err, e)
+		} else {
+			atomic.AddUint64(&bs.atomicDirWrites, 1)
 		}
 	}
 
@@ -314,22 +394,51 @@ func (bs *bubbleScheduler) managedPerformBubbleUpdate(siaPath modules.SiaPath) (
 	// loops start at the root directory so there is no point triggering them
 	// until the root directory is updated
 	if siaPath.IsRoot() {
-		if modules.NeedsRepair(metadata.AggregateHealth) {
-			select {
-			case r.uploadHeap.repairNeeded <- struct{}{}:
-			default:
-			}
-		}
-		if metadata.AggregateNumStuckChunks > 0 {
-			select {
-			case r.uploadHeap.stuckChunkFound <- struct{}{}:
-			default:
-			}
-		}
+		r.callSignalRepairLoops(metadata)
 	}
 	return err
 }
 
+// managedFlush flushes the bubbled metadata of all directories to disk and
+// closes the complete channels of the corresponding bubble updates. It returns
+// the number of directories which were written.
+func (bs *bubbleScheduler) managedFlush() (int, error) {
+	r := bs.staticRenter
+	bs.mu.Lock()
+	unflushed := bs.unflushed
+	root := bs.unflushedRoot
+	bs.unflushed = nil
+	bs.unflushedRoot = nil
+	bs.mu.Unlock()
+
+	n, err := r.staticFileSystem.FlushBubbledMetadata()
+	atomic.AddUint64(&bs.atomicDirWrites, uint64(n))
+	for _, complete := range unflushed {
+		close(complete)
+	}
+	if err != nil {
+		return n, errors.AddContext(err, "failed to flush bubbled metadata")
+	}
+	// The root directory was updated, check if the repair loops need to be
+	// signaled.
+	if root != nil {
+		r.callSignalRepairLoops(*root)
+	}
+	return n, nil
+}
+
+// managedNeedsFlush returns whether the bubbled metadata should be flushed,
+// which is the case if there are no more queued bubble updates or if the
+// metadata was held back for too long.
+func (bs *bubbleScheduler) managedNeedsFlush() bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if len(bs.unflushed) == 0 {
+		return false
+	}
+	return bs.fifo.Len() == 0 || time.Since(bs.unflushedSince) >= bubbleFlushInterval
+}
+
 // managedPop pops the next bubble update off of the fifo queue and updates the
 // bubble status.
 func (bs *bubbleScheduler) managedPop() *bubbleUpdate {
@@ -375,6 +484,24 @@ func (bs *bubbleScheduler) managedQueueParent(siaPath modules.SiaPath) error {
 	return nil
 }
 
+// callSignalRepairLoops signals the repair and stuck loops if the metadata of
+// the root directory indicates that files need to be repaired or that there
+// are stuck chunks.
+func (r *Renter) callSignalRepairLoops(rootMetadata siadir.Metadata) {
+	if modules.NeedsRepair(rootMetadata.AggregateHealth) {
+		select {
+		case r.uploadHeap.repairNeeded <- struct{}{}:
+		default:
+		}
+	}
+	if rootMetadata.AggregateNumStuckChunks > 0 {
+		select {
+		case r.uploadHeap.stuckChunkFound <- struct{}{}:
+		default:
+		}
+	}
+}
+
 // BubbleMetadata will queue a bubble update for the directory. A bubble update
 // includes calculating the updated values of a directory's metadata, updating
 // the siadir metadata on disk, and then queuing a bubble update for the parent
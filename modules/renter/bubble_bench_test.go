@@ -3,7 +3,9 @@ package renter
 import (
 	"fmt"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/crypto"
@@ -86,3 +88,58 @@ func BenchmarkBubbleMetadata(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkBubbleBatching compares the number of directory writes caused by
+// the file health updates of a 5-level tree with 10k files when bubbling with
+// and without batching.
+//
+// Results (goos, goarch, CPU: Benchmark Output: date)
+//
+// linux, amd64, Intel(R) Xeon(R) Processor @ 2.10GHz: Batched 375 dirwrites/op | Unbatched 525 dirwrites/op: 10/17/2026
+func BenchmarkBubbleBatching(b *testing.B) {
+	b.Run("Batched", func(b *testing.B) {
+		benchmarkBubbleBatching(b, &dependencies.DependencyDisableRepairAndHealthLoops{})
+	})
+	b.Run("Unbatched", func(b *testing.B) {
+		benchmarkBubbleBatching(b, &dependencies.DependencyDisableBubbleBatching{})
+	})
+}
+
+// benchmarkBubbleBatching runs BenchmarkBubbleBatching with the given
+// dependencies.
+func benchmarkBubbleBatching(b *testing.B, deps modules.Dependencies) {
+	r, err := newBenchmarkRenterWithDependency(b.Name(), deps)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	files, _, err := createBubbleTestTree(r, 5, 3, 10e3)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bs := r.staticBubbleScheduler
+	if err := bs.managedBlockUntilIdle(); err != nil {
+		b.Fatal(err)
+	}
+
+	// Reset Timer
+	b.ResetTimer()
+
+	// Run Benchmark
+	var writes uint64
+	for n := 0; n < b.N; n++ {
+		before := atomic.LoadUint64(&bs.atomicDirWrites)
+		if err := queueFileBubbles(r, files, 100*time.Microsecond); err != nil {
+			b.Fatal(err)
+		}
+		if err := bs.managedBlockUntilIdle(); err != nil {
+			b.Fatal(err)
+		}
+		writes += atomic.LoadUint64(&bs.atomicDirWrites) - before
+	}
+	b.ReportMetric(float64(writes)/float64(b.N), "dirwrites/op")
+}
@@ -1,13 +1,21 @@
 package renter
 
 import (
+	"fmt"
+	"path/filepath"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siadir"
+	"go.sia.tech/siad/persist"
+	"go.sia.tech/siad/siatest/dependencies"
 )
 
 var (
@@ -64,6 +72,88 @@ func (rt *renterTester) bubbleAll(siaPaths []modules.SiaPath) (errs error) {
 	return
 }
 
+// managedBlockUntilIdle blocks until the bubbleScheduler processed all bubble
+// updates and flushed their metadata.
+func (bs *bubbleScheduler) managedBlockUntilIdle() error {
+	return build.Retry(int(bubbleWaitInTestTime/(10*time.Millisecond)), 10*time.Millisecond, func() error {
+		bs.mu.Lock()
+		defer bs.mu.Unlock()
+		if len(bs.bubbleUpdates) != 0 || len(bs.unflushed) != 0 {
+			return errors.New("bubbles still in progress")
+		}
+		return nil
+	})
+}
+
+// createBubbleTestTree creates a tree of directories beneath the root
+// directory which is depth levels deep and in which every directory has fanout
+// subdirectories. numFiles files are spread evenly across the directories on
+// the lowest level. Every 7th file has a stuck chunk. It returns the siapaths
+// of the files and the directories.
+func createBubbleTestTree(r *Renter, depth, fanout, numFiles int) (files, dirs []modules.SiaPath, err error) {
+	dirs = []modules.SiaPath{modules.RootSiaPath()}
+	level := dirs
+	for i := 0; i < depth; i++ {
+		var next []modules.SiaPath
+		for _, parent := range level {
+			for j := 0; j < fanout; j++ {
+				dir, err := parent.Join(fmt.Sprintf("dir%v", j))
+				if err != nil {
+					return nil, nil, err
+				}
+				next = append(next, dir)
+			}
+		}
+		dirs = append(dirs, next...)
+		level = next
+	}
+	for _, dir := range level {
+		if err := r.staticFileSystem.NewSiaDir(dir, modules.DefaultDirPerm); err != nil {
+			return nil, nil, err
+		}
+	}
+	rsc, _ := modules.NewRSCode(1, 1)
+	for i := 0; i < numFiles; i++ {
+		file, err := level[i%len(level)].Join(fmt.Sprintf("file%v", i))
+		if err != nil {
+			return nil, nil, err
+		}
+		err = r.staticFileSystem.NewSiaFile(file, "", rsc, crypto.GenerateSiaKey(crypto.TypeDefaultRenter), uint64(i+1)*100, persist.DefaultDiskPermissionsTest, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i%7 == 0 {
+			f, err := r.staticFileSystem.OpenSiaFile(file)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = errors.Compose(f.SetStuck(0, true), f.Close())
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		files = append(files, file)
+	}
+	return files, dirs, nil
+}
+
+// queueFileBubbles queues a bubble for the directory of every file as if the
+// health of every file was updated. The updates are spread out by waiting for
+// interval after every update.
+func queueFileBubbles(r *Renter, files []modules.SiaPath, interval time.Duration) error {
+	for _, file := range files {
+		dir, err := file.Dir()
+		if err != nil {
+			return err
+		}
+		_ = r.staticBubbleScheduler.callQueueBubble(dir)
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+	return nil
+}
+
 // TestBubble tests the bubble code.
 //
 // TODO: moves bubble tests from other files into here
@@ -77,6 +167,104 @@ func TestBubble(t *testing.T) {
 	t.Run("BubbleScheduler", testBubbleScheduler)
 }
 
+// TestBubbleBatching tests that batching the bubbled metadata results in the
+// same metadata as bubbling without batching while writing fewer directories.
+func TestBubbleBatching(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a renter which batches bubbles and one which doesn't.
+	rtBatched, err := newRenterTesterWithDependency(filepath.Join(t.Name(), "batched"), &dependencies.DependencyDisableRepairAndHealthLoops{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtUnbatched, err := newRenterTesterWithDependency(filepath.Join(t.Name(), "unbatched"), &dependencies.DependencyDisableBubbleBatching{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rtUnbatched.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create the same tree for both and update the health of all files.
+	depth, fanout, numFiles := 3, 2, 80
+	var dirs []modules.SiaPath
+	for _, rt := range []*renterTester{rtBatched, rtUnbatched} {
+		var files []modules.SiaPath
+		files, dirs, err = createBubbleTestTree(rt.renter, depth, fanout, numFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := queueFileBubbles(rt.renter, files, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := rt.renter.staticBubbleScheduler.managedBlockUntilIdle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The metadata of all dirs should match, apart from the timestamps.
+	clearTimes := func(md siadir.Metadata) siadir.Metadata {
+		md.AggregateLastHealthCheckTime = time.Time{}
+		md.AggregateModTime = time.Time{}
+		md.LastHealthCheckTime = time.Time{}
+		md.ModTime = time.Time{}
+		return md
+	}
+	for _, dir := range dirs {
+		mdBatched, err := rtBatched.renter.managedDirectoryMetadata(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mdUnbatched, err := rtUnbatched.renter.managedDirectoryMetadata(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(clearTimes(mdBatched), clearTimes(mdUnbatched)) {
+			t.Log("batched", mdBatched)
+			t.Log("unbatched", mdUnbatched)
+			t.Fatal("metadata mismatch for", dir)
+		}
+	}
+
+	// Sanity check the root.
+	root, err := rtBatched.renter.staticFileSystem.DirInfo(modules.RootSiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	numStuck := uint64((numFiles + 6) / 7)
+	if root.AggregateNumFiles != uint64(numFiles) || root.AggregateNumStuckChunks != numStuck {
+		t.Fatal("wrong root metadata", root.AggregateNumFiles, root.AggregateNumStuckChunks)
+	}
+
+	// Batching should result in fewer writes.
+	writesBatched := atomic.LoadUint64(&rtBatched.renter.staticBubbleScheduler.atomicDirWrites)
+	writesUnbatched := atomic.LoadUint64(&rtUnbatched.renter.staticBubbleScheduler.atomicDirWrites)
+	if writesBatched >= writesUnbatched {
+		t.Fatal("batching didn't reduce the number of writes", writesBatched, writesUnbatched)
+	}
+	t.Logf("dir writes batched: %v, unbatched: %v", writesBatched, writesUnbatched)
+
+	// Metadata which wasn't flushed yet is flushed on shutdown.
+	leaf := dirs[len(dirs)-1]
+	rtBatched.renter.staticFileSystem.QueueBubbledMetadata(leaf, siadir.Metadata{AggregateNumFiles: 1234})
+	leafPath := rtBatched.renter.staticFileSystem.DirPath(leaf)
+	if err := rtBatched.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sd, err := siadir.LoadSiaDir(leafPath, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Metadata().AggregateNumFiles != 1234 {
+		t.Fatal("metadata wasn't flushed on shutdown", sd.Metadata().AggregateNumFiles)
+	}
+}
+
 // testBubbleQueue probes the bubbleQueue
 func testBubbleQueue(t *testing.T) {
 	// Initialize a queue
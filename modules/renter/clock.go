@@ -0,0 +1,20 @@
+package renter
+
+import "time"
+
+type (
+	// clock is the source of the current time for the parts of the renter
+	// which need sub-second precision. Unlike types.Clock it doesn't round
+	// the time to seconds. Tests replace it to control the passage of time.
+	clock interface {
+		Now() time.Time
+	}
+
+	// stdClock is a clock which returns the system time.
+	stdClock struct{}
+)
+
+// Now implements clock.
+func (stdClock) Now() time.Time {
+	return time.Now()
+}
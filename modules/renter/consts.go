@@ -163,12 +163,45 @@ const (
 	DefaultMaxUploadSpeed = 0
 )
 
+// Default download concurrency parameters.
+const (
+	// DefaultDownloadOverdrive is the number of extra pieces that are fetched
+	// for every chunk of a download unless the user sets a custom
+	// DownloadOverdrive through the API.
+	DefaultDownloadOverdrive = 3
+
+	// DefaultMaxConcurrentDownloadChunks is set to zero to indicate that the
+	// number of chunks downloaded at the same time is only limited by the
+	// available memory.
+	DefaultMaxConcurrentDownloadChunks = 0
+
+	// DefaultMaxDownloadWorkersPerChunk is set to zero to indicate that the
+	// number of workers fetching pieces of a chunk at the same time is only
+	// limited by the number of pieces required and the overdrive.
+	DefaultMaxDownloadWorkersPerChunk = 0
+
+	// maxDownloadOverdrive is the largest DownloadOverdrive a user can set.
+	maxDownloadOverdrive = 32
+
+	// maxMaxConcurrentDownloadChunks is the largest
+	// MaxConcurrentDownloadChunks a user can set.
+	maxMaxConcurrentDownloadChunks = 1024
+
+	// maxMaxDownloadWorkersPerChunk is the largest MaxDownloadWorkersPerChunk
+	// a user can set.
+	maxMaxDownloadWorkersPerChunk = 256
+)
+
 // Naming conventions for code readability.
 const (
 	// destinationTypeSeekStream is the destination type used for downloads
 	// from the /renter/stream endpoint.
 	destinationTypeSeekStream = "httpseekstream"
 
+	// destinationTypeDiscard is the destination type used for downloads which
+	// only recover the data without writing it anywhere.
+	destinationTypeDiscard = "discard"
+
 	// memoryPriorityLow is used to request low priority memory
 	memoryPriorityLow = false
 
@@ -276,6 +309,16 @@ var (
 		Testing:  1,
 	}).(int)
 
+	// bubbleFlushInterval is the maximum amount of time the bubbled metadata
+	// of directories is held back before it is flushed to disk while bubbles
+	// keep being queued. If no bubbles are queued, it is flushed right away.
+	bubbleFlushInterval = build.Select(build.Var{
+		Dev:      time.Second * 5,
+		Standard: time.Second * 10,
+		Testnet:  time.Second * 10,
+		Testing:  time.Second,
+	}).(time.Duration)
+
 	// numBubbleWorkerThreads is the number of threads used when using worker
 	// groups in various bubble methods
 	numBubbleWorkerThreads = build.Select(build.Var{
@@ -362,6 +405,49 @@ var (
 		Testing:  3,
 	}).(int)
 
+	// maxSectorUploadsPerSecond is the maximum number of new sectors the
+	// renter uploads per second across all hosts.
+	maxSectorUploadsPerSecond = build.Select(build.Var{
+		Dev:      200.0,
+		Standard: 200.0,
+		Testnet:  200.0,
+		Testing:  1e6,
+	}).(float64)
+
+	// uploadPacerInitialHostRate is the number of new sectors per second that
+	// are uploaded to a host which wasn't used for uploads before or which
+	// throttled the renter.
+	uploadPacerInitialHostRate = build.Select(build.Var{
+		Dev:      2.0,
+		Standard: 2.0,
+		Testnet:  2.0,
+		Testing:  1e6,
+	}).(float64)
+
+	// uploadPacerMaxHostRate is the number of new sectors per second that the
+	// upload rate of a host can be increased to.
+	uploadPacerMaxHostRate = build.Select(build.Var{
+		Dev:      20.0,
+		Standard: 20.0,
+		Testnet:  20.0,
+		Testing:  1e6,
+	}).(float64)
+
+	// uploadPacerHostRateIncrease is the number of new sectors per second by
+	// which the upload rate of a host is increased after every successful
+	// upload.
+	uploadPacerHostRateIncrease = 0.5
+
+	// uploadThrottleBackoff is how long a worker waits initially before
+	// uploading again after its host throttled an upload. It is doubled for
+	// every consecutive throttled upload up to maxConsecutivePenalty times.
+	uploadThrottleBackoff = build.Select(build.Var{
+		Dev:      time.Second * 2,
+		Standard: time.Second * 5,
+		Testnet:  time.Second * 5,
+		Testing:  time.Millisecond * 100,
+	}).(time.Duration)
+
 	// uploadFailureCooldown is how long a worker will wait initially if an
 	// upload fails. This number is prime to increase the chance to avoid
 	// intersecting with regularly occurring events which may cause failures.
@@ -1,6 +1,8 @@
 package contractor
 
 import (
+	"time"
+
 	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/types"
@@ -96,6 +98,15 @@ var (
 		Testnet:  types.BlockHeight(types.BlocksPerWeek),     // 7 days
 		Testing:  types.BlockHeight(types.BlocksPerHour * 2),
 	}).(types.BlockHeight)
+
+	// contractSetCloseTimeout is the maximum amount of time the contractor
+	// waits for open refcounter update sessions to finish on shutdown.
+	contractSetCloseTimeout = build.Select(build.Var{
+		Dev:      10 * time.Second,
+		Standard: time.Minute,
+		Testnet:  time.Minute,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
 )
 
 // Constants related to the safety values for when the contractor is forming
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -498,14 +499,22 @@ func contractorBlockingStartup(cs modules.ConsensusSet, w modules.Wallet, tp mod
 	c.staticWatchdog = newWatchdog(c)
 
 	// Close the contract set and logger upon shutdown.
-	err := c.tg.AfterStop(func() error {
-		if err := c.staticContracts.Close(); err != nil {
-			return errors.AddContext(err, "failed to close contract set")
+	err := c.tg.AfterStop(func() (err error) {
+		if err = c.staticContracts.CloseWithTimeout(contractSetCloseTimeout); err != nil {
+			err = errors.AddContext(err, "failed to close contract set")
 		}
-		if err := c.log.Close(); err != nil {
-			return errors.AddContext(err, "failed to close the contractor logger")
+		// If refcounter updates didn't finish in time, log the stack traces
+		// of all running goroutines to find out what is blocking them.
+		if errors.Contains(err, proto.ErrRefCounterUpdateInProgress) {
+			c.log.Println("WARN:", err)
+			buf := make([]byte, modules.StackSize)
+			n := runtime.Stack(buf, true)
+			c.log.Println(string(buf[:n]))
 		}
-		return nil
+		if errLog := c.log.Close(); errLog != nil {
+			err = errors.Compose(err, errors.AddContext(errLog, "failed to close the contractor logger"))
+		}
+		return err
 	})
 	if err != nil {
 		return nil, err
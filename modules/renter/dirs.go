@@ -1,12 +1,14 @@
 package renter
 
 import (
+	"fmt"
 	"os"
 	"sort"
 	"sync"
 
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem"
 )
 
 // CreateDir creates a directory for the renter
@@ -50,12 +52,105 @@ func (r *Renter) managedDirList(siaPath modules.SiaPath) (dis []modules.Director
 	if err != nil {
 		return nil, err
 	}
+	// Fill in the effective upload defaults. The subdirectories inherit the
+	// defaults of the listed directory.
+	effective, err := r.managedEffectiveUploadDefaults(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dis {
+		if dis[i].SiaPath.Equals(siaPath) {
+			dis[i].EffectiveUploadDefaults = effective
+		} else {
+			dis[i].EffectiveUploadDefaults = dis[i].UploadDefaults.Inherit(effective)
+		}
+	}
 	sort.Slice(dis, func(i, j int) bool {
 		return dis[i].SiaPath.String() < dis[j].SiaPath.String()
 	})
 	return dis, nil
 }
 
+// SetDirUploadDefaults sets the upload defaults of a directory. Files that are
+// uploaded beneath the directory inherit them unless a closer directory or the
+// upload itself specifies them.
+func (r *Renter) SetDirUploadDefaults(siaPath modules.SiaPath, defaults modules.DirUploadDefaults) (err error) {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if err := defaults.Validate(); err != nil {
+		return err
+	}
+	dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Compose(err, dir.Close())
+	}()
+	return dir.SetUploadDefaults(defaults)
+}
+
+// managedEffectiveUploadDefaults returns the upload defaults of a directory
+// merged with the defaults of its ancestors, the nearest directory that sets
+// a field takes precedence. Directories that don't exist yet are skipped.
+func (r *Renter) managedEffectiveUploadDefaults(siaPath modules.SiaPath) (defaults modules.DirUploadDefaults, _ error) {
+	for {
+		dir, err := r.staticFileSystem.OpenSiaDir(siaPath)
+		if err == nil {
+			md, err := dir.Metadata()
+			err = errors.Compose(err, dir.Close())
+			if err != nil {
+				return modules.DirUploadDefaults{}, errors.AddContext(err, fmt.Sprintf("unable to read metadata of %v", siaPath))
+			}
+			defaults = defaults.Inherit(md.UploadDefaults)
+		} else if !errors.Contains(err, filesystem.ErrNotExist) {
+			return modules.DirUploadDefaults{}, errors.AddContext(err, fmt.Sprintf("unable to open %v", siaPath))
+		}
+		if siaPath.IsRoot() {
+			return defaults, nil
+		}
+		siaPath, err = siaPath.Dir()
+		if err != nil {
+			return modules.DirUploadDefaults{}, err
+		}
+	}
+}
+
+// managedApplyUploadDefaults fills in the upload parameters that weren't set
+// explicitly. The defaults of the directories above the upload's SiaPath are
+// used first and the renter-wide defaults second.
+func (r *Renter) managedApplyUploadDefaults(up modules.FileUploadParams) (modules.FileUploadParams, error) {
+	dirSiaPath, err := up.SiaPath.Dir()
+	if err != nil {
+		return modules.FileUploadParams{}, err
+	}
+	defaults, err := r.managedEffectiveUploadDefaults(dirSiaPath)
+	if err != nil {
+		return modules.FileUploadParams{}, errors.AddContext(err, "unable to get directory upload defaults")
+	}
+	if up.ErasureCode == nil {
+		up.ErasureCode, err = defaults.ErasureCode()
+		if err != nil {
+			return modules.FileUploadParams{}, errors.AddContext(err, "invalid inherited erasure code")
+		}
+	}
+	if up.ErasureCode == nil {
+		up.ErasureCode = r.managedDefaultErasureCode()
+	}
+	if up.RepairThreshold == 0 {
+		up.RepairThreshold = defaults.RepairThreshold
+	}
+	if up.ConflictMode == "" {
+		up.ConflictMode = defaults.ConflictMode
+	}
+	if up.ConflictMode == modules.UploadConflictModeOverwrite {
+		up.Force = true
+	}
+	return up, nil
+}
+
 // RenameDir takes an existing directory and changes the path. The original
 // directory must exist, and there must not be any directory that already has
 // the replacement path.  All sia files within directory will also be renamed
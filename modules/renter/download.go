@@ -17,11 +17,28 @@ import (
 	"gitlab.com/NebulousLabs/errors"
 
 	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem"
 	"go.sia.tech/siad/modules/renter/filesystem/siafile"
 	"go.sia.tech/siad/types"
 )
 
+var (
+	// ErrDownloadVerificationFailed is returned by VerifyOutput if the
+	// downloaded data doesn't match the expected size or Merkle root.
+	ErrDownloadVerificationFailed = errors.New("downloaded data failed verification")
+
+	// errDownloadNotComplete is returned by VerifyOutput if the download is
+	// still in progress.
+	errDownloadNotComplete = errors.New("download is not complete yet")
+
+	// errVerifyOutputUnsupported is returned by VerifyOutput if the Merkle
+	// root of a download can't be verified because its destination can't be
+	// read back.
+	errVerifyOutputUnsupported = errors.New("can't verify merkle root of download destination")
+)
+
 type (
 	// A download is a file download that has been queued by the renter.
 	download struct {
@@ -53,6 +70,10 @@ type (
 
 		staticParams downloadParams
 
+		// provenance contains the pieces which were used to recover the
+		// chunks of the download.
+		provenance downloadProvenance
+
 		// Retrieval settings for the file.
 		staticLatencyTarget time.Duration // In milliseconds. Lower latency results in lower total system throughput.
 		staticOverdrive     int           // How many extra pieces to download to prevent slow hosts from being a bottleneck.
@@ -75,6 +96,7 @@ type (
 		needsMemory       bool                // Whether new memory needs to be allocated to perform the download.
 		offset            uint64              // Offset within the file to start the download. Must be less than the total filesize.
 		overdrive         int                 // How many extra pieces to download to prevent slow hosts from being a bottleneck.
+		pieceCache        modules.PieceCache  // Local store of previously downloaded pieces, may be nil.
 		priority          uint64              // Files with a higher priority will be downloaded first.
 
 		staticMemoryManager *memoryManager
@@ -192,6 +214,45 @@ func (d *download) UID() modules.DownloadID {
 	return d.staticUID
 }
 
+// VerifyOutput checks that a completed download produced the expected output.
+// The downloaded length must match expectedSize and, if expectedRoot is not
+// the empty hash, the Merkle root of the downloaded data must match
+// expectedRoot. Roots can only be verified for downloads to a file since the
+// other destinations can't be read back.
+func (d *download) VerifyOutput(expectedSize uint64, expectedRoot crypto.Hash) (err error) {
+	if !d.staticComplete() {
+		return errDownloadNotComplete
+	}
+	if errDownload := d.Err(); errDownload != nil {
+		return errors.AddContext(errDownload, "download failed")
+	}
+	received := atomic.LoadUint64(&d.atomicDataReceived)
+	if d.staticLength != expectedSize || received != expectedSize {
+		return errors.AddContext(ErrDownloadVerificationFailed, fmt.Sprintf("expected %v bytes but download has length %v and received %v bytes", expectedSize, d.staticLength, received))
+	}
+	if expectedRoot == (crypto.Hash{}) {
+		return nil
+	}
+	if d.staticDestinationType != "file" {
+		return errors.AddContext(errVerifyOutputUnsupported, d.staticDestinationType)
+	}
+	f, err := os.Open(d.destinationString)
+	if err != nil {
+		return errors.AddContext(err, "failed to open download destination for verification")
+	}
+	defer func() {
+		err = errors.Compose(err, f.Close())
+	}()
+	t := crypto.NewTree()
+	if err = t.ReadAll(io.LimitReader(f, int64(expectedSize)), crypto.SegmentSize); err != nil {
+		return errors.AddContext(err, "failed to read download destination for verification")
+	}
+	if root := t.Root(); root != expectedRoot {
+		return errors.AddContext(ErrDownloadVerificationFailed, fmt.Sprintf("expected merkle root %v but got %v", expectedRoot, root))
+	}
+	return nil
+}
+
 // Download creates a file download using the passed parameters and blocks until
 // the download is finished. The download needs to be started by calling the
 // returned method.
@@ -214,7 +275,7 @@ func (r *Renter) Download(p modules.RenterDownloadParameters) (modules.DownloadI
 		case <-d.completeChan:
 			return d.Err()
 		case <-r.tg.StopChan():
-			return errors.New("download interrupted by shutdown")
+			return errors.Extend(errors.New("download interrupted by shutdown"), modules.ErrDownloadCancelled)
 		}
 	}, nil
 }
@@ -247,7 +308,9 @@ func (r *Renter) DownloadAsync(p modules.RenterDownloadParameters, f func(error)
 func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (_ *download, err error) {
 	// Lookup the file associated with the nickname.
 	entry, err := r.staticFileSystem.OpenSiaFile(p.SiaPath)
-	if err != nil {
+	if errors.Contains(err, filesystem.ErrNotExist) {
+		return nil, errors.Extend(err, modules.ErrFileNotFound)
+	} else if err != nil {
 		return nil, err
 	}
 	defer func() {
@@ -263,9 +326,17 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (_ *downloa
 	if isHTTPResp && p.Destination != "" {
 		return nil, errors.New("destination cannot be specified when downloading to http response")
 	}
-	if !isHTTPResp && p.Destination == "" {
+	if p.Discard && (isHTTPResp || p.Destination != "") {
+		return nil, errors.New("destination cannot be specified when discarding the download")
+	}
+	if !isHTTPResp && !p.Discard && p.Destination == "" {
 		return nil, errors.New("destination not supplied")
 	}
+	// A discarded download is used to verify that the file can be recovered
+	// from the network. Fetching it from the local copy would defeat that.
+	if p.Discard {
+		p.DisableDiskFetch = true
+	}
 	if p.Destination != "" && !filepath.IsAbs(p.Destination) {
 		return nil, errors.New("destination must be an absolute path")
 	}
@@ -290,10 +361,13 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (_ *downloa
 	if isHTTPResp {
 		dw = newDownloadDestinationWriter(p.Httpwriter)
 		destinationType = "http stream"
+	} else if p.Discard {
+		dw = downloadDestinationDiscard{}
+		destinationType = destinationTypeDiscard
 	} else {
 		osFile, err := os.OpenFile(p.Destination, os.O_CREATE|os.O_WRONLY, entry.Mode())
 		if err != nil {
-			return nil, err
+			return nil, errors.Extend(err, modules.ErrDestinationWrite)
 		}
 		dw = &downloadDestinationFile{
 			deps:            r.deps,
@@ -329,7 +403,8 @@ func (r *Renter) managedDownload(p modules.RenterDownloadParameters) (_ *downloa
 		length:        p.Length,
 		needsMemory:   true,
 		offset:        p.Offset,
-		overdrive:     3, // TODO: moderate default until full overdrive support is added.
+		overdrive:     r.managedDownloadConcurrencySettings().overdrive,
+		pieceCache:    p.PieceCache,
 		priority:      5, // TODO: moderate default until full priority support is added.
 
 		staticMemoryManager:    r.userDownloadMemoryManager, // user initiated download
@@ -468,6 +543,17 @@ func (d *download) Start() error {
 		}
 	}
 
+	d.mu.Lock()
+	d.provenance = newDownloadProvenance(minChunk, maxChunk)
+	d.mu.Unlock()
+
+	// Track the download as active until it completes.
+	d.r.staticMetrics.callDownloadStarted()
+	d.OnComplete(func(_ error) error {
+		d.r.staticMetrics.callDownloadFinished()
+		return nil
+	})
+
 	// Queue the downloads for each chunk.
 	writeOffset := int64(0) // where to write a chunk within the download destination.
 	d.chunksRemaining += maxChunk - minChunk + 1
@@ -483,6 +569,8 @@ func (d *download) Start() error {
 			staticChunkSize:  params.file.ChunkSize(),
 			staticPieceSize:  params.file.PieceSize(),
 
+			staticSectorPacking: params.file.SectorPacking(),
+
 			staticSpendingCategory: d.staticParams.staticSpendingCategory,
 
 			// TODO: 25ms is just a guess for a good default. Really, we want to
@@ -497,10 +585,12 @@ func (d *download) Start() error {
 			staticDisableDiskFetch: params.disableLocalFetch,
 			staticLatencyTarget:    d.staticLatencyTarget + (25 * time.Duration(i-minChunk)), // Increase target by 25ms per chunk.
 			staticNeedsMemory:      params.needsMemory,
+			staticPieceCache:       params.pieceCache,
 			staticPriority:         params.priority,
 
 			completedPieces:   make([]bool, params.file.ErasureCode().NumPieces()),
 			physicalChunkData: make([][]byte, params.file.ErasureCode().NumPieces()),
+			pieceProvenance:   make([]*pieceProvenance, params.file.ErasureCode().NumPieces()),
 			pieceUsage:        make([]bool, params.file.ErasureCode().NumPieces()),
 
 			download:            d,
@@ -529,8 +619,10 @@ func (d *download) Start() error {
 
 		// TODO: Currently all chunks are given overdrive. This should probably
 		// be changed once the hostdb knows how to measure host speed/latency
-		// and once we can assign overdrive dynamically.
-		udc.staticOverdrive = params.overdrive
+		// and once we can assign overdrive dynamically. Chunks scheduled by
+		// the download loop get the overdrive of the renter's settings
+		// instead.
+		udc.overdrive = params.overdrive
 
 		// Add this chunk to the chunk heap, and notify the download loop that
 		// there is work to do.
@@ -553,6 +645,10 @@ func (r *Renter) DownloadByUID(uid modules.DownloadID) (modules.DownloadInfo, bo
 	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	var errStr string
+	if d.err != nil {
+		errStr = d.err.Error()
+	}
 	return modules.DownloadInfo{
 		Destination:     d.destinationString,
 		DestinationType: d.staticDestinationType,
@@ -562,10 +658,14 @@ func (r *Renter) DownloadByUID(uid modules.DownloadID) (modules.DownloadInfo, bo
 
 		Completed:            d.staticComplete(),
 		EndTime:              d.endTime,
+		Error:                errStr,
 		Received:             atomic.LoadUint64(&d.atomicDataReceived),
 		StartTime:            d.staticStartTime,
 		StartTimeUnix:        d.staticStartTime.UnixNano(),
 		TotalDataTransferred: atomic.LoadUint64(&d.atomicTotalDataTransferred),
+
+		ErrorCategory: modules.ClassifyDownloadError(d.err),
+		Provenance:    d.provenance.info(),
 	}, true
 }
 
@@ -615,8 +715,9 @@ func (r *Renter) DownloadHistory() []modules.DownloadInfo {
 		// lock. The error needs to be checked separately because we need to
 		// know if it's 'nil' before grabbing the error string.
 		d.mu.Unlock()
-		if d.Err() != nil {
-			downloads[i].Error = d.Err().Error()
+		if err := d.Err(); err != nil {
+			downloads[i].Error = err.Error()
+			downloads[i].ErrorCategory = modules.ClassifyDownloadError(err)
 		} else {
 			downloads[i].Error = ""
 		}
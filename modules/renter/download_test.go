@@ -1,15 +1,46 @@
 package renter
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
 
 	"go.sia.tech/siad/types"
 )
 
+// testPieceCache is an in-memory modules.PieceCache.
+type testPieceCache struct {
+	pieces map[[2]uint64][]byte
+	gets   int
+	mu     sync.Mutex
+}
+
+// Get implements modules.PieceCache.
+func (pc *testPieceCache) Get(chunkIndex, pieceIndex uint64) ([]byte, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.gets++
+	piece, ok := pc.pieces[[2]uint64{chunkIndex, pieceIndex}]
+	return piece, ok
+}
+
+// Put implements modules.PieceCache.
+func (pc *testPieceCache) Put(chunkIndex, pieceIndex uint64, piece []byte) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.pieces[[2]uint64{chunkIndex, pieceIndex}] = piece
+}
+
 // TestClearDownloads tests all the edge cases of the ClearDownloadHistory Method
 func TestClearDownloads(t *testing.T) {
 	if testing.Short() {
@@ -313,3 +344,420 @@ func checkDownloadHistory(downloads []modules.DownloadInfo, check []int64) bool
 	}
 	return true
 }
+
+// TestDownloadDiscardParams tests the validation of the parameters of
+// downloads which discard their data.
+func TestDownloadDiscardParams(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Upload a file.
+	source, err := rt.createZeroByteFileOnDisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: modules.NewRSCodeDefault(),
+	}
+	if err := rt.renter.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+
+	// Discarding can't be combined with a destination.
+	_, _, err = rt.renter.Download(modules.RenterDownloadParameters{
+		SiaPath:     up.SiaPath,
+		Destination: source,
+		Discard:     true,
+	})
+	if err == nil {
+		t.Fatal("expected discarding with a destination to fail")
+	}
+
+	// Discarding without a destination is valid.
+	id, _, err := rt.renter.Download(modules.RenterDownloadParameters{
+		SiaPath: up.SiaPath,
+		Discard: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	di, ok := rt.renter.DownloadByUID(id)
+	if !ok {
+		t.Fatal("download not found in history")
+	}
+	if di.DestinationType != destinationTypeDiscard {
+		t.Fatal("unexpected destination type", di.DestinationType)
+	}
+}
+
+// TestDownloadFromPieceCache checks that a download is served from the piece
+// cache without fetching any pieces from hosts.
+func TestDownloadFromPieceCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create a file without any hosts. Its data can only come from the cache.
+	siaPath, ec := testingFileParamsCustom(1, 2)
+	entry, err := rt.renter.createRenterTestFileWithParams(siaPath, ec, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(entry.Size()))
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a cache the download fails since there are no workers.
+	var buf bytes.Buffer
+	_, wait, err := rt.renter.Download(modules.RenterDownloadParameters{
+		SiaPath:    siaPath,
+		Httpwriter: &buf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err == nil {
+		t.Fatal("expected download without cache to fail")
+	}
+
+	// Cache the second piece of the chunk.
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), ec, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards, err := ec.EncodeShards(dataPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padAndEncryptPiece(0, 1, shards, crypto.GenerateSiaKey(crypto.TypePlain))
+	cache := &testPieceCache{pieces: make(map[[2]uint64][]byte)}
+	cache.Put(0, 1, shards[1])
+
+	// The download should succeed now.
+	buf.Reset()
+	uid, wait, err := rt.renter.Download(modules.RenterDownloadParameters{
+		SiaPath:    siaPath,
+		Httpwriter: &buf,
+		PieceCache: cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("downloaded data doesn't match")
+	}
+	if cache.gets == 0 {
+		t.Fatal("cache wasn't used")
+	}
+
+	// The provenance should contain the cached piece without a host.
+	di, exists := rt.renter.DownloadByUID(uid)
+	if !exists {
+		t.Fatal("download not found in history")
+	}
+	if di.Provenance == nil || len(di.Provenance.Chunks) != 1 || len(di.Provenance.Hosts) != 0 {
+		t.Fatalf("unexpected provenance %+v", di.Provenance)
+	}
+	pieces := di.Provenance.Chunks[0].Pieces
+	if len(pieces) != 1 || pieces[0].HostIndex != -1 || pieces[0].PieceIndex != 1 || pieces[0].ProofVerified || pieces[0].FetchTime.IsZero() {
+		t.Fatalf("unexpected piece provenance %+v", pieces)
+	}
+}
+
+// TestWorkersWithoutCompletedPiece checks that workers whose piece of a chunk
+// was already fetched from the piece cache are not distributed the chunk.
+func TestWorkersWithoutCompletedPiece(t *testing.T) {
+	t.Parallel()
+
+	// Create 3 workers. The first two have a piece of the chunk, the third
+	// doesn't.
+	workers := []*worker{
+		{staticHostPubKeyStr: "host0"},
+		{staticHostPubKeyStr: "host1"},
+		{staticHostPubKeyStr: "host2"},
+	}
+	udc := &unfinishedDownloadChunk{
+		completedPieces: make([]bool, 2),
+		staticChunkMap: map[string]downloadPieceInfo{
+			"host0": {index: 0},
+			"host1": {index: 1},
+		},
+	}
+
+	// Without completed pieces all workers are used.
+	if filtered := udc.workersWithoutCompletedPiece(workers); len(filtered) != 3 {
+		t.Fatalf("expected 3 workers but got %v", len(filtered))
+	}
+
+	// Mark the second piece as cached. Its worker shouldn't be used anymore.
+	udc.markPieceCompleted(1)
+	filtered := udc.workersWithoutCompletedPiece(workers)
+	if len(filtered) != 2 || filtered[0] != workers[0] || filtered[1] != workers[2] {
+		t.Fatal("worker with cached piece wasn't filtered", filtered)
+	}
+}
+
+// errWriter is an io.Writer which always fails.
+type errWriter struct{}
+
+// Write implements io.Writer.
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// TestDownloadErrorCategories checks that failed downloads are assigned the
+// expected error category for every failure mode.
+func TestDownloadErrorCategories(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// checkCategory is a helper that checks the category of a download error
+	// and that the download history reports the same category.
+	checkCategory := func(err error, category modules.DownloadErrorCategory, uid modules.DownloadID) {
+		t.Helper()
+		if c := modules.ClassifyDownloadError(err); c != category {
+			t.Fatalf("expected category %v, got %v: %v", category, c, err)
+		}
+		if uid == "" {
+			return
+		}
+		di, exists := r.DownloadByUID(uid)
+		if !exists {
+			t.Fatal("download not found in history")
+		}
+		if di.ErrorCategory != category || di.Error == "" {
+			t.Fatalf("expected category %v in history, got %v: %v", category, di.ErrorCategory, di.Error)
+		}
+	}
+
+	// Downloading a file that doesn't exist.
+	_, _, err = r.Download(modules.RenterDownloadParameters{
+		SiaPath:    modules.RandomSiaPath(),
+		Httpwriter: &bytes.Buffer{},
+	})
+	checkCategory(err, modules.DownloadErrorCategoryFileNotFound, "")
+
+	// Downloading a file that isn't stored on any hosts.
+	siaPath, ec := testingFileParamsCustom(1, 2)
+	entry, err := r.createRenterTestFileWithParams(siaPath, ec, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(entry.Size()))
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	uid, wait, err := r.Download(modules.RenterDownloadParameters{
+		SiaPath:    siaPath,
+		Httpwriter: &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCategory(wait(), modules.DownloadErrorCategoryInsufficientRedundancy, uid)
+
+	// Cancelling a download.
+	uid, _, cancel, err := r.DownloadAsync(modules.RenterDownloadParameters{
+		SiaPath: siaPath,
+		Discard: true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	di, _ := r.DownloadByUID(uid)
+	if di.ErrorCategory != modules.DownloadErrorCategoryCancelled {
+		t.Fatal("expected cancelled download, got", di.ErrorCategory)
+	}
+
+	// Failing to write the recovered data to the destination.
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), ec, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards, err := ec.EncodeShards(dataPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padAndEncryptPiece(0, 0, shards, crypto.GenerateSiaKey(crypto.TypePlain))
+	cache := &testPieceCache{pieces: make(map[[2]uint64][]byte)}
+	cache.Put(0, 0, shards[0])
+	uid, wait, err = r.Download(modules.RenterDownloadParameters{
+		SiaPath:    siaPath,
+		Httpwriter: errWriter{},
+		PieceCache: cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCategory(wait(), modules.DownloadErrorCategoryDestinationWrite, uid)
+
+	// failChunk is a helper that fails a chunk whose pieces are stored on
+	// enough hosts after all of its workers failed with the given errors.
+	failChunk := func(workerErrs ...error) error {
+		d := &download{
+			completeChan: make(chan struct{}),
+			r:            r,
+		}
+		udc := &unfinishedDownloadChunk{
+			erasureCode:    ec,
+			staticChunkMap: make(map[string]downloadPieceInfo),
+			download:       d,
+		}
+		for i, err := range workerErrs {
+			w := &worker{staticHostPubKey: types.SiaPublicKey{Key: fastrand.Bytes(32)}}
+			udc.staticChunkMap[w.staticHostPubKey.String()] = downloadPieceInfo{index: uint64(i)}
+			udc.addWorkerErr(w, err)
+		}
+		udc.managedCleanUp()
+		return d.Err()
+	}
+
+	// All hosts failing or being on cooldown.
+	err = failChunk(errors.New("host offline"), errWorkerOnCooldown)
+	checkCategory(err, modules.DownloadErrorCategoryInsufficientHosts, "")
+	if !errors.Contains(err, errWorkerOnCooldown) {
+		t.Fatal("host-level error is missing:", err)
+	}
+
+	// A host that couldn't be paid.
+	err = failChunk(errors.New("host offline"), errors.Extend(errors.New("ephemeral account balance was insufficient"), errWorkerBudget))
+	checkCategory(err, modules.DownloadErrorCategoryBudgetExhausted, "")
+	if !isBudgetErr(err) {
+		t.Fatal("host-level error is missing:", err)
+	}
+}
+
+// TestDownloadVerifyOutput tests that VerifyOutput detects downloads which
+// don't match the expected size or merkle root.
+func TestDownloadVerifyOutput(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create a file without any hosts and cache one of its pieces to be able
+	// to download it.
+	siaPath, ec := testingFileParamsCustom(1, 2)
+	entry, err := rt.renter.createRenterTestFileWithParams(siaPath, ec, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(entry.Size()))
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dataPieces, _, err := readDataPieces(bytes.NewReader(data), ec, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards, err := ec.EncodeShards(dataPieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padAndEncryptPiece(0, 1, shards, crypto.GenerateSiaKey(crypto.TypePlain))
+	cache := &testPieceCache{pieces: make(map[[2]uint64][]byte)}
+	cache.Put(0, 1, shards[1])
+
+	// download is a helper to download the file to the given destination.
+	download := func(p modules.RenterDownloadParameters) *download {
+		p.SiaPath = siaPath
+		p.PieceCache = cache
+		d, err := rt.renter.managedDownload(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.VerifyOutput(uint64(len(data)), crypto.Hash{}); !errors.Contains(err, errDownloadNotComplete) {
+			t.Fatal("expected errDownloadNotComplete but got", err)
+		}
+		if err := d.Start(); err != nil {
+			t.Fatal(err)
+		}
+		<-d.completeChan
+		if err := d.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	root := crypto.MerkleRoot(data)
+
+	// Download to a file and verify it.
+	dst := filepath.Join(rt.dir, "download")
+	d := download(modules.RenterDownloadParameters{Destination: dst})
+	if err := d.VerifyOutput(uint64(len(data)), root); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.VerifyOutput(uint64(len(data)), crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	// A wrong size or root should be detected.
+	if err := d.VerifyOutput(uint64(len(data))-1, root); !errors.Contains(err, ErrDownloadVerificationFailed) {
+		t.Fatal("expected ErrDownloadVerificationFailed but got", err)
+	}
+	if err := d.VerifyOutput(uint64(len(data)), crypto.Hash{1}); !errors.Contains(err, ErrDownloadVerificationFailed) {
+		t.Fatal("expected ErrDownloadVerificationFailed but got", err)
+	}
+	// Corrupt the downloaded file.
+	corrupted := append([]byte{}, data...)
+	corrupted[fastrand.Intn(len(corrupted))]++
+	if err := ioutil.WriteFile(dst, corrupted, modules.DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.VerifyOutput(uint64(len(data)), root); !errors.Contains(err, ErrDownloadVerificationFailed) {
+		t.Fatal("expected ErrDownloadVerificationFailed but got", err)
+	}
+
+	// The root of a stream can't be verified but its size can.
+	var buf bytes.Buffer
+	d = download(modules.RenterDownloadParameters{Httpwriter: &buf})
+	if err := d.VerifyOutput(uint64(len(data)), crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.VerifyOutput(uint64(len(data)), root); !errors.Contains(err, errVerifyOutputUnsupported) {
+		t.Fatal("expected errVerifyOutputUnsupported but got", err)
+	}
+}
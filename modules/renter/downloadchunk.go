@@ -50,6 +50,10 @@ type unfinishedDownloadChunk struct {
 	staticPieceSize   uint64
 	staticWriteOffset int64 // Offset within the writer to write the completed data.
 
+	// staticSectorPacking describes where the pieces are stored within their
+	// sectors.
+	staticSectorPacking siafile.SectorPacking
+
 	// Spending details.
 	staticSpendingCategory spendingCategory
 
@@ -58,19 +62,24 @@ type unfinishedDownloadChunk struct {
 	staticLatencyTarget    time.Duration
 	staticNeedsMemory      bool // Set to true if memory was not pre-allocated for this chunk.
 	staticMemoryManager    *memoryManager
-	staticOverdrive        int
+	staticPieceCache       modules.PieceCache // Checked for pieces before fetching them from hosts, may be nil.
 	staticPriority         uint64
 
 	// Download chunk state - need mutex to access.
-	completedPieces   []bool    // Which pieces were downloaded successfully.
-	failed            bool      // Indicates if the chunk has been marked as failed.
-	physicalChunkData [][]byte  // Used to recover the logical data.
-	pieceUsage        []bool    // Which pieces are being actively fetched.
-	piecesCompleted   int       // Number of pieces that have successfully completed.
-	piecesRegistered  int       // Number of pieces that workers are actively fetching.
-	recoveryComplete  bool      // Whether or not the recovery has completed and the chunk memory released.
-	workersRemaining  int       // Number of workers still able to fetch the chunk.
-	workersStandby    []*worker // Set of workers that are able to work on this download, but are not needed unless other workers fail.
+	completedPieces   []bool             // Which pieces were downloaded successfully.
+	failed            bool               // Indicates if the chunk has been marked as failed.
+	holdsChunkSlot    bool               // Whether the chunk holds a slot of the renter's download chunk limiter.
+	maxWorkers        int                // Max number of workers fetching pieces at the same time, 0 means no limit.
+	overdrive         int                // How many extra pieces to fetch to prevent slow hosts from being a bottleneck.
+	physicalChunkData [][]byte           // Used to recover the logical data.
+	pieceProvenance   []*pieceProvenance // Where the pieces in physicalChunkData came from.
+	pieceUsage        []bool             // Which pieces are being actively fetched.
+	piecesCompleted   int                // Number of pieces that have successfully completed.
+	piecesRegistered  int                // Number of pieces that workers are actively fetching.
+	recoveryComplete  bool               // Whether or not the recovery has completed and the chunk memory released.
+	workersRemaining  int                // Number of workers still able to fetch the chunk.
+	workersStandby    []*worker          // Set of workers that are able to work on this download, but are not needed unless other workers fail.
+	workerErrs        error              // Why workers failed to fetch their pieces, reported if the chunk fails.
 
 	// Memory management variables.
 	memoryAllocated uint64
@@ -92,8 +101,28 @@ func (udc *unfinishedDownloadChunk) fail(err error) {
 	for i := range udc.physicalChunkData {
 		udc.physicalChunkData[i] = nil
 	}
-	udc.download.managedFail(fmt.Errorf("chunk %v failed: %v", udc.staticChunkIndex, err))
+	udc.download.managedFail(errors.AddContext(err, fmt.Sprintf("chunk %v failed", udc.staticChunkIndex)))
 	udc.destination = nil
+	udc.releaseChunkSlot()
+}
+
+// notEnoughWorkersErr returns the error of a chunk that can't be recovered
+// anymore because there are not enough workers left. The error is categorized
+// as ErrInsufficientRedundancy if the chunk's pieces are stored on too few
+// hosts, as ErrBudgetExhausted if workers failed because the renter couldn't
+// pay for their pieces and as ErrInsufficientHosts otherwise. The errors of
+// the failed workers are kept as host-level details.
+func (udc *unfinishedDownloadChunk) notEnoughWorkersErr() error {
+	str := fmt.Sprintf("workers remaining %v, pieces completed %v, min pieces %v", udc.workersRemaining, udc.piecesCompleted, udc.erasureCode.MinPieces())
+	err := errors.Compose(errors.AddContext(errNotEnoughWorkers, str), udc.workerErrs)
+	if len(udc.staticChunkMap) < udc.erasureCode.MinPieces() {
+		str := fmt.Sprintf("pieces stored on %v hosts, min pieces %v", len(udc.staticChunkMap), udc.erasureCode.MinPieces())
+		return errors.Extend(errors.AddContext(err, str), modules.ErrInsufficientRedundancy)
+	}
+	if errors.Contains(udc.workerErrs, errWorkerBudget) {
+		return errors.Extend(err, modules.ErrBudgetExhausted)
+	}
+	return errors.Extend(err, modules.ErrInsufficientHosts)
 }
 
 // managedCleanUp will check if the download has failed, and if not it will add
@@ -104,8 +133,7 @@ func (udc *unfinishedDownloadChunk) managedCleanUp() {
 	// Check if the chunk is newly failed.
 	udc.mu.Lock()
 	if udc.workersRemaining+udc.piecesCompleted < udc.erasureCode.MinPieces() && !udc.failed {
-		str := fmt.Sprintf("workers remaining %v, pieces completed %v, min pieces %v", udc.workersRemaining, udc.piecesCompleted, udc.erasureCode.MinPieces())
-		udc.fail(errors.AddContext(errNotEnoughWorkers, str))
+		udc.fail(udc.notEnoughWorkersErr())
 	}
 	// Return any excess memory.
 	udc.returnMemory()
@@ -118,8 +146,11 @@ func (udc *unfinishedDownloadChunk) managedCleanUp() {
 
 	// Check whether standby workers are required.
 	chunkComplete := udc.piecesCompleted >= udc.erasureCode.MinPieces()
-	desiredPiecesRegistered := udc.erasureCode.MinPieces() + udc.staticOverdrive - udc.piecesCompleted
+	desiredPiecesRegistered := udc.erasureCode.MinPieces() + udc.overdrive - udc.piecesCompleted
 	standbyWorkersRequired := !chunkComplete && udc.piecesRegistered < desiredPiecesRegistered
+	if udc.maxWorkers > 0 && udc.piecesRegistered >= udc.maxWorkers {
+		standbyWorkersRequired = false
+	}
 	if !standbyWorkersRequired {
 		udc.mu.Unlock()
 		return
@@ -148,6 +179,7 @@ func (udc *unfinishedDownloadChunk) managedFinalizeRecovery() {
 	udc.mu.Lock()
 	udc.physicalChunkData = nil
 	udc.recoveryComplete = true
+	udc.releaseChunkSlot()
 	udc.mu.Unlock()
 
 	// Update the download and signal completion of this chunk.
@@ -225,14 +257,18 @@ func (udc *unfinishedDownloadChunk) threadedRecoverLogicalData() error {
 	// succeeds or fails.
 	defer udc.managedCleanUp()
 
+	// Remember which pieces are used for the recovery.
+	udc.managedRecordProvenance()
+
 	// Write the pieces to the requested output.
 	dataOffset := recoveredDataOffset(udc.staticFetchOffset, udc.erasureCode)
 	err := udc.destination.WritePieces(udc.erasureCode, udc.physicalChunkData, dataOffset, udc.staticWriteOffset, udc.staticFetchLength)
 	if err != nil {
+		err = errors.Extend(err, modules.ErrDestinationWrite)
 		udc.mu.Lock()
 		udc.fail(err)
 		udc.mu.Unlock()
-		return errors.AddContext(err, "unable to write to download destination")
+		return err
 	}
 	// finalize the chunk.
 	udc.managedFinalizeRecovery()
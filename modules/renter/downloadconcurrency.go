@@ -0,0 +1,146 @@
+package renter
+
+// downloadconcurrency.go applies the user's download concurrency settings to
+// the chunks scheduled by the download loop. The number of chunks that are
+// downloaded at the same time is limited by the downloadChunkLimiter, the
+// overdrive and the number of workers per chunk are set on every chunk right
+// before it is handed to the workers. That way changes to the settings apply
+// to all chunks which are scheduled afterwards, including the remaining chunks
+// of downloads which are already in progress.
+//
+// The settings never replace the memory manager. A chunk still needs to
+// acquire the memory for all of its pieces before it is scheduled, so raising
+// the limits can't make the renter use more memory than before.
+
+import (
+	"fmt"
+	"sync"
+
+	"go.sia.tech/siad/modules"
+)
+
+type (
+	// downloadChunkLimiter limits the number of chunks the download loop
+	// schedules at the same time.
+	downloadChunkLimiter struct {
+		active int
+		limit  int // 0 means no limit
+
+		// wakeChan is closed and replaced whenever a slot might have become
+		// available.
+		wakeChan chan struct{}
+		mu       sync.Mutex
+	}
+
+	// downloadConcurrencySettings are the settings applied to a chunk when it
+	// is scheduled.
+	downloadConcurrencySettings struct {
+		maxWorkers int
+		overdrive  int
+	}
+)
+
+// newDownloadChunkLimiter creates a new limiter without a limit.
+func newDownloadChunkLimiter() *downloadChunkLimiter {
+	return &downloadChunkLimiter{
+		wakeChan: make(chan struct{}),
+	}
+}
+
+// callActive returns the number of chunks currently holding a slot.
+func (dcl *downloadChunkLimiter) callActive() int {
+	dcl.mu.Lock()
+	defer dcl.mu.Unlock()
+	return dcl.active
+}
+
+// callRelease releases a slot acquired by managedAcquire.
+func (dcl *downloadChunkLimiter) callRelease() {
+	dcl.mu.Lock()
+	defer dcl.mu.Unlock()
+	dcl.active--
+	dcl.wake()
+}
+
+// callSetLimit updates the limit. Threads waiting for a slot are woken up in
+// case the limit was raised.
+func (dcl *downloadChunkLimiter) callSetLimit(limit int) {
+	dcl.mu.Lock()
+	defer dcl.mu.Unlock()
+	dcl.limit = limit
+	dcl.wake()
+}
+
+// managedAcquire blocks until fewer chunks than the limit are active and then
+// acquires a slot. It returns false if stopChan was closed before a slot
+// became available.
+func (dcl *downloadChunkLimiter) managedAcquire(stopChan <-chan struct{}) bool {
+	for {
+		dcl.mu.Lock()
+		if dcl.limit == 0 || dcl.active < dcl.limit {
+			dcl.active++
+			dcl.mu.Unlock()
+			return true
+		}
+		wakeChan := dcl.wakeChan
+		dcl.mu.Unlock()
+
+		select {
+		case <-stopChan:
+			return false
+		case <-wakeChan:
+		}
+	}
+}
+
+// wake wakes up all threads waiting for a slot.
+func (dcl *downloadChunkLimiter) wake() {
+	close(dcl.wakeChan)
+	dcl.wakeChan = make(chan struct{})
+}
+
+// validateDownloadConcurrencySettings checks that the download concurrency
+// settings are within sane bounds.
+func validateDownloadConcurrencySettings(s modules.RenterSettings) error {
+	if s.DownloadOverdrive < 0 || s.DownloadOverdrive > maxDownloadOverdrive {
+		return fmt.Errorf("download overdrive must be between 0 and %v", maxDownloadOverdrive)
+	}
+	if s.MaxConcurrentDownloadChunks < 0 || s.MaxConcurrentDownloadChunks > maxMaxConcurrentDownloadChunks {
+		return fmt.Errorf("max concurrent download chunks must be between 0 and %v", maxMaxConcurrentDownloadChunks)
+	}
+	if s.MaxDownloadWorkersPerChunk < 0 || s.MaxDownloadWorkersPerChunk > maxMaxDownloadWorkersPerChunk {
+		return fmt.Errorf("max download workers per chunk must be between 0 and %v", maxMaxDownloadWorkersPerChunk)
+	}
+	return nil
+}
+
+// managedDownloadConcurrencySettings returns the current settings that are
+// applied to scheduled chunks.
+func (r *Renter) managedDownloadConcurrencySettings() downloadConcurrencySettings {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return downloadConcurrencySettings{
+		maxWorkers: r.persist.MaxDownloadWorkersPerChunk,
+		overdrive:  r.persist.DownloadOverdrive,
+	}
+}
+
+// managedApplyDownloadConcurrencySettings applies the current download
+// concurrency settings to a chunk that is about to be scheduled.
+func (r *Renter) managedApplyDownloadConcurrencySettings(udc *unfinishedDownloadChunk) {
+	settings := r.managedDownloadConcurrencySettings()
+	udc.mu.Lock()
+	defer udc.mu.Unlock()
+	udc.maxWorkers = settings.maxWorkers
+	udc.overdrive = settings.overdrive
+}
+
+// releaseChunkSlot releases the chunk's slot in the renter's download chunk
+// limiter if it holds one. The chunk's lock needs to be held.
+func (udc *unfinishedDownloadChunk) releaseChunkSlot() {
+	if !udc.holdsChunkSlot {
+		return
+	}
+	udc.holdsChunkSlot = false
+	udc.download.r.staticDownloadChunkLimiter.callRelease()
+}
@@ -0,0 +1,218 @@
+package renter
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/persist"
+)
+
+// blockingWriter is an io.Writer which blocks all writes until it is
+// released.
+type blockingWriter struct {
+	buf      bytes.Buffer
+	release  chan struct{}
+	mu       sync.Mutex
+	wroteOne chan struct{}
+	once     sync.Once
+}
+
+// Write implements io.Writer.
+func (bw *blockingWriter) Write(b []byte) (int, error) {
+	bw.once.Do(func() { close(bw.wroteOne) })
+	<-bw.release
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.buf.Write(b)
+}
+
+// TestDownloadConcurrencySettings checks that the download concurrency
+// settings are validated and persisted.
+func TestDownloadConcurrencySettings(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Check the defaults.
+	settings, err := rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.DownloadOverdrive != DefaultDownloadOverdrive ||
+		settings.MaxConcurrentDownloadChunks != DefaultMaxConcurrentDownloadChunks ||
+		settings.MaxDownloadWorkersPerChunk != DefaultMaxDownloadWorkersPerChunk {
+		t.Fatalf("unexpected defaults %v %v %v", settings.DownloadOverdrive, settings.MaxConcurrentDownloadChunks, settings.MaxDownloadWorkersPerChunk)
+	}
+
+	// Settings out of bounds should be rejected.
+	tests := []func(*modules.RenterSettings){
+		func(s *modules.RenterSettings) { s.DownloadOverdrive = -1 },
+		func(s *modules.RenterSettings) { s.DownloadOverdrive = maxDownloadOverdrive + 1 },
+		func(s *modules.RenterSettings) { s.MaxConcurrentDownloadChunks = -1 },
+		func(s *modules.RenterSettings) { s.MaxConcurrentDownloadChunks = maxMaxConcurrentDownloadChunks + 1 },
+		func(s *modules.RenterSettings) { s.MaxDownloadWorkersPerChunk = -1 },
+		func(s *modules.RenterSettings) { s.MaxDownloadWorkersPerChunk = maxMaxDownloadWorkersPerChunk + 1 },
+	}
+	for i, modify := range tests {
+		s := settings
+		modify(&s)
+		if err := rt.renter.SetSettings(s); err == nil {
+			t.Fatalf("%v: invalid settings were accepted", i)
+		}
+	}
+
+	// Set valid settings.
+	settings.DownloadOverdrive = maxDownloadOverdrive
+	settings.MaxConcurrentDownloadChunks = 2
+	settings.MaxDownloadWorkersPerChunk = 10
+	if err := rt.renter.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if dcs := rt.renter.managedDownloadConcurrencySettings(); dcs.overdrive != maxDownloadOverdrive || dcs.maxWorkers != 10 {
+		t.Fatalf("settings weren't applied %+v", dcs)
+	}
+
+	// The settings should be persisted.
+	rt.renter.persist = persistence{}
+	if err := persist.LoadJSON(settingsMetadata, &rt.renter.persist, filepath.Join(rt.renter.persistDir, PersistFilename)); err != nil {
+		t.Fatal(err)
+	}
+	p := rt.renter.persist
+	if p.DownloadOverdrive != maxDownloadOverdrive || p.MaxConcurrentDownloadChunks != 2 || p.MaxDownloadWorkersPerChunk != 10 {
+		t.Fatalf("settings weren't persisted %v %v %v", p.DownloadOverdrive, p.MaxConcurrentDownloadChunks, p.MaxDownloadWorkersPerChunk)
+	}
+}
+
+// TestDownloadConcurrencyMidDownload checks that changing the max number of
+// concurrent download chunks during a download applies to the remaining
+// chunks of the download.
+func TestDownloadConcurrencyMidDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Only allow for a single chunk at a time.
+	settings, err := rt.renter.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.MaxConcurrentDownloadChunks = 1
+	if err := rt.renter.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file with a few chunks without any hosts and cache all of its
+	// pieces.
+	numChunks := 5
+	siaPath, ec := testingFileParamsCustom(1, 1)
+	chunkSize := modules.SectorSize * uint64(ec.MinPieces())
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypePlain), chunkSize*uint64(numChunks), persist.DefaultDiskPermissionsTest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(int(chunkSize) * numChunks)
+	cache := &testPieceCache{pieces: make(map[[2]uint64][]byte)}
+	for i := 0; i < numChunks; i++ {
+		dataPieces, _, err := readDataPieces(bytes.NewReader(data[uint64(i)*chunkSize:uint64(i+1)*chunkSize]), ec, modules.SectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards, err := ec.EncodeShards(dataPieces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.Put(uint64(i), 0, shards[0])
+	}
+
+	// Start the download. The first write blocks the first chunk.
+	bw := &blockingWriter{
+		release:  make(chan struct{}),
+		wroteOne: make(chan struct{}),
+	}
+	_, wait, err := rt.renter.Download(modules.RenterDownloadParameters{
+		SiaPath:    siaPath,
+		Httpwriter: bw,
+		PieceCache: cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- wait()
+	}()
+	select {
+	case <-bw.wroteOne:
+	case err := <-done:
+		t.Fatal("download finished before the first write", err)
+	case <-time.After(time.Minute):
+		t.Fatal("download didn't start")
+	}
+
+	// No other chunk should be scheduled.
+	limiter := rt.renter.staticDownloadChunkLimiter
+	time.Sleep(time.Second)
+	if active := limiter.callActive(); active != 1 {
+		t.Fatal("wrong number of active chunks", active)
+	}
+
+	// Raise the limit. The chunks after the blocked chunk can be scheduled
+	// now but they can't complete before the first chunk is written.
+	settings.MaxConcurrentDownloadChunks = 3
+	if err := rt.renter.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if active := limiter.callActive(); active != 3 {
+			return fmt.Errorf("expected 3 active chunks but got %v", active)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if active := limiter.callActive(); active != 3 {
+		t.Fatal("wrong number of active chunks", active)
+	}
+
+	// Release the writer. The download should complete and release all
+	// slots.
+	close(bw.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bw.buf.Bytes(), data) {
+		t.Fatal("downloaded data doesn't match")
+	}
+	if active := limiter.callActive(); active != 0 {
+		t.Fatal("slots weren't released", active)
+	}
+}
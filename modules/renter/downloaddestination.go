@@ -11,6 +11,7 @@ package renter
 //		+ os.File
 //		+ downloadDestinationBuffer (an alias of a []byte)
 //		+ downloadDestinationWriteCloser (created using an io.WriteCloser)
+//		+ downloadDestinationDiscard (recovers the data and discards it)
 //
 // There is also a helper function to convert an io.Writer to an io.WriteCloser,
 // so that an io.Writer can be used to create a downloadDestinationWriteCloser
@@ -19,6 +20,7 @@ package renter
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 	"time"
@@ -113,6 +115,16 @@ func (dw *downloadDestinationBuffer) WritePieces(_ modules.ErasureCoder, pieces
 	return nil
 }
 
+// downloadDestinationDiscard recovers the logical chunk data and discards it.
+// It is used to verify that a file is recoverable without storing it.
+type downloadDestinationDiscard struct{}
+
+// WritePieces recovers the data from the provided pieces and discards it.
+func (downloadDestinationDiscard) WritePieces(ec modules.ErasureCoder, pieces [][]byte, dataOffset uint64, _ int64, length uint64) error {
+	err := ec.Recover(pieces, dataOffset+length, ioutil.Discard)
+	return errors.AddContext(err, "unable to recover pieces")
+}
+
 // downloadDestinationFile wraps an os.File into a downloadDestination.
 type downloadDestinationFile struct {
 	deps            modules.Dependencies
@@ -3,6 +3,8 @@ package renter
 import (
 	"testing"
 
+	"gitlab.com/NebulousLabs/fastrand"
+
 	"go.sia.tech/siad/modules"
 )
 
@@ -20,3 +22,32 @@ func TestWritePiecesPanic(t *testing.T) {
 	rsc, _ := modules.NewRSCode(1, 1)
 	ddw.WritePieces(rsc, [][]byte{}, 0, 0, 0)
 }
+
+// TestDownloadDestinationDiscard tests that the discard destination recovers
+// the data of a chunk.
+func TestDownloadDestinationDiscard(t *testing.T) {
+	t.Parallel()
+
+	rsc, err := modules.NewRSCode(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(100)
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recovery from parity pieces works.
+	var ddd downloadDestinationDiscard
+	pieces[0], pieces[1] = nil, nil
+	if err := ddd.WritePieces(rsc, pieces, 10, 0, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recovery from too few pieces fails.
+	pieces[0], pieces[1], pieces[2] = nil, nil, nil
+	if err := ddd.WritePieces(rsc, pieces, 0, 0, 100); err == nil {
+		t.Fatal("expected recovery to fail")
+	}
+}
@@ -18,6 +18,9 @@ import (
 	"os"
 	"sync/atomic"
 	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/modules"
 )
 
 // downloadChunkHeap is a heap that is sorted first by file priority, then by
@@ -69,7 +72,7 @@ func (r *Renter) managedAcquireMemoryForDownloadChunk(udc *unfinishedDownloadChu
 	// need extra memory to decode a bunch of pieces, though I do not believe
 	// our erasure coding has been optimized around this yet, so we may actually
 	// go over the memory limits when we decode pieces.
-	memoryRequired := uint64(udc.staticOverdrive+udc.erasureCode.MinPieces()) * udc.staticPieceSize
+	memoryRequired := uint64(udc.overdrive+udc.erasureCode.MinPieces()) * udc.staticPieceSize
 	udc.memoryAllocated = memoryRequired
 	return udc.staticMemoryManager.Request(context.Background(), memoryRequired, memoryPriorityHigh)
 }
@@ -126,11 +129,19 @@ func (r *Renter) managedBlockUntilOnline() bool {
 func (r *Renter) managedDistributeDownloadChunkToWorkers(udc *unfinishedDownloadChunk) {
 	// Distribute the chunk to workers, marking the number of workers
 	// that have received the work.
+	// Blacklisted hosts are not used for downloads.
 	r.staticWorkerPool.mu.RLock()
+	workers := make([]*worker, 0, len(r.staticWorkerPool.workers))
+	for _, worker := range r.staticWorkerPool.workers {
+		if !r.staticHostBlacklist.callContains(worker.staticHostPubKeyStr) {
+			workers = append(workers, worker)
+		}
+	}
 	udc.mu.Lock()
-	udc.workersRemaining = len(r.staticWorkerPool.workers)
+	workers = udc.workersWithoutCompletedPiece(workers)
+	udc.workersRemaining = len(workers)
 	udc.mu.Unlock()
-	for _, worker := range r.staticWorkerPool.workers {
+	for _, worker := range workers {
 		go worker.threadedPerformDownloadChunkJob(udc)
 	}
 	r.staticWorkerPool.mu.RUnlock()
@@ -141,6 +152,22 @@ func (r *Renter) managedDistributeDownloadChunkToWorkers(udc *unfinishedDownload
 	udc.managedCleanUp()
 }
 
+// workersWithoutCompletedPiece filters out the workers whose piece of the
+// chunk was already completed, e.g. because it was fetched from the chunk's
+// piece cache. Those workers can't contribute to the chunk and must not be
+// counted as remaining workers. The chunk's lock needs to be held.
+func (udc *unfinishedDownloadChunk) workersWithoutCompletedPiece(workers []*worker) []*worker {
+	filtered := make([]*worker, 0, len(workers))
+	for _, w := range workers {
+		pieceData, workerHasPiece := udc.staticChunkMap[w.staticHostPubKeyStr]
+		if workerHasPiece && udc.completedPieces[pieceData.index] {
+			continue
+		}
+		filtered = append(filtered, w)
+	}
+	return filtered
+}
+
 // managedNextDownloadChunk will fetch the next chunk from the download heap. If
 // the download heap is empty, 'nil' will be returned.
 func (r *Renter) managedNextDownloadChunk() *unfinishedDownloadChunk {
@@ -227,6 +254,7 @@ func (r *Renter) managedTryFetchChunkFromDisk(chunk *unfinishedDownloadChunk) bo
 				// recovery.
 				atomic.AddUint64(&chunk.download.atomicDataReceived, chunk.staticFetchLength)
 				atomic.AddUint64(&chunk.download.atomicTotalDataTransferred, chunk.staticFetchLength)
+				chunk.download.managedMarkChunkFromDisk(chunk.staticChunkIndex)
 				chunk.managedFinalizeRecovery()
 				chunk.returnMemory()
 			} else {
@@ -266,6 +294,59 @@ func (r *Renter) managedTryFetchChunkFromDisk(chunk *unfinishedDownloadChunk) bo
 	return true
 }
 
+// managedTryFetchChunkFromPieceCache marks the pieces of the chunk that are
+// found in the chunk's piece cache as completed. If enough pieces are found to
+// recover the chunk, the recovery is started and true is returned. Otherwise
+// the chunk needs to be distributed to the workers which will skip the cached
+// pieces.
+func (r *Renter) managedTryFetchChunkFromPieceCache(chunk *unfinishedDownloadChunk) bool {
+	if chunk.staticPieceCache == nil {
+		return false
+	}
+	// Only the part of the piece that the workers would fetch is needed.
+	fetchOffset, fetchLength := sectorOffsetAndLength(chunk.staticFetchOffset, chunk.staticFetchLength, chunk.erasureCode)
+	minPieces := chunk.erasureCode.MinPieces()
+	cached := make(map[uint64][]byte)
+	for pieceIndex := uint64(0); pieceIndex < uint64(chunk.erasureCode.NumPieces()) && len(cached) < minPieces; pieceIndex++ {
+		piece, ok := chunk.staticPieceCache.Get(chunk.staticChunkIndex, pieceIndex)
+		if !ok || uint64(len(piece)) < fetchOffset+fetchLength {
+			continue
+		}
+		cached[pieceIndex] = append([]byte(nil), piece[fetchOffset:fetchOffset+fetchLength]...)
+	}
+	if len(cached) == 0 {
+		return false
+	}
+
+	chunk.mu.Lock()
+	defer chunk.mu.Unlock()
+	for pieceIndex, piece := range cached {
+		chunk.markPieceCompleted(pieceIndex)
+		chunk.physicalChunkData[pieceIndex] = piece
+		chunk.setPieceProvenance(pieceIndex, &pieceProvenance{
+			cached:    true,
+			fetchTime: time.Now(),
+			root:      chunk.pieceRoot(pieceIndex),
+		})
+		atomic.AddUint64(&chunk.download.atomicDataReceived, chunk.staticFetchLength/uint64(minPieces))
+	}
+	if chunk.piecesCompleted < minPieces {
+		return false
+	}
+	// Account for the remainder of the uint division like the workers do.
+	addedReceivedData := uint64(minPieces) * (chunk.staticFetchLength / uint64(minPieces))
+	atomic.AddUint64(&chunk.download.atomicDataReceived, chunk.staticFetchLength-addedReceivedData)
+	if err := r.tg.Add(); err != nil {
+		chunk.fail(errors.Extend(err, modules.ErrDownloadCancelled))
+		return true
+	}
+	go func() {
+		defer r.tg.Done()
+		chunk.threadedRecoverLogicalData()
+	}()
+	return true
+}
+
 // threadedDownloadLoop utilizes the worker pool to make progress on any queued
 // downloads.
 func (r *Renter) threadedDownloadLoop() {
@@ -308,7 +389,21 @@ LOOP:
 				break
 			}
 
-			// Get the required memory to download this chunk.
+			// Wait until the number of chunks being downloaded is below the
+			// user's limit and apply the user's current download settings
+			// to the chunk.
+			if !r.staticDownloadChunkLimiter.managedAcquire(r.tg.StopChan()) {
+				// The renter shut down before a slot became available.
+				return
+			}
+			nextChunk.mu.Lock()
+			nextChunk.holdsChunkSlot = true
+			nextChunk.mu.Unlock()
+			r.managedApplyDownloadConcurrencySettings(nextChunk)
+
+			// Get the required memory to download this chunk. The memory
+			// depends on the overdrive, so it needs to be acquired after the
+			// settings were applied.
 			if !r.managedAcquireMemoryForDownloadChunk(nextChunk) {
 				// The renter shut down before memory could be acquired.
 				return
@@ -317,6 +412,10 @@ LOOP:
 			if !nextChunk.staticDisableDiskFetch && r.managedTryFetchChunkFromDisk(nextChunk) {
 				continue
 			}
+			// Check if we can serve the chunk from the piece cache.
+			if r.managedTryFetchChunkFromPieceCache(nextChunk) {
+				continue
+			}
 			// Distribute the chunk to workers.
 			r.managedDistributeDownloadChunkToWorkers(nextChunk)
 		}
@@ -0,0 +1,168 @@
+package renter
+
+// downloadprovenance.go keeps track of which pieces were used to recover the
+// chunks of a download. The provenance only contains the pieces which were
+// actually passed to the erasure coder, pieces which were requested but failed
+// or arrived after the chunk could already be recovered are not included.
+
+import (
+	"time"
+
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
+)
+
+type (
+	// downloadProvenance contains the provenance of the chunks of a download.
+	// Every host is only stored once and referenced by its index in hosts.
+	downloadProvenance struct {
+		chunks      []modules.DownloadChunkProvenance
+		hosts       []types.SiaPublicKey
+		hostIndices map[string]int
+		minChunk    uint64
+	}
+
+	// pieceProvenance describes where a piece of an unfinished download chunk
+	// came from.
+	pieceProvenance struct {
+		cached        bool
+		fetchTime     time.Time
+		host          types.SiaPublicKey
+		proofVerified bool
+		root          crypto.Hash
+	}
+)
+
+// newDownloadProvenance creates the provenance for a download of the chunks
+// minChunk to maxChunk.
+func newDownloadProvenance(minChunk, maxChunk uint64) downloadProvenance {
+	chunks := make([]modules.DownloadChunkProvenance, maxChunk-minChunk+1)
+	for i := range chunks {
+		chunks[i].ChunkIndex = minChunk + uint64(i)
+	}
+	return downloadProvenance{
+		chunks:      chunks,
+		hostIndices: make(map[string]int),
+		minChunk:    minChunk,
+	}
+}
+
+// chunk returns the provenance of the chunk with the given index or nil if the
+// download doesn't contain the chunk.
+func (dp *downloadProvenance) chunk(chunkIndex uint64) *modules.DownloadChunkProvenance {
+	if chunkIndex < dp.minChunk || chunkIndex-dp.minChunk >= uint64(len(dp.chunks)) {
+		return nil
+	}
+	return &dp.chunks[chunkIndex-dp.minChunk]
+}
+
+// hostIndex returns the index of the host within the provenance's hosts,
+// adding the host if necessary.
+func (dp *downloadProvenance) hostIndex(host types.SiaPublicKey) int {
+	index, exists := dp.hostIndices[host.String()]
+	if !exists {
+		index = len(dp.hosts)
+		dp.hosts = append(dp.hosts, host)
+		dp.hostIndices[host.String()] = index
+	}
+	return index
+}
+
+// info returns a copy of the provenance which is safe to return to the caller.
+func (dp *downloadProvenance) info() *modules.DownloadProvenance {
+	if dp.chunks == nil {
+		return nil
+	}
+	info := &modules.DownloadProvenance{
+		Hosts:  append([]types.SiaPublicKey{}, dp.hosts...),
+		Chunks: make([]modules.DownloadChunkProvenance, len(dp.chunks)),
+	}
+	for i, chunk := range dp.chunks {
+		info.Chunks[i] = chunk
+		info.Chunks[i].Pieces = append([]modules.DownloadPieceProvenance{}, chunk.Pieces...)
+	}
+	return info
+}
+
+// managedMarkChunkFromDisk marks a chunk as read from the local copy of the
+// file.
+func (d *download) managedMarkChunkFromDisk(chunkIndex uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if chunk := d.provenance.chunk(chunkIndex); chunk != nil {
+		chunk.FromDisk = true
+	}
+}
+
+// managedMarkOverdriveDiscarded marks a chunk as having discarded an overdrive
+// piece.
+func (d *download) managedMarkOverdriveDiscarded(chunkIndex uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if chunk := d.provenance.chunk(chunkIndex); chunk != nil {
+		chunk.OverdriveDiscarded = true
+	}
+}
+
+// managedSetChunkPieces sets the pieces which were used to recover a chunk.
+// The pieces are indexed by their piece index and nil for pieces which were
+// not used.
+func (d *download) managedSetChunkPieces(chunkIndex uint64, pieces []*pieceProvenance) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	chunk := d.provenance.chunk(chunkIndex)
+	if chunk == nil {
+		return
+	}
+	chunk.Pieces = chunk.Pieces[:0]
+	for pieceIndex, piece := range pieces {
+		if piece == nil {
+			continue
+		}
+		hostIndex := -1
+		if !piece.cached {
+			hostIndex = d.provenance.hostIndex(piece.host)
+		}
+		chunk.Pieces = append(chunk.Pieces, modules.DownloadPieceProvenance{
+			HostIndex:     hostIndex,
+			PieceIndex:    uint64(pieceIndex),
+			SectorRoot:    piece.root,
+			FetchTime:     piece.fetchTime,
+			ProofVerified: piece.proofVerified,
+		})
+	}
+}
+
+// managedRecordProvenance records the pieces which are about to be used to
+// recover the chunk in the provenance of the chunk's download.
+func (udc *unfinishedDownloadChunk) managedRecordProvenance() {
+	udc.mu.Lock()
+	pieces := make([]*pieceProvenance, len(udc.pieceProvenance))
+	for i := range pieces {
+		if i < len(udc.physicalChunkData) && udc.physicalChunkData[i] != nil {
+			pieces[i] = udc.pieceProvenance[i]
+		}
+	}
+	udc.mu.Unlock()
+	udc.download.managedSetChunkPieces(udc.staticChunkIndex, pieces)
+}
+
+// pieceRoot returns the Merkle root of the sector which contains the piece
+// with the given index.
+func (udc *unfinishedDownloadChunk) pieceRoot(pieceIndex uint64) crypto.Hash {
+	for _, pi := range udc.staticChunkMap {
+		if pi.index == pieceIndex {
+			return pi.root
+		}
+	}
+	return crypto.Hash{}
+}
+
+// setPieceProvenance remembers where the piece with the given index came from.
+func (udc *unfinishedDownloadChunk) setPieceProvenance(pieceIndex uint64, pp *pieceProvenance) {
+	if pieceIndex >= uint64(len(udc.pieceProvenance)) {
+		return
+	}
+	udc.pieceProvenance[pieceIndex] = pp
+}
@@ -180,7 +180,7 @@ func (s *streamer) managedFillCache() bool {
 		length:        uint64(fetchLen),
 		needsMemory:   true,
 		offset:        uint64(fetchOffset),
-		overdrive:     5,    // TODO: high default until full overdrive support is added.
+		overdrive:     s.r.managedDownloadConcurrencySettings().overdrive,
 		priority:      1000, // TODO: high default until full priority support is added.
 
 		staticMemoryManager:    s.r.userDownloadMemoryManager, // user initiated download
@@ -218,7 +218,7 @@ func (s *streamer) managedFillCache() bool {
 			return false
 		}
 	case <-s.r.tg.StopChan():
-		stopErr := errors.New("download interrupted by shutdown")
+		stopErr := errors.Extend(errors.New("download interrupted by shutdown"), modules.ErrDownloadCancelled)
 		s.mu.Lock()
 		readErr := errors.Compose(s.readErr, stopErr)
 		s.readErr = readErr
@@ -480,7 +480,9 @@ func (r *Renter) Streamer(siaPath modules.SiaPath, disableLocalFetch bool) (_ st
 
 	// Lookup the file associated with the nickname.
 	node, err := r.staticFileSystem.OpenSiaFile(siaPath)
-	if err != nil {
+	if errors.Contains(err, filesystem.ErrNotExist) {
+		return "", nil, errors.Extend(err, modules.ErrFileNotFound)
+	} else if err != nil {
 		return "", nil, err
 	}
 	defer func() {
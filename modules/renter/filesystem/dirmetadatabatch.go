@@ -0,0 +1,138 @@
+package filesystem
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"gitlab.com/NebulousLabs/errors"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siadir"
+)
+
+// dirMetadataBatch collects the bubbled metadata of directories until it is
+// flushed to disk. Bubbling the metadata of a file usually updates all of its
+// ancestors, so holding the metadata back allows for updating every directory
+// only once per flush, no matter how many of its children were updated in the
+// meantime.
+type dirMetadataBatch struct {
+	// pending contains the metadata which wasn't flushed yet.
+	pending map[modules.SiaPath]siadir.Metadata
+	mu      sync.Mutex
+
+	// flushMu is held for writing while a batch is flushed and for reading
+	// by methods which return the metadata of directories. That way readers
+	// either see the tree before or after a flush but never in between.
+	flushMu sync.RWMutex
+}
+
+// newDirMetadataBatch creates a new, empty batch.
+func newDirMetadataBatch() *dirMetadataBatch {
+	return &dirMetadataBatch{
+		pending: make(map[modules.SiaPath]siadir.Metadata),
+	}
+}
+
+// callAdd adds the metadata of a directory to the batch, replacing the
+// metadata which was previously added for the same directory.
+func (b *dirMetadataBatch) callAdd(siaPath modules.SiaPath, md siadir.Metadata) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[siaPath] = md
+}
+
+// callMetadata returns the metadata of a directory from the batch.
+func (b *dirMetadataBatch) callMetadata(siaPath modules.SiaPath) (siadir.Metadata, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	md, exists := b.pending[siaPath]
+	return md, exists
+}
+
+// callRemoveSubtree removes the metadata of a directory and all of its
+// subdirectories from the batch.
+func (b *dirMetadataBatch) callRemoveSubtree(siaPath modules.SiaPath) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	prefix := siaPath.String() + "/"
+	for sp := range b.pending {
+		if siaPath.IsRoot() || sp.Equals(siaPath) || strings.HasPrefix(sp.String(), prefix) {
+			delete(b.pending, sp)
+		}
+	}
+}
+
+// callTake removes all of the metadata from the batch and returns it.
+func (b *dirMetadataBatch) callTake() map[modules.SiaPath]siadir.Metadata {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := b.pending
+	b.pending = make(map[modules.SiaPath]siadir.Metadata)
+	return pending
+}
+
+// BubbledMetadata returns the bubbled metadata of a directory which wasn't
+// flushed yet.
+func (fs *FileSystem) BubbledMetadata(siaPath modules.SiaPath) (siadir.Metadata, bool) {
+	return fs.staticDirMetadataBatch.callMetadata(siaPath)
+}
+
+// FlushBubbledMetadata writes the bubbled metadata of all directories which
+// were queued since the last flush to disk using a single WAL transaction. It
+// returns the number of directories which were written.
+func (fs *FileSystem) FlushBubbledMetadata() (_ int, err error) {
+	b := fs.staticDirMetadataBatch
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	// Sort the directories to write them in a deterministic order.
+	pending := b.callTake()
+	siaPaths := make([]modules.SiaPath, 0, len(pending))
+	for siaPath := range pending {
+		siaPaths = append(siaPaths, siaPath)
+	}
+	sort.Slice(siaPaths, func(i, j int) bool {
+		return siaPaths[i].String() < siaPaths[j].String()
+	})
+
+	// Open the directories. Directories which were deleted in the meantime
+	// are skipped.
+	sds := make([]*siadir.SiaDir, 0, len(siaPaths))
+	mds := make([]siadir.Metadata, 0, len(siaPaths))
+	for _, siaPath := range siaPaths {
+		dir, openErr := fs.managedOpenSiaDir(siaPath)
+		if errors.Contains(openErr, ErrNotExist) {
+			continue
+		}
+		if openErr != nil {
+			return 0, errors.AddContext(openErr, "failed to open directory")
+		}
+		// The open node keeps the SiaDir loaded until the flush is done.
+		defer func() {
+			err = errors.Compose(err, dir.Close())
+		}()
+		dir.mu.Lock()
+		sd, loadErr := dir.siaDir()
+		dir.mu.Unlock()
+		if errors.Contains(loadErr, ErrNotExist) {
+			continue
+		}
+		if loadErr != nil {
+			return 0, errors.AddContext(loadErr, "failed to load directory")
+		}
+		sds = append(sds, sd)
+		mds = append(mds, pending[siaPath])
+	}
+	err = siadir.UpdateBubbledMetadatas(fs.staticWal, sds, mds)
+	if err != nil {
+		return 0, errors.AddContext(err, "failed to update metadatas")
+	}
+	return len(sds), nil
+}
+
+// QueueBubbledMetadata queues the bubbled metadata of a directory to be
+// written to disk by the next call to FlushBubbledMetadata. Until then, the
+// metadata is only returned by BubbledMetadata.
+func (fs *FileSystem) QueueBubbledMetadata(siaPath modules.SiaPath, md siadir.Metadata) {
+	fs.staticDirMetadataBatch.callAdd(siaPath, md)
+}
@@ -0,0 +1,187 @@
+package filesystem
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siadir"
+)
+
+// TestFlushBubbledMetadata tests queueing and flushing the bubbled metadata of
+// directories.
+func TestFlushBubbledMetadata(t *testing.T) {
+	if testing.Short() && !build.VLONG {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// Create filesystem with a few dirs.
+	root := filepath.Join(testDir(t.Name()), "fs-root")
+	fs := newTestFileSystem(root)
+	dirs := []modules.SiaPath{modules.RootSiaPath(), newSiaPath("a"), newSiaPath("a/b"), newSiaPath("c"), newSiaPath("c/d")}
+	for _, dir := range dirs[1:] {
+		if err := fs.NewSiaDir(dir, modules.DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Queue metadata for all dirs.
+	for i, dir := range dirs {
+		fs.QueueBubbledMetadata(dir, siadir.Metadata{AggregateNumFiles: uint64(i + 1)})
+	}
+
+	// The queued metadata should be returned by BubbledMetadata but not by
+	// DirInfo.
+	for i, dir := range dirs {
+		md, exists := fs.BubbledMetadata(dir)
+		if !exists || md.AggregateNumFiles != uint64(i+1) {
+			t.Fatal("wrong bubbled metadata", exists, md.AggregateNumFiles)
+		}
+		di, err := fs.DirInfo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if di.AggregateNumFiles != 0 {
+			t.Fatal("metadata shouldn't be visible before flush", di.AggregateNumFiles)
+		}
+	}
+
+	// Deleting a dir removes the metadata of the dir and its subdirs.
+	if err := fs.DeleteDir(newSiaPath("c")); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs[3:] {
+		if _, exists := fs.BubbledMetadata(dir); exists {
+			t.Fatal("metadata of deleted dir wasn't removed", dir)
+		}
+	}
+
+	// Flush the metadata. Only the remaining dirs should be written.
+	n, err := fs.FlushBubbledMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatal("wrong number of dirs written", n)
+	}
+	for i, dir := range dirs[:3] {
+		if _, exists := fs.BubbledMetadata(dir); exists {
+			t.Fatal("metadata wasn't removed after flush")
+		}
+		di, err := fs.DirInfo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if di.AggregateNumFiles != uint64(i+1) {
+			t.Fatal("metadata wasn't flushed", di.AggregateNumFiles)
+		}
+		if di.DirMode != modules.DefaultDirPerm {
+			t.Fatal("mode wasn't preserved", di.DirMode)
+		}
+		sd, err := siadir.LoadSiaDir(fs.DirPath(dir), modules.ProdDependencies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sd.Metadata().AggregateNumFiles != uint64(i+1) {
+			t.Fatal("metadata wasn't persisted", sd.Metadata().AggregateNumFiles)
+		}
+	}
+
+	// Flushing again shouldn't write anything.
+	n, err = fs.FlushBubbledMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatal("expected no writes", n)
+	}
+}
+
+// TestFlushBubbledMetadataAtomic tests that listing directories never returns
+// the metadata of a partially flushed batch.
+func TestFlushBubbledMetadataAtomic(t *testing.T) {
+	if testing.Short() && !build.VLONG {
+		t.SkipNow()
+	}
+	t.Parallel()
+	// Create filesystem with more dirs than the number of threads used for
+	// listing them.
+	root := filepath.Join(testDir(t.Name()), "fs-root")
+	fs := newTestFileSystem(root)
+	dirs := []modules.SiaPath{modules.RootSiaPath()}
+	for i := 0; i < 5; i++ {
+		dirs = append(dirs, newSiaPath(fmt.Sprintf("dir%v", i)))
+		for j := 0; j < 20; j++ {
+			dirs = append(dirs, newSiaPath(fmt.Sprintf("dir%v/sub%v", i, j)))
+		}
+	}
+	for _, dir := range dirs[1:] {
+		if err := fs.NewSiaDir(dir, modules.DefaultDirPerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Start listing the dirs but block the listing after the first dirs were
+	// read.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	var dis []modules.DirectoryInfo
+	dlf := func(di modules.DirectoryInfo) {
+		mu.Lock()
+		dis = append(dis, di)
+		mu.Unlock()
+		once.Do(func() { close(started) })
+		<-release
+	}
+	listErr := make(chan error)
+	go func() {
+		listErr <- fs.CachedList(modules.RootSiaPath(), true, func(modules.FileInfo) {}, dlf)
+	}()
+
+	// Flush a batch for all dirs while the listing is blocked.
+	<-started
+	for _, dir := range dirs {
+		fs.QueueBubbledMetadata(dir, siadir.Metadata{AggregateNumFiles: 1})
+	}
+	flushErr := make(chan error)
+	go func() {
+		_, err := fs.FlushBubbledMetadata()
+		flushErr <- err
+	}()
+
+	// Release the listing. It should only see the metadata from before the
+	// flush.
+	time.Sleep(time.Second)
+	close(release)
+	if err := <-listErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-flushErr; err != nil {
+		t.Fatal(err)
+	}
+	if len(dis) != len(dirs) {
+		t.Fatal("wrong number of dirs", len(dis))
+	}
+	for _, di := range dis {
+		if di.AggregateNumFiles != 0 {
+			t.Fatal("listing returned partially flushed batch", di.SiaPath)
+		}
+	}
+
+	// Another listing should only see the metadata after the flush.
+	_, dis, err := fs.CachedListCollect(modules.RootSiaPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, di := range dis {
+		if di.AggregateNumFiles != 1 {
+			t.Fatal("listing didn't return flushed metadata", di.SiaPath)
+		}
+	}
+}
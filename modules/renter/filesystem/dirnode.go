@@ -134,6 +134,17 @@ func (n *DirNode) Path() (string, error) {
 	return sd.Path(), nil
 }
 
+// SetUploadDefaults is a wrapper for SiaDir.SetUploadDefaults.
+func (n *DirNode) SetUploadDefaults(defaults modules.DirUploadDefaults) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sd, err := n.siaDir()
+	if err != nil {
+		return err
+	}
+	return sd.SetUploadDefaults(defaults)
+}
+
 // UpdateBubbledMetadata is a wrapper for SiaDir.UpdateBubbledMetadata.
 func (n *DirNode) UpdateBubbledMetadata(md siadir.Metadata) error {
 	n.mu.Lock()
@@ -609,6 +620,7 @@ func (n *DirNode) managedInfo(siaPath modules.SiaPath) (modules.DirectoryInfo, e
 		StuckSize:           metadata.StuckSize,
 		SiaPath:             siaPath,
 		UID:                 n.staticUID,
+		UploadDefaults:      metadata.UploadDefaults,
 	}, nil
 }
 
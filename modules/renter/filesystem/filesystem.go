@@ -40,6 +40,10 @@ type (
 	// future.
 	FileSystem struct {
 		DirNode
+
+		// staticDirMetadataBatch contains the bubbled metadata of directories
+		// which wasn't flushed to disk yet.
+		staticDirMetadataBatch *dirMetadataBatch
 	}
 
 	// node is a struct that contains the common fields of every node.
@@ -157,6 +161,7 @@ func New(root string, log *persist.Logger, wal *writeaheadlog.WAL) (*FileSystem,
 			files:       make(map[string]*FileNode),
 			lazySiaDir:  new(*siadir.SiaDir),
 		},
+		staticDirMetadataBatch: newDirMetadataBatch(),
 	}
 	// Prepare root folder.
 	err := fs.NewSiaDir(modules.RootSiaPath(), modules.DefaultDirPerm)
@@ -222,7 +227,9 @@ func (fs *FileSystem) CachedListOnNode(d *DirNode) (fis []modules.FileInfo, dis
 		dis = append(dis, di)
 		dmu.Unlock()
 	}
+	fs.staticDirMetadataBatch.flushMu.RLock()
 	err = d.managedList(fs.managedAbsPath(), false, true, nil, nil, nil, flf, dlf)
+	fs.staticDirMetadataBatch.flushMu.RUnlock()
 
 	// Sort slices by SiaPath.
 	sort.Slice(dis, func(i, j int) bool {
@@ -241,6 +248,7 @@ func (fs *FileSystem) CachedListOnNode(d *DirNode) (fis []modules.FileInfo, dis
 // file of the same path can be created and the existing file can't be opened
 // until all instances of it are closed.
 func (fs *FileSystem) DeleteDir(siaPath modules.SiaPath) error {
+	fs.staticDirMetadataBatch.callRemoveSubtree(siaPath)
 	return fs.managedDeleteDir(siaPath.String())
 }
 
@@ -263,6 +271,8 @@ func (fs *FileSystem) DirInfo(siaPath modules.SiaPath) (_ modules.DirectoryInfo,
 	defer func() {
 		err = errors.Compose(err, dir.Close())
 	}()
+	fs.staticDirMetadataBatch.flushMu.RLock()
+	defer fs.staticDirMetadataBatch.flushMu.RUnlock()
 	di, err := dir.managedInfo(siaPath)
 	if err != nil {
 		return modules.DirectoryInfo{}, err
@@ -275,6 +285,8 @@ func (fs *FileSystem) DirInfo(siaPath modules.SiaPath) (_ modules.DirectoryInfo,
 // more efficient than calling fs.DirInfo.
 func (fs *FileSystem) DirNodeInfo(n *DirNode) (modules.DirectoryInfo, error) {
 	sp := fs.DirSiaPath(n)
+	fs.staticDirMetadataBatch.flushMu.RLock()
+	defer fs.staticDirMetadataBatch.flushMu.RUnlock()
 	return n.managedInfo(sp)
 }
 
@@ -523,6 +535,9 @@ func (fs *FileSystem) RenameFile(oldSiaPath, newSiaPath modules.SiaPath) (err er
 // directory must exist, and there must not be any directory that already has
 // the replacement path.  All sia files within directory will also be renamed
 func (fs *FileSystem) RenameDir(oldSiaPath, newSiaPath modules.SiaPath) error {
+	// The directories will be bubbled at their new location.
+	fs.staticDirMetadataBatch.callRemoveSubtree(oldSiaPath)
+
 	// Open SiaDir for parent dir at old location.
 	oldDirSiaPath, err := oldSiaPath.Dir()
 	if err != nil {
@@ -638,6 +653,8 @@ func (fs *FileSystem) managedList(siaPath modules.SiaPath, recursive, cached boo
 	defer func() {
 		err = errors.Compose(err, dir.Close())
 	}()
+	fs.staticDirMetadataBatch.flushMu.RLock()
+	defer fs.staticDirMetadataBatch.flushMu.RUnlock()
 	return dir.managedList(fs.managedAbsPath(), recursive, cached, offlineMap, goodForRenewMap, contractsMap, flf, dlf)
 }
 
@@ -10,7 +10,9 @@ import (
 	"reflect"
 	"time"
 
+	"gitlab.com/NebulousLabs/encoding"
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/writeaheadlog"
 
 	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/crypto"
@@ -33,6 +35,10 @@ const (
 
 	// metadataVersion is the version of the metadata
 	metadataVersion = "1.0"
+
+	// updateMetadataName is the name of a siadir update that overwrites the
+	// metadata of a directory.
+	updateMetadataName = "SiaDirMetadata"
 )
 
 var (
@@ -45,8 +51,24 @@ var (
 
 	// ErrInvalidChecksum is the error returned if the siadir checksum is invalid
 	ErrInvalidChecksum = errors.New(".siadir has invalid checksum")
+
+	// errUnknownSiaDirUpdate is returned when applyUpdates finds an update
+	// that is unknown
+	errUnknownSiaDirUpdate = errors.New("unknown siadir update")
 )
 
+// ApplyUpdates is a wrapper for applyUpdates that uses the production
+// dependencies.
+func ApplyUpdates(updates ...writeaheadlog.Update) error {
+	return applyUpdates(modules.ProdDependencies, updates...)
+}
+
+// IsSiaDirUpdate is a helper method that makes sure that a wal update belongs
+// to the SiaDir package.
+func IsSiaDirUpdate(update writeaheadlog.Update) bool {
+	return update.Name == updateMetadataName
+}
+
 // New creates a new directory in the renter directory and makes sure there is a
 // metadata file in the directory and creates one as needed. This method will
 // also make sure that all the parent directories are created and have metadata
@@ -149,10 +171,93 @@ func (sd *SiaDir) UpdateBubbledMetadata(metadata Metadata) error {
 	sd.mu.Lock()
 	defer sd.mu.Unlock()
 	metadata.Mode = sd.metadata.Mode
+	metadata.UploadDefaults = sd.metadata.UploadDefaults
 	metadata.Version = sd.metadata.Version
 	return sd.updateMetadata(metadata)
 }
 
+// UpdateBubbledMetadatas updates the bubbled metadata of multiple SiaDirs like
+// UpdateBubbledMetadata but saves all of the changes to disk using a single
+// WAL transaction. Either all or none of the changes are persisted. SiaDirs
+// which are deleted are skipped.
+func UpdateBubbledMetadatas(wal *writeaheadlog.WAL, sds []*SiaDir, metadatas []Metadata) (err error) {
+	if len(sds) != len(metadatas) {
+		return errors.New("number of SiaDirs doesn't match number of metadatas")
+	}
+	// Lock all the SiaDirs to make sure that the new metadata becomes visible
+	// for all of them at once.
+	for _, sd := range sds {
+		sd.mu.Lock()
+		defer sd.mu.Unlock()
+	}
+	var dirs []*SiaDir
+	var mds []Metadata
+	var updates []writeaheadlog.Update
+	for i, sd := range sds {
+		if sd.deleted {
+			continue
+		}
+		md := metadatas[i]
+		md.Mode = sd.metadata.Mode
+		md.UploadDefaults = sd.metadata.UploadDefaults
+		md.Version = sd.metadata.Version
+		update, err := createMetadataUpdate(sd.path, md)
+		if err != nil {
+			return errors.AddContext(err, "failed to create metadata update")
+		}
+		dirs = append(dirs, sd)
+		mds = append(mds, md)
+		updates = append(updates, update)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	// Create the writeaheadlog transaction.
+	txn, err := wal.NewTransaction(updates)
+	if err != nil {
+		return errors.AddContext(err, "failed to create wal txn")
+	}
+	// No extra setup is required. Signal that it is done.
+	if err := <-txn.SignalSetupComplete(); err != nil {
+		return errors.AddContext(err, "failed to signal setup completion")
+	}
+	// Starting at this point the changes to be made are written to the WAL.
+	// This means we need to panic in case applying the updates fails.
+	defer func() {
+		if err != nil {
+			panic(err)
+		}
+	}()
+	// Apply the updates.
+	for i, sd := range dirs {
+		err = saveDir(sd.path, mds[i], sd.deps)
+		if errors.IsOSNotExist(err) {
+			// The directory was deleted together with one of its parents.
+			err = nil
+			continue
+		}
+		if err != nil {
+			return errors.AddContext(err, "failed to apply update")
+		}
+		sd.metadata = mds[i]
+	}
+	// Updates are applied. Let the writeaheadlog know.
+	if err := txn.SignalUpdatesApplied(); err != nil {
+		return errors.AddContext(err, "failed to signal that updates are applied")
+	}
+	return nil
+}
+
+// SetUploadDefaults sets the upload defaults of the SiaDir and saves the
+// changes to disk.
+func (sd *SiaDir) SetUploadDefaults(defaults modules.DirUploadDefaults) error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	md := sd.metadata
+	md.UploadDefaults = defaults
+	return sd.updateMetadata(md)
+}
+
 // UpdateLastHealthCheckTime updates the SiaDir LastHealthCheckTime and
 // AggregateLastHealthCheckTime and saves the changes to disk
 func (sd *SiaDir) UpdateLastHealthCheckTime(aggregateLastHealthCheckTime, lastHealthCheckTime time.Time) error {
@@ -225,6 +330,7 @@ func (sd *SiaDir) updateMetadata(metadata Metadata) error {
 	sd.metadata.StuckHealth = metadata.StuckHealth
 	sd.metadata.StuckSize = metadata.StuckSize
 
+	sd.metadata.UploadDefaults = metadata.UploadDefaults
 	sd.metadata.Version = metadata.Version
 
 	// Testing check to ensure new fields aren't missed
@@ -366,6 +472,55 @@ func newMetadata() Metadata {
 	}
 }
 
+// applyUpdates applies a number of writeaheadlog updates to the corresponding
+// SiaDirs. This method should only be run before the SiaDirs are loaded from
+// disk right after the startup of siad.
+func applyUpdates(deps modules.Dependencies, updates ...writeaheadlog.Update) error {
+	for _, u := range updates {
+		if u.Name != updateMetadataName {
+			return errUnknownSiaDirUpdate
+		}
+		path, md, err := readMetadataUpdate(u)
+		if err != nil {
+			return errors.AddContext(err, "failed to read update")
+		}
+		err = saveDir(path, md, deps)
+		if errors.IsOSNotExist(err) {
+			// The directory was deleted after the update was created.
+			continue
+		}
+		if err != nil {
+			return errors.AddContext(err, "failed to apply update")
+		}
+	}
+	return nil
+}
+
+// createMetadataUpdate creates a writeaheadlog update which overwrites the
+// metadata of the SiaDir at the provided path.
+func createMetadataUpdate(path string, md Metadata) (writeaheadlog.Update, error) {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return writeaheadlog.Update{}, errors.AddContext(err, "unable to marshal metadata")
+	}
+	return writeaheadlog.Update{
+		Name:         updateMetadataName,
+		Instructions: encoding.MarshalAll(path, data),
+	}, nil
+}
+
+// readMetadataUpdate decodes a metadata update created by
+// createMetadataUpdate.
+func readMetadataUpdate(update writeaheadlog.Update) (path string, md Metadata, err error) {
+	var data []byte
+	err = encoding.UnmarshalAll(update.Instructions, &path, &data)
+	if err != nil {
+		return "", Metadata{}, err
+	}
+	err = json.Unmarshal(data, &md)
+	return path, md, err
+}
+
 // saveDir saves the metadata to disk at the provided path.
 func saveDir(path string, md Metadata, deps modules.Dependencies) (err error) {
 	// Open .siadir file
@@ -9,6 +9,7 @@ import (
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/writeaheadlog"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/persist"
 )
@@ -22,8 +23,154 @@ func TestPersist(t *testing.T) {
 	}
 	t.Parallel()
 
+	t.Run("ApplyUpdates", testApplyUpdates)
 	t.Run("CallLoadSiaDirMetadata", testCallLoadSiaDirMetadata)
 	t.Run("CreateDirMetadataAll", testCreateDirMetadataAll)
+	t.Run("UpdateBubbledMetadatas", testUpdateBubbledMetadatas)
+}
+
+// persistedRandomMetadata returns random metadata whose time fields survive
+// being persisted unchanged.
+func persistedRandomMetadata() Metadata {
+	md := randomMetadata()
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	md.AggregateLastHealthCheckTime = now
+	md.AggregateModTime = now
+	md.LastHealthCheckTime = now
+	md.ModTime = now
+	return md
+}
+
+// testApplyUpdates probes applying the WAL updates of SiaDirs.
+func testApplyUpdates(t *testing.T) {
+	sd, err := newTestDir(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create an update for the dir and one for a dir which doesn't exist.
+	md := persistedRandomMetadata()
+	md.Mode = modules.DefaultDirPerm
+	md.Version = metadataVersion
+	update, err := createMetadataUpdate(sd.path, md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSiaDirUpdate(update) {
+		t.Fatal("update should be a siadir update")
+	}
+	missingUpdate, err := createMetadataUpdate(filepath.Join(sd.path, "missing"), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying the updates should only update the existing dir.
+	err = ApplyUpdates(update, missingUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSiaDir(sd.path, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.metadata, md) {
+		t.Log(loaded.metadata)
+		t.Log(md)
+		t.Fatal("metadata wasn't applied")
+	}
+	if _, err := os.Stat(filepath.Join(sd.path, "missing")); !os.IsNotExist(err) {
+		t.Fatal("missing dir shouldn't have been created", err)
+	}
+
+	// Unknown updates can't be applied.
+	update.Name = "unknown"
+	if IsSiaDirUpdate(update) {
+		t.Fatal("update shouldn't be a siadir update")
+	}
+	err = ApplyUpdates(update)
+	if !errors.Contains(err, errUnknownSiaDirUpdate) {
+		t.Fatal("expected errUnknownSiaDirUpdate", err)
+	}
+}
+
+// testUpdateBubbledMetadatas probes UpdateBubbledMetadatas.
+func testUpdateBubbledMetadatas(t *testing.T) {
+	rootDir, err := newSiaDirTestDir(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, wal, err := writeaheadlog.New(filepath.Join(rootDir, "wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wal.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create a few dirs. Set the upload defaults of one of them and delete
+	// another one.
+	var sds []*SiaDir
+	var mds []Metadata
+	for i := 0; i < 3; i++ {
+		sd, err := New(modules.RandomSiaPath().SiaDirSysPath(rootDir), rootDir, modules.DefaultDirPerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sds = append(sds, sd)
+		mds = append(mds, persistedRandomMetadata())
+	}
+	defaults := modules.DirUploadDefaults{DataPieces: 5, ParityPieces: 7}
+	if err := sds[0].SetUploadDefaults(defaults); err != nil {
+		t.Fatal(err)
+	}
+	if err := sds[2].Delete(); err != nil {
+		t.Fatal(err)
+	}
+	deletedMD := sds[2].Metadata()
+
+	// The number of dirs and metadatas needs to match.
+	err = UpdateBubbledMetadatas(wal, sds, mds[:2])
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Update the dirs.
+	err = UpdateBubbledMetadatas(wal, sds, mds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The deleted dir should be unchanged.
+	if !reflect.DeepEqual(sds[2].Metadata(), deletedMD) {
+		t.Fatal("deleted dir was updated")
+	}
+
+	// The other dirs should have the bubbled metadata in memory and on disk.
+	// The fields which aren't bubbled should be unchanged.
+	for i, sd := range sds[:2] {
+		expected := mds[i]
+		expected.Mode = modules.DefaultDirPerm
+		expected.Version = metadataVersion
+		if i == 0 {
+			expected.UploadDefaults = defaults
+		}
+		if !reflect.DeepEqual(sd.Metadata(), expected) {
+			t.Log(sd.Metadata())
+			t.Log(expected)
+			t.Fatal("wrong metadata in memory")
+		}
+		loaded, err := LoadSiaDir(sd.Path(), modules.ProdDependencies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded.metadata, expected) {
+			t.Log(loaded.metadata)
+			t.Log(expected)
+			t.Fatal("wrong metadata on disk")
+		}
+	}
 }
 
 // testCallLoadSiaDirMetadata probes the callLoadSiaDirMetadata function
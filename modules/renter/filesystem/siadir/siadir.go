@@ -87,6 +87,11 @@ type (
 		StuckHealth         float64     `json:"stuckhealth"`
 		StuckSize           uint64      `json:"stucksize"`
 
+		// UploadDefaults are the upload parameters inherited by the files
+		// uploaded beneath the siadir. They are set by the user and not
+		// bubbled.
+		UploadDefaults modules.DirUploadDefaults `json:"uploaddefaults"`
+
 		// Version is the used version of the header file.
 		Version string `json:"version"`
 	}
@@ -162,6 +162,8 @@ func unmarshalMetadata(raw []byte) (md Metadata, err error) {
 	if err != nil {
 		return
 	}
+	// Validate the piece and chunk size.
+	err = md.validateSizes()
 	return
 }
 
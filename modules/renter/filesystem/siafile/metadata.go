@@ -43,11 +43,14 @@ type (
 	Metadata struct {
 		UniqueID SiafileUID `json:"uniqueid"` // unique identifier for file
 
-		StaticPagesPerChunk uint8    `json:"pagesperchunk"` // number of pages reserved for storing a chunk.
-		StaticVersion       [16]byte `json:"version"`       // version of the sia file format used
-		FileSize            int64    `json:"filesize"`      // total size of the file
-		StaticPieceSize     uint64   `json:"piecesize"`     // size of a single piece of the file
-		LocalPath           string   `json:"localpath"`     // file to the local copy of the file used for repairing
+		StaticPagesPerChunk   uint8    `json:"pagesperchunk"`   // number of pages reserved for storing a chunk.
+		StaticVersion         [16]byte `json:"version"`         // version of the sia file format used
+		FileSize              int64    `json:"filesize"`        // total size of the file
+		StaticPieceSize       uint64   `json:"piecesize"`       // size of a single piece of the file
+		StaticChunkSize       uint64   `json:"chunksize"`       // size of a single chunk of the file
+		StaticPiecesPerSector uint64   `json:"piecespersector"` // number of pieces stored in a single sector
+		StaticSectorPadding   uint64   `json:"sectorpadding"`   // unused bytes at the end of every sector
+		LocalPath             string   `json:"localpath"`       // file to the local copy of the file used for repairing
 
 		// Fields for encryption
 		StaticMasterKey      []byte            `json:"masterkey"` // masterkey used to encrypt pieces
@@ -123,11 +126,17 @@ type (
 		// was checked
 		//
 		// StuckHealth is the worst health of any of the file's stuck chunks
+		//
+		// RepairThreshold is the redundancy multiplier at which the file's
+		// chunks are considered in need of repair. It is used to scale the
+		// health of the chunks. A value of 0 means that the default
+		// modules.RepairThreshold is applied to the unscaled health.
 		Health              float64   `json:"health"`
 		LastHealthCheckTime time.Time `json:"lasthealthchecktime"`
 		NumStuckChunks      uint64    `json:"numstuckchunks"`
 		Redundancy          float64   `json:"redundancy"`
 		RepairBytes         uint64    `json:"repairbytes"`
+		RepairThreshold     float64   `json:"repairthreshold"`
 		StuckHealth         float64   `json:"stuckhealth"`
 		StuckBytes          uint64    `json:"stuckbytes"`
 
@@ -279,6 +288,11 @@ func (sf *SiaFile) PieceSize() uint64 {
 	return sf.staticMetadata.StaticPieceSize
 }
 
+// SectorPacking returns how the pieces of the file are packed into sectors.
+func (sf *SiaFile) SectorPacking() SectorPacking {
+	return sf.staticMetadata.staticSectorPacking()
+}
+
 // Rename changes the name of the file to a new one. To guarantee that renaming
 // the file is atomic across all operating systems, we create a wal transaction
 // that moves over all the chunks one-by-one and deletes the src file.
@@ -295,6 +309,9 @@ func (md Metadata) backup() (b Metadata) {
 	b.StaticPagesPerChunk = md.StaticPagesPerChunk
 	b.StaticVersion = md.StaticVersion
 	b.StaticPieceSize = md.StaticPieceSize
+	b.StaticChunkSize = md.StaticChunkSize
+	b.StaticPiecesPerSector = md.StaticPiecesPerSector
+	b.StaticSectorPadding = md.StaticSectorPadding
 	b.StaticMasterKey = md.StaticMasterKey
 	b.StaticMasterKeyType = md.StaticMasterKeyType
 	b.StaticSharingKey = md.StaticSharingKey
@@ -329,6 +346,7 @@ func (md Metadata) backup() (b Metadata) {
 	b.LastHealthCheckTime = md.LastHealthCheckTime
 	b.NumStuckChunks = md.NumStuckChunks
 	b.RepairBytes = md.RepairBytes
+	b.RepairThreshold = md.RepairThreshold
 	b.StuckBytes = md.StuckBytes
 	b.Redundancy = md.Redundancy
 	b.StuckHealth = md.StuckHealth
@@ -381,6 +399,7 @@ func (md *Metadata) restore(b Metadata) {
 	md.LastHealthCheckTime = b.LastHealthCheckTime
 	md.NumStuckChunks = b.NumStuckChunks
 	md.RepairBytes = b.RepairBytes
+	md.RepairThreshold = b.RepairThreshold
 	md.StuckBytes = b.StuckBytes
 	md.Redundancy = b.Redundancy
 	md.StuckHealth = b.StuckHealth
@@ -496,6 +515,40 @@ func (sf *SiaFile) SetMode(mode os.FileMode) (err error) {
 	return sf.createAndApplyTransaction(updates...)
 }
 
+// RepairThreshold returns the repair threshold of the file. A value of 0 means
+// that no custom threshold is set.
+func (sf *SiaFile) RepairThreshold() float64 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.staticMetadata.RepairThreshold
+}
+
+// SetRepairThreshold sets the repair threshold of the file, expressed as a
+// redundancy multiplier. A threshold of 0 resets it to the default.
+func (sf *SiaFile) SetRepairThreshold(threshold float64) (err error) {
+	if err := ValidateRepairThreshold(threshold, sf.staticMetadata.staticErasureCode); err != nil {
+		return err
+	}
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// backup the changed metadata before changing it. Revert the change on
+	// error.
+	defer func(backup Metadata) {
+		if err != nil {
+			sf.staticMetadata.restore(backup)
+		}
+	}(sf.staticMetadata.backup())
+	sf.staticMetadata.RepairThreshold = threshold
+	sf.staticMetadata.ChangeTime = time.Now()
+
+	// Save changes to metadata to disk.
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		return err
+	}
+	return sf.createAndApplyTransaction(updates...)
+}
+
 // SetLastHealthCheckTime sets the LastHealthCheckTime in memory to the current
 // time but does not update and write to disk.
 //
@@ -581,7 +634,48 @@ func (sf *SiaFile) numStuckChunks() uint64 {
 
 // staticChunkSize returns the size of a single chunk of the file.
 func (sf *SiaFile) staticChunkSize() uint64 {
-	return sf.staticMetadata.StaticPieceSize * uint64(sf.staticMetadata.staticErasureCode.MinPieces())
+	return sf.staticMetadata.StaticChunkSize
+}
+
+// staticSectorPacking returns the sector packing persisted in the metadata.
+func (md *Metadata) staticSectorPacking() SectorPacking {
+	return SectorPacking{
+		PieceSize:       md.StaticPieceSize + md.StaticMasterKeyType.Overhead(),
+		PiecesPerSector: md.StaticPiecesPerSector,
+		Padding:         md.StaticSectorPadding,
+	}
+}
+
+// validateSizes checks the piece size, chunk size and sector packing of the
+// metadata against the erasure coder and the master key. Legacy files don't
+// persist their chunk size or sector packing. For those they are computed
+// instead.
+func (md *Metadata) validateSizes() error {
+	if md.StaticPieceSize == 0 {
+		return errors.AddContext(ErrInvalidPieceSize, fmt.Sprintf("piece size is %v", md.StaticPieceSize))
+	}
+	expected := md.staticErasureCode.ChunkSize(md.StaticPieceSize)
+	if md.StaticChunkSize == 0 {
+		md.StaticChunkSize = expected
+	}
+	if md.StaticChunkSize != expected {
+		return errors.AddContext(ErrChunkSizeMismatch, fmt.Sprintf("expected %v but was %v", expected, md.StaticChunkSize))
+	}
+	if !crypto.IsValidCipherType(md.StaticMasterKeyType) {
+		return crypto.ErrInvalidCipherType
+	}
+	packing, err := PlanSectorPacking(md.StaticPieceSize, md.StaticMasterKeyType.Overhead())
+	if err != nil {
+		return err
+	}
+	if md.StaticPiecesPerSector == 0 {
+		md.StaticPiecesPerSector = packing.PiecesPerSector
+		md.StaticSectorPadding = packing.Padding
+	}
+	if md.staticSectorPacking() != packing {
+		return errors.AddContext(ErrSectorPackingMismatch, fmt.Sprintf("expected %v pieces per sector and %v bytes of padding but was %v and %v", packing.PiecesPerSector, packing.Padding, md.StaticPiecesPerSector, md.StaticSectorPadding))
+	}
+	return nil
 }
 
 // staticMasterKey returns the masterkey used to encrypt the file.
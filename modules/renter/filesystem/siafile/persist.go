@@ -259,6 +259,10 @@ func loadSiaFileFromReader(r io.ReadSeeker, path string, wal *writeaheadlog.WAL,
 	if err != nil {
 		return nil, err
 	}
+	// Validate the piece and chunk size.
+	if err := sf.staticMetadata.validateSizes(); err != nil {
+		return nil, err
+	}
 	// COMPATv140 legacy 0-byte files might not have correct cached fields since we
 	// never update them once they are created.
 	if sf.staticMetadata.FileSize == 0 {
@@ -332,6 +336,8 @@ func loadSiaFileMetadata(path string, deps modules.Dependencies) (md Metadata, e
 	if err != nil {
 		return
 	}
+	// Validate the piece and chunk size.
+	err = md.validateSizes()
 	return
 }
 
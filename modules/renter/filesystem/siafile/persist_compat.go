@@ -44,6 +44,10 @@ func NewFromLegacyData(fd FileData, siaFilePath string, wal *writeaheadlog.WAL)
 	currentTime := time.Now()
 	ecType, ecParams := marshalErasureCoder(fd.ErasureCode)
 	zeroHealth := float64(1 + fd.ErasureCode.MinPieces()/(fd.ErasureCode.NumPieces()-fd.ErasureCode.MinPieces()))
+	packing, err := PlanSectorPacking(fd.PieceSize, mk.Type().Overhead())
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to plan sector packing")
+	}
 	file := &SiaFile{
 		staticMetadata: Metadata{
 			AccessTime:              currentTime,
@@ -67,6 +71,9 @@ func NewFromLegacyData(fd FileData, siaFilePath string, wal *writeaheadlog.WAL)
 			StaticErasureCodeParams: ecParams,
 			StaticPagesPerChunk:     numChunkPagesRequired(fd.ErasureCode.NumPieces()),
 			StaticPieceSize:         fd.PieceSize,
+			StaticChunkSize:         fd.ErasureCode.ChunkSize(fd.PieceSize),
+			StaticPiecesPerSector:   packing.PiecesPerSector,
+			StaticSectorPadding:     packing.Padding,
 			UniqueID:                SiafileUID(fd.UID),
 		},
 		deps:        modules.ProdDependencies,
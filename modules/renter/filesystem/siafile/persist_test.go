@@ -1076,3 +1076,130 @@ func TestDeleteUpdateRegression(t *testing.T) {
 	update := sf.createDeleteUpdate()
 	sf.createAndApplyTransaction(update, update)
 }
+
+// TestLoadLegacyChunkSize makes sure that siafiles which were created before
+// the chunk size was persisted can still be loaded and get their chunk size
+// from the erasure coder.
+func TestLoadLegacyChunkSize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wal, _ := newTestWAL()
+	tests := []struct {
+		path       string
+		dataPieces int
+		numPieces  int
+	}{
+		{filepath.Join("testdata", "legacy_rs.sia"), 2, 4},
+		{filepath.Join("testdata", "legacy_rssub.sia"), 4, 6},
+	}
+	for _, test := range tests {
+		sf, err := LoadSiaFile(test.path, wal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ec := sf.ErasureCode()
+		if ec.MinPieces() != test.dataPieces || ec.NumPieces() != test.numPieces {
+			t.Fatalf("%v: wrong erasure code %v-of-%v", test.path, ec.MinPieces(), ec.NumPieces())
+		}
+		// The chunk size should be set and the file should be split into 3
+		// chunks. The last one is only half full.
+		chunkSize := sf.PieceSize() * uint64(test.dataPieces)
+		if sf.ChunkSize() != chunkSize {
+			t.Fatalf("%v: expected chunk size %v but was %v", test.path, chunkSize, sf.ChunkSize())
+		}
+		if sf.Size() != 2*chunkSize+chunkSize/2 {
+			t.Fatalf("%v: wrong file size %v", test.path, sf.Size())
+		}
+		if sf.NumChunks() != 3 {
+			t.Fatalf("%v: expected 3 chunks but got %v", test.path, sf.NumChunks())
+		}
+		// The second chunk should have all its pieces.
+		pieces, err := sf.Pieces(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pieceIndex, pieceSet := range pieces {
+			if len(pieceSet) != 1 || pieceSet[0].MerkleRoot != (crypto.Hash{byte(pieceIndex + 1)}) {
+				t.Fatalf("%v: wrong piece at index %v", test.path, pieceIndex)
+			}
+		}
+		// The snapshot should use the same chunk size.
+		snap, err := sf.Snapshot(modules.RandomSiaPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.ChunkSize() != chunkSize {
+			t.Fatalf("%v: expected snapshot chunk size %v but was %v", test.path, chunkSize, snap.ChunkSize())
+		}
+	}
+}
+
+// TestLoadChunkSizeMismatch makes sure that a siafile with a chunk size that
+// doesn't match its erasure code can't be loaded.
+func TestLoadChunkSizeMismatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a new file. It should have a chunk size.
+	sf, wal, _ := newBlankTestFileAndWAL(1)
+	if sf.staticMetadata.StaticChunkSize != sf.ErasureCode().ChunkSize(sf.PieceSize()) {
+		t.Fatal("chunk size wasn't set")
+	}
+	// Change the chunk size and save the file.
+	sf.staticMetadata.StaticChunkSize++
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.createAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	// Loading the file or its metadata should fail.
+	_, err = LoadSiaFile(sf.siaFilePath, wal)
+	if !errors.Contains(err, ErrChunkSizeMismatch) {
+		t.Fatal("expected ErrChunkSizeMismatch but got", err)
+	}
+	_, err = LoadSiaFileMetadata(sf.siaFilePath)
+	if !errors.Contains(err, ErrChunkSizeMismatch) {
+		t.Fatal("expected ErrChunkSizeMismatch but got", err)
+	}
+}
+
+// TestLoadSectorPackingMismatch makes sure that a siafile with a sector
+// packing that doesn't match its piece size can't be loaded.
+func TestLoadSectorPackingMismatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a new file. It should have a sector packing.
+	sf, wal, _ := newBlankTestFileAndWAL(1)
+	packing := sf.SectorPacking()
+	if packing.PiecesPerSector != 1 || packing.Padding != 0 || packing.PieceSize != modules.SectorSize {
+		t.Fatal("unexpected sector packing", packing)
+	}
+	// Change the packing and save the file.
+	sf.staticMetadata.StaticPiecesPerSector++
+	updates, err := sf.saveMetadataUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.createAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	// Loading the file or its metadata should fail.
+	_, err = LoadSiaFile(sf.siaFilePath, wal)
+	if !errors.Contains(err, ErrSectorPackingMismatch) {
+		t.Fatal("expected ErrSectorPackingMismatch but got", err)
+	}
+	_, err = LoadSiaFileMetadata(sf.siaFilePath)
+	if !errors.Contains(err, ErrSectorPackingMismatch) {
+		t.Fatal("expected ErrSectorPackingMismatch but got", err)
+	}
+}
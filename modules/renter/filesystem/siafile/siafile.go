@@ -29,6 +29,21 @@ var (
 	// ErrDeleted is returned when an operation failed due to the siafile being
 	// deleted already.
 	ErrDeleted = errors.New("files was deleted")
+	// ErrInvalidRepairThreshold is returned when a repair threshold can't be
+	// reached with a file's erasure code.
+	ErrInvalidRepairThreshold = errors.New("invalid repair threshold")
+	// ErrChunkSizeMismatch is returned when the chunk size persisted in a
+	// file's metadata doesn't match the chunk size of its erasure coder.
+	ErrChunkSizeMismatch = errors.New("chunk size doesn't match erasure code")
+	// ErrInvalidPieceSize is returned when the piece size persisted in a
+	// file's metadata is invalid.
+	ErrInvalidPieceSize = errors.New("invalid piece size")
+	// ErrPieceExceedsSectorSize is returned when a single encrypted piece of a
+	// file doesn't fit into a sector.
+	ErrPieceExceedsSectorSize = errors.New("piece exceeds sector size")
+	// ErrSectorPackingMismatch is returned when the sector packing persisted
+	// in a file's metadata doesn't match its piece size.
+	ErrSectorPackingMismatch = errors.New("sector packing doesn't match piece size")
 )
 
 type (
@@ -109,6 +124,15 @@ type (
 		MerkleRoot crypto.Hash        // merkle root of the piece
 	}
 
+	// SectorPacking describes how the encrypted pieces of a file are packed
+	// into sectors. Every piece is stored in a slot of PieceSize bytes and the
+	// Padding bytes at the end of every sector are unused.
+	SectorPacking struct {
+		PieceSize       uint64 // size of an encrypted piece
+		PiecesPerSector uint64 // number of pieces that fit into a sector
+		Padding         uint64 // unused bytes at the end of every sector
+	}
+
 	// HostPublicKey is an entry in the HostPubKey table.
 	HostPublicKey struct {
 		PublicKey types.SiaPublicKey // public key of host
@@ -132,6 +156,46 @@ func CalculateHealth(goodPieces, minPieces, numPieces int) float64 {
 	return health
 }
 
+// ScaleHealth scales a health calculated by CalculateHealth according to a
+// repair threshold which is expressed as a redundancy multiplier. The health is
+// scaled in a way that a chunk with a redundancy equal to the repair threshold
+// has a health of modules.RepairThreshold. That way a chunk is considered in
+// need of repair once its redundancy drops to the repair threshold and chunks
+// below the threshold are prioritized by how far below it they are. A repair
+// threshold of 0 leaves the health unchanged. The repair threshold must have
+// been validated with ValidateRepairThreshold.
+func ScaleHealth(health, repairThreshold float64, minPieces, numPieces int) float64 {
+	// Health above 1 means that the chunk is unrecoverable from the network.
+	// That doesn't depend on the threshold.
+	if repairThreshold == 0 || health <= 0 || health > 1 {
+		return health
+	}
+	// Compute the health at which the redundancy of a chunk is equal to the
+	// repair threshold and map it to modules.RepairThreshold.
+	thresholdHealth := 1 - (repairThreshold-1)*float64(minPieces)/float64(numPieces-minPieces)
+	if health <= thresholdHealth {
+		health = health * modules.RepairThreshold / thresholdHealth
+	} else {
+		health = modules.RepairThreshold + (health-thresholdHealth)*(1-modules.RepairThreshold)/(1-thresholdHealth)
+	}
+	// Round percentage to 2 digits.
+	return math.Round(health*10e3) / 10e3
+}
+
+// ValidateRepairThreshold checks whether the repair threshold, expressed as a
+// redundancy multiplier, can be reached with the provided erasure code. A
+// threshold of 0 is valid and means that the default is used.
+func ValidateRepairThreshold(repairThreshold float64, ec modules.ErasureCoder) error {
+	if repairThreshold == 0 {
+		return nil
+	}
+	maxRedundancy := float64(ec.NumPieces()) / float64(ec.MinPieces())
+	if repairThreshold <= 1 || repairThreshold > maxRedundancy || math.IsNaN(repairThreshold) {
+		return errors.AddContext(ErrInvalidRepairThreshold, fmt.Sprintf("threshold needs to be greater than 1 and at most %v", maxRedundancy))
+	}
+	return nil
+}
+
 // MarshalSia implements the encoding.SiaMarshaler interface.
 func (hpk HostPublicKey) MarshalSia(w io.Writer) error {
 	e := encoding.NewEncoder(w)
@@ -187,6 +251,36 @@ func (c *chunk) numPieces() (numPieces int) {
 	return
 }
 
+// PlanSectorPacking computes how pieces of pieceSize bytes, which grow by
+// pieceOverhead bytes when they are encrypted, are packed into sectors.
+func PlanSectorPacking(pieceSize, pieceOverhead uint64) (SectorPacking, error) {
+	if pieceSize == 0 {
+		return SectorPacking{}, errors.AddContext(ErrInvalidPieceSize, fmt.Sprintf("piece size is %v", pieceSize))
+	}
+	encryptedSize := pieceSize + pieceOverhead
+	if encryptedSize < pieceSize || encryptedSize > modules.SectorSize {
+		return SectorPacking{}, errors.AddContext(ErrPieceExceedsSectorSize, fmt.Sprintf("encrypted piece size %v+%v exceeds sector size %v", pieceSize, pieceOverhead, modules.SectorSize))
+	}
+	piecesPerSector := modules.SectorSize / encryptedSize
+	return SectorPacking{
+		PieceSize:       encryptedSize,
+		PiecesPerSector: piecesPerSector,
+		Padding:         modules.SectorSize - piecesPerSector*encryptedSize,
+	}, nil
+}
+
+// SectorRange translates a range of length bytes at offset within the piece
+// stored in the given slot of a sector into a range within the sector.
+func (sp SectorPacking) SectorRange(slot, offset, length uint64) (uint64, uint64, error) {
+	if slot >= sp.PiecesPerSector {
+		return 0, 0, fmt.Errorf("slot %v is out of bounds, sector only contains %v pieces", slot, sp.PiecesPerSector)
+	}
+	if offset+length < offset || offset+length > sp.PieceSize {
+		return 0, 0, fmt.Errorf("range [%v, %v) exceeds piece size %v", offset, offset+length, sp.PieceSize)
+	}
+	return slot*sp.PieceSize + offset, length, nil
+}
+
 // New create a new SiaFile.
 func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules.ErasureCoder, masterKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode, partialsSiaFile *SiaFile, disablePartialUpload bool) (*SiaFile, error) {
 	// TODO remove this
@@ -198,6 +292,11 @@ func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules
 	numPieces := erasureCode.NumPieces()
 	zeroHealth := float64(1 + minPieces/(numPieces-minPieces))
 	repairSize := fileSize * uint64(numPieces/minPieces)
+	pieceSize := modules.SectorSize - masterKey.Type().Overhead()
+	packing, err := PlanSectorPacking(pieceSize, masterKey.Type().Overhead())
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to plan sector packing")
+	}
 	file := &SiaFile{
 		staticMetadata: Metadata{
 			AccessTime:              currentTime,
@@ -223,7 +322,10 @@ func New(siaFilePath, source string, wal *writeaheadlog.WAL, erasureCode modules
 			StaticErasureCodeType:   ecType,
 			StaticErasureCodeParams: ecParams,
 			StaticPagesPerChunk:     numChunkPagesRequired(erasureCode.NumPieces()),
-			StaticPieceSize:         modules.SectorSize - masterKey.Type().Overhead(),
+			StaticPieceSize:         pieceSize,
+			StaticChunkSize:         erasureCode.ChunkSize(pieceSize),
+			StaticPiecesPerSector:   packing.PiecesPerSector,
+			StaticSectorPadding:     packing.Padding,
 			UniqueID:                uniqueID(),
 		},
 		deps:            modules.ProdDependencies,
@@ -463,6 +565,7 @@ func (sf *SiaFile) chunkHealth(chunk chunk, offlineMap map[string]bool, goodForR
 	// Find the good pieces that are good for renew
 	goodPieces, _ := sf.goodPieces(chunk, offlineMap, goodForRenewMap)
 	chunkHealth := CalculateHealth(int(goodPieces), minPieces, numPieces)
+	chunkHealth = ScaleHealth(chunkHealth, sf.staticMetadata.RepairThreshold, minPieces, numPieces)
 	// Handle health of incomplete partial chunk.
 	if sf.isIncompletePartialChunk(uint64(chunk.Index)) {
 		return chunkHealth, 0, 0, nil // Partial chunk has full health if not yet included in combined chunk
@@ -1509,3 +1509,167 @@ func TestCalculateHealth(t *testing.T) {
 	}()
 	checkHealth(0, 0, 0, 0)
 }
+
+// TestRepairThreshold tests that the repair threshold of a file is used to
+// determine whether its chunks need to be repaired.
+func TestRepairThreshold(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a 2-of-10 file.
+	rc, err := modules.NewRSCode(2, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaFilePath, _, source, rc, sk, fileSize, numChunks, fileMode := newTestFileParamsWithRC(1, false, rc)
+	sf, wal, _ := customTestFileAndWAL(siaFilePath, source, rc, sk, fileSize, numChunks, fileMode)
+
+	// Upload 5 pieces of the first chunk to good hosts which results in a
+	// redundancy of 2.5x.
+	offlineMap := make(map[string]bool)
+	goodForRenewMap := make(map[string]bool)
+	for pieceIndex := uint64(0); pieceIndex < 5; pieceIndex++ {
+		spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)}
+		offlineMap[spk.String()] = false
+		goodForRenewMap[spk.String()] = true
+		if err := sf.AddPiece(spk, 0, pieceIndex, crypto.Hash{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chunkHealth := func() float64 {
+		t.Helper()
+		h, _, _, err := sf.ChunkHealth(0, offlineMap, goodForRenewMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	// With the default threshold the chunk needs to be repaired.
+	if h := chunkHealth(); h != CalculateHealth(5, 2, 10) || !modules.NeedsRepair(h) {
+		t.Fatal("chunk should need repair with the default threshold", h)
+	}
+
+	// Thresholds that can't be reached are rejected.
+	for _, threshold := range []float64{-1, 0.5, 1, 5.01, math.NaN()} {
+		if err := sf.SetRepairThreshold(threshold); !errors.Contains(err, ErrInvalidRepairThreshold) {
+			t.Fatalf("threshold %v: expected ErrInvalidRepairThreshold, got %v", threshold, err)
+		}
+	}
+
+	// A threshold below the current redundancy doesn't require a repair.
+	if err := sf.SetRepairThreshold(2); err != nil {
+		t.Fatal(err)
+	}
+	if h := chunkHealth(); modules.NeedsRepair(h) {
+		t.Fatal("chunk shouldn't need repair", h)
+	}
+	// A threshold at the current redundancy does.
+	if err := sf.SetRepairThreshold(2.5); err != nil {
+		t.Fatal(err)
+	}
+	if h := chunkHealth(); h != modules.RepairThreshold {
+		t.Fatalf("expected health %v, got %v", modules.RepairThreshold, h)
+	}
+	// A threshold above the current redundancy does too and the chunk is more
+	// urgent.
+	if err := sf.SetRepairThreshold(4); err != nil {
+		t.Fatal(err)
+	}
+	h := chunkHealth()
+	if !modules.NeedsRepair(h) || h <= modules.RepairThreshold {
+		t.Fatal("chunk should need repair", h)
+	}
+	// Chunks without any pieces are still the most urgent.
+	h1, _, _, err := sf.ChunkHealth(1, offlineMap, goodForRenewMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != CalculateHealth(0, 2, 10) {
+		t.Fatal("health of unrecoverable chunk shouldn't be scaled", h1)
+	}
+
+	// The threshold is persisted.
+	sf2, err := LoadSiaFile(sf.SiaFilePath(), wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf2.RepairThreshold() != 4 {
+		t.Fatal("threshold wasn't persisted", sf2.RepairThreshold())
+	}
+}
+
+// TestPlanSectorPacking tests packing pieces of different sizes into sectors.
+func TestPlanSectorPacking(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pieceSize uint64
+		overhead  uint64
+		packing   SectorPacking
+		err       error
+	}{
+		// pieces that fill a sector
+		{modules.SectorSize, 0, SectorPacking{modules.SectorSize, 1, 0}, nil},
+		{modules.SectorSize - 28, 28, SectorPacking{modules.SectorSize, 1, 0}, nil},
+		// pieces that divide the sector evenly
+		{modules.SectorSize / 4, 0, SectorPacking{modules.SectorSize / 4, 4, 0}, nil},
+		{modules.SectorSize/2 - 28, 28, SectorPacking{modules.SectorSize / 2, 2, 0}, nil},
+		// pieces that leave a remainder
+		{modules.SectorSize/2 + 1, 0, SectorPacking{modules.SectorSize/2 + 1, 1, modules.SectorSize/2 - 1}, nil},
+		{modules.SectorSize / 3, 1, SectorPacking{modules.SectorSize/3 + 1, 2, modules.SectorSize - 2*(modules.SectorSize/3+1)}, nil},
+		// pieces that exceed the sector size
+		{modules.SectorSize + 1, 0, SectorPacking{}, ErrPieceExceedsSectorSize},
+		{modules.SectorSize - 27, 28, SectorPacking{}, ErrPieceExceedsSectorSize},
+		{math.MaxUint64, 1, SectorPacking{}, ErrPieceExceedsSectorSize},
+		// empty pieces
+		{0, 0, SectorPacking{}, ErrInvalidPieceSize},
+	}
+	for i, test := range tests {
+		packing, err := PlanSectorPacking(test.pieceSize, test.overhead)
+		if (err == nil) != (test.err == nil) || (err != nil && !errors.Contains(err, test.err)) {
+			t.Fatalf("%v: expected error %v but got %v", i, test.err, err)
+		}
+		if packing != test.packing {
+			t.Fatalf("%v: expected packing %v but got %v", i, test.packing, packing)
+		}
+		if err == nil && packing.PiecesPerSector*packing.PieceSize+packing.Padding != modules.SectorSize {
+			t.Fatalf("%v: packing doesn't add up to the sector size", i)
+		}
+	}
+}
+
+// TestSectorPackingSectorRange tests translating ranges within pieces into
+// ranges within sectors.
+func TestSectorPackingSectorRange(t *testing.T) {
+	t.Parallel()
+
+	pieceSize := modules.SectorSize/3 + 1
+	packing, err := PlanSectorPacking(pieceSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first slot starts at the beginning of the sector
+	offset, length, err := packing.SectorRange(0, 64, 128)
+	if err != nil || offset != 64 || length != 128 {
+		t.Fatal("unexpected range", offset, length, err)
+	}
+	// the second slot doesn't overlap with the first one
+	offset, length, err = packing.SectorRange(1, 0, pieceSize)
+	if err != nil || offset != pieceSize || length != pieceSize {
+		t.Fatal("unexpected range", offset, length, err)
+	}
+	// the padding isn't part of a slot
+	if _, _, err := packing.SectorRange(packing.PiecesPerSector, 0, 1); err == nil {
+		t.Fatal("expected out of bounds slot to fail")
+	}
+	// ranges can't exceed the piece
+	if _, _, err := packing.SectorRange(0, 1, pieceSize); err == nil {
+		t.Fatal("expected range exceeding the piece to fail")
+	}
+	if _, _, err := packing.SectorRange(0, math.MaxUint64, 2); err == nil {
+		t.Fatal("expected overflowing range to fail")
+	}
+}
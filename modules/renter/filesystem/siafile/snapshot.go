@@ -21,6 +21,8 @@ type (
 		staticChunks          []Chunk
 		staticFileSize        int64
 		staticPieceSize       uint64
+		staticChunkSize       uint64
+		staticSectorPacking   SectorPacking
 		staticErasureCode     modules.ErasureCoder
 		staticHasPartialChunk bool
 		staticMasterKey       crypto.CipherKey
@@ -110,7 +112,7 @@ func (s *Snapshot) ChunkIndexByOffset(offset uint64) (chunkIndex uint64, off uin
 
 // ChunkSize returns the size of a single chunk of the file.
 func (s *Snapshot) ChunkSize() uint64 {
-	return s.staticPieceSize * uint64(s.staticErasureCode.MinPieces())
+	return s.staticChunkSize
 }
 
 // PartialChunks returns the snapshot's PartialChunks.
@@ -179,6 +181,11 @@ func (s *Snapshot) PieceSize() uint64 {
 	return s.staticPieceSize
 }
 
+// SectorPacking returns how the pieces of the file are packed into sectors.
+func (s *Snapshot) SectorPacking() SectorPacking {
+	return s.staticSectorPacking
+}
+
 // SiaPath returns the SiaPath of the file.
 func (s *Snapshot) SiaPath() modules.SiaPath {
 	return s.staticSiaPath
@@ -287,6 +294,8 @@ func (sf *SiaFile) readlockSnapshot(sp modules.SiaPath, chunks []chunk) (*Snapsh
 		staticHasPartialChunk: hasPartial,
 		staticFileSize:        fileSize,
 		staticPieceSize:       sf.staticMetadata.StaticPieceSize,
+		staticChunkSize:       sf.staticMetadata.StaticChunkSize,
+		staticSectorPacking:   sf.staticMetadata.staticSectorPacking(),
 		staticErasureCode:     sf.staticMetadata.staticErasureCode,
 		staticMasterKey:       mk,
 		staticMode:            mode,
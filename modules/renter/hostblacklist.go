@@ -0,0 +1,136 @@
+package renter
+
+// hostblacklist contains the renter's host blacklist. Hosts on the blacklist
+// are permanently excluded from uploads and downloads. In contrast to the
+// hostdb's filter mode, the renter's contracts with blacklisted hosts are not
+// affected, the hosts are only skipped when selecting hosts for uploading and
+// downloading data. The blacklist is persisted in the renter's settings.
+
+import (
+	"sync"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/types"
+)
+
+var (
+	// ErrHostNotBlacklisted is returned when trying to remove a host from the
+	// blacklist that is not blacklisted.
+	ErrHostNotBlacklisted = errors.New("host is not blacklisted")
+)
+
+// hostBlacklist is a thread-safe set of blacklisted hosts.
+type hostBlacklist struct {
+	hosts map[string]types.SiaPublicKey
+	mu    sync.Mutex
+}
+
+// newHostBlacklist creates a new, empty blacklist.
+func newHostBlacklist() *hostBlacklist {
+	return &hostBlacklist{
+		hosts: make(map[string]types.SiaPublicKey),
+	}
+}
+
+// callAdd adds a host to the blacklist and returns the updated list of
+// blacklisted hosts.
+func (hb *hostBlacklist) callAdd(spk types.SiaPublicKey) []types.SiaPublicKey {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.hosts[spk.String()] = spk
+	return hb.keys()
+}
+
+// callContains returns whether the host with the given key is blacklisted.
+func (hb *hostBlacklist) callContains(hostKey string) bool {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	_, exists := hb.hosts[hostKey]
+	return exists
+}
+
+// callFilter removes all blacklisted hosts from the provided map of host keys.
+func (hb *hostBlacklist) callFilter(hosts map[string]struct{}) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	for hostKey := range hb.hosts {
+		delete(hosts, hostKey)
+	}
+}
+
+// callKeys returns the keys of all blacklisted hosts.
+func (hb *hostBlacklist) callKeys() []types.SiaPublicKey {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return hb.keys()
+}
+
+// callRemove removes a host from the blacklist and returns the updated list of
+// blacklisted hosts.
+func (hb *hostBlacklist) callRemove(spk types.SiaPublicKey) ([]types.SiaPublicKey, error) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if _, exists := hb.hosts[spk.String()]; !exists {
+		return nil, ErrHostNotBlacklisted
+	}
+	delete(hb.hosts, spk.String())
+	return hb.keys(), nil
+}
+
+// callSet replaces the blacklist with the provided hosts.
+func (hb *hostBlacklist) callSet(spks []types.SiaPublicKey) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.hosts = make(map[string]types.SiaPublicKey, len(spks))
+	for _, spk := range spks {
+		hb.hosts[spk.String()] = spk
+	}
+}
+
+// keys returns the keys of all blacklisted hosts.
+func (hb *hostBlacklist) keys() []types.SiaPublicKey {
+	spks := make([]types.SiaPublicKey, 0, len(hb.hosts))
+	for _, spk := range hb.hosts {
+		spks = append(spks, spk)
+	}
+	return spks
+}
+
+// AddToBlacklist adds a host to the renter's blacklist. Blacklisted hosts are
+// not used for uploads and downloads.
+func (r *Renter) AddToBlacklist(spk types.SiaPublicKey) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.HostBlacklist = r.staticHostBlacklist.callAdd(spk)
+	return r.saveSync()
+}
+
+// Blacklist returns the hosts on the renter's blacklist.
+func (r *Renter) Blacklist() ([]types.SiaPublicKey, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	return r.staticHostBlacklist.callKeys(), nil
+}
+
+// RemoveFromBlacklist removes a host from the renter's blacklist.
+func (r *Renter) RemoveFromBlacklist(spk types.SiaPublicKey) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	hosts, err := r.staticHostBlacklist.callRemove(spk)
+	if err != nil {
+		return err
+	}
+	r.persist.HostBlacklist = hosts
+	return r.saveSync()
+}
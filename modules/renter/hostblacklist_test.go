@@ -0,0 +1,121 @@
+package renter
+
+import (
+	"testing"
+
+	"go.sia.tech/siad/types"
+)
+
+// TestHostBlacklistFilter tests that blacklisted hosts are removed from the
+// hosts used for uploading and downloading.
+func TestHostBlacklistFilter(t *testing.T) {
+	t.Parallel()
+
+	hb := newHostBlacklist()
+	spk1 := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1}}
+	spk2 := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{2}}
+	spk3 := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{3}}
+
+	// Blacklist the first host.
+	if keys := hb.callAdd(spk1); len(keys) != 1 {
+		t.Fatal("expected 1 blacklisted host, got", len(keys))
+	}
+	if !hb.callContains(spk1.String()) || hb.callContains(spk2.String()) {
+		t.Fatal("wrong hosts blacklisted")
+	}
+
+	// Filter a set of hosts.
+	hosts := map[string]struct{}{
+		spk1.String(): {},
+		spk2.String(): {},
+		spk3.String(): {},
+	}
+	hb.callFilter(hosts)
+	if len(hosts) != 2 {
+		t.Fatal("expected 2 hosts, got", len(hosts))
+	}
+	if _, exists := hosts[spk1.String()]; exists {
+		t.Fatal("blacklisted host wasn't filtered")
+	}
+
+	// Removing a host that isn't blacklisted should fail.
+	if _, err := hb.callRemove(spk2); err != ErrHostNotBlacklisted {
+		t.Fatal("expected ErrHostNotBlacklisted, got", err)
+	}
+	keys, err := hb.callRemove(spk1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 || hb.callContains(spk1.String()) {
+		t.Fatal("host wasn't removed from the blacklist")
+	}
+
+	// Replace the blacklist.
+	hb.callSet([]types.SiaPublicKey{spk2, spk3})
+	if len(hb.callKeys()) != 2 || !hb.callContains(spk2.String()) || !hb.callContains(spk3.String()) {
+		t.Fatal("blacklist wasn't set")
+	}
+}
+
+// TestRenterHostBlacklist tests adding and removing hosts from the renter's
+// blacklist and that the blacklist is persisted.
+func TestRenterHostBlacklist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// The blacklist should be empty.
+	bl, err := rt.renter.Blacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bl) != 0 {
+		t.Fatal("expected empty blacklist, got", len(bl))
+	}
+
+	// Blacklist a host and restart the renter.
+	spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{1, 2, 3}}
+	if err := rt.renter.AddToBlacklist(spk); err != nil {
+		t.Fatal(err)
+	}
+	r, err := rt.reloadRenter(rt.renter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host should still be blacklisted.
+	bl, err = r.Blacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bl) != 1 || !bl[0].Equals(spk) {
+		t.Fatal("blacklist wasn't persisted", bl)
+	}
+	if !r.staticHostBlacklist.callContains(spk.String()) {
+		t.Fatal("host isn't blacklisted")
+	}
+
+	// Remove the host.
+	if err := r.RemoveFromBlacklist(spk); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemoveFromBlacklist(spk); err != ErrHostNotBlacklisted {
+		t.Fatal("expected ErrHostNotBlacklisted, got", err)
+	}
+	bl, err = r.Blacklist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bl) != 0 {
+		t.Fatal("expected empty blacklist, got", len(bl))
+	}
+}
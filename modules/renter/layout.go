@@ -0,0 +1,102 @@
+package renter
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
+)
+
+var (
+	// ErrLayoutPartialChunks is returned when the layout of a file with partial
+	// chunks is requested. Partial chunks are not stored in the file's piece
+	// table.
+	ErrLayoutPartialChunks = errors.New("the layout of files with partial chunks can't be computed")
+)
+
+// FileLayout returns the layout of the file at the given siaPath. The layout is
+// computed from the file's metadata without contacting any hosts.
+func (r *Renter) FileLayout(siaPath modules.SiaPath) (modules.FileLayout, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.FileLayout{}, err
+	}
+	defer r.tg.Done()
+
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return modules.FileLayout{}, errors.AddContext(err, "failed to open file")
+	}
+	snap, err := entry.Snapshot(siaPath)
+	err = errors.Compose(err, entry.Close())
+	if err != nil {
+		return modules.FileLayout{}, errors.AddContext(err, "failed to get snapshot")
+	}
+	return newFileLayout(snap)
+}
+
+// newFileLayout computes the layout of the file from a snapshot. The pieces of
+// every chunk are sorted by piece index and host key to make the layout
+// deterministic.
+func newFileLayout(snap *siafile.Snapshot) (modules.FileLayout, error) {
+	ec := snap.ErasureCode()
+	ecType := ec.Type()
+	segmentSize, _ := ec.SupportsPartialEncoding()
+	chunkSize := snap.ChunkSize()
+	fl := modules.FileLayout{
+		Version:    modules.FileLayoutVersion,
+		SiaPath:    snap.SiaPath(),
+		Filesize:   snap.Size(),
+		ChunkSize:  chunkSize,
+		PieceSize:  snap.PieceSize(),
+		SectorSize: modules.SectorSize,
+		CipherType: snap.MasterKey().Type().String(),
+		ErasureCode: modules.FileLayoutErasureCode{
+			Type:         binary.BigEndian.Uint32(ecType[:]),
+			DataPieces:   uint64(ec.MinPieces()),
+			ParityPieces: uint64(ec.NumPieces() - ec.MinPieces()),
+			SegmentSize:  segmentSize,
+		},
+		Chunks: make([]modules.FileLayoutChunk, 0, snap.NumChunks()),
+	}
+	if snap.NumChunks() > 0 {
+		fl.FinalChunkPadding = snap.NumChunks()*chunkSize - fl.Filesize
+	}
+	for chunkIndex := uint64(0); chunkIndex < snap.NumChunks(); chunkIndex++ {
+		_, included := snap.IsIncludedPartialChunk(chunkIndex)
+		if included || snap.IsIncompletePartialChunk(chunkIndex) {
+			return modules.FileLayout{}, ErrLayoutPartialChunks
+		}
+		offset := chunkIndex * chunkSize
+		length := chunkSize
+		if remaining := fl.Filesize - offset; remaining < length {
+			length = remaining
+		}
+		chunk := modules.FileLayoutChunk{
+			Index:  chunkIndex,
+			Offset: offset,
+			Length: length,
+			Pieces: []modules.FileLayoutPiece{},
+		}
+		for pieceIndex, pieceSet := range snap.Pieces(chunkIndex) {
+			for _, piece := range pieceSet {
+				chunk.Pieces = append(chunk.Pieces, modules.FileLayoutPiece{
+					PieceIndex:    uint64(pieceIndex),
+					HostPublicKey: piece.HostPubKey.String(),
+					SectorRoot:    piece.MerkleRoot,
+				})
+			}
+		}
+		sort.SliceStable(chunk.Pieces, func(i, j int) bool {
+			pi, pj := chunk.Pieces[i], chunk.Pieces[j]
+			if pi.PieceIndex != pj.PieceIndex {
+				return pi.PieceIndex < pj.PieceIndex
+			}
+			return pi.HostPublicKey < pj.HostPublicKey
+		})
+		fl.Chunks = append(fl.Chunks, chunk)
+	}
+	return fl, nil
+}
@@ -0,0 +1,205 @@
+package renter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/writeaheadlog"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
+	"go.sia.tech/siad/types"
+)
+
+const (
+	// goldenLayoutJSON is the expected JSON encoding of the layout computed in
+	// TestFileLayoutGolden. The sizes depend on the build and are filled in by
+	// the test. It must not change without increasing FileLayoutVersion.
+	goldenLayoutJSON = `{"version":1,"siapath":"dir/file","filesize":%[1]d,"chunksize":%[2]d,"piecesize":%[3]d,"sectorsize":%[3]d,"finalchunkpadding":%[4]d,"ciphertype":"plaintext","erasurecode":{"type":2,"datapieces":2,"paritypieces":1,"segmentsize":64},"chunks":[{"index":0,"offset":0,"length":%[2]d,"pieces":[{"pieceindex":0,"hostpublickey":"ed25519:0101010101010101010101010101010101010101010101010101010101010101","sectorroot":"0100000000000000000000000000000000000000000000000000000000000000","offset":0},{"pieceindex":0,"hostpublickey":"ed25519:0202020202020202020202020202020202020202020202020202020202020202","sectorroot":"0200000000000000000000000000000000000000000000000000000000000000","offset":0},{"pieceindex":1,"hostpublickey":"ed25519:0202020202020202020202020202020202020202020202020202020202020202","sectorroot":"0300000000000000000000000000000000000000000000000000000000000000","offset":0}]},{"index":1,"offset":%[2]d,"length":10,"pieces":[{"pieceindex":2,"hostpublickey":"ed25519:0101010101010101010101010101010101010101010101010101010101010101","sectorroot":"0400000000000000000000000000000000000000000000000000000000000000","offset":0}]}]}`
+)
+
+// newTestLayoutFile creates a siafile with the given erasure code, key and size
+// for testing the file layout.
+func newTestLayoutFile(t *testing.T, ec modules.ErasureCoder, sk crypto.CipherKey, fileSize uint64) *siafile.SiaFile {
+	t.Helper()
+	dir := build.TempDir("renter", t.Name())
+	if err := os.MkdirAll(dir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	_, wal, err := writeaheadlog.New(filepath.Join(dir, "wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := siafile.New(filepath.Join(dir, "file"+modules.SiaFileExtension), "", wal, ec, sk, fileSize, modules.DefaultFilePerm, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sf
+}
+
+// TestFileLayoutGolden verifies that the layout format doesn't change.
+func TestFileLayoutGolden(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	ec, err := modules.NewRSSubCode(2, 1, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := crypto.GenerateSiaKey(crypto.TypePlain)
+	pieceSize := modules.SectorSize - sk.Type().Overhead()
+	chunkSize := pieceSize * uint64(ec.MinPieces())
+	fileSize := chunkSize + 10
+	sf := newTestLayoutFile(t, ec, sk, fileSize)
+
+	// Add the pieces out of order to check that they are sorted.
+	hostA := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: bytes.Repeat([]byte{1}, crypto.PublicKeySize)}
+	hostB := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: bytes.Repeat([]byte{2}, crypto.PublicKeySize)}
+	pieces := []struct {
+		host       types.SiaPublicKey
+		chunkIndex uint64
+		pieceIndex uint64
+		root       crypto.Hash
+	}{
+		{hostB, 0, 1, crypto.Hash{3}},
+		{hostB, 0, 0, crypto.Hash{2}},
+		{hostA, 0, 0, crypto.Hash{1}},
+		{hostA, 1, 2, crypto.Hash{4}},
+	}
+	for _, p := range pieces {
+		if err := sf.AddPiece(p.host, p.chunkIndex, p.pieceIndex, p.root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := sf.Snapshot(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := newFileLayout(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(fl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := fmt.Sprintf(goldenLayoutJSON, fileSize, chunkSize, pieceSize, chunkSize-10)
+	if string(b) != golden {
+		t.Fatalf("layout doesn't match golden JSON\n%v\n%v", string(b), golden)
+	}
+	// The JSON should decode to the same layout.
+	var fl2 modules.FileLayout
+	if err := json.Unmarshal(b, &fl2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fl, fl2) {
+		t.Fatal("layout changed after decoding")
+	}
+}
+
+// TestFileLayoutDownload verifies that a file can be recovered using only its
+// layout, its master key and the sectors stored on the hosts.
+func TestFileLayoutDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	ec, err := modules.NewRSSubCode(2, 2, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	pieceSize := modules.SectorSize - sk.Type().Overhead()
+	chunkSize := pieceSize * uint64(ec.MinPieces())
+	data := fastrand.Bytes(int(2*chunkSize + chunkSize/2))
+	sf := newTestLayoutFile(t, ec, sk, uint64(len(data)))
+
+	// Upload the file to the test hosts. Every piece is stored on its own host
+	// and the first piece of every chunk is lost to force the recovery to use
+	// a parity piece.
+	sectors := make(map[crypto.Hash][]byte)
+	hosts := make([]types.SiaPublicKey, ec.NumPieces())
+	for i := range hosts {
+		hosts[i] = types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(crypto.PublicKeySize)}
+	}
+	for chunkIndex := uint64(0); chunkIndex < sf.NumChunks(); chunkIndex++ {
+		offset := chunkIndex * chunkSize
+		end := offset + chunkSize
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		dataPieces, _, err := readDataPieces(bytes.NewReader(data[offset:end]), ec, pieceSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logicalChunkData, err := ec.EncodeShards(dataPieces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pieceIndex := 1; pieceIndex < len(logicalChunkData); pieceIndex++ {
+			padAndEncryptPiece(chunkIndex, uint64(pieceIndex), logicalChunkData, sk)
+			root := crypto.MerkleRoot(logicalChunkData[pieceIndex])
+			sectors[root] = logicalChunkData[pieceIndex]
+			if err := sf.AddPiece(hosts[pieceIndex], chunkIndex, uint64(pieceIndex), root); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	siaPath, err := modules.NewSiaPath("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := sf.Snapshot(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := newFileLayout(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the file using only the layout.
+	numPieces := int(fl.ErasureCode.DataPieces + fl.ErasureCode.ParityPieces)
+	var downloaded bytes.Buffer
+	for _, chunk := range fl.Chunks {
+		pieces := make([][]byte, numPieces)
+		for _, lp := range chunk.Pieces {
+			sector, exists := sectors[lp.SectorRoot]
+			if !exists {
+				t.Fatal("unknown sector", lp.SectorRoot)
+			}
+			key := sk.Derive(chunk.Index, lp.PieceIndex)
+			piece, err := key.DecryptBytesInPlace(append([]byte(nil), sector...), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pieces[lp.PieceIndex] = piece[lp.Offset:][:fl.PieceSize]
+		}
+		if err := ec.Recover(pieces, chunk.Length, &downloaded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(downloaded.Bytes(), data) {
+		t.Fatal("downloaded data doesn't match the original data")
+	}
+	if fl.FinalChunkPadding != chunkSize/2 {
+		t.Fatalf("expected padding %v, got %v", chunkSize/2, fl.FinalChunkPadding)
+	}
+}
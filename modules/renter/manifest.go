@@ -0,0 +1,119 @@
+package renter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
+)
+
+var (
+	// ErrManifestMissingChunks is returned when a manifest is requested for a
+	// file that has chunks which can't be recovered.
+	ErrManifestMissingChunks = errors.New("file has missing chunks")
+
+	// ErrManifestRequiresStream is returned when a manifest is requested
+	// without streaming the file. The file's metadata doesn't contain the
+	// hashes of the plaintext, so the file needs to be streamed to compute
+	// them.
+	ErrManifestRequiresStream = errors.New("plaintext hashes are not available in the file's metadata, the file needs to be streamed to compute the manifest")
+)
+
+// FileManifest returns the checksum manifest of the file at the given siaPath.
+// The siafile metadata doesn't contain the hashes of the plaintext, so the
+// whole file needs to be downloaded through the regular download path to
+// compute them. Since that is expensive, ErrManifestRequiresStream is returned
+// unless stream is set.
+func (r *Renter) FileManifest(siaPath modules.SiaPath, stream bool) (modules.FileManifest, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.FileManifest{}, err
+	}
+	defer r.tg.Done()
+
+	// Check that all of the file's chunks are recoverable.
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return modules.FileManifest{}, errors.AddContext(err, "failed to open file")
+	}
+	snap, err := entry.Snapshot(siaPath)
+	err = errors.Compose(err, entry.Close())
+	if err != nil {
+		return modules.FileManifest{}, errors.AddContext(err, "failed to get snapshot")
+	}
+	if missing := missingChunks(snap); len(missing) > 0 {
+		return modules.FileManifest{}, errors.AddContext(ErrManifestMissingChunks, fmt.Sprintf("missing chunks %v", missing))
+	}
+	if !stream {
+		return modules.FileManifest{}, ErrManifestRequiresStream
+	}
+
+	// Stream the file to compute the hashes.
+	_, streamer, err := r.Streamer(siaPath, false)
+	if err != nil {
+		return modules.FileManifest{}, errors.AddContext(err, "failed to create streamer")
+	}
+	fm, err := newFileManifest(siaPath, snap.Size(), snap.ChunkSize(), streamer)
+	err = errors.Compose(err, streamer.Close())
+	if err != nil {
+		return modules.FileManifest{}, errors.AddContext(err, "failed to compute manifest")
+	}
+	return fm, nil
+}
+
+// missingChunks returns the indices of the chunks of a snapshot that don't
+// have enough pieces to be recovered.
+func missingChunks(snap *siafile.Snapshot) []uint64 {
+	var missing []uint64
+	minPieces := snap.ErasureCode().MinPieces()
+	for chunkIndex := uint64(0); chunkIndex < snap.NumChunks(); chunkIndex++ {
+		numPieces := 0
+		for _, pieceSet := range snap.Pieces(chunkIndex) {
+			if len(pieceSet) > 0 {
+				numPieces++
+			}
+		}
+		if numPieces < minPieces {
+			missing = append(missing, chunkIndex)
+		}
+	}
+	return missing
+}
+
+// newFileManifest computes the manifest of a file with the given size by
+// reading its plaintext from r one chunk at a time.
+func newFileManifest(siaPath modules.SiaPath, fileSize, chunkSize uint64, r io.Reader) (modules.FileManifest, error) {
+	if chunkSize == 0 {
+		return modules.FileManifest{}, errors.New("chunk size can't be zero")
+	}
+	fm := modules.FileManifest{
+		SiaPath:   siaPath,
+		Filesize:  fileSize,
+		ChunkSize: chunkSize,
+		Chunks:    make([]modules.FileManifestChunk, 0, (fileSize+chunkSize-1)/chunkSize),
+	}
+	fileHash := sha256.New()
+	for offset := uint64(0); offset < fileSize; offset += chunkSize {
+		length := chunkSize
+		if remaining := fileSize - offset; remaining < length {
+			length = remaining
+		}
+		chunkHash := sha256.New()
+		_, err := io.CopyN(io.MultiWriter(chunkHash, fileHash), r, int64(length))
+		if err != nil {
+			return modules.FileManifest{}, errors.AddContext(err, fmt.Sprintf("failed to read chunk at offset %v", offset))
+		}
+		fm.Chunks = append(fm.Chunks, modules.FileManifestChunk{
+			Index:  offset / chunkSize,
+			Offset: offset,
+			Length: length,
+			SHA256: hex.EncodeToString(chunkHash.Sum(nil)),
+		})
+	}
+	fm.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+	return fm, nil
+}
@@ -0,0 +1,166 @@
+package renter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/writeaheadlog"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
+	"go.sia.tech/siad/persist"
+	"go.sia.tech/siad/types"
+)
+
+const (
+	// goldenManifestJSON is the expected JSON encoding of the manifest
+	// computed in TestFileManifestGolden. It must not change across releases.
+	goldenManifestJSON = `{"siapath":"dir/file","filesize":10,"chunksize":4,"sha256":"1f825aa2f0020ef7cf91dfa30da4668d791c5d4824fc8e41354b89ec05795ab3","chunks":[{"index":0,"offset":0,"length":4,"sha256":"054edec1d0211f624fed0cbca9d4f9400b0e491c43742af2c5b0abebf0c990d8"},{"index":1,"offset":4,"length":4,"sha256":"c6d44cf418f610e3fe9e1d9294ff43def81c6cdcad6cbb1820cff48d3aa4355d"},{"index":2,"offset":8,"length":2,"sha256":"73907589101a7e8ab83178e7db2997aab7272cd02d364e8e3ecc2beccda4b631"}]}`
+
+	// goldenManifestSHA256Sums is the expected sha256sum compatible text form
+	// of the manifest computed in TestFileManifestGolden.
+	goldenManifestSHA256Sums = `1f825aa2f0020ef7cf91dfa30da4668d791c5d4824fc8e41354b89ec05795ab3  file
+054edec1d0211f624fed0cbca9d4f9400b0e491c43742af2c5b0abebf0c990d8  file.chunk0
+c6d44cf418f610e3fe9e1d9294ff43def81c6cdcad6cbb1820cff48d3aa4355d  file.chunk1
+73907589101a7e8ab83178e7db2997aab7272cd02d364e8e3ecc2beccda4b631  file.chunk2
+`
+)
+
+// TestFileManifestGolden verifies that the manifest format doesn't change.
+func TestFileManifestGolden(t *testing.T) {
+	t.Parallel()
+
+	siaPath, err := modules.NewSiaPath("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	fm, err := newFileManifest(siaPath, uint64(len(data)), 4, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the JSON form.
+	b, err := json.Marshal(fm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != goldenManifestJSON {
+		t.Fatalf("manifest doesn't match golden JSON\n%v\n%v", string(b), goldenManifestJSON)
+	}
+	// Check the text form.
+	if sums := fm.SHA256Sums(); sums != goldenManifestSHA256Sums {
+		t.Fatalf("manifest doesn't match golden text\n%v\n%v", sums, goldenManifestSHA256Sums)
+	}
+	// The JSON should decode to the same manifest.
+	var fm2 modules.FileManifest
+	if err := json.Unmarshal(b, &fm2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fm, fm2) {
+		t.Fatal("manifest changed after decoding")
+	}
+
+	// A reader that is too short should result in an error.
+	_, err = newFileManifest(siaPath, uint64(len(data)), 4, bytes.NewReader(data[:9]))
+	if err == nil {
+		t.Fatal("expected error for short reader")
+	}
+}
+
+// TestMissingChunks verifies that missingChunks returns the indices of the
+// chunks that don't have enough pieces to be recovered.
+func TestMissingChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a siafile with 3 chunks.
+	dir := build.TempDir("renter", t.Name())
+	if err := os.MkdirAll(dir, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	_, wal, err := writeaheadlog.New(filepath.Join(dir, "wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := modules.NewRSSubCode(2, 1, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := crypto.GenerateSiaKey(crypto.TypePlain)
+	fileSize := 3 * modules.SectorSize * uint64(ec.MinPieces())
+	sf, err := siafile.New(filepath.Join(dir, "file"+modules.SiaFileExtension), "", wal, ec, sk, fileSize, modules.DefaultFilePerm, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := modules.NewSiaPath("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Give chunk 0 all pieces, chunk 1 enough pieces and chunk 2 only a
+	// single piece.
+	addPieces := func(chunkIndex uint64, numPieces int) {
+		for pieceIndex := 0; pieceIndex < numPieces; pieceIndex++ {
+			pk := types.SiaPublicKey{Key: fastrand.Bytes(crypto.EntropySize)}
+			if err := sf.AddPiece(pk, chunkIndex, uint64(pieceIndex), crypto.Hash{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	addPieces(0, ec.NumPieces())
+	addPieces(1, ec.MinPieces())
+	addPieces(2, ec.MinPieces()-1)
+
+	snap, err := sf.Snapshot(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := missingChunks(snap); !reflect.DeepEqual(missing, []uint64{2}) {
+		t.Fatal("unexpected missing chunks", missing)
+	}
+}
+
+// TestFileManifestMissingChunks verifies that requesting the manifest of a
+// file without any uploaded pieces fails with ErrManifestMissingChunks.
+func TestFileManifestMissingChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create a file with 2 chunks without any hosts.
+	siaPath, ec := testingFileParamsCustom(1, 1)
+	chunkSize := modules.SectorSize * uint64(ec.MinPieces())
+	err = rt.renter.staticFileSystem.NewSiaFile(siaPath, "", ec, crypto.GenerateSiaKey(crypto.TypePlain), 2*chunkSize, persist.DefaultDiskPermissionsTest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.renter.FileManifest(siaPath, true)
+	if !errors.Contains(err, ErrManifestMissingChunks) {
+		t.Fatal("expected ErrManifestMissingChunks, got", err)
+	}
+	if !strings.Contains(err.Error(), "[0 1]") {
+		t.Fatal("error doesn't list the missing chunks", err)
+	}
+}
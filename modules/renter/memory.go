@@ -84,6 +84,10 @@ type memoryManager struct {
 	blocking chan struct{}
 	mu       sync.Mutex
 	stop     <-chan struct{}
+
+	// reclaim is called whenever a request blocks for memory. It allows
+	// caches which hold memory of the manager to release it.
+	reclaim func(amount uint64)
 }
 
 // memoryRequest is a single thread that is blocked while waiting for memory.
@@ -214,8 +218,15 @@ func (mm *memoryManager) Request(ctx context.Context, amount uint64, priority bo
 	} else {
 		el = mm.fifo.PushBack(myRequest)
 	}
+	reclaim := mm.reclaim
 	mm.mu.Unlock()
 
+	// Ask the caches to release their memory. This happens without holding
+	// the lock since returning the memory requires it.
+	if reclaim != nil {
+		reclaim(amount)
+	}
+
 	// Send a note that a thread is now blocking. This is only used in testing,
 	// to ensure that the test can have multiple threads blocking for memory
 	// which block in a determinstic order.
@@ -254,6 +265,28 @@ func (mm *memoryManager) Request(ctx context.Context, amount uint64, priority bo
 	}
 }
 
+// SetReclaimFunc sets the function which is called with the requested amount
+// of memory whenever a request has to block. Any previously set function is
+// replaced.
+func (mm *memoryManager) SetReclaimFunc(reclaim func(amount uint64)) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.reclaim = reclaim
+}
+
+// TryRequest is a non-blocking request for low priority memory. The memory is
+// only granted if no other requests are waiting and if granting it doesn't
+// dip into the priority reserve.
+func (mm *memoryManager) TryRequest(amount uint64) bool {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.fifo.Len() != 0 || mm.priorityFifo.Len() != 0 || mm.available < amount+mm.priorityReserve {
+		return false
+	}
+	mm.available -= amount
+	return true
+}
+
 // Return will return memory to the manager, waking any blocking threads which
 // now have enough memory to proceed.
 func (mm *memoryManager) Return(amount uint64) {
@@ -434,6 +434,11 @@ func (r *Renter) managedDirectoryMetadata(siaPath modules.SiaPath) (_ siadir.Met
 		return siadir.Metadata{}, fmt.Errorf("%v is not a directory", siaPath)
 	}
 
+	// Prefer the bubbled metadata which wasn't flushed yet.
+	if md, exists := r.staticFileSystem.BubbledMetadata(siaPath); exists {
+		return md, nil
+	}
+
 	//  Open SiaDir
 	siaDir, err := r.staticFileSystem.OpenSiaDirCustom(siaPath, true)
 	if err != nil {
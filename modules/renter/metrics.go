@@ -0,0 +1,136 @@
+package renter
+
+// metrics tracks the renter's upload and download throughput. The totals only
+// count data that was transferred to and from hosts, data served from disk is
+// not included. The bandwidth is a rolling average over the last
+// renterMetricsBandwidthWindow seconds.
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.sia.tech/siad/modules"
+)
+
+const (
+	// renterMetricsBandwidthWindow is the number of seconds over which the
+	// upload and download bandwidth is averaged.
+	renterMetricsBandwidthWindow = 60
+)
+
+type (
+	// renterMetrics contains the renter's throughput counters.
+	renterMetrics struct {
+		atomicBytesDownloaded uint64
+		atomicBytesUploaded   uint64
+		atomicActiveDownloads uint64
+
+		staticDownloadBandwidth *bandwidthTracker
+		staticUploadBandwidth   *bandwidthTracker
+	}
+
+	// bandwidthTracker computes the average number of bytes transferred per
+	// second over a rolling window. It uses one bucket per second.
+	bandwidthTracker struct {
+		buckets    []uint64
+		lastSecond int64
+		mu         sync.Mutex
+	}
+)
+
+// newRenterMetrics creates a new, empty renterMetrics object.
+func newRenterMetrics() *renterMetrics {
+	return &renterMetrics{
+		staticDownloadBandwidth: newBandwidthTracker(renterMetricsBandwidthWindow),
+		staticUploadBandwidth:   newBandwidthTracker(renterMetricsBandwidthWindow),
+	}
+}
+
+// newBandwidthTracker creates a tracker that averages over the given number of
+// seconds.
+func newBandwidthTracker(windowSeconds int) *bandwidthTracker {
+	return &bandwidthTracker{
+		buckets: make([]uint64, windowSeconds),
+	}
+}
+
+// callAddDownloaded records n bytes downloaded from a host.
+func (rm *renterMetrics) callAddDownloaded(n uint64) {
+	atomic.AddUint64(&rm.atomicBytesDownloaded, n)
+	rm.staticDownloadBandwidth.callAdd(n, time.Now())
+}
+
+// callAddUploaded records n bytes uploaded to a host.
+func (rm *renterMetrics) callAddUploaded(n uint64) {
+	atomic.AddUint64(&rm.atomicBytesUploaded, n)
+	rm.staticUploadBandwidth.callAdd(n, time.Now())
+}
+
+// callDownloadFinished marks a download as finished.
+func (rm *renterMetrics) callDownloadFinished() {
+	atomic.AddUint64(&rm.atomicActiveDownloads, ^uint64(0))
+}
+
+// callDownloadStarted marks a download as started.
+func (rm *renterMetrics) callDownloadStarted() {
+	atomic.AddUint64(&rm.atomicActiveDownloads, 1)
+}
+
+// callAdd records n bytes that were transferred at the given time.
+func (bt *bandwidthTracker) callAdd(n uint64, now time.Time) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	sec := now.Unix()
+	bt.advance(sec)
+	bt.buckets[sec%int64(len(bt.buckets))] += n
+}
+
+// callBytesPerSecond returns the average number of bytes transferred per
+// second within the window that ends at the given time.
+func (bt *bandwidthTracker) callBytesPerSecond(now time.Time) float64 {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	bt.advance(now.Unix())
+	var total uint64
+	for _, n := range bt.buckets {
+		total += n
+	}
+	return float64(total) / float64(len(bt.buckets))
+}
+
+// advance moves the window forward to the given second, clearing the buckets
+// of the seconds that dropped out of the window.
+func (bt *bandwidthTracker) advance(sec int64) {
+	if sec <= bt.lastSecond {
+		return
+	}
+	window := int64(len(bt.buckets))
+	if sec-bt.lastSecond >= window {
+		for i := range bt.buckets {
+			bt.buckets[i] = 0
+		}
+	} else {
+		for s := bt.lastSecond + 1; s <= sec; s++ {
+			bt.buckets[s%window] = 0
+		}
+	}
+	bt.lastSecond = sec
+}
+
+// Metrics returns the renter's upload and download throughput counters.
+func (r *Renter) Metrics() (modules.RenterMetrics, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.RenterMetrics{}, err
+	}
+	defer r.tg.Done()
+	now := time.Now()
+	return modules.RenterMetrics{
+		TotalBytesUploaded:   atomic.LoadUint64(&r.staticMetrics.atomicBytesUploaded),
+		TotalBytesDownloaded: atomic.LoadUint64(&r.staticMetrics.atomicBytesDownloaded),
+		ActiveUploads:        uint64(r.uploadHeap.managedNumRepairingChunks()),
+		ActiveDownloads:      atomic.LoadUint64(&r.staticMetrics.atomicActiveDownloads),
+		UploadBandwidthBps:   r.staticMetrics.staticUploadBandwidth.callBytesPerSecond(now),
+		DownloadBandwidthBps: r.staticMetrics.staticDownloadBandwidth.callBytesPerSecond(now),
+	}, nil
+}
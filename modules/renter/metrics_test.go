@@ -0,0 +1,81 @@
+package renter
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBandwidthTracker tests the rolling average of the bandwidthTracker.
+func TestBandwidthTracker(t *testing.T) {
+	t.Parallel()
+
+	bt := newBandwidthTracker(10)
+	start := time.Unix(1000, 0)
+	if bps := bt.callBytesPerSecond(start); bps != 0 {
+		t.Fatal("expected 0 bps, got", bps)
+	}
+
+	// Transfer 100 bytes per second for 5 seconds.
+	for i := 0; i < 5; i++ {
+		bt.callAdd(100, start.Add(time.Duration(i)*time.Second))
+	}
+	if bps := bt.callBytesPerSecond(start.Add(4 * time.Second)); bps != 50 {
+		t.Fatal("expected 50 bps, got", bps)
+	}
+	// Multiple transfers within the same second are added up.
+	bt.callAdd(500, start.Add(4*time.Second+time.Millisecond))
+	if bps := bt.callBytesPerSecond(start.Add(4 * time.Second)); bps != 100 {
+		t.Fatal("expected 100 bps, got", bps)
+	}
+	// The first seconds drop out of the window.
+	if bps := bt.callBytesPerSecond(start.Add(11 * time.Second)); bps != 80 {
+		t.Fatal("expected 80 bps, got", bps)
+	}
+	// After a full window without transfers the average is 0.
+	if bps := bt.callBytesPerSecond(start.Add(time.Minute)); bps != 0 {
+		t.Fatal("expected 0 bps, got", bps)
+	}
+	// Transfers in the past don't reset the window.
+	bt.callAdd(10, start)
+	if bps := bt.callBytesPerSecond(start.Add(time.Minute)); bps != 1 {
+		t.Fatal("expected 1 bps, got", bps)
+	}
+}
+
+// TestRenterMetricsCounters tests the counters of the renterMetrics.
+func TestRenterMetricsCounters(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	r.staticMetrics.callAddUploaded(100)
+	r.staticMetrics.callAddDownloaded(200)
+	r.staticMetrics.callDownloadStarted()
+	r.staticMetrics.callDownloadStarted()
+	r.staticMetrics.callDownloadFinished()
+	metrics, err := r.Metrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.TotalBytesUploaded != 100 || metrics.TotalBytesDownloaded != 200 {
+		t.Fatal("unexpected totals", metrics)
+	}
+	if metrics.ActiveDownloads != 1 || metrics.ActiveUploads != 0 {
+		t.Fatal("unexpected number of active transfers", metrics)
+	}
+	if metrics.UploadBandwidthBps <= 0 || metrics.DownloadBandwidthBps <= 0 {
+		t.Fatal("expected nonzero bandwidth", metrics)
+	}
+}
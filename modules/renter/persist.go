@@ -9,6 +9,7 @@ import (
 
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/modules/renter/filesystem"
+	"go.sia.tech/siad/modules/renter/filesystem/siadir"
 	"go.sia.tech/siad/modules/renter/filesystem/siafile"
 	"go.sia.tech/siad/persist"
 	"go.sia.tech/siad/types"
@@ -60,6 +61,28 @@ type (
 		MaxUploadSpeed   int64
 		UploadedBackups  []modules.UploadedBackup
 		SyncedContracts  []types.FileContractID
+
+		// DefaultDataPieces and DefaultParityPieces are the erasure code
+		// parameters used for uploads without an erasure code. If they are
+		// 0, modules.RenterDefaultDataPieces and
+		// modules.RenterDefaultParityPieces are used.
+		DefaultDataPieces   int
+		DefaultParityPieces int
+
+		// DefaultRepairThreshold is the repair threshold, expressed as a
+		// redundancy multiplier, that is applied to new files. 0 means that
+		// the built-in health based threshold is used.
+		DefaultRepairThreshold float64
+
+		// HostBlacklist contains the hosts which are excluded from uploads
+		// and downloads.
+		HostBlacklist []types.SiaPublicKey
+
+		// The download concurrency settings. Renters which persisted their
+		// settings before these fields were added keep the defaults.
+		DownloadOverdrive           int
+		MaxConcurrentDownloadChunks int
+		MaxDownloadWorkersPerChunk  int
 	}
 )
 
@@ -70,7 +93,11 @@ func (r *Renter) saveSync() error {
 
 // managedLoadSettings fetches the saved renter data from disk.
 func (r *Renter) managedLoadSettings() error {
-	r.persist = persistence{}
+	r.persist = persistence{
+		DownloadOverdrive:           DefaultDownloadOverdrive,
+		MaxConcurrentDownloadChunks: DefaultMaxConcurrentDownloadChunks,
+		MaxDownloadWorkersPerChunk:  DefaultMaxDownloadWorkersPerChunk,
+	}
 	err := persist.LoadJSON(settingsMetadata, &r.persist, filepath.Join(r.persistDir, PersistFilename))
 	if os.IsNotExist(err) {
 		// No persistence yet, set the defaults and continue.
@@ -108,6 +135,12 @@ func (r *Renter) managedLoadSettings() error {
 		return err
 	}
 
+	// Initialize the host blacklist.
+	r.staticHostBlacklist.callSet(r.persist.HostBlacklist)
+
+	// Initialize the download chunk limit.
+	r.staticDownloadChunkLimiter.callSetLimit(r.persist.MaxConcurrentDownloadChunks)
+
 	// Set the bandwidth limits on the contractor, which was already initialized
 	// without bandwidth limits.
 	return r.setBandwidthLimits(r.persist.MaxDownloadSpeed, r.persist.MaxUploadSpeed)
@@ -156,6 +189,11 @@ func (r *Renter) managedInitPersist() error {
 				if err := siafile.ApplyUpdates(update); err != nil {
 					return errors.AddContext(err, "failed to apply SiaFile update")
 				}
+			} else if siadir.IsSiaDirUpdate(update) {
+				r.log.Println("Applying a siadir update:", update.Name)
+				if err := siadir.ApplyUpdates(update); err != nil {
+					return errors.AddContext(err, "failed to apply SiaDir update")
+				}
 			} else {
 				r.log.Println("wal update not applied, marking transaction as not applied")
 				applyTxn = false
@@ -97,7 +97,7 @@ func (f *file) numChunks() uint64 {
 
 // staticChunkSize returns the size of one chunk.
 func (f *file) staticChunkSize() uint64 {
-	return f.pieceSize * uint64(f.erasureCode.MinPieces())
+	return f.erasureCode.ChunkSize(f.pieceSize)
 }
 
 // MarshalSia implements the encoding.SiaMarshaller interface, writing the
@@ -0,0 +1,204 @@
+package renter
+
+// pieceavailabilitycache implements a small TTL cache that remembers the result
+// of HasSector queries per host and sector root. Different downloads that share
+// chunks will ask the same hosts about the same roots, the cache makes sure
+// that only the first download pays for the lookup. Expired entries are evicted
+// when they are accessed and by a sweep over the whole cache which runs at
+// most once per TTL, so entries that are never accessed again don't stay in
+// memory.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+)
+
+var (
+	// pieceAvailabilityCacheTTL defines how long the result of a HasSector
+	// query is considered to be valid.
+	pieceAvailabilityCacheTTL = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: time.Minute,
+		Testnet:  time.Minute,
+		Testing:  time.Second * 5,
+	}).(time.Duration)
+)
+
+type (
+	// pieceAvailabilityCache caches the availability of sectors on hosts.
+	pieceAvailabilityCache struct {
+		entries map[pieceAvailabilityKey]*pieceAvailabilityEntry
+
+		// lastSweep is the last time expired entries were removed from the
+		// cache.
+		lastSweep time.Time
+
+		staticTTL time.Duration
+		mu        sync.Mutex
+	}
+
+	// pieceAvailabilityKey uniquely identifies a sector on a host.
+	pieceAvailabilityKey struct {
+		hostKey string
+		root    crypto.Hash
+	}
+
+	// pieceAvailabilityEntry is a single entry in the cache. While a lookup
+	// for the entry is in progress, doneChan is open and other callers that
+	// are interested in the same entry will block on it rather than perform
+	// the same lookup again.
+	pieceAvailabilityEntry struct {
+		available bool
+		err       error
+		expiry    time.Time
+
+		doneChan chan struct{}
+	}
+
+	// pieceAvailabilityFetchFunc is the function used by the cache to look up
+	// the availability of the roots that were not found in the cache.
+	pieceAvailabilityFetchFunc func(roots []crypto.Hash) ([]bool, error)
+)
+
+// newPieceAvailabilityCache returns a new, empty piece availability cache.
+func newPieceAvailabilityCache(ttl time.Duration) *pieceAvailabilityCache {
+	return &pieceAvailabilityCache{
+		entries:   make(map[pieceAvailabilityKey]*pieceAvailabilityEntry),
+		staticTTL: ttl,
+	}
+}
+
+// callSet updates the cache to reflect the given availability of a root on a
+// host. It is used to keep the cache up-to-date when a sector is uploaded.
+func (pac *pieceAvailabilityCache) callSet(hostKey string, root crypto.Hash, available bool) {
+	now := time.Now()
+	pac.mu.Lock()
+	defer pac.mu.Unlock()
+	pac.sweep(now)
+	key := pieceAvailabilityKey{hostKey: hostKey, root: root}
+	if entry, exists := pac.entries[key]; exists && !isClosed(entry.doneChan) {
+		// A lookup is in progress, it will overwrite the entry when it
+		// completes. Leave it alone.
+		return
+	}
+	doneChan := make(chan struct{})
+	close(doneChan)
+	pac.entries[key] = &pieceAvailabilityEntry{
+		available: available,
+		expiry:    now.Add(pac.staticTTL),
+		doneChan:  doneChan,
+	}
+}
+
+// managedHasSectors returns whether the host with the given key has the given
+// roots. Roots that are not cached are looked up using the provided fetch
+// function, which is called at most once. If another thread is already looking
+// up one of the roots, this call will wait for that lookup to complete instead
+// of performing it again unless the context is closed first.
+func (pac *pieceAvailabilityCache) managedHasSectors(ctx context.Context, hostKey string, roots []crypto.Hash, fetch pieceAvailabilityFetchFunc) ([]bool, error) {
+	entries := make([]*pieceAvailabilityEntry, len(roots))
+	var fetchRoots []crypto.Hash
+	var fetchEntries []*pieceAvailabilityEntry
+
+	// Check the cache for every root. Expired entries are evicted and entries
+	// for roots that are not in the cache are added as pending.
+	now := time.Now()
+	pac.mu.Lock()
+	pac.sweep(now)
+	for i, root := range roots {
+		key := pieceAvailabilityKey{hostKey: hostKey, root: root}
+		entry, exists := pac.entries[key]
+		if exists && isClosed(entry.doneChan) && now.After(entry.expiry) {
+			delete(pac.entries, key)
+			exists = false
+		}
+		if !exists {
+			entry = &pieceAvailabilityEntry{
+				doneChan: make(chan struct{}),
+			}
+			pac.entries[key] = entry
+			fetchRoots = append(fetchRoots, root)
+			fetchEntries = append(fetchEntries, entry)
+		}
+		entries[i] = entry
+	}
+	pac.mu.Unlock()
+
+	// Look up the roots that were not cached.
+	if len(fetchRoots) > 0 {
+		availables, err := fetch(fetchRoots)
+		if err == nil && len(availables) != len(fetchRoots) {
+			err = errors.New("fetch returned an unexpected number of results")
+		}
+		expiry := time.Now().Add(pac.staticTTL)
+		pac.mu.Lock()
+		for i, entry := range fetchEntries {
+			if err != nil {
+				// Failed lookups are not cached.
+				entry.err = err
+				key := pieceAvailabilityKey{hostKey: hostKey, root: fetchRoots[i]}
+				if pac.entries[key] == entry {
+					delete(pac.entries, key)
+				}
+			} else {
+				entry.available = availables[i]
+				entry.expiry = expiry
+			}
+			close(entry.doneChan)
+		}
+		pac.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Collect the results, waiting for lookups performed by other threads
+	// where necessary.
+	results := make([]bool, len(roots))
+	for i, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return nil, errors.AddContext(ctx.Err(), "interrupted while waiting for concurrent lookup")
+		case <-entry.doneChan:
+		}
+		pac.mu.Lock()
+		available, err := entry.available, entry.err
+		pac.mu.Unlock()
+		if err != nil {
+			return nil, errors.AddContext(err, "concurrent lookup failed")
+		}
+		results[i] = available
+	}
+	return results, nil
+}
+
+// sweep removes all expired entries from the cache. To keep the cost of
+// sweeping low, it only sweeps if at least one TTL has passed since the last
+// sweep. The cache's lock needs to be held.
+func (pac *pieceAvailabilityCache) sweep(now time.Time) {
+	if now.Sub(pac.lastSweep) < pac.staticTTL {
+		return
+	}
+	for key, entry := range pac.entries {
+		if isClosed(entry.doneChan) && now.After(entry.expiry) {
+			delete(pac.entries, key)
+		}
+	}
+	pac.lastSweep = now
+}
+
+// isClosed is a helper that returns whether the given channel is closed.
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,214 @@
+package renter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"go.sia.tech/siad/crypto"
+)
+
+// TestPieceAvailabilityCacheConcurrentDownloads runs two simultaneous
+// downloads that share half of their chunks and verifies that every root is
+// only looked up once.
+func TestPieceAvailabilityCacheConcurrentDownloads(t *testing.T) {
+	t.Parallel()
+
+	pac := newPieceAvailabilityCache(time.Minute)
+	hostKey := "host"
+
+	// Create the roots for the chunks of both downloads. The second half of
+	// the first download is the first half of the second download.
+	numChunks := 20
+	roots := make([]crypto.Hash, numChunks+numChunks/2)
+	for i := range roots {
+		fastrand.Read(roots[i][:])
+	}
+	download1 := roots[:numChunks]
+	download2 := roots[numChunks/2:]
+
+	// The fetch function counts the number of roots looked up. It sleeps a
+	// bit to make sure lookups overlap.
+	var lookups uint64
+	fetch := func(roots []crypto.Hash) ([]bool, error) {
+		atomic.AddUint64(&lookups, uint64(len(roots)))
+		time.Sleep(10 * time.Millisecond)
+		availables := make([]bool, len(roots))
+		for i := range roots {
+			availables[i] = roots[i][0]%2 == 0
+		}
+		return availables, nil
+	}
+
+	// Download both files chunk by chunk at the same time.
+	var wg sync.WaitGroup
+	download := func(chunkRoots []crypto.Hash) {
+		defer wg.Done()
+		for _, root := range chunkRoots {
+			availables, err := pac.managedHasSectors(context.Background(), hostKey, []crypto.Hash{root}, fetch)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if availables[0] != (root[0]%2 == 0) {
+				t.Error("wrong availability")
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go download(download1)
+	go download(download2)
+	wg.Wait()
+
+	// Every unique root should only have been looked up once.
+	if n := atomic.LoadUint64(&lookups); n > uint64(len(roots)) {
+		t.Fatalf("expected at most %v lookups, got %v", len(roots), n)
+	}
+}
+
+// TestPieceAvailabilityCache is a unit test for the pieceAvailabilityCache.
+func TestPieceAvailabilityCache(t *testing.T) {
+	t.Parallel()
+
+	pac := newPieceAvailabilityCache(100 * time.Millisecond)
+	var root1, root2 crypto.Hash
+	fastrand.Read(root1[:])
+	fastrand.Read(root2[:])
+
+	var lookups int
+	fetchErr := errors.New("fetch failed")
+	var failFetch bool
+	fetch := func(roots []crypto.Hash) ([]bool, error) {
+		if failFetch {
+			return nil, fetchErr
+		}
+		lookups += len(roots)
+		return make([]bool, len(roots)), nil
+	}
+
+	// A failed fetch should not be cached.
+	failFetch = true
+	_, err := pac.managedHasSectors(context.Background(), "host", []crypto.Hash{root1}, fetch)
+	if !errors.Contains(err, fetchErr) {
+		t.Fatal("expected fetch error", err)
+	}
+	if len(pac.entries) != 0 {
+		t.Fatal("failed lookup was cached")
+	}
+	failFetch = false
+
+	// Look up both roots, then again. The second time should be a cache hit.
+	for i := 0; i < 2; i++ {
+		availables, err := pac.managedHasSectors(context.Background(), "host", []crypto.Hash{root1, root2}, fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if availables[0] || availables[1] {
+			t.Fatal("wrong availability")
+		}
+	}
+	if lookups != 2 {
+		t.Fatal("expected 2 lookups, got", lookups)
+	}
+
+	// A different host should not share the entries.
+	_, err = pac.managedHasSectors(context.Background(), "otherhost", []crypto.Hash{root1}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 3 {
+		t.Fatal("expected 3 lookups, got", lookups)
+	}
+
+	// Mark root1 as available, this should be returned without a lookup.
+	pac.callSet("host", root1, true)
+	availables, err := pac.managedHasSectors(context.Background(), "host", []crypto.Hash{root1}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !availables[0] || lookups != 3 {
+		t.Fatal("expected cached availability")
+	}
+
+	// After the TTL expired, the roots should be looked up again.
+	time.Sleep(200 * time.Millisecond)
+	_, err = pac.managedHasSectors(context.Background(), "host", []crypto.Hash{root1, root2}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 5 {
+		t.Fatal("expected 5 lookups, got", lookups)
+	}
+}
+
+// TestPieceAvailabilityCacheSweep tests that expired entries are removed from
+// the cache even if they are never accessed again.
+func TestPieceAvailabilityCacheSweep(t *testing.T) {
+	t.Parallel()
+
+	pac := newPieceAvailabilityCache(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		var root crypto.Hash
+		fastrand.Read(root[:])
+		pac.callSet("host", root, true)
+	}
+	if len(pac.entries) != 10 {
+		t.Fatal("expected 10 entries, got", len(pac.entries))
+	}
+
+	// After the TTL expired, adding another entry sweeps the others.
+	time.Sleep(200 * time.Millisecond)
+	var root crypto.Hash
+	fastrand.Read(root[:])
+	pac.callSet("host", root, true)
+	if len(pac.entries) != 1 {
+		t.Fatal("expected 1 entry, got", len(pac.entries))
+	}
+}
+
+// TestPieceAvailabilityCacheCancelWait tests that a caller waiting for a
+// lookup performed by another thread can be interrupted.
+func TestPieceAvailabilityCacheCancelWait(t *testing.T) {
+	t.Parallel()
+
+	pac := newPieceAvailabilityCache(time.Minute)
+	var root crypto.Hash
+	fastrand.Read(root[:])
+
+	// Start a lookup which blocks until it is released.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fetch := func(roots []crypto.Hash) ([]bool, error) {
+		close(started)
+		<-release
+		return make([]bool, len(roots)), nil
+	}
+	done := make(chan error)
+	go func() {
+		_, err := pac.managedHasSectors(context.Background(), "host", []crypto.Hash{root}, fetch)
+		done <- err
+	}()
+	<-started
+
+	// Another caller with a cancelled context shouldn't wait for it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := pac.managedHasSectors(ctx, "host", []crypto.Hash{root}, func([]crypto.Hash) ([]bool, error) {
+		t.Error("root shouldn't be looked up twice")
+		return nil, nil
+	})
+	if !errors.Contains(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+
+	// The original lookup still succeeds.
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -388,6 +388,10 @@ func (pcws *projectChunkWorkerSet) threadedFindWorkers(allWorkersLaunchedChan ch
 	workersLaunched := 0
 	responseChan := make(chan *jobHasSectorResponse, len(workers))
 	for _, w := range workers {
+		// Blacklisted hosts are not used for downloads.
+		if ws.staticRenter.staticHostBlacklist.callContains(w.staticHostPubKeyStr) {
+			continue
+		}
 		err := pcws.managedLaunchWorker(ctx, w, responseChan, ws)
 		if err == nil {
 			workersLaunched++
@@ -537,7 +541,7 @@ func (pcws *projectChunkWorkerSet) managedDownload(ctx context.Context, pricePer
 	// to be downloaded as full sectors. This feels reasonable because smaller
 	// sectors were not supported when encryption schemes with overhead were
 	// being suggested.
-	if pcws.staticMasterKey.Type().Overhead() != 0 && (offset != 0 || length != modules.SectorSize*uint64(ec.MinPieces())) {
+	if pcws.staticMasterKey.Type().Overhead() != 0 && (offset != 0 || length != ec.ChunkSize(modules.SectorSize)) {
 		return nil, errors.New("invalid request performed - this chunk has encryption overhead and therefore the full chunk must be downloaded")
 	}
 
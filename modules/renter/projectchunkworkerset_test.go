@@ -102,11 +102,13 @@ func testBasic(t *testing.T, wt *workerTester) {
 		t.Fatal("unexpected")
 	}
 
-	// add the sector to the host
+	// add the sector to the host, since it's not uploaded by the worker we
+	// need to update the piece availability cache like an upload would
 	err = wt.host.AddSector(sectorRoot, sectorData)
 	if err != nil {
 		t.Fatal(err)
 	}
+	wt.renter.staticPieceAvailabilityCache.callSet(wt.staticHostPubKeyStr, sectorRoot, true)
 
 	// reset the launch time - allowing us to force a state update
 	pcws.mu.Lock()
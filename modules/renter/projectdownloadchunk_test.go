@@ -595,6 +595,7 @@ type mockErasureCoder struct{}
 
 func (mec *mockErasureCoder) NumPieces() int                       { return 10 }
 func (mec *mockErasureCoder) MinPieces() int                       { return 1 }
+func (mec *mockErasureCoder) ChunkSize(pieceSize uint64) uint64    { return pieceSize }
 func (mec *mockErasureCoder) Encode(data []byte) ([][]byte, error) { return nil, nil }
 func (mec *mockErasureCoder) Identifier() modules.ErasureCoderIdentifier {
 	return modules.ErasureCoderIdentifier("mock")
@@ -179,6 +179,10 @@ type SafeContract struct {
 	// revisionMu, it is still necessary to lock mu when modifying fields
 	// of the SafeContract.
 	revisionMu sync.Mutex
+
+	// acquired indicates whether the contract is currently acquired. It is
+	// protected by the mutex of the ContractSet.
+	acquired bool
 }
 
 // CommitPaymentIntent will commit the intent to pay a host for an rpc by
@@ -840,7 +844,6 @@ func (cs *ContractSet) managedApplyInsertContractUpdate(update writeaheadlog.Upd
 	}
 	headerFilePath := filepath.Join(cs.staticDir, h.ID().String()+contractHeaderExtension)
 	rootsFilePath := filepath.Join(cs.staticDir, h.ID().String()+contractRootsExtension)
-	rcFilePath := filepath.Join(cs.staticDir, h.ID().String()+refCounterExtension)
 	// create the files.
 	headerFile, err := os.OpenFile(headerFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, modules.DefaultFilePerm)
 	if err != nil {
@@ -874,7 +877,7 @@ func (cs *ContractSet) managedApplyInsertContractUpdate(update writeaheadlog.Upd
 	}
 	var rc *refCounter
 	if build.Release == "testing" {
-		rc, err = newRefCounter(rcFilePath, uint64(len(roots)), cs.staticWal)
+		rc, err = newRefCounterForContract(cs.staticDir, h.ID().String(), uint64(len(roots)), cs.staticWal, cs.staticRefCounterLayout)
 		if err != nil {
 			return modules.RenterContract{}, errors.AddContext(err, "failed to create a refcounter")
 		}
@@ -984,7 +987,7 @@ func (cs *ContractSet) loadSafeContract(headerFileName, rootsFileName, refCountF
 		// load the reference counter or create a new one if it doesn't exist
 		rc, err = loadRefCounter(refCountFileName, cs.staticWal)
 		if errors.Contains(err, ErrRefCounterNotExist) {
-			rc, err = newRefCounter(refCountFileName, uint64(merkleRoots.numMerkleRoots), cs.staticWal)
+			rc, err = newRefCounterAt(refCountFileName, uint64(merkleRoots.numMerkleRoots), cs.staticWal)
 		}
 		if err != nil {
 			return errors.AddContext(err, "failed to load or create a refcounter")
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/ratelimit"
@@ -29,6 +30,9 @@ type ContractSet struct {
 	mu         sync.Mutex
 	staticRL   *ratelimit.RateLimit
 	staticWal  *writeaheadlog.WAL
+
+	// staticRefCounterLayout is the layout used for new refcounter files.
+	staticRefCounterLayout RefCounterLayout
 }
 
 // Acquire looks up the contract for the specified host key and locks it before
@@ -46,6 +50,9 @@ func (cs *ContractSet) Acquire(id types.FileContractID) (*SafeContract, bool) {
 	// deleted in the meantime.
 	cs.mu.Lock()
 	_, ok = cs.contracts[id]
+	if ok {
+		safeContract.acquired = true
+	}
 	cs.mu.Unlock()
 	if !ok {
 		safeContract.revisionMu.Unlock()
@@ -67,13 +74,17 @@ func (cs *ContractSet) Delete(c *SafeContract) {
 	}
 	delete(cs.contracts, c.header.ID())
 	delete(cs.pubKeys, c.header.HostPublicKey().String())
+	c.acquired = false
 	cs.mu.Unlock()
 	c.revisionMu.Unlock()
 	// delete contract file
 	headerPath := filepath.Join(cs.staticDir, c.header.ID().String()+contractHeaderExtension)
 	rootsPath := filepath.Join(cs.staticDir, c.header.ID().String()+contractRootsExtension)
-	// close header and root files.
+	// close header and root files and release the refcounter.
 	err := errors.Compose(c.staticHeaderFile.Close(), c.merkleRoots.rootsFile.Close())
+	if c.staticRC != nil {
+		err = errors.Compose(err, c.staticRC.callClose())
+	}
 	// remove the files.
 	err = errors.Compose(err, os.Remove(headerPath), os.Remove(rootsPath))
 	if err != nil {
@@ -129,6 +140,7 @@ func (cs *ContractSet) Return(c *SafeContract) {
 		cs.mu.Unlock()
 		build.Critical("no contract with that key")
 	}
+	c.acquired = false
 	cs.mu.Unlock()
 	c.revisionMu.Unlock()
 }
@@ -173,12 +185,50 @@ func (cs *ContractSet) ViewAll() []modules.RenterContract {
 
 // Close closes all contracts in a contract set, this means rendering it unusable for I/O
 func (cs *ContractSet) Close() error {
+	return cs.managedClose(false, 0)
+}
+
+// CloseWithTimeout closes the contract set like Close but first waits up to
+// timeout for open refcounter update sessions to finish. Sessions which are
+// still open once the timeout expired are reported using
+// ErrRefCounterUpdateInProgress. Only contracts which are currently acquired
+// are waited for. A session of a contract without a revision in progress
+// belongs to an interrupted revision and is recovered from the WAL. The
+// contract set is closed either way.
+func (cs *ContractSet) CloseWithTimeout(timeout time.Duration) error {
+	return cs.managedClose(true, timeout)
+}
+
+// managedClose closes all contracts in the set. If waitForUpdates is set, open
+// refcounter update sessions of acquired contracts get a shared amount of time
+// to finish before the contracts are closed.
+func (cs *ContractSet) managedClose(waitForUpdates bool, timeout time.Duration) error {
+	var err error
+	if waitForUpdates {
+		// Don't hold the lock while waiting since the revisions which are
+		// still in progress might need it to finish.
+		cs.mu.Lock()
+		var acquired []*SafeContract
+		for _, c := range cs.contracts {
+			if c.acquired && c.staticRC != nil {
+				acquired = append(acquired, c)
+			}
+		}
+		cs.mu.Unlock()
+		deadline := time.Now().Add(timeout)
+		for _, c := range acquired {
+			err = errors.Compose(err, c.staticRC.callWaitForUpdateSession(time.Until(deadline)))
+		}
+	}
+
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	var err error
 	for _, c := range cs.contracts {
 		err = errors.Compose(err, c.staticHeaderFile.Close())
 		err = errors.Compose(err, c.merkleRoots.rootsFile.Close())
+		if c.staticRC != nil {
+			err = errors.Compose(err, c.staticRC.callClose())
+		}
 	}
 	_, errWal := cs.staticWal.CloseIncomplete()
 	return errors.Compose(err, errWal)
@@ -187,6 +237,15 @@ func (cs *ContractSet) Close() error {
 // NewContractSet returns a ContractSet storing its contracts in the specified
 // dir.
 func NewContractSet(dir string, rl *ratelimit.RateLimit, deps modules.Dependencies) (*ContractSet, error) {
+	return NewContractSetWithLayout(dir, rl, deps, RefCounterLayoutFlat)
+}
+
+// NewContractSetWithLayout returns a ContractSet storing its contracts in the
+// specified dir. New refcounter files are created using the provided layout.
+func NewContractSetWithLayout(dir string, rl *ratelimit.RateLimit, deps modules.Dependencies, layout RefCounterLayout) (*ContractSet, error) {
+	if layout != RefCounterLayoutFlat && layout != RefCounterLayoutSharded {
+		return nil, fmt.Errorf("unknown refcounter layout %v", layout)
+	}
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, err
 	}
@@ -223,6 +282,8 @@ func NewContractSet(dir string, rl *ratelimit.RateLimit, deps modules.Dependenci
 		staticDir:  dir,
 		staticRL:   rl,
 		staticWal:  wal,
+
+		staticRefCounterLayout: layout,
 	}
 	// Set the initial rate limit to 'unlimited' bandwidth with 4kib packets.
 	cs.staticRL = ratelimit.NewRateLimit(0, 0, 0)
@@ -267,7 +328,7 @@ func NewContractSet(dir string, rl *ratelimit.RateLimit, deps modules.Dependenci
 		nameNoExt := strings.TrimSuffix(filename, contractHeaderExtension)
 		headerPath := filepath.Join(dir, filename)
 		rootsPath := filepath.Join(dir, nameNoExt+contractRootsExtension)
-		refCounterPath := filepath.Join(dir, nameNoExt+refCounterExtension)
+		refCounterPath := findRefCounterPath(dir, nameNoExt, cs.staticRefCounterLayout)
 
 		if err := cs.loadSafeContract(headerPath, rootsPath, refCounterPath, walTxns); err != nil {
 			extErr := fmt.Errorf("failed to load safecontract for header %v", headerPath)
@@ -413,3 +413,208 @@ func TestInsertContractTotalCost(t *testing.T) {
 		t.Fatal("wrong TotalCost", contract.TotalCost, expectedTotalCost)
 	}
 }
+
+// TestContractSetRefCounterLayout tests creating refcounters using the sharded
+// layout and migrating flat refcounters into it.
+func TestContractSetRefCounterLayout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	testDir := build.TempDir(t.Name())
+	rl := ratelimit.NewRateLimit(0, 0, 0)
+
+	// newHeader is a helper to create a contract header with the given id.
+	newHeader := func(id byte) contractHeader {
+		return contractHeader{Transaction: types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:             types.FileContractID{id},
+				NewValidProofOutputs: []types.SiacoinOutput{{}, {}},
+				UnlockConditions: types.UnlockConditions{
+					PublicKeys: []types.SiaPublicKey{{}, {}},
+				},
+			}},
+		}}
+	}
+	// exists is a helper to check whether a file exists.
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// Unknown layouts are rejected.
+	if _, err := NewContractSetWithLayout(testDir, rl, modules.ProdDependencies, RefCounterLayout(2)); err == nil {
+		t.Fatal("expected unknown layout to be rejected")
+	}
+
+	// Create a contract using the flat layout.
+	cs, err := NewContractSet(testDir, rl, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1 := newHeader(1)
+	name1 := h1.ID().String()
+	if _, err := cs.managedInsertContract(h1, []crypto.Hash{{}, {}}); err != nil {
+		t.Fatal(err)
+	}
+	flatPath := RefCounterLayoutFlat.refCounterPath(testDir, name1)
+	shardedPath := RefCounterLayoutSharded.refCounterPath(testDir, name1)
+	if filepath.Base(filepath.Dir(shardedPath)) != name1[:refCounterShardPrefixLen] {
+		t.Fatal("unexpected sharded path", shardedPath)
+	}
+	if !exists(flatPath) || exists(shardedPath) {
+		t.Fatal("refcounter should use the flat layout")
+	}
+
+	// Close the set and migrate the refcounter.
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateRefCountersToShardedLayout(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if exists(flatPath) || exists(flatPath+refCounterLockExtension) || !exists(shardedPath) {
+		t.Fatal("refcounter wasn't migrated")
+	}
+	// Migrating again is a no-op.
+	if err := MigrateRefCountersToShardedLayout(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the set with the sharded layout. The migrated refcounter should be
+	// used and new refcounters should be sharded.
+	cs, err = NewContractSetWithLayout(testDir, rl, modules.ProdDependencies, RefCounterLayoutSharded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cs.managedMustAcquire(t, h1.ID())
+	if c.staticRC.filepath != shardedPath {
+		t.Fatal("wrong refcounter path", c.staticRC.filepath)
+	}
+	if count, err := c.staticRC.callCount(1); err != nil || count != 1 {
+		t.Fatal("unexpected count", count, err)
+	}
+	cs.Return(c)
+	h2 := newHeader(2)
+	if _, err := cs.managedInsertContract(h2, []crypto.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(RefCounterLayoutSharded.refCounterPath(testDir, h2.ID().String())) {
+		t.Fatal("new refcounter should use the sharded layout")
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the set with the flat layout still finds the sharded
+	// refcounters instead of creating new ones.
+	cs, err = NewContractSet(testDir, rl, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if exists(flatPath) {
+		t.Fatal("flat refcounter shouldn't have been created")
+	}
+}
+
+// TestContractSetCloseOpenUpdateSession tests that closing a contract set with
+// a timeout doesn't block forever on a refcounter update session which is
+// never finished.
+func TestContractSetCloseOpenUpdateSession(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	testDir := build.TempDir(t.Name())
+	cs, err := NewContractSet(testDir, ratelimit.NewRateLimit(0, 0, 0), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := contractHeader{Transaction: types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID:             types.FileContractID{1},
+			NewValidProofOutputs: []types.SiacoinOutput{{}, {}},
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys: []types.SiaPublicKey{{}, {}},
+			},
+		}},
+	}}
+	if _, err := cs.managedInsertContract(h, []crypto.Hash{{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open an update session on an acquired contract and never finish it.
+	c := cs.managedMustAcquire(t, h.ID())
+	if err := c.staticRC.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close should return once the timeout expired and report the session.
+	timeout := 100 * time.Millisecond
+	start := time.Now()
+	err = cs.CloseWithTimeout(timeout)
+	if !errors.Contains(err, ErrRefCounterUpdateInProgress) {
+		t.Fatal("expected ErrRefCounterUpdateInProgress, got", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 10*timeout {
+		t.Fatal("unexpected duration of Close", elapsed)
+	}
+
+	// Reopen the set. A session of a contract that was returned belongs to an
+	// interrupted revision which is recovered from the WAL. It is therefore
+	// neither waited for nor reported.
+	cs, err = NewContractSet(testDir, ratelimit.NewRateLimit(0, 0, 0), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = cs.managedMustAcquire(t, h.ID())
+	if err := c.staticRC.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	cs.Return(c)
+	start = time.Now()
+	if err := cs.CloseWithTimeout(timeout); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Fatal("Close waited for an interrupted revision", elapsed)
+	}
+
+	// Reopen the set. A revision which is still in progress can use the set
+	// and the contract's files while Close waits for its session.
+	cs, err = NewContractSet(testDir, ratelimit.NewRateLimit(0, 0, 0), modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = cs.managedMustAcquire(t, h.ID())
+	if err := c.staticRC.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	revisionErr := make(chan error)
+	go func() {
+		time.Sleep(timeout)
+		if _, ok := cs.View(h.ID()); !ok {
+			revisionErr <- errors.New("contract not found")
+			return
+		}
+		err := c.staticHeaderFile.Sync()
+		err = errors.Compose(err, c.staticRC.callUpdateApplied())
+		cs.Return(c)
+		revisionErr <- err
+	}()
+	start = time.Now()
+	if err := cs.CloseWithTimeout(100 * timeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-revisionErr; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 10*timeout {
+		t.Fatal("Close didn't return once the session finished", elapsed)
+	}
+}
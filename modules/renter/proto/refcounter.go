@@ -1,11 +1,17 @@
 package proto
 
+//go:generate go run ../../../cmd/gendocs/refcounter -o refcounterformat.md
+
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"math"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	siasync "go.sia.tech/siad/sync"
 
@@ -24,6 +30,10 @@ var (
 	// ErrInvalidSectorNumber is returned when the requested sector doesnt' exist
 	ErrInvalidSectorNumber = errors.New("invalid sector given - it does not exist")
 
+	// ErrInvalidRefCounterMode is returned when the header of a refcounter
+	// file contains an unknown mode.
+	ErrInvalidRefCounterMode = errors.New("invalid refcounter mode")
+
 	// ErrInvalidVersion is returned when the version of the file we are trying to
 	// read does not match the current refCounterHeaderSize
 	ErrInvalidVersion = errors.New("invalid file version")
@@ -36,6 +46,34 @@ var (
 	// the given path
 	ErrRefCounterNotExist = errors.New("refcounter does not exist")
 
+	// ErrRefCounterNotInitialized is returned when a method is called on a
+	// refcounter that wasn't created by newRefCounter or loadRefCounter.
+	ErrRefCounterNotInitialized = errors.New("refcounter is not initialized")
+
+	// ErrRefCounterSectorsReserved is returned when trying to drop sectors
+	// while some sectors are reserved but not committed yet.
+	ErrRefCounterSectorsReserved = errors.New("refcounter has reserved sectors which are not committed")
+
+	// ErrSectorChecksumMismatch is returned when the checksum of a sector's
+	// count in a verified refcounter doesn't match the count.
+	ErrSectorChecksumMismatch = errors.New("sector count checksum mismatch")
+
+	// ErrSectorCountOverflow is returned when a sector count is incremented
+	// beyond the maximum value of a counter.
+	ErrSectorCountOverflow = errors.New("sector count overflow")
+
+	// ErrSectorCountUnderflow is returned when a sector count of 0 is
+	// decremented.
+	ErrSectorCountUnderflow = errors.New("sector count underflow")
+
+	// ErrRefCounterUpdateInProgress is returned when a refcounter is closed
+	// while an update session didn't finish in time.
+	ErrRefCounterUpdateInProgress = errors.New("refcounter update session still in progress")
+
+	// ErrSectorsNotReserved is returned when committing a range of sectors
+	// which wasn't reserved with callReserveSectors.
+	ErrSectorsNotReserved = errors.New("sectors were not reserved")
+
 	// ErrUpdateWithoutUpdateSession is returned when an update operation is
 	// called without an open update session
 	ErrUpdateWithoutUpdateSession = errors.New("an update operation was called without an open update session")
@@ -45,7 +83,7 @@ var (
 	ErrUpdateAfterDelete = errors.New("updates cannot be created after a deletion")
 
 	// refCounterVersion defines the latest version of the refCounter
-	refCounterVersion = [8]byte{1}
+	refCounterVersion = [7]byte{1}
 
 	// updateNameRCDelete is the name of an idempotent update that deletes a file
 	// from the disk.
@@ -55,16 +93,41 @@ var (
 	// refcounter file by a number of sectors.
 	updateNameRCTruncate = "RC_TRUNCATE"
 
+	// updateNameRCWriteCounts is the name of an idempotent update that writes
+	// a list of values to a range of positions in the file.
+	updateNameRCWriteCounts = "RC_WRITE_COUNTS"
+
 	// updateNameRCWriteAt is the name of an idempotent update that writes a
 	// value to a position in the file.
 	updateNameRCWriteAt = "RC_WRITE_AT"
+
+	// updateNameRCWriteRange is the name of an idempotent update that writes
+	// the same value to a range of positions in the file.
+	updateNameRCWriteRange = "RC_WRITE_RANGE"
 )
 
 const (
 	// refCounterHeaderSize is the size of the header in bytes
 	refCounterHeaderSize = 8
+
+	// refCounterIterBatchSize is the number of counts callForEachCount and
+	// callStats read at once.
+	refCounterIterBatchSize = 1 << 16
 )
 
+const (
+	// RefCounterModeFast stores a 2 byte count per sector.
+	RefCounterModeFast RefCounterMode = iota
+
+	// RefCounterModeVerified stores a 4 byte CRC32 checksum after every
+	// count. The checksum covers the index of the sector and its count and is
+	// verified whenever the count is read.
+	RefCounterModeVerified
+)
+
+// RefCounterMode determines how the counts of a refcounter file are stored.
+type RefCounterMode uint8
+
 type (
 	// refCounter keeps track of how many references to each sector exist.
 	//
@@ -79,7 +142,33 @@ type (
 		filepath   string // where the refcounter is persisted on disk
 		numSectors uint64 // used for sanity checks before we attempt mutation operations
 		staticWal  *writeaheadlog.WAL
-		mu         sync.Mutex
+		mu         sync.RWMutex
+
+		// opLog is the optional log of mutating operations. It is nil unless
+		// enabled through the refCounterOptions.
+		opLog *refCounterOperationLog
+
+		// staticSaturatingMax is the value at which increments saturate. It is
+		// 0 unless enabled through the refCounterOptions.
+		staticSaturatingMax uint16
+
+		// mmap is the memory mapping which reads are served from. It is nil
+		// unless staticMemoryMapped was enabled through the
+		// refCounterOptions and the file could be mapped.
+		mmap               *refCounterMmap
+		staticMemoryMapped bool
+
+		// reservations maps the first index of every range of sectors that was
+		// reserved by callReserveSectors but not committed yet to the number
+		// of sectors in the range. reservedEnd is the index after the last
+		// reserved sector.
+		reservations map[uint64]uint64
+		reservedEnd  uint64
+
+		// lock is the exclusive lock on the refcounter which prevents other
+		// processes from using it. It is released by callClose or when the
+		// refcounter is deleted.
+		lock *refCounterLock
 
 		// utility fields
 		staticDeps modules.Dependencies
@@ -89,7 +178,16 @@ type (
 
 	// refCounterHeader contains metadata about the reference counter file
 	refCounterHeader struct {
-		Version [8]byte
+		Version [7]byte        `doc:"version of the refcounter file format, currently 1 followed by 6 zero bytes"`
+		Mode    RefCounterMode `doc:"0 for a 2 byte count per sector, 1 if every count is followed by a 4 byte little endian CRC32 (IEEE) of the little endian sector index and count"`
+	}
+
+	// refCounterStats summarizes the counts of a refcounter.
+	refCounterStats struct {
+		NumSectors      uint64 // number of sectors in the refcounter
+		NumUnreferenced uint64 // number of sectors with a count of 0
+		TotalReferences uint64 // sum of all counts
+		MaxCount        uint16 // highest count of any sector
 	}
 
 	// refCounterUpdateControl is a helper struct that holds fields pertaining
@@ -105,6 +203,10 @@ type (
 		// update session, so we can use them even before they are stored on
 		// disk
 		newSectorCounts map[uint64]uint16
+		// fillValue is set when all sector counters were set to the same
+		// value during an update session. Values in newSectorCounts take
+		// precedence over it.
+		fillValue *uint16
 
 		// muUpdate serializes updates to the refcounter. It is acquired by
 		// callStartUpdate and released by callUpdateApplied.
@@ -113,10 +215,25 @@ type (
 
 	// u16 is a utility type for ser/des of uint16 values
 	u16 [2]byte
+
+	// RefCounterFileFormat describes the binary layout of a refcounter file.
+	// Refcounter files are never decoded into it, it only exists to generate
+	// refcounterformat.md. The doc tag describes a field and the layout tag
+	// marks fields which are repeated until the end of the file.
+	RefCounterFileFormat struct {
+		Header refCounterHeader
+		Count  u16 `doc:"little endian reference count of sector i, followed by its checksum if Mode is 1" layout:"repeated"`
+	}
 )
 
 // loadRefCounter loads a refcounter from disk
-func loadRefCounter(path string, wal *writeaheadlog.WAL) (_ *refCounter, err error) {
+func loadRefCounter(path string, wal *writeaheadlog.WAL) (*refCounter, error) {
+	return loadRefCounterWithOptions(path, wal, refCounterOptions{})
+}
+
+// loadRefCounterWithOptions loads a refcounter from disk using the provided
+// options.
+func loadRefCounterWithOptions(path string, wal *writeaheadlog.WAL, opts refCounterOptions) (_ *refCounter, err error) {
 	// Open the file and start loading the data.
 	f, err := os.Open(path)
 	if err != nil {
@@ -137,48 +254,95 @@ func loadRefCounter(path string, wal *writeaheadlog.WAL) (_ *refCounter, err err
 	if header.Version != refCounterVersion {
 		return nil, errors.AddContext(ErrInvalidVersion, fmt.Sprintf("expected version %d, got version %d", refCounterVersion, header.Version))
 	}
+	if !header.Mode.valid() {
+		return nil, errors.AddContext(ErrInvalidRefCounterMode, fmt.Sprint(header.Mode))
+	}
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, errors.AddContext(err, "failed to read file stats")
 	}
-	numSectors := uint64((fi.Size() - refCounterHeaderSize) / 2)
-	return &refCounter{
+	numSectors := uint64(fi.Size()-refCounterHeaderSize) / header.Mode.recordSize()
+	lock, err := acquireRefCounterLock(path, false)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to lock refcounter")
+	}
+	rc := &refCounter{
 		refCounterHeader: header,
 		filepath:         path,
 		numSectors:       numSectors,
 		staticWal:        wal,
+		opLog:            newRefCounterOperationLog(opts.OperationLogSize),
+		lock:             lock,
 		staticDeps:       modules.ProdDependencies,
+
+		staticSaturatingMax: opts.SaturatingMax,
+		staticMemoryMapped:  opts.MemoryMapped,
 		refCounterUpdateControl: refCounterUpdateControl{
 			newSectorCounts: make(map[uint64]uint16),
 		},
-	}, nil
+	}
+	if opts.MemoryMapped {
+		rc.mmap, err = mapRefCounterFile(path)
+		if errors.Contains(err, errMmapNotSupported) {
+			err = nil
+		} else if err != nil {
+			return nil, errors.Compose(errors.AddContext(err, "failed to map refcounter"), lock.release(false))
+		}
+	}
+	return rc, nil
 }
 
 // newCustomRefCounter creates a new sector reference counter file to accompany
 // a contract file and allows setting custom dependencies
 func newCustomRefCounter(path string, numSec uint64, wal *writeaheadlog.WAL, deps modules.Dependencies) (*refCounter, error) {
+	return newCustomRefCounterWithOptions(path, numSec, wal, deps, refCounterOptions{})
+}
+
+// newCustomRefCounterWithOptions creates a new sector reference counter file
+// using the provided options and dependencies.
+func newCustomRefCounterWithOptions(path string, numSec uint64, wal *writeaheadlog.WAL, deps modules.Dependencies, opts refCounterOptions) (*refCounter, error) {
+	if !opts.Mode.valid() {
+		return nil, errors.AddContext(ErrInvalidRefCounterMode, fmt.Sprint(opts.Mode))
+	}
+	lock, err := acquireRefCounterLock(path, false)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to lock refcounter")
+	}
 	h := refCounterHeader{
 		Version: refCounterVersion,
+		Mode:    opts.Mode,
 	}
 	updateHeader := writeaheadlog.WriteAtUpdate(path, 0, serializeHeader(h))
 
-	b := make([]byte, numSec*2)
-	for i := uint64(0); i < numSec; i++ {
-		binary.LittleEndian.PutUint16(b[i*2:i*2+2], 1)
+	counts := make([]uint16, numSec)
+	for i := range counts {
+		counts[i] = 1
 	}
-	updateCounters := writeaheadlog.WriteAtUpdate(path, refCounterHeaderSize, b)
+	updateCounters := writeaheadlog.WriteAtUpdate(path, refCounterHeaderSize, h.Mode.encodeCounts(0, counts))
 
-	err := wal.CreateAndApplyTransaction(writeaheadlog.ApplyUpdates, updateHeader, updateCounters)
-	return &refCounter{
+	err = wal.CreateAndApplyTransaction(writeaheadlog.ApplyUpdates, updateHeader, updateCounters)
+	if err != nil {
+		return nil, errors.Compose(errors.AddContext(err, "failed to create refcounter"), lock.release(false))
+	}
+	rc := &refCounter{
 		refCounterHeader: h,
 		filepath:         path,
 		numSectors:       numSec,
 		staticWal:        wal,
+		opLog:            newRefCounterOperationLog(opts.OperationLogSize),
+		lock:             lock,
 		staticDeps:       deps,
+
+		staticSaturatingMax: opts.SaturatingMax,
+		staticMemoryMapped:  opts.MemoryMapped,
 		refCounterUpdateControl: refCounterUpdateControl{
 			newSectorCounts: make(map[uint64]uint16),
 		},
-	}, err
+	}
+	if err := rc.remap(); err != nil {
+		return nil, errors.Compose(errors.AddContext(err, "failed to map refcounter"), lock.release(false))
+	}
+	return rc, nil
 }
 
 // newRefCounter creates a new sector reference counter file to accompany
@@ -187,9 +351,88 @@ func newRefCounter(path string, numSec uint64, wal *writeaheadlog.WAL) (*refCoun
 	return newCustomRefCounter(path, numSec, wal, modules.ProdDependencies)
 }
 
+// newRefCounterWithOptions creates a new sector reference counter file using
+// the provided options.
+func newRefCounterWithOptions(path string, numSec uint64, wal *writeaheadlog.WAL, opts refCounterOptions) (*refCounter, error) {
+	return newCustomRefCounterWithOptions(path, numSec, wal, modules.ProdDependencies, opts)
+}
+
+// callApplyDeltas adds the signed delta of every sector in deltas to the
+// sector's count. All indices and resulting counts are validated before any of
+// them are changed, so either all deltas are applied or none. Counts saturate
+// at staticSaturatingMax if it is set. The counts of contiguous sectors are
+// written with a single update.
+func (rc *refCounter) callApplyDeltas(deltas map[uint64]int) ([]writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.isUpdateInProgress {
+		return nil, ErrUpdateWithoutUpdateSession
+	}
+	if rc.isDeleted {
+		return nil, ErrUpdateAfterDelete
+	}
+	// Compute the new counts in order of the sector indices.
+	indices := make([]uint64, 0, len(deltas))
+	for secIdx, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		if secIdx >= rc.numSectors {
+			return nil, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to apply delta to sector %v", secIdx))
+		}
+		indices = append(indices, secIdx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	oldCounts := make([]uint16, len(indices))
+	newCounts := make([]uint16, len(indices))
+	for i, secIdx := range indices {
+		count, err := rc.readCount(secIdx)
+		if err != nil {
+			return nil, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for delta", secIdx))
+		}
+		newCount := int64(count) + int64(deltas[secIdx])
+		max := int64(math.MaxUint16)
+		if sat := int64(rc.staticSaturatingMax); sat > 0 && deltas[secIdx] > 0 && newCount > sat {
+			// Counts that are already above the maximum don't increase.
+			newCount = sat
+			if int64(count) > sat {
+				newCount = int64(count)
+			}
+		}
+		if newCount < 0 {
+			return nil, errors.AddContext(ErrSectorCountUnderflow, fmt.Sprintf("failed to apply delta %v to sector %v", deltas[secIdx], secIdx))
+		}
+		if newCount > max {
+			return nil, errors.AddContext(ErrSectorCountOverflow, fmt.Sprintf("failed to apply delta %v to sector %v", deltas[secIdx], secIdx))
+		}
+		oldCounts[i] = count
+		newCounts[i] = uint16(newCount)
+	}
+	// Write every run of contiguous sectors with a single update.
+	var updates []writeaheadlog.Update
+	for start := 0; start < len(indices); {
+		end := start + 1
+		for end < len(indices) && indices[end] == indices[end-1]+1 {
+			end++
+		}
+		updates = append(updates, rc.writeCounts(indices[start], newCounts[start:end]))
+		start = end
+	}
+	for i, secIdx := range indices {
+		rc.opLog.add(refCounterOpApplyDelta, secIdx, oldCounts[i], newCounts[i])
+	}
+	return updates, nil
+}
+
 // callAppend appends one counter to the end of the refcounter file and
-// initializes it with `1`
+// initializes it with `1`. Reserved sectors are skipped.
 func (rc *refCounter) callAppend() (writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -198,21 +441,115 @@ func (rc *refCounter) callAppend() (writeaheadlog.Update, error) {
 	if rc.isDeleted {
 		return writeaheadlog.Update{}, ErrUpdateAfterDelete
 	}
+	secIdx := rc.nextSectorIndex()
+	rc.opLog.add(refCounterOpAppend, secIdx, 0, 1)
+	if secIdx > rc.numSectors {
+		return rc.writeCounts(secIdx, []uint16{1}), nil
+	}
 	rc.numSectors++
-	rc.newSectorCounts[rc.numSectors-1] = 1
-	return createWriteAtUpdate(rc.filepath, rc.numSectors-1, 1), nil
+	rc.newSectorCounts[secIdx] = 1
+	return createWriteAtUpdate(rc.filepath, secIdx, 1), nil
 }
 
-// callCount returns the number of references to the given sector
-func (rc *refCounter) callCount(secIdx uint64) (uint16, error) {
+// callCommitReservedSectors sets the counts of the sectors which were reserved
+// by a call to callReserveSectors that returned startIdx. values needs to
+// contain one count for every reserved sector. Reservations can be committed
+// in any order. If a reservation is committed before the reservations in front
+// of it, the uncommitted sectors in front of it are initialized with 0 until
+// they are committed.
+func (rc *refCounter) callCommitReservedSectors(startIdx uint64, values []uint16) ([]writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.isUpdateInProgress {
+		return nil, ErrUpdateWithoutUpdateSession
+	}
+	if rc.isDeleted {
+		return nil, ErrUpdateAfterDelete
+	}
+	n, exists := rc.reservations[startIdx]
+	if !exists {
+		return nil, errors.AddContext(ErrSectorsNotReserved, fmt.Sprintf("no reservation starts at sector %v", startIdx))
+	}
+	if uint64(len(values)) != n {
+		return nil, fmt.Errorf("expected %v values for the reserved sectors but got %v", n, len(values))
+	}
+	delete(rc.reservations, startIdx)
+	if len(rc.reservations) == 0 {
+		rc.reservedEnd = 0
+	}
+	for i, value := range values {
+		rc.opLog.add(refCounterOpCommitReserved, startIdx+uint64(i), 0, value)
+	}
+	return []writeaheadlog.Update{rc.writeCounts(startIdx, values)}, nil
+}
+
+// callConcat appends the counts of all of src's sectors to the end of the
+// refcounter. The appended sectors keep their order and are placed after any
+// reserved sectors. In contrast to appending the
+// sectors one by one, this creates a single update which is applied with a
+// single write. The refcounter needs an active update session, src is only
+// read.
+func (rc *refCounter) callConcat(src *refCounter) ([]writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
+	if !src.initialized() {
+		return nil, errors.AddContext(ErrRefCounterNotInitialized, "source refcounter")
+	}
+	if rc == src {
+		return nil, errors.New("can't concatenate a refcounter with itself")
+	}
+	// Read src's counts first to avoid holding both locks at the same time.
+	src.mu.RLock()
+	counts, err := src.readCountRange(0, src.numSectors)
+	src.mu.RUnlock()
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read counts of source refcounter")
+	}
+
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
+	if !rc.isUpdateInProgress {
+		return nil, ErrUpdateWithoutUpdateSession
+	}
+	if rc.isDeleted {
+		return nil, ErrUpdateAfterDelete
+	}
+	first := rc.nextSectorIndex()
+	rc.opLog.add(refCounterOpConcat, first, 0, 0)
+	return []writeaheadlog.Update{rc.writeCounts(first, counts)}, nil
+}
+
+// callCount returns the number of references to the given sector
+func (rc *refCounter) callCount(secIdx uint64) (uint16, error) {
+	if !rc.initialized() {
+		return 0, ErrRefCounterNotInitialized
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
 	return rc.readCount(secIdx)
 }
 
+// callCountRange returns the counts of the numSec sectors starting at the
+// sector with index startIdx.
+func (rc *refCounter) callCountRange(startIdx, numSec uint64) ([]uint16, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.readCountRange(startIdx, numSec)
+}
+
 // callCreateAndApplyTransaction is a helper method that creates a writeaheadlog
 // transaction and applies it.
 func (rc *refCounter) callCreateAndApplyTransaction(updates ...writeaheadlog.Update) error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	// We allow the creation of the file here because of the case where we got
@@ -253,23 +590,33 @@ func (rc *refCounter) callCreateAndApplyTransaction(updates ...writeaheadlog.Upd
 	if err = txn.SignalUpdatesApplied(); err != nil {
 		return errors.AddContext(err, "failed to signal that updates are applied")
 	}
-	// If the refcounter got deleted then we're done.
+	// If the refcounter got deleted then we release and remove its lock and
+	// we're done.
 	if rc.isDeleted {
-		return nil
+		errMap := errors.AddContext(rc.remap(), "failed to unmap refcounter")
+		if rc.lock == nil {
+			return errMap
+		}
+		errLock := rc.lock.release(true)
+		rc.lock = nil
+		return errors.Compose(errMap, errors.AddContext(errLock, "failed to release refcounter lock"))
 	}
 	// Update the in-memory helper fields.
 	fi, err := os.Stat(rc.filepath)
 	if err != nil {
 		return errors.AddContext(err, "failed to read from disk after updates")
 	}
-	rc.numSectors = uint64((fi.Size() - refCounterHeaderSize) / 2)
-	return nil
+	rc.numSectors = uint64(fi.Size()-refCounterHeaderSize) / rc.Mode.recordSize()
+	return errors.AddContext(rc.remap(), "failed to remap refcounter")
 }
 
 // callDecrement decrements the reference counter of a given sector. The sector
 // is specified by its sequential number (secIdx).
 // Returns the updated number of references or an error.
 func (rc *refCounter) callDecrement(secIdx uint64) (writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -279,22 +626,26 @@ func (rc *refCounter) callDecrement(secIdx uint64) (writeaheadlog.Update, error)
 		return writeaheadlog.Update{}, ErrUpdateAfterDelete
 	}
 	if secIdx >= rc.numSectors {
-		return writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, "failed to decrement")
+		return writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to decrement sector %v", secIdx))
 	}
 	count, err := rc.readCount(secIdx)
 	if err != nil {
-		return writeaheadlog.Update{}, errors.AddContext(err, "failed to read count from decrement")
+		return writeaheadlog.Update{}, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for decrement", secIdx))
 	}
 	if count == 0 {
-		return writeaheadlog.Update{}, errors.New("sector count underflow")
+		return writeaheadlog.Update{}, errors.AddContext(ErrSectorCountUnderflow, fmt.Sprintf("failed to decrement sector %v", secIdx))
 	}
 	count--
 	rc.newSectorCounts[secIdx] = count
+	rc.opLog.add(refCounterOpDecrement, secIdx, count+1, count)
 	return createWriteAtUpdate(rc.filepath, secIdx, count), nil
 }
 
 // callDeleteRefCounter deletes the counter's file from disk
 func (rc *refCounter) callDeleteRefCounter() (writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -310,6 +661,9 @@ func (rc *refCounter) callDeleteRefCounter() (writeaheadlog.Update, error) {
 
 // callDropSectors removes the last numSec sector counts from the refcounter file
 func (rc *refCounter) callDropSectors(numSec uint64) (writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -319,42 +673,159 @@ func (rc *refCounter) callDropSectors(numSec uint64) (writeaheadlog.Update, erro
 		return writeaheadlog.Update{}, ErrUpdateAfterDelete
 	}
 	if numSec > rc.numSectors {
-		return writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, "failed to drop sectors")
+		return writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to drop %v of %v sectors", numSec, rc.numSectors))
+	}
+	if len(rc.reservations) > 0 {
+		return writeaheadlog.Update{}, ErrRefCounterSectorsReserved
+	}
+	if rc.opLog != nil {
+		// Only log as many dropped sectors as fit into the log.
+		first := rc.numSectors - numSec
+		if logSize := uint64(len(rc.opLog.entries)); numSec > logSize {
+			first = rc.numSectors - logSize
+		}
+		for secIdx := first; secIdx < rc.numSectors; secIdx++ {
+			count, err := rc.readCount(secIdx)
+			if err != nil {
+				return writeaheadlog.Update{}, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for drop sectors", secIdx))
+			}
+			rc.opLog.add(refCounterOpDropSectors, secIdx, count, 0)
+		}
 	}
 	rc.numSectors -= numSec
 	return createTruncateUpdate(rc.filepath, rc.numSectors), nil
 }
 
+// callFill sets the reference counters of all sectors to the given value. In
+// contrast to calling callSetCount for every sector, this creates a single
+// update which is applied with a single write.
+func (rc *refCounter) callFill(value uint16) ([]writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.isUpdateInProgress {
+		return nil, ErrUpdateWithoutUpdateSession
+	}
+	if rc.isDeleted {
+		return nil, ErrUpdateAfterDelete
+	}
+	// The fill overrides all pending counts.
+	rc.newSectorCounts = make(map[uint64]uint16)
+	rc.fillValue = &value
+	rc.opLog.add(refCounterOpFill, rc.numSectors, 0, value)
+	return []writeaheadlog.Update{createWriteRangeUpdate(rc.filepath, 0, rc.numSectors, value)}, nil
+}
+
+// callForEachCount calls fn with the index and count of every sector starting
+// at startIdx in ascending order. The counts are read in batches and fn is
+// called without holding the refcounter's lock, so fn may use the refcounter.
+// Sectors which are appended or dropped while iterating are included or
+// skipped respectively. If fn returns an error, the iteration stops and the
+// error is returned.
+func (rc *refCounter) callForEachCount(startIdx uint64, fn func(secIdx uint64, count uint16) error) error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
+	for secIdx := startIdx; ; {
+		counts, err := rc.managedCountBatch(secIdx)
+		if err != nil {
+			return err
+		}
+		if len(counts) == 0 {
+			return nil
+		}
+		for _, count := range counts {
+			if err := fn(secIdx, count); err != nil {
+				return err
+			}
+			secIdx++
+		}
+	}
+}
+
 // callIncrement increments the reference counter of a given sector. The sector
 // is specified by its sequential number (secIdx).
 // Returns the updated number of references or an error.
 func (rc *refCounter) callIncrement(secIdx uint64) (writeaheadlog.Update, error) {
+	u, _, err := rc.callIncrementSaturating(secIdx)
+	return u, err
+}
+
+// callIncrementSaturating increments the reference counter of a given sector
+// like callIncrement and also returns whether the counter saturated. If the
+// refcounter was loaded with a SaturatingMax, a counter that reached the max
+// keeps its value instead of causing an overflow error.
+func (rc *refCounter) callIncrementSaturating(secIdx uint64) (_ writeaheadlog.Update, saturated bool, _ error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, false, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
-		return writeaheadlog.Update{}, ErrUpdateWithoutUpdateSession
+		return writeaheadlog.Update{}, false, ErrUpdateWithoutUpdateSession
 	}
 	if rc.isDeleted {
-		return writeaheadlog.Update{}, ErrUpdateAfterDelete
+		return writeaheadlog.Update{}, false, ErrUpdateAfterDelete
 	}
 	if secIdx >= rc.numSectors {
-		return writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, "failed to increment")
+		return writeaheadlog.Update{}, false, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to increment sector %v", secIdx))
 	}
 	count, err := rc.readCount(secIdx)
 	if err != nil {
-		return writeaheadlog.Update{}, errors.AddContext(err, "failed to read count from increment")
+		return writeaheadlog.Update{}, false, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for increment", secIdx))
 	}
-	if count == math.MaxUint16 {
-		return writeaheadlog.Update{}, errors.New("sector count overflow")
+	newCount := count + 1
+	if rc.staticSaturatingMax > 0 && count >= rc.staticSaturatingMax {
+		newCount = count
+		saturated = true
+	} else if count == math.MaxUint16 {
+		return writeaheadlog.Update{}, false, errors.AddContext(ErrSectorCountOverflow, fmt.Sprintf("failed to increment sector %v", secIdx))
 	}
-	count++
-	rc.newSectorCounts[secIdx] = count
-	return createWriteAtUpdate(rc.filepath, secIdx, count), nil
+	rc.newSectorCounts[secIdx] = newCount
+	rc.opLog.add(refCounterOpIncrement, secIdx, count, newCount)
+	return createWriteAtUpdate(rc.filepath, secIdx, newCount), saturated, nil
+}
+
+// callReserveSectors claims the n sectors following the last sector of the
+// refcounter and any previously reserved sectors. It returns the index of the
+// first reserved sector. This allows multiple appenders to determine the
+// indices of their sectors upfront without stepping on each other. The counts
+// of the sectors are set by callCommitReservedSectors within an update
+// session. Reservations don't require an update session themselves. They are
+// not persisted, so reservations which weren't committed before a restart are
+// lost.
+func (rc *refCounter) callReserveSectors(n uint64) (uint64, error) {
+	if !rc.initialized() {
+		return 0, ErrRefCounterNotInitialized
+	}
+	if n == 0 {
+		return 0, errors.New("can't reserve 0 sectors")
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.isDeleted {
+		return 0, ErrUpdateAfterDelete
+	}
+	startIdx := rc.nextSectorIndex()
+	if startIdx+n < startIdx {
+		return 0, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to reserve %v sectors starting at sector %v", n, startIdx))
+	}
+	if rc.reservations == nil {
+		rc.reservations = make(map[uint64]uint64)
+	}
+	rc.reservations[startIdx] = n
+	rc.reservedEnd = startIdx + n
+	return startIdx, nil
 }
 
 // callSetCount sets the value of the reference counter of a given sector. The
 // sector is specified by its sequential number (secIdx).
 func (rc *refCounter) callSetCount(secIdx uint64, c uint16) (writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return writeaheadlog.Update{}, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -363,6 +834,17 @@ func (rc *refCounter) callSetCount(secIdx uint64, c uint16) (writeaheadlog.Updat
 	if rc.isDeleted {
 		return writeaheadlog.Update{}, ErrUpdateAfterDelete
 	}
+	if rc.opLog != nil {
+		var oldCount uint16
+		if secIdx < rc.numSectors {
+			var err error
+			oldCount, err = rc.readCount(secIdx)
+			if err != nil {
+				return writeaheadlog.Update{}, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for set count", secIdx))
+			}
+		}
+		rc.opLog.add(refCounterOpSetCount, secIdx, oldCount, c)
+	}
 	// this allows the client to set multiple new counts in random order
 	if secIdx >= rc.numSectors {
 		rc.numSectors = secIdx + 1
@@ -376,12 +858,50 @@ func (rc *refCounter) callSetCount(secIdx uint64, c uint16) (writeaheadlog.Updat
 // calling callUpdateApplied after calling callCreateAndApplyTransaction in
 // order to apply the updates.
 func (rc *refCounter) callStartUpdate() error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
 	rc.muUpdate.Lock()
 	return rc.managedStartUpdate()
 }
 
+// callStats returns a summary of the counts of all sectors. In contrast to
+// callForEachCount, the read lock is held for the whole computation so the
+// stats reflect a single state of the refcounter.
+func (rc *refCounter) callStats() (refCounterStats, error) {
+	if !rc.initialized() {
+		return refCounterStats{}, ErrRefCounterNotInitialized
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	stats := refCounterStats{NumSectors: rc.numSectors}
+	for startIdx := uint64(0); startIdx < rc.numSectors; startIdx += refCounterIterBatchSize {
+		numSec := rc.numSectors - startIdx
+		if numSec > refCounterIterBatchSize {
+			numSec = refCounterIterBatchSize
+		}
+		counts, err := rc.readCountRange(startIdx, numSec)
+		if err != nil {
+			return refCounterStats{}, errors.AddContext(err, "failed to read counts for stats")
+		}
+		for _, count := range counts {
+			if count == 0 {
+				stats.NumUnreferenced++
+			}
+			if count > stats.MaxCount {
+				stats.MaxCount = count
+			}
+			stats.TotalReferences += uint64(count)
+		}
+	}
+	return stats, nil
+}
+
 // callSwap swaps the two sectors at the given indices
 func (rc *refCounter) callSwap(firstIdx, secondIdx uint64) ([]writeaheadlog.Update, error) {
+	if !rc.initialized() {
+		return nil, ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	if !rc.isUpdateInProgress {
@@ -391,27 +911,46 @@ func (rc *refCounter) callSwap(firstIdx, secondIdx uint64) ([]writeaheadlog.Upda
 		return []writeaheadlog.Update{}, ErrUpdateAfterDelete
 	}
 	if firstIdx >= rc.numSectors || secondIdx >= rc.numSectors {
-		return []writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, "failed to swap sectors")
+		return []writeaheadlog.Update{}, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to swap sectors %v and %v", firstIdx, secondIdx))
 	}
 	firstVal, err := rc.readCount(firstIdx)
 	if err != nil {
-		return []writeaheadlog.Update{}, errors.AddContext(err, "failed to read count from swap")
+		return []writeaheadlog.Update{}, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for swap", firstIdx))
 	}
 	secondVal, err := rc.readCount(secondIdx)
 	if err != nil {
-		return []writeaheadlog.Update{}, errors.AddContext(err, "failed to read count from swap")
+		return []writeaheadlog.Update{}, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v for swap", secondIdx))
 	}
 	rc.newSectorCounts[firstIdx] = secondVal
 	rc.newSectorCounts[secondIdx] = firstVal
+	rc.opLog.add(refCounterOpSwap, firstIdx, firstVal, secondVal)
+	rc.opLog.add(refCounterOpSwap, secondIdx, secondVal, firstVal)
 	return []writeaheadlog.Update{
 		createWriteAtUpdate(rc.filepath, firstIdx, secondVal),
 		createWriteAtUpdate(rc.filepath, secondIdx, firstVal),
 	}, nil
 }
 
+// callWaitForUpdateSession waits up to timeout for an open update session to
+// finish. ErrRefCounterUpdateInProgress is returned if the session is still
+// open once the timeout expired.
+func (rc *refCounter) callWaitForUpdateSession(timeout time.Duration) error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
+	if !rc.muUpdate.TryLockTimed(timeout) {
+		return errors.AddContext(ErrRefCounterUpdateInProgress, rc.filepath)
+	}
+	rc.muUpdate.Unlock()
+	return nil
+}
+
 // callUpdateApplied cleans up temporary data and releases the update lock, thus
 // allowing other actors to acquire it in order to update the refcounter.
 func (rc *refCounter) callUpdateApplied() error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 
@@ -422,6 +961,7 @@ func (rc *refCounter) callUpdateApplied() error {
 
 	// clean up the temp counts
 	rc.newSectorCounts = make(map[uint64]uint16)
+	rc.fillValue = nil
 	// close the update session
 	rc.isUpdateInProgress = false
 	// release the update lock
@@ -429,6 +969,30 @@ func (rc *refCounter) callUpdateApplied() error {
 	return nil
 }
 
+// initialized returns whether the refcounter was created by one of its
+// constructors. Calling methods on a zero-value or nil refcounter would
+// otherwise panic. Only fields which are set once by the constructors are
+// checked since the guard is called without holding the lock.
+func (rc *refCounter) initialized() bool {
+	return rc != nil && rc.staticWal != nil && rc.staticDeps != nil
+}
+
+// managedCountBatch reads the counts of up to refCounterIterBatchSize sectors
+// starting at startIdx. It returns no counts if startIdx is not smaller than
+// the number of sectors.
+func (rc *refCounter) managedCountBatch(startIdx uint64) ([]uint16, error) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	if startIdx >= rc.numSectors {
+		return nil, nil
+	}
+	numSec := rc.numSectors - startIdx
+	if numSec > refCounterIterBatchSize {
+		numSec = refCounterIterBatchSize
+	}
+	return rc.readCountRange(startIdx, numSec)
+}
+
 // managedStartUpdate does everything callStartUpdate needs, aside from acquiring a
 // lock
 func (rc *refCounter) managedStartUpdate() error {
@@ -442,52 +1006,142 @@ func (rc *refCounter) managedStartUpdate() error {
 	return nil
 }
 
+// nextSectorIndex returns the index of the first sector which neither exists
+// nor is reserved.
+func (rc *refCounter) nextSectorIndex() uint64 {
+	if rc.reservedEnd > rc.numSectors {
+		return rc.reservedEnd
+	}
+	return rc.numSectors
+}
+
 // readCount reads the given sector count either from disk (if there are no
 // pending updates) or from the in-memory cache (if there are).
 func (rc *refCounter) readCount(secIdx uint64) (_ uint16, err error) {
 	// check if the secIdx is a valid sector index based on the number of
 	// sectors in the file
 	if secIdx >= rc.numSectors {
-		return 0, errors.AddContext(ErrInvalidSectorNumber, "failed to read count")
+		return 0, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to read count of sector %v of %v", secIdx, rc.numSectors))
 	}
 	// check if the value is being changed by a pending update
 	if count, ok := rc.newSectorCounts[secIdx]; ok {
 		return count, nil
 	}
-	// read the value from disk
+	if rc.fillValue != nil {
+		return *rc.fillValue, nil
+	}
+	// read the value from the mapping or from disk
+	b := make([]byte, rc.Mode.recordSize())
+	if rc.mmap.readAt(b, rc.Mode.offset(secIdx)) {
+		return rc.Mode.decodeCount(secIdx, b)
+	}
 	f, err := rc.staticDeps.Open(rc.filepath)
 	if err != nil {
-		return 0, errors.AddContext(err, "failed to open the refcounter file")
+		return 0, errors.AddContext(err, fmt.Sprintf("failed to open the refcounter file %v", rc.filepath))
 	}
 	defer func() {
 		err = errors.Compose(err, f.Close())
 	}()
 
-	var b u16
-	if _, err = f.ReadAt(b[:], int64(offset(secIdx))); err != nil {
-		return 0, errors.AddContext(err, "failed to read from refcounter file")
+	if _, err = f.ReadAt(b, int64(rc.Mode.offset(secIdx))); err != nil {
+		return 0, errors.AddContext(err, fmt.Sprintf("failed to read count of sector %v from refcounter file", secIdx))
+	}
+	return rc.Mode.decodeCount(secIdx, b)
+}
+
+// readCountRange reads the counts of numSec sectors starting at startIdx with a
+// single read and applies the values of pending updates on top.
+func (rc *refCounter) readCountRange(startIdx, numSec uint64) (_ []uint16, err error) {
+	if startIdx+numSec < startIdx || startIdx+numSec > rc.numSectors {
+		return nil, errors.AddContext(ErrInvalidSectorNumber, fmt.Sprintf("failed to read counts of %v sectors starting at sector %v", numSec, startIdx))
+	}
+	counts := make([]uint16, numSec)
+	if numSec == 0 {
+		return counts, nil
+	}
+	if rc.fillValue != nil {
+		for i := range counts {
+			counts[i] = *rc.fillValue
+		}
+	} else {
+		// read the values from the mapping or from disk
+		size := rc.Mode.recordSize()
+		b, mapped := rc.mmap.slice(rc.Mode.offset(startIdx), size*numSec)
+		if !mapped {
+			b = make([]byte, size*numSec)
+			f, err := rc.staticDeps.Open(rc.filepath)
+			if err != nil {
+				return nil, errors.AddContext(err, fmt.Sprintf("failed to open the refcounter file %v", rc.filepath))
+			}
+			defer func() {
+				err = errors.Compose(err, f.Close())
+			}()
+			if _, err = f.ReadAt(b, int64(rc.Mode.offset(startIdx))); err != nil {
+				return nil, errors.AddContext(err, fmt.Sprintf("failed to read counts of %v sectors starting at sector %v from refcounter file", numSec, startIdx))
+			}
+		}
+		for i := range counts {
+			secIdx := startIdx + uint64(i)
+			if counts[i], err = rc.Mode.decodeCount(secIdx, b[size*uint64(i):]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// apply the values of pending updates
+	for secIdx, count := range rc.newSectorCounts {
+		if secIdx >= startIdx && secIdx < startIdx+numSec {
+			counts[secIdx-startIdx] = count
+		}
+	}
+	return counts, nil
+}
+
+// writeCounts sets the counts of the sectors starting at secIdx and returns the
+// update which persists them. The refcounter is extended if necessary. If
+// secIdx lies beyond the last sector, the sectors in between are reserved but
+// not committed yet and are initialized with 0.
+func (rc *refCounter) writeCounts(secIdx uint64, counts []uint16) writeaheadlog.Update {
+	if secIdx > rc.numSectors {
+		counts = append(make([]uint16, secIdx-rc.numSectors), counts...)
+		secIdx = rc.numSectors
+	}
+	for i, count := range counts {
+		rc.newSectorCounts[secIdx+uint64(i)] = count
 	}
-	return binary.LittleEndian.Uint16(b[:]), nil
+	if end := secIdx + uint64(len(counts)); end > rc.numSectors {
+		rc.numSectors = end
+	}
+	return createWriteCountsUpdate(rc.filepath, secIdx, counts)
 }
 
-// applyUpdates takes a list of WAL updates and applies them.
+// applyUpdates takes a list of WAL updates and applies them. The updates don't
+// depend on the mode of the refcounter, which is read from the header of the
+// file instead.
 func applyUpdates(f modules.File, updates ...writeaheadlog.Update) (err error) {
+	mode, err := readMode(f)
+	if err != nil {
+		return errors.AddContext(err, "failed to read refcounter mode")
+	}
 	for _, update := range updates {
 		switch update.Name {
 		case updateNameRCDelete:
 			err = applyDeleteUpdate(update)
 		case updateNameRCTruncate:
-			err = applyTruncateUpdate(f, update)
+			err = applyTruncateUpdate(f, mode, update)
 		case updateNameRCWriteAt:
-			err = applyWriteAtUpdate(f, update)
+			err = applyWriteAtUpdate(f, mode, update)
+		case updateNameRCWriteCounts:
+			err = applyWriteCountsUpdate(f, mode, update)
+		case updateNameRCWriteRange:
+			err = applyWriteRangeUpdate(f, mode, update)
 		default:
 			err = fmt.Errorf("unknown update type: %v", update.Name)
 		}
 		if err != nil {
-			return err
+			return errors.AddContext(err, fmt.Sprintf("failed to apply %v update", update.Name))
 		}
 	}
-	return f.Sync()
+	return errors.AddContext(f.Sync(), "failed to sync refcounter file")
 }
 
 // createDeleteUpdate is a helper function which creates a writeaheadlog update
@@ -524,7 +1178,7 @@ func createTruncateUpdate(path string, newNumSec uint64) writeaheadlog.Update {
 }
 
 // applyTruncateUpdate parses and applies a Truncate update.
-func applyTruncateUpdate(f modules.File, u writeaheadlog.Update) error {
+func applyTruncateUpdate(f modules.File, mode RefCounterMode, u writeaheadlog.Update) error {
 	if u.Name != updateNameRCTruncate {
 		return fmt.Errorf("applyAppendTruncate called on update of type %v", u.Name)
 	}
@@ -534,7 +1188,7 @@ func applyTruncateUpdate(f modules.File, u writeaheadlog.Update) error {
 		return err
 	}
 	// Truncate the file to the needed size.
-	return f.Truncate(refCounterHeaderSize + int64(newNumSec)*2)
+	return errors.AddContext(f.Truncate(int64(mode.offset(newNumSec))), fmt.Sprintf("failed to truncate refcounter to %v sectors", newNumSec))
 }
 
 // createWriteAtUpdate is a helper function which creates a writeaheadlog
@@ -551,7 +1205,7 @@ func createWriteAtUpdate(path string, secIdx uint64, value uint16) writeaheadlog
 }
 
 // applyWriteAtUpdate parses and applies a WriteAt update.
-func applyWriteAtUpdate(f modules.File, u writeaheadlog.Update) error {
+func applyWriteAtUpdate(f modules.File, mode RefCounterMode, u writeaheadlog.Update) error {
 	if u.Name != updateNameRCWriteAt {
 		return fmt.Errorf("applyAppendWriteAt called on update of type %v", u.Name)
 	}
@@ -562,10 +1216,83 @@ func applyWriteAtUpdate(f modules.File, u writeaheadlog.Update) error {
 	}
 
 	// Write the value to disk.
-	var b u16
-	binary.LittleEndian.PutUint16(b[:], value)
-	_, err = f.WriteAt(b[:], int64(offset(secIdx)))
-	return err
+	_, err = f.WriteAt(mode.encodeCounts(secIdx, []uint16{value}), int64(mode.offset(secIdx)))
+	return errors.AddContext(err, fmt.Sprintf("failed to write count of sector %v", secIdx))
+}
+
+// createWriteCountsUpdate is a helper function which creates a writeaheadlog
+// update for writing the given values to consecutive positions in the file,
+// starting at secIdx.
+func createWriteCountsUpdate(path string, secIdx uint64, counts []uint16) writeaheadlog.Update {
+	numSec := uint64(len(counts))
+	b := make([]byte, 8+8+2*numSec+uint64(len(path)))
+	binary.LittleEndian.PutUint64(b[:8], secIdx)
+	binary.LittleEndian.PutUint64(b[8:16], numSec)
+	for i, count := range counts {
+		binary.LittleEndian.PutUint16(b[16+2*i:], count)
+	}
+	copy(b[16+2*numSec:], path)
+	return writeaheadlog.Update{
+		Name:         updateNameRCWriteCounts,
+		Instructions: b,
+	}
+}
+
+// applyWriteCountsUpdate parses and applies a WriteCounts update.
+func applyWriteCountsUpdate(f modules.File, mode RefCounterMode, u writeaheadlog.Update) error {
+	if u.Name != updateNameRCWriteCounts {
+		return fmt.Errorf("applyWriteCountsUpdate called on update of type %v", u.Name)
+	}
+	// Decode update.
+	_, secIdx, counts, err := readWriteCountsUpdate(u)
+	if err != nil {
+		return err
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// Write the values to disk.
+	_, err = f.WriteAt(mode.encodeCounts(secIdx, counts), int64(mode.offset(secIdx)))
+	return errors.AddContext(err, fmt.Sprintf("failed to write counts of %v sectors starting at sector %v", len(counts), secIdx))
+}
+
+// createWriteRangeUpdate is a helper function which creates a writeaheadlog
+// update for writing the same value to numSec positions in the file, starting
+// at secIdx.
+func createWriteRangeUpdate(path string, secIdx, numSec uint64, value uint16) writeaheadlog.Update {
+	b := make([]byte, 8+8+2+len(path))
+	binary.LittleEndian.PutUint64(b[:8], secIdx)
+	binary.LittleEndian.PutUint64(b[8:16], numSec)
+	binary.LittleEndian.PutUint16(b[16:18], value)
+	copy(b[18:18+len(path)], path)
+	return writeaheadlog.Update{
+		Name:         updateNameRCWriteRange,
+		Instructions: b,
+	}
+}
+
+// applyWriteRangeUpdate parses and applies a WriteRange update.
+func applyWriteRangeUpdate(f modules.File, mode RefCounterMode, u writeaheadlog.Update) error {
+	if u.Name != updateNameRCWriteRange {
+		return fmt.Errorf("applyWriteRangeUpdate called on update of type %v", u.Name)
+	}
+	// Decode update.
+	_, secIdx, numSec, value, err := readWriteRangeUpdate(u)
+	if err != nil {
+		return err
+	}
+	if numSec == 0 {
+		return nil
+	}
+
+	// Write the values to disk.
+	counts := make([]uint16, numSec)
+	for i := range counts {
+		counts[i] = value
+	}
+	_, err = f.WriteAt(mode.encodeCounts(secIdx, counts), int64(mode.offset(secIdx)))
+	return errors.AddContext(err, fmt.Sprintf("failed to write counts of %v sectors starting at sector %v", numSec, secIdx))
 }
 
 // deserializeHeader deserializes a header from []byte
@@ -573,13 +1300,81 @@ func deserializeHeader(b []byte, h *refCounterHeader) error {
 	if uint64(len(b)) < refCounterHeaderSize {
 		return ErrInvalidHeaderData
 	}
-	copy(h.Version[:], b[:8])
+	copy(h.Version[:], b[:7])
+	h.Mode = RefCounterMode(b[7])
 	return nil
 }
 
+// readMode reads the mode from the header of the refcounter file. Files which
+// are too short to contain a header are still being created and use
+// RefCounterModeFast.
+func readMode(f modules.File) (RefCounterMode, error) {
+	var h refCounterHeader
+	b := make([]byte, refCounterHeaderSize)
+	if _, err := f.ReadAt(b, 0); errors.Contains(err, io.EOF) {
+		return RefCounterModeFast, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if err := deserializeHeader(b, &h); err != nil {
+		return 0, err
+	}
+	if !h.Mode.valid() {
+		return 0, errors.AddContext(ErrInvalidRefCounterMode, fmt.Sprint(h.Mode))
+	}
+	return h.Mode, nil
+}
+
+// decodeCount decodes the count of the sector with index secIdx from the
+// beginning of b and verifies its checksum if necessary.
+func (m RefCounterMode) decodeCount(secIdx uint64, b []byte) (uint16, error) {
+	count := binary.LittleEndian.Uint16(b)
+	if m == RefCounterModeVerified && binary.LittleEndian.Uint32(b[2:]) != countChecksum(secIdx, count) {
+		return 0, errors.AddContext(ErrSectorChecksumMismatch, fmt.Sprintf("failed to read count of sector %v", secIdx))
+	}
+	return count, nil
+}
+
+// encodeCounts encodes the counts of the sectors starting at secIdx.
+func (m RefCounterMode) encodeCounts(secIdx uint64, counts []uint16) []byte {
+	size := m.recordSize()
+	b := make([]byte, size*uint64(len(counts)))
+	for i, count := range counts {
+		record := b[size*uint64(i):]
+		binary.LittleEndian.PutUint16(record, count)
+		if m == RefCounterModeVerified {
+			binary.LittleEndian.PutUint32(record[2:], countChecksum(secIdx+uint64(i), count))
+		}
+	}
+	return b
+}
+
 // offset calculates the byte offset of the sector counter in the file on disk
-func offset(secIdx uint64) uint64 {
-	return refCounterHeaderSize + secIdx*2
+func (m RefCounterMode) offset(secIdx uint64) uint64 {
+	return refCounterHeaderSize + secIdx*m.recordSize()
+}
+
+// recordSize returns the number of bytes used to store the count of a single
+// sector.
+func (m RefCounterMode) recordSize() uint64 {
+	if m == RefCounterModeVerified {
+		return 6
+	}
+	return 2
+}
+
+// valid returns whether the mode is known.
+func (m RefCounterMode) valid() bool {
+	return m == RefCounterModeFast || m == RefCounterModeVerified
+}
+
+// countChecksum returns the checksum of a sector's count. It covers the
+// sector's index to detect counts which were written to the wrong position.
+func countChecksum(secIdx uint64, count uint16) uint32 {
+	var b [10]byte
+	binary.LittleEndian.PutUint64(b[:8], secIdx)
+	binary.LittleEndian.PutUint16(b[8:], count)
+	return crc32.ChecksumIEEE(b[:])
 }
 
 // readTruncateUpdate decodes a Truncate update
@@ -605,9 +1400,43 @@ func readWriteAtUpdate(u writeaheadlog.Update) (path string, secIdx uint64, valu
 	return
 }
 
+// readWriteCountsUpdate decodes a WriteCounts update
+func readWriteCountsUpdate(u writeaheadlog.Update) (path string, secIdx uint64, counts []uint16, err error) {
+	if len(u.Instructions) < 16 {
+		err = ErrInvalidUpdateInstruction
+		return
+	}
+	secIdx = binary.LittleEndian.Uint64(u.Instructions[:8])
+	numSec := binary.LittleEndian.Uint64(u.Instructions[8:16])
+	if numSec > uint64(len(u.Instructions)-16)/2 {
+		err = ErrInvalidUpdateInstruction
+		return
+	}
+	counts = make([]uint16, numSec)
+	for i := range counts {
+		counts[i] = binary.LittleEndian.Uint16(u.Instructions[16+2*i:])
+	}
+	path = string(u.Instructions[16+2*numSec:])
+	return
+}
+
+// readWriteRangeUpdate decodes a WriteRange update
+func readWriteRangeUpdate(u writeaheadlog.Update) (path string, secIdx, numSec uint64, value uint16, err error) {
+	if len(u.Instructions) < 18 {
+		err = ErrInvalidUpdateInstruction
+		return
+	}
+	secIdx = binary.LittleEndian.Uint64(u.Instructions[:8])
+	numSec = binary.LittleEndian.Uint64(u.Instructions[8:16])
+	value = binary.LittleEndian.Uint16(u.Instructions[16:18])
+	path = string(u.Instructions[18:])
+	return
+}
+
 // serializeHeader serializes a header to []byte
 func serializeHeader(h refCounterHeader) []byte {
 	b := make([]byte, refCounterHeaderSize)
-	copy(b[:8], h.Version[:])
+	copy(b[:7], h.Version[:])
+	b[7] = byte(h.Mode)
 	return b
 }
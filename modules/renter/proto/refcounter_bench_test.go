@@ -0,0 +1,185 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/writeaheadlog"
+
+	"go.sia.tech/siad/build"
+)
+
+// benchPrepareRefCounter is a helper that creates a refcounter with numSec
+// sectors for a benchmark. Benchmarks are run multiple times with the same
+// name, so any refcounter left behind by a previous run is removed first. The
+// refcounter is closed when the benchmark is done.
+func benchPrepareRefCounter(numSec uint64, b *testing.B) *refCounter {
+	if err := os.RemoveAll(build.TempDir(b.Name())); err != nil {
+		b.Fatal(err)
+	}
+	rc := testPrepareRefCounter(numSec, b)
+	b.Cleanup(func() {
+		if err := rc.callClose(); err != nil {
+			b.Error(err)
+		}
+	})
+	return rc
+}
+
+// benchApplyUpdates is a helper that applies the updates within an update
+// session.
+func benchApplyUpdates(rc *refCounter, updates []writeaheadlog.Update, b *testing.B) {
+	if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+		b.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkRefCounterCountColdWarm measures reading a single count from a
+// refcounter that was just loaded from disk and from a refcounter which has
+// already been read from.
+func BenchmarkRefCounterCountColdWarm(b *testing.B) {
+	rc := benchPrepareRefCounter(1<<16, b)
+	b.Run("Cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rcLoaded, err := loadRefCounter(rc.filepath, testWAL)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := rcLoaded.callCount(fastrand.Uint64n(rcLoaded.numSectors)); err != nil {
+				b.Fatal(err)
+			}
+			if err := rcLoaded.callClose(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Warm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := rc.callCount(fastrand.Uint64n(rc.numSectors)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkRefCounterCountRangeLarge measures reading ranges of different
+// lengths from a refcounter with 1<<20 sectors, up to reading all of them.
+func BenchmarkRefCounterCountRangeLarge(b *testing.B) {
+	rc := benchPrepareRefCounter(1<<20, b)
+	for _, numSec := range []uint64{1 << 6, 1 << 12, 1 << 20} {
+		b.Run(fmt.Sprint(numSec), func(b *testing.B) {
+			b.SetBytes(int64(2 * numSec))
+			for i := 0; i < b.N; i++ {
+				startIdx := fastrand.Uint64n(rc.numSectors - numSec + 1)
+				if _, err := rc.callCountRange(startIdx, numSec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRefCounterIncrementBatch compares applying a batch of increments
+// one update per sector to coalescing them with callApplyDeltas. Every other
+// batch decrements the counts again to avoid overflowing them.
+func BenchmarkRefCounterIncrementBatch(b *testing.B) {
+	for _, batchSize := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("Individual/%v", batchSize), func(b *testing.B) {
+			rc := benchPrepareRefCounter(uint64(batchSize), b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := rc.callStartUpdate(); err != nil {
+					b.Fatal(err)
+				}
+				updates := make([]writeaheadlog.Update, 0, batchSize)
+				for secIdx := uint64(0); secIdx < uint64(batchSize); secIdx++ {
+					var u writeaheadlog.Update
+					var err error
+					if i%2 == 0 {
+						u, err = rc.callIncrement(secIdx)
+					} else {
+						u, err = rc.callDecrement(secIdx)
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					updates = append(updates, u)
+				}
+				benchApplyUpdates(rc, updates, b)
+			}
+		})
+		b.Run(fmt.Sprintf("Coalesced/%v", batchSize), func(b *testing.B) {
+			rc := benchPrepareRefCounter(uint64(batchSize), b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := rc.callStartUpdate(); err != nil {
+					b.Fatal(err)
+				}
+				delta := 1
+				if i%2 == 1 {
+					delta = -1
+				}
+				deltas := make(map[uint64]int, batchSize)
+				for secIdx := uint64(0); secIdx < uint64(batchSize); secIdx++ {
+					deltas[secIdx] = delta
+				}
+				updates, err := rc.callApplyDeltas(deltas)
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchApplyUpdates(rc, updates, b)
+			}
+		})
+	}
+}
+
+// BenchmarkRefCounterAppendMany compares appending sectors one by one to
+// reserving them upfront and committing them with a single update.
+func BenchmarkRefCounterAppendMany(b *testing.B) {
+	const numAppends = 64
+	b.Run("Append", func(b *testing.B) {
+		rc := benchPrepareRefCounter(0, b)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := rc.callStartUpdate(); err != nil {
+				b.Fatal(err)
+			}
+			updates := make([]writeaheadlog.Update, 0, numAppends)
+			for j := 0; j < numAppends; j++ {
+				u, err := rc.callAppend()
+				if err != nil {
+					b.Fatal(err)
+				}
+				updates = append(updates, u)
+			}
+			benchApplyUpdates(rc, updates, b)
+		}
+	})
+	b.Run("Reserve", func(b *testing.B) {
+		rc := benchPrepareRefCounter(0, b)
+		values := make([]uint16, numAppends)
+		for i := range values {
+			values[i] = 1
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			startIdx, err := rc.callReserveSectors(numAppends)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := rc.callStartUpdate(); err != nil {
+				b.Fatal(err)
+			}
+			updates, err := rc.callCommitReservedSectors(startIdx, values)
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchApplyUpdates(rc, updates, b)
+		}
+	})
+}
@@ -5,9 +5,15 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -156,6 +162,308 @@ func TestRefCounterAppend(t *testing.T) {
 	}
 }
 
+// TestRefCounterConcurrentReaders runs many readers concurrently with a
+// TestRefCounterApplyDeltas tests applying a map of deltas to a refcounter.
+func TestRefCounterApplyDeltas(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// prepare a refcounter with all counts set to 1
+	rc := testPrepareRefCounter(10, t)
+	deltas := map[uint64]int{2: 3, 3: -1, 4: 2, 7: 1, 9: 0}
+
+	// applying deltas requires an update session
+	_, err := rc.callApplyDeltas(deltas)
+	if !errors.Contains(err, ErrUpdateWithoutUpdateSession) {
+		t.Fatal("Expected ErrUpdateWithoutUpdateSession, got:", err)
+	}
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// invalid deltas are rejected without changing any counts
+	invalid := []struct {
+		deltas map[uint64]int
+		err    error
+	}{
+		{map[uint64]int{0: 1, 10: 1}, ErrInvalidSectorNumber},
+		{map[uint64]int{0: 1, 1: -2}, ErrSectorCountUnderflow},
+		{map[uint64]int{0: 1, 1: math.MaxUint16}, ErrSectorCountOverflow},
+	}
+	for _, test := range invalid {
+		if _, err := rc.callApplyDeltas(test.deltas); !errors.Contains(err, test.err) {
+			t.Fatalf("Expected %v, got %v", test.err, err)
+		}
+		if count, err := rc.readCount(0); err != nil || count != 1 {
+			t.Fatal("count changed by invalid deltas", count, err)
+		}
+	}
+
+	// contiguous sectors are written with a single update
+	updates, err := rc.callApplyDeltas(deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 {
+		t.Fatal("expected 2 updates, got", len(updates))
+	}
+	_, secIdx, counts, err := readWriteCountsUpdate(updates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secIdx != 2 || !reflect.DeepEqual(counts, []uint16{4, 0, 3}) {
+		t.Fatal("unexpected first update", secIdx, counts)
+	}
+	if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// verify the counts on disk
+	counts, err = rc.callCountRange(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint16{1, 1, 4, 0, 3, 1, 1, 2, 1, 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatal("unexpected counts", counts, expected)
+	}
+}
+
+// TestRefCounterConcat tests appending all counts of one refcounter to another.
+func TestRefCounterConcat(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	dstNumSec := 2 + fastrand.Uint64n(10)
+	dst := testPrepareRefCounter(dstNumSec, t)
+	srcNumSec := 2 + fastrand.Uint64n(10)
+	src, err := newRefCounter(filepath.Join(filepath.Dir(dst.filepath), "src"+refCounterExtension), srcNumSec, testWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// give the source some distinct counts
+	if err := src.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	var updates []writeaheadlog.Update
+	for i := uint64(0); i < srcNumSec; i++ {
+		u, err := src.callSetCount(i, uint16(i+10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates = append(updates, u)
+	}
+	if err := src.callCreateAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// concat requires an update session
+	if _, err := dst.callConcat(src); !errors.Contains(err, ErrUpdateWithoutUpdateSession) {
+		t.Fatal("Expected ErrUpdateWithoutUpdateSession, got:", err)
+	}
+	if err := dst.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.callConcat(dst); err == nil {
+		t.Fatal("Expected concatenating a refcounter with itself to fail")
+	}
+	us, err := dst.callConcat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 1 {
+		t.Fatal("Expected a single update, got", len(us))
+	}
+	if dst.numSectors != dstNumSec+srcNumSec {
+		t.Fatalf("Expected %v sectors, got %v", dstNumSec+srcNumSec, dst.numSectors)
+	}
+	// the new counts are visible before the update is applied
+	if c, err := dst.callCount(dstNumSec); err != nil || c != 10 {
+		t.Fatal("Unexpected count", c, err)
+	}
+	if err := dst.callCreateAndApplyTransaction(us...); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the counts on disk after a reload
+	if err := dst.callClose(); err != nil {
+		t.Fatal(err)
+	}
+	dst, err = loadRefCounter(dst.filepath, testWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.numSectors != dstNumSec+srcNumSec {
+		t.Fatalf("Expected %v sectors after reload, got %v", dstNumSec+srcNumSec, dst.numSectors)
+	}
+	counts, err := dst.callCountRange(0, dst.numSectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, count := range counts {
+		expected := uint16(1)
+		if uint64(i) >= dstNumSec {
+			expected = uint16(uint64(i) - dstNumSec + 10)
+		}
+		if count != expected {
+			t.Fatalf("sector %v: expected %v, got %v", i, expected, count)
+		}
+	}
+}
+
+// writer performing serialized updates. It is meant to be run with -race.
+func TestRefCounterConcurrentReaders(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	const (
+		numSec     = 1000
+		numReaders = 8
+		duration   = 2 * time.Second
+	)
+	rc := testPrepareRefCounter(numSec, t)
+
+	// The writer only ever sets the count of a sector to a value that is
+	// congruent to its index modulo 100. That way the readers can check that
+	// they never read a value that belongs to a different sector.
+	validCount := func(secIdx uint64, count uint16) bool {
+		return count == 1 || uint64(count)%100 == secIdx%100
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				secIdx := fastrand.Uint64n(numSec)
+				count, err := rc.callCount(secIdx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !validCount(secIdx, count) {
+					t.Errorf("invalid count %v for sector %v", count, secIdx)
+					return
+				}
+				startIdx := fastrand.Uint64n(numSec)
+				counts, err := rc.callCountRange(startIdx, fastrand.Uint64n(numSec-startIdx+1))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for i, count := range counts {
+					if !validCount(startIdx+uint64(i), count) {
+						t.Errorf("invalid count %v for sector %v", count, startIdx+uint64(i))
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// Perform serialized updates until the time is up.
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		if err := rc.callStartUpdate(); err != nil {
+			t.Fatal(err)
+		}
+		var updates []writeaheadlog.Update
+		for i := 0; i < 10; i++ {
+			secIdx := fastrand.Uint64n(numSec)
+			count := uint16(secIdx%100 + 100*fastrand.Uint64n(600))
+			u, err := rc.callSetCount(secIdx, count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			updates = append(updates, u)
+		}
+		if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.callUpdateApplied(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// TestRefCounterCountRange tests that callCountRange returns the same counts
+// as callCount, including the values of pending updates.
+func TestRefCounterCountRange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rc := testPrepareRefCounter(20, t)
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := rc.callSetCount(5, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	// leave a pending update in the session
+	if _, err := rc.callIncrement(7); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := rc.callCountRange(3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, count := range counts {
+		expected, err := rc.callCount(3 + uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Fatalf("sector %v: expected %v, got %v", 3+i, expected, count)
+		}
+	}
+	if counts[2] != 42 || counts[4] != 2 {
+		t.Fatal("unexpected counts", counts)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// out of bounds ranges are rejected
+	if _, err := rc.callCountRange(15, 6); !errors.Contains(err, ErrInvalidSectorNumber) {
+		t.Fatal("expected ErrInvalidSectorNumber, got", err)
+	}
+	if _, err := rc.callCountRange(math.MaxUint64, 2); !errors.Contains(err, ErrInvalidSectorNumber) {
+		t.Fatal("expected ErrInvalidSectorNumber, got", err)
+	}
+}
+
 // TestRefCounterCreateAndApplyTransaction test that callCreateAndApplyTransaction
 // panics and restores the original in-memory structures on a failure to apply
 // updates.
@@ -393,6 +701,206 @@ func TestRefCounterDropSectors(t *testing.T) {
 	}
 }
 
+// TestRefCounterFill tests that the callFill method behaves correctly
+func TestRefCounterFill(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// prepare a refcounter for the tests
+	numSec := 2 + fastrand.Uint64n(10)
+	rc := testPrepareRefCounter(numSec, t)
+
+	// fill requires an update session
+	_, err := rc.callFill(3)
+	if !errors.Contains(err, ErrUpdateWithoutUpdateSession) {
+		t.Fatal("Expected ErrUpdateWithoutUpdateSession, got:", err)
+	}
+
+	err = rc.callStartUpdate()
+	if err != nil {
+		t.Fatal("Failed to start an update session", err)
+	}
+	// set a count before filling, the fill should override it
+	u, err := rc.callSetCount(0, 7)
+	if err != nil {
+		t.Fatal("Failed to create set count update:", err)
+	}
+	updates := []writeaheadlog.Update{u}
+	val := uint16(3)
+	us, err := rc.callFill(val)
+	if err != nil {
+		t.Fatal("Failed to create fill update:", err)
+	}
+	if len(us) != 1 {
+		t.Fatalf("expected a single update, got %d", len(us))
+	}
+	updates = append(updates, us...)
+	// increment a count after filling, this should be based on the fill value
+	u, err = rc.callIncrement(1)
+	if err != nil {
+		t.Fatal("Failed to create increment update:", err)
+	}
+	updates = append(updates, u)
+
+	// verify the in-memory values before applying the updates
+	for i := uint64(0); i < numSec; i++ {
+		expected := val
+		if i == 1 {
+			expected = val + 1
+		}
+		count, err := rc.readCount(i)
+		if err != nil {
+			t.Fatal("Failed to read count:", err)
+		}
+		if count != expected {
+			t.Fatalf("wrong count for sector %d before applying, expected %d, got %d", i, expected, count)
+		}
+	}
+
+	// apply the updates
+	err = rc.callCreateAndApplyTransaction(updates...)
+	if err != nil {
+		t.Fatal("Failed to apply fill update:", err)
+	}
+	err = rc.callUpdateApplied()
+	if err != nil {
+		t.Fatal("Failed to finish the update session:", err)
+	}
+
+	// verify the values on disk
+	for i := uint64(0); i < numSec; i++ {
+		expected := val
+		if i == 1 {
+			expected = val + 1
+		}
+		count, err := rc.callCount(i)
+		if err != nil {
+			t.Fatal("Failed to read count:", err)
+		}
+		if count != expected {
+			t.Fatalf("wrong count for sector %d, expected %d, got %d", i, expected, count)
+		}
+	}
+
+	// verify the update encoding
+	path, secIdx, n, value, err := readWriteRangeUpdate(us[0])
+	if err != nil {
+		t.Fatal("Failed to read a write range update:", err)
+	}
+	if path != rc.filepath || secIdx != 0 || n != numSec || value != val {
+		t.Fatalf("wrong values read from WriteRange update. Expected %s, %d, %d, %d found %s, %d, %d, %d", rc.filepath, 0, numSec, val, path, secIdx, n, value)
+	}
+}
+
+// TestRefCounterForEachCount tests that callForEachCount iterates over the
+// counts of all sectors including pending updates and that callStats
+// summarizes them.
+func TestRefCounterForEachCount(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// use more sectors than fit into a single batch
+	numSec := uint64(refCounterIterBatchSize + 10)
+	rc := testPrepareRefCounter(numSec, t)
+
+	// set some counts, leaving one of them pending
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u1, err := rc.callSetCount(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := rc.callSetCount(refCounterIterBatchSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u1, u2); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.callSetCount(numSec-1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]uint16, numSec)
+	for i := range expected {
+		expected[i] = 1
+	}
+	expected[0] = 0
+	expected[refCounterIterBatchSize] = 5
+	expected[numSec-1] = 3
+
+	// iterate over all counts
+	counts := make([]uint16, 0, numSec)
+	err = rc.callForEachCount(0, func(secIdx uint64, count uint16) error {
+		if secIdx != uint64(len(counts)) {
+			t.Fatalf("expected sector %v, got %v", len(counts), secIdx)
+		}
+		counts = append(counts, count)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatal("iterated counts don't match")
+	}
+
+	// iterate starting in the middle and stop early
+	errStop := errors.New("stop")
+	var iterated []uint64
+	err = rc.callForEachCount(numSec-3, func(secIdx uint64, count uint16) error {
+		iterated = append(iterated, secIdx)
+		if len(iterated) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Contains(err, errStop) {
+		t.Fatal("expected iteration to be stopped", err)
+	}
+	if !reflect.DeepEqual(iterated, []uint64{numSec - 3, numSec - 2}) {
+		t.Fatal("unexpected sectors", iterated)
+	}
+
+	// starting after the last sector doesn't call fn
+	err = rc.callForEachCount(numSec, func(uint64, uint16) error {
+		t.Fatal("fn shouldn't be called")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check the stats
+	stats, err := rc.callStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStats := refCounterStats{
+		NumSectors:      numSec,
+		NumUnreferenced: 1,
+		TotalReferences: numSec - 3 + 5 + 3,
+		MaxCount:        5,
+	}
+	if stats != expectedStats {
+		t.Fatalf("expected stats %v, got %v", expectedStats, stats)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestRefCounterIncrement tests that the callIncrement method behaves correctly
 func TestRefCounterIncrement(t *testing.T) {
 	if testing.Short() {
@@ -554,41 +1062,270 @@ func TestRefCounterLoadInvalidVersion(t *testing.T) {
 	}
 }
 
-// TestRefCounterSetCount tests that the callSetCount method behaves correctly
-func TestRefCounterSetCount(t *testing.T) {
+// TestRefCounterLock tests that a refcounter can't be opened while its lock is
+// held by another process and that the lock is released on close and delete.
+func TestRefCounterLock(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
 	t.Parallel()
 
-	// prepare a refcounter for the tests
-	rc := testPrepareRefCounter(2+fastrand.Uint64n(10), t)
-	err := rc.callStartUpdate()
+	// prepare a refcounter
+	rc := testPrepareRefCounter(fastrand.Uint64n(10), t)
+	lockPath := rc.filepath + refCounterLockExtension
+
+	// Loading the refcounter again within the same process should work.
+	rc2, err := loadRefCounter(rc.filepath, testWAL)
 	if err != nil {
-		t.Fatal("Failed to start an update session", err)
+		t.Fatal("Failed to load refcounter:", err)
 	}
 
-	// test callSetCount on an existing sector counter
-	oldNumSec := rc.numSectors
-	secIdx := rc.numSectors - 2
-	count := uint16(fastrand.Intn(10_000))
-	u, err := rc.callSetCount(secIdx, count)
-	if err != nil {
-		t.Fatal("Failed to create a set count update:", err)
+	// Simulate another process trying to open the refcounter by bypassing the
+	// registry. This should fail and identify our PID.
+	_, err = acquireRefCounterLock(rc.filepath, true)
+	if !errors.Contains(err, ErrRefCounterLocked) {
+		t.Fatal("Expected ErrRefCounterLocked, got:", err)
 	}
-	// verify that the number of sectors did not change
-	if rc.numSectors != oldNumSec {
-		t.Fatalf("wrong number of sectors after setting the value of an existing sector. Expected %d number of sectors, got %d", oldNumSec, rc.numSectors)
+	if !strings.Contains(err.Error(), fmt.Sprint(os.Getpid())) {
+		t.Fatal("Error doesn't identify the holder's PID:", err)
 	}
-	// verify that the counter value was correctly set
-	val, err := rc.readCount(secIdx)
-	if err != nil {
-		t.Fatal("Failed to read value after set count:", err)
+
+	// The lock should only be released once both refcounters are closed.
+	if err := rc.callClose(); err != nil {
+		t.Fatal(err)
 	}
-	if val != count {
-		t.Fatalf("read wrong value after increment. Expected %d, got %d", count, val)
+	_, err = acquireRefCounterLock(rc.filepath, true)
+	if !errors.Contains(err, ErrRefCounterLocked) {
+		t.Fatal("Expected ErrRefCounterLocked, got:", err)
 	}
-	// apply the update
+	if err := rc2.callClose(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Now the other process can acquire the lock and we can't load the
+	// refcounter anymore.
+	other, err := acquireRefCounterLock(rc.filepath, true)
+	if err != nil {
+		t.Fatal("Failed to acquire released lock:", err)
+	}
+	_, err = loadRefCounter(rc.filepath, testWAL)
+	if !errors.Contains(err, ErrRefCounterLocked) {
+		t.Fatal("Expected ErrRefCounterLocked, got:", err)
+	}
+	if err := other.release(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the refcounter again and delete it. The lock file should be
+	// removed.
+	rc, err = loadRefCounter(rc.filepath, testWAL)
+	if err != nil {
+		t.Fatal("Failed to load refcounter:", err)
+	}
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := rc.callDeleteRefCounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatal("lock file wasn't removed", err)
+	}
+}
+
+// TestRefCounterLockReleasedOnCreateFailure tests that the lock of a new
+// refcounter is released if the refcounter can't be created.
+func TestRefCounterLockReleasedOnCreateFailure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a directory at the refcounter's path to make writing the
+	// refcounter fail.
+	path := filepath.Join(build.TempDir(t.Name()), "rc"+refCounterExtension)
+	if err := os.MkdirAll(path, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	wal, _ := newTestWAL()
+	if _, err := newRefCounter(path, 1, wal); err == nil {
+		t.Fatal("expected creating the refcounter to fail")
+	}
+
+	// The lock shouldn't be held by this process anymore.
+	lockPath := path + refCounterLockExtension
+	refCounterLocks.mu.Lock()
+	_, exists := refCounterLocks.locks[lockPath]
+	refCounterLocks.mu.Unlock()
+	if exists {
+		t.Fatal("lock wasn't removed from the registry")
+	}
+	other, err := acquireRefCounterLock(path, true)
+	if err != nil {
+		t.Fatal("lock file wasn't unlocked:", err)
+	}
+	if err := other.release(true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRefCounterOperationLog tests that the operation log records all
+// mutating operations and is bounded in size.
+func TestRefCounterOperationLog(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// prepare a refcounter for the tests
+	rc := testPrepareRefCounter(4, t)
+
+	// by default the log is disabled
+	if rc.callOperationLog() != nil {
+		t.Fatal("operation log should be disabled by default")
+	}
+
+	// reload the refcounter with the log enabled
+	logSize := 6
+	rc, err := loadRefCounterWithOptions(rc.filepath, testWAL, refCounterOptions{OperationLogSize: logSize})
+	if err != nil {
+		t.Fatal("Failed to load refcounter:", err)
+	}
+
+	// perform one of each mutating operation
+	err = rc.callStartUpdate()
+	if err != nil {
+		t.Fatal("Failed to start an update session", err)
+	}
+	var updates []writeaheadlog.Update
+	u, err := rc.callIncrement(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, u)
+	u, err = rc.callDecrement(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, u)
+	us, err := rc.callSwap(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, us...)
+	u, err = rc.callAppend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, u)
+	u, err = rc.callDropSectors(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, u)
+	if err = rc.callCreateAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the log holds the last logSize operations, the first increment was
+	// overwritten
+	expected := []refCounterOperation{
+		{Op: refCounterOpDecrement, Sector: 1, OldCount: 1, NewCount: 0},
+		{Op: refCounterOpSwap, Sector: 0, OldCount: 2, NewCount: 0},
+		{Op: refCounterOpSwap, Sector: 1, OldCount: 0, NewCount: 2},
+		{Op: refCounterOpAppend, Sector: 4, OldCount: 0, NewCount: 1},
+		{Op: refCounterOpDropSectors, Sector: 4, OldCount: 1, NewCount: 0},
+	}
+	records := rc.callOperationLog()
+	if len(records) != logSize {
+		t.Fatalf("expected %v records, got %v", logSize, len(records))
+	}
+	if records[0].Op != refCounterOpIncrement {
+		t.Fatal("unexpected first record", records[0])
+	}
+	records = records[1:]
+	for i, r := range records {
+		if r.Timestamp.IsZero() {
+			t.Fatal("record is missing a timestamp")
+		}
+		r.Timestamp = time.Time{}
+		if r != expected[i] {
+			t.Fatalf("record %v: expected %v, got %v", i, expected[i], r)
+		}
+	}
+
+	// add one more operation, this should overwrite the oldest record
+	if err = rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err = rc.callSetCount(2, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if err = rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	records = rc.callOperationLog()
+	if len(records) != logSize {
+		t.Fatalf("expected %v records, got %v", logSize, len(records))
+	}
+	if records[0].Op != refCounterOpDecrement {
+		t.Fatal("oldest record wasn't overwritten", records[0])
+	}
+	last := records[len(records)-1]
+	if last.Op != refCounterOpSetCount || last.Sector != 2 || last.OldCount != 1 || last.NewCount != 5 {
+		t.Fatal("unexpected last record", last)
+	}
+}
+
+// TestRefCounterSetCount tests that the callSetCount method behaves correctly
+func TestRefCounterSetCount(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// prepare a refcounter for the tests
+	rc := testPrepareRefCounter(2+fastrand.Uint64n(10), t)
+	err := rc.callStartUpdate()
+	if err != nil {
+		t.Fatal("Failed to start an update session", err)
+	}
+
+	// test callSetCount on an existing sector counter
+	oldNumSec := rc.numSectors
+	secIdx := rc.numSectors - 2
+	count := uint16(fastrand.Intn(10_000))
+	u, err := rc.callSetCount(secIdx, count)
+	if err != nil {
+		t.Fatal("Failed to create a set count update:", err)
+	}
+	// verify that the number of sectors did not change
+	if rc.numSectors != oldNumSec {
+		t.Fatalf("wrong number of sectors after setting the value of an existing sector. Expected %d number of sectors, got %d", oldNumSec, rc.numSectors)
+	}
+	// verify that the counter value was correctly set
+	val, err := rc.readCount(secIdx)
+	if err != nil {
+		t.Fatal("Failed to read value after set count:", err)
+	}
+	if val != count {
+		t.Fatalf("read wrong value after increment. Expected %d, got %d", count, val)
+	}
+	// apply the update
 	err = rc.callCreateAndApplyTransaction(u)
 	if err != nil {
 		t.Fatal("Failed to apply a set count update:", err)
@@ -891,6 +1628,98 @@ func TestRefCounterWALFunctions(t *testing.T) {
 	}
 }
 
+// TestRefCounterWALReplayStress applies many random updates to a refcounter in
+// batches. After every batch it simulates a crash by reloading the refcounter
+// from disk and verifies that every counter has the expected value.
+func TestRefCounterWALReplayStress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	const (
+		numUpdates = 10000
+		batchSize  = 100
+	)
+
+	// prepare a refcounter and the expected counts
+	rc := testPrepareRefCounter(50, t)
+	expected := make([]uint16, rc.numSectors)
+	for i := range expected {
+		expected[i] = 1
+	}
+
+	// verify is a helper that checks all counts of the refcounter.
+	verify := func(rc *refCounter, batch int) {
+		if rc.numSectors != uint64(len(expected)) {
+			t.Fatalf("batch %v: expected %v sectors, got %v", batch, len(expected), rc.numSectors)
+		}
+		for secIdx, exp := range expected {
+			count, err := rc.callCount(uint64(secIdx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != exp {
+				t.Fatalf("batch %v: expected count %v for sector %v, got %v", batch, exp, secIdx, count)
+			}
+		}
+	}
+
+	for batch := 0; batch < numUpdates/batchSize; batch++ {
+		if err := rc.callStartUpdate(); err != nil {
+			t.Fatal(err)
+		}
+		updates := make([]writeaheadlog.Update, 0, batchSize)
+		for len(updates) < batchSize {
+			var u writeaheadlog.Update
+			var err error
+			switch n := fastrand.Intn(10); {
+			case n < 2 || len(expected) == 0:
+				// append a sector, this is a writeAt update
+				u, err = rc.callAppend()
+				expected = append(expected, 1)
+			case n < 4:
+				// drop a few sectors, this is a truncate update
+				numSec := fastrand.Intn(3) + 1
+				if numSec > len(expected) {
+					numSec = len(expected)
+				}
+				u, err = rc.callDropSectors(uint64(numSec))
+				expected = expected[:len(expected)-numSec]
+			default:
+				// set a random count, this is a writeAt update
+				secIdx := fastrand.Intn(len(expected))
+				count := uint16(fastrand.Intn(math.MaxUint16 + 1))
+				u, err = rc.callSetCount(uint64(secIdx), count)
+				expected[secIdx] = count
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			updates = append(updates, u)
+		}
+		if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.callUpdateApplied(); err != nil {
+			t.Fatal(err)
+		}
+		verify(rc, batch)
+
+		// simulate a crash by reloading the refcounter from disk
+		if err := rc.callClose(); err != nil {
+			t.Fatal(err)
+		}
+		path := rc.filepath
+		var err error
+		rc, err = loadRefCounter(path, testWAL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verify(rc, batch)
+	}
+}
+
 // TestRefCounterNumSectorsUnderflow tests for and guards against an NDF that
 // can happen in various methods when numSectors is zero and we check the sector
 // index to be read against numSectors-1.
@@ -975,7 +1804,7 @@ func newTestWAL() (*writeaheadlog.WAL, string) {
 
 // testPrepareRefCounter is a helper that creates a refcounter and fails the
 // test if that is not successful
-func testPrepareRefCounter(numSec uint64, t *testing.T) *refCounter {
+func testPrepareRefCounter(numSec uint64, t testing.TB) *refCounter {
 	tcid := types.FileContractID(crypto.HashBytes([]byte("contractId")))
 	td := build.TempDir(t.Name())
 	err := os.MkdirAll(td, modules.DefaultDirPerm)
@@ -1004,8 +1833,755 @@ func writeVal(path string, secIdx uint64, val uint16) (err error) {
 	}()
 	var b u16
 	binary.LittleEndian.PutUint16(b[:], val)
-	if _, err = f.WriteAt(b[:], int64(offset(secIdx))); err != nil {
+	if _, err = f.WriteAt(b[:], int64(RefCounterModeFast.offset(secIdx))); err != nil {
 		return errors.AddContext(err, "failed to write to refcounter file")
 	}
 	return nil
 }
+
+// BenchmarkRefCounterCount measures the read throughput of concurrent readers
+// with and without acquiring the refcounter's lock.
+func BenchmarkRefCounterCount(b *testing.B) {
+	tcid := types.FileContractID(crypto.HashBytes([]byte("contractId")))
+	td := build.TempDir(b.Name())
+	if err := os.MkdirAll(td, modules.DefaultDirPerm); err != nil {
+		b.Fatal(err)
+	}
+	rc, err := newRefCounter(filepath.Join(td, tcid.String()+refCounterExtension), 1000, testWAL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Locked", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := rc.callCount(fastrand.Uint64n(rc.numSectors)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("Unlocked", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := rc.readCount(fastrand.Uint64n(rc.numSectors)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+// TestRefCounterNotInitialized tests that calling methods on a zero-value or
+// nil refcounter returns ErrRefCounterNotInitialized instead of panicking.
+func TestRefCounterNotInitialized(t *testing.T) {
+	t.Parallel()
+
+	for _, rc := range []*refCounter{nil, {}} {
+		if err := rc.callStartUpdate(); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if _, err := rc.callAppend(); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if _, err := rc.callCount(0); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if _, err := rc.callIncrement(0); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if err := rc.callCreateAndApplyTransaction(); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if err := rc.callUpdateApplied(); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if err := rc.callClose(); !errors.Contains(err, ErrRefCounterNotInitialized) {
+			t.Fatal("Expected ErrRefCounterNotInitialized, got:", err)
+		}
+		if ops := rc.callOperationLog(); ops != nil {
+			t.Fatal("Expected no operations, got:", ops)
+		}
+	}
+}
+
+// TestRefCounterReserveSectors tests reserving sectors and committing them out
+// of order.
+func TestRefCounterReserveSectors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	numSec := fastrand.Uint64n(10)
+	rc := testPrepareRefCounter(numSec, t)
+
+	// reserve ranges concurrently, they shouldn't overlap
+	numReservations := 10
+	starts := make([]uint64, numReservations)
+	var wg sync.WaitGroup
+	for i := 0; i < numReservations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			startIdx, err := rc.callReserveSectors(uint64(i + 1))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			starts[i] = startIdx
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	reserved := make(map[uint64]struct{})
+	for i, startIdx := range starts {
+		for secIdx := startIdx; secIdx < startIdx+uint64(i+1); secIdx++ {
+			if secIdx < numSec {
+				t.Fatal("reserved existing sector", secIdx)
+			}
+			if _, exists := reserved[secIdx]; exists {
+				t.Fatal("sector reserved twice", secIdx)
+			}
+			reserved[secIdx] = struct{}{}
+		}
+	}
+	end := numSec + uint64(len(reserved))
+	if _, err := rc.callReserveSectors(0); err == nil {
+		t.Fatal("expected reserving 0 sectors to fail")
+	}
+
+	// committing requires an update session
+	if _, err := rc.callCommitReservedSectors(starts[0], []uint16{1}); !errors.Contains(err, ErrUpdateWithoutUpdateSession) {
+		t.Fatal("Expected ErrUpdateWithoutUpdateSession, got:", err)
+	}
+
+	// values is a helper that returns the values a reservation is committed
+	// with
+	values := func(i int) []uint16 {
+		vals := make([]uint16, i+1)
+		for j := range vals {
+			vals[j] = uint16(i + 1)
+		}
+		return vals
+	}
+
+	// commit the reservations starting with the last range, each in its own
+	// session
+	order := make([]int, numReservations)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return starts[order[i]] > starts[order[j]]
+	})
+	for n, i := range order {
+		if err := rc.callStartUpdate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rc.callCommitReservedSectors(starts[i], values(i)[1:]); err == nil {
+			t.Fatal("expected committing the wrong number of values to fail")
+		}
+		if n == numReservations/2 {
+			// sectors can't be dropped while there are reservations
+			if _, err := rc.callDropSectors(1); !errors.Contains(err, ErrRefCounterSectorsReserved) {
+				t.Fatal("Expected ErrRefCounterSectorsReserved, got:", err)
+			}
+		}
+		updates, err := rc.callCommitReservedSectors(starts[i], values(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.callUpdateApplied(); err != nil {
+			t.Fatal(err)
+		}
+		if rc.numSectors != end {
+			t.Fatalf("expected %v sectors, got %v", end, rc.numSectors)
+		}
+	}
+
+	// a reservation can only be committed once
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.callCommitReservedSectors(starts[0], values(0)); !errors.Contains(err, ErrSectorsNotReserved) {
+		t.Fatal("Expected ErrSectorsNotReserved, got:", err)
+	}
+	// once all reservations are committed appends go to the end again
+	u, err := rc.callAppend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the counts after reloading the refcounter
+	if err := rc.callClose(); err != nil {
+		t.Fatal(err)
+	}
+	rcLoaded, err := loadRefCounter(rc.filepath, testWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcLoaded.numSectors != end+1 {
+		t.Fatalf("expected %v sectors, got %v", end+1, rcLoaded.numSectors)
+	}
+	for i, startIdx := range starts {
+		counts, err := rcLoaded.callCountRange(startIdx, uint64(i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(counts, values(i)) {
+			t.Fatalf("reservation %v: expected counts %v, got %v", i, values(i), counts)
+		}
+	}
+	if count, err := rcLoaded.callCount(end); err != nil || count != 1 {
+		t.Fatal("unexpected count of appended sector", count, err)
+	}
+}
+
+// TestRefCounterAppendReserved tests that appending and concatenating skip
+// reserved sectors.
+func TestRefCounterAppendReserved(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	numSec := uint64(3)
+	rc := testPrepareRefCounter(numSec, t)
+	src, err := newRefCounter(filepath.Join(filepath.Dir(rc.filepath), "src"+refCounterExtension), 2, testWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startIdx, err := rc.callReserveSectors(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if startIdx != numSec {
+		t.Fatalf("expected reservation to start at %v, got %v", numSec, startIdx)
+	}
+
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := rc.callAppend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, err := rc.callConcat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(append(updates, u)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	// the reserved sectors are 0 until they are committed
+	expected := []uint16{1, 1, 1, 0, 0, 1, 1, 1}
+	counts, err := rc.callCountRange(0, rc.numSectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected counts %v, got %v", expected, counts)
+	}
+
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	updates, err = rc.callCommitReservedSectors(startIdx, []uint16{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	expected = []uint16{1, 1, 1, 2, 3, 1, 1, 1}
+	counts, err = rc.callCountRange(0, rc.numSectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected counts %v, got %v", expected, counts)
+	}
+}
+
+// TestRefCounterSaturatingMax tests that increments saturate at the configured
+// max instead of failing.
+func TestRefCounterSaturatingMax(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rc := testPrepareRefCounter(2, t)
+
+	// by default an overflow is an error
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.callSetCount(0, math.MaxUint16); err != nil {
+		t.Fatal(err)
+	}
+	if _, saturated, err := rc.callIncrementSaturating(0); !errors.Contains(err, ErrSectorCountOverflow) || saturated {
+		t.Fatal("expected increment to fail on overflow", saturated, err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload the refcounter with saturation enabled
+	max := uint16(3)
+	rc, err := loadRefCounterWithOptions(rc.filepath, testWAL, refCounterOptions{SaturatingMax: max})
+	if err != nil {
+		t.Fatal("Failed to load refcounter:", err)
+	}
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	var updates []writeaheadlog.Update
+	for i := uint16(2); i <= max+1; i++ {
+		u, saturated, err := rc.callIncrementSaturating(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saturated != (i > max) {
+			t.Fatalf("increment to %v: expected saturated to be %v", i, i > max)
+		}
+		updates = append(updates, u)
+	}
+	// callIncrement saturates as well
+	u, err := rc.callIncrement(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = append(updates, u)
+	if err := rc.callCreateAndApplyTransaction(updates...); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := rc.callCount(0); err != nil || count != max {
+		t.Fatalf("expected count %v, got %v %v", max, count, err)
+	}
+
+	// the counter can drop below the max again
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.callDecrement(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, saturated, err := rc.callIncrementSaturating(0); err != nil || saturated {
+		t.Fatal("unexpected saturation", saturated, err)
+	}
+	if count, err := rc.callCount(0); err != nil || count != max {
+		t.Fatalf("expected count %v, got %v %v", max, count, err)
+	}
+}
+
+// TestRefCounterMemoryMapped tests that a memory mapped refcounter returns the
+// same counts as the file on disk and that its mapping follows the size of the
+// file.
+func TestRefCounterMemoryMapped(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rc := testPrepareRefCounter(10, t)
+	rc, err := loadRefCounterWithOptions(rc.filepath, testWAL, refCounterOptions{MemoryMapped: true})
+	if err != nil {
+		t.Fatal("Failed to load refcounter:", err)
+	}
+	if runtime.GOOS != "windows" && rc.mmap == nil {
+		t.Fatal("refcounter wasn't mapped")
+	}
+
+	// checkCounts compares the counts of the mapped refcounter to the counts
+	// read from disk by a refcounter without a mapping.
+	checkCounts := func() {
+		t.Helper()
+		unmapped, err := loadRefCounter(rc.filepath, testWAL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := unmapped.callClose(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+		expected, err := unmapped.callCountRange(0, unmapped.numSectors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts, err := rc.callCountRange(0, rc.numSectors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Fatalf("expected counts %v, got %v", expected, counts)
+		}
+		for secIdx, c := range expected {
+			if count, err := rc.callCount(uint64(secIdx)); err != nil || count != c {
+				t.Fatalf("sector %v: expected count %v, got %v %v", secIdx, c, count, err)
+			}
+		}
+		var iterated []uint16
+		err = rc.callForEachCount(0, func(secIdx uint64, count uint16) error {
+			if secIdx != uint64(len(iterated)) {
+				t.Fatalf("expected sector %v, got %v", len(iterated), secIdx)
+			}
+			iterated = append(iterated, count)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(iterated, expected) {
+			t.Fatalf("expected iterated counts %v, got %v", expected, iterated)
+		}
+		expectedStats, err := unmapped.callStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats, err := rc.callStats(); err != nil || stats != expectedStats {
+			t.Fatalf("expected stats %v, got %v %v", expectedStats, stats, err)
+		}
+		if rc.mmap != nil && uint64(len(rc.mmap.data)) != rc.Mode.offset(rc.numSectors) {
+			t.Fatalf("mapping covers %v bytes instead of %v", len(rc.mmap.data), rc.Mode.offset(rc.numSectors))
+		}
+	}
+	checkCounts()
+
+	// change some counts and grow the file
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u1, err := rc.callIncrement(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := rc.callSetCount(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u3, err := rc.callAppend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u1, u2, u3); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts()
+
+	// shrink the file
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := rc.callDropSectors(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts()
+
+	// deleting the refcounter releases the mapping
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err = rc.callDeleteRefCounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if rc.mmap != nil {
+		t.Fatal("mapping wasn't released")
+	}
+}
+
+// BenchmarkRefCounterReadPath compares reading counts from a memory mapped
+// refcounter to reading them from the file.
+func BenchmarkRefCounterReadPath(b *testing.B) {
+	tcid := types.FileContractID(crypto.HashBytes([]byte("contractId")))
+	td := build.TempDir(b.Name())
+	if err := os.MkdirAll(td, modules.DefaultDirPerm); err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(td, tcid.String()+refCounterExtension)
+	if _, err := newRefCounter(path, 1<<20, testWAL); err != nil {
+		b.Fatal(err)
+	}
+	for _, mapped := range []bool{false, true} {
+		rc, err := loadRefCounterWithOptions(path, testWAL, refCounterOptions{MemoryMapped: mapped})
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "ReadAt"
+		if mapped {
+			name = "Mmap"
+		}
+		b.Run(name+"/Count", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := rc.callCount(fastrand.Uint64n(rc.numSectors)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/CountRange", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := rc.callCountRange(fastrand.Uint64n(rc.numSectors-64), 64); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		if err := rc.callClose(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestRefCounterErrorContext checks that errors contain the index of the
+// sector that caused them while still matching their sentinel errors.
+func TestRefCounterErrorContext(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rc := testPrepareRefCounter(2, t)
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rc.callUpdateApplied(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// reading an invalid sector
+	_, err := rc.callCount(7)
+	if !errors.Contains(err, ErrInvalidSectorNumber) || !strings.Contains(err.Error(), "sector 7") {
+		t.Fatal("unexpected error", err)
+	}
+	// swapping an invalid sector
+	_, err = rc.callSwap(0, 9)
+	if !errors.Contains(err, ErrInvalidSectorNumber) || !strings.Contains(err.Error(), "sectors 0 and 9") {
+		t.Fatal("unexpected error", err)
+	}
+	// decrementing a sector with a count of 0
+	if _, err := rc.callSetCount(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rc.callDecrement(1)
+	if !errors.Contains(err, ErrSectorCountUnderflow) || !strings.Contains(err.Error(), "sector 1") {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestRefCounterVerifiedMode tests that a refcounter in verified mode stores a
+// checksum with every count and detects corrupted counts.
+func TestRefCounterVerifiedMode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	td := build.TempDir(t.Name())
+	if err := os.MkdirAll(td, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(td, "verified"+refCounterExtension)
+	rc, err := newRefCounterWithOptions(path, 10, testWAL, refCounterOptions{Mode: RefCounterModeVerified})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change some counts, grow the file and shrink it again
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u1, err := rc.callIncrement(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := rc.callSetCount(5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u3, err := rc.callAppend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u4, err := rc.callDropSectors(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u1, u2, u3, u4); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint16{1, 1, 1, 2, 1, 7, 1, 1, 1}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != refCounterHeaderSize+int64(len(expected))*6 {
+		t.Fatalf("expected file size %v, got %v", refCounterHeaderSize+len(expected)*6, fi.Size())
+	}
+
+	// the mode is loaded from the header
+	if err := rc.callClose(); err != nil {
+		t.Fatal(err)
+	}
+	rc, err = loadRefCounter(path, testWAL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Mode != RefCounterModeVerified {
+		t.Fatalf("expected mode %v, got %v", RefCounterModeVerified, rc.Mode)
+	}
+	counts, err := rc.callCountRange(0, rc.numSectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected counts %v, got %v", expected, counts)
+	}
+
+	// corrupt one byte of the checksum of sector 5
+	f, err := os.OpenFile(path, os.O_RDWR, modules.DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	off := int64(rc.Mode.offset(5)) + 2 + int64(fastrand.Intn(4))
+	if _, err := f.ReadAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	b[0]++
+	if _, err := f.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.callCount(5); !errors.Contains(err, ErrSectorChecksumMismatch) {
+		t.Fatal("expected ErrSectorChecksumMismatch, got", err)
+	}
+	if _, err := rc.callCountRange(0, rc.numSectors); !errors.Contains(err, ErrSectorChecksumMismatch) {
+		t.Fatal("expected ErrSectorChecksumMismatch, got", err)
+	}
+	// the other sectors can still be read
+	if count, err := rc.callCount(4); err != nil || count != 1 {
+		t.Fatalf("expected count 1, got %v %v", count, err)
+	}
+	// overwriting the count fixes the checksum
+	if err := rc.callStartUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := rc.callSetCount(5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callCreateAndApplyTransaction(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.callUpdateApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := rc.callCount(5); err != nil || count != 3 {
+		t.Fatalf("expected count 3, got %v %v", count, err)
+	}
+	if err := rc.callClose(); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown modes are rejected
+	if _, err := newRefCounterWithOptions(filepath.Join(td, "invalid"+refCounterExtension), 1, testWAL, refCounterOptions{Mode: 2}); !errors.Contains(err, ErrInvalidRefCounterMode) {
+		t.Fatal("expected ErrInvalidRefCounterMode, got", err)
+	}
+	header := serializeHeader(refCounterHeader{Version: refCounterVersion, Mode: 2})
+	if err := ioutil.WriteFile(path, header, modules.DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRefCounter(path, testWAL); !errors.Contains(err, ErrInvalidRefCounterMode) {
+		t.Fatal("expected ErrInvalidRefCounterMode, got", err)
+	}
+}
+
+// BenchmarkRefCounterIterate compares iterating over the counts of a
+// refcounter with 4M sectors by reading them one at a time to iterating over
+// them with callForEachCount with and without a memory mapping.
+func BenchmarkRefCounterIterate(b *testing.B) {
+	const numSec = 1 << 22
+	tcid := types.FileContractID(crypto.HashBytes([]byte("contractId")))
+	td := build.TempDir(b.Name())
+	if err := os.RemoveAll(td); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.MkdirAll(td, modules.DefaultDirPerm); err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(td, tcid.String()+refCounterExtension)
+	if _, err := newRefCounter(path, numSec, testWAL); err != nil {
+		b.Fatal(err)
+	}
+	noop := func(uint64, uint16) error { return nil }
+	for _, mapped := range []bool{false, true} {
+		rc, err := loadRefCounterWithOptions(path, testWAL, refCounterOptions{MemoryMapped: mapped})
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "ReadAt"
+		if mapped {
+			name = "Mmap"
+		}
+		b.Run(name+"/Count", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for secIdx := uint64(0); secIdx < rc.numSectors; secIdx++ {
+					if _, err := rc.callCount(secIdx); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(name+"/ForEachCount", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := rc.callForEachCount(0, noop); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		if err := rc.callClose(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package proto
+
+// refcounterlayout determines where the refcounter files of a contract set are
+// stored. By default all refcounters are stored next to the contract files in
+// the contract set's directory. Hosts and renters with hundreds of thousands of
+// contracts can choose the sharded layout instead, which stores every
+// refcounter in a subdirectory named after the first characters of its
+// contract's ID to keep the number of entries per directory small.
+//
+// Refcounters are always looked up in both locations, which means that
+// switching the layout only affects where new refcounters are created.
+// Existing flat refcounters can be moved into the sharded layout using
+// MigrateRefCountersToShardedLayout.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/writeaheadlog"
+)
+
+const (
+	// RefCounterLayoutFlat stores all refcounters in the contract set's
+	// directory.
+	RefCounterLayoutFlat RefCounterLayout = iota
+
+	// RefCounterLayoutSharded stores refcounters in subdirectories of the
+	// contract set's directory which are named after the first
+	// refCounterShardPrefixLen characters of the contract ID.
+	RefCounterLayoutSharded
+)
+
+const (
+	// refCounterShardPrefixLen is the number of characters of the contract ID
+	// used as the name of a refcounter's shard directory.
+	refCounterShardPrefixLen = 2
+)
+
+// RefCounterLayout describes how refcounter files are laid out on disk.
+type RefCounterLayout int
+
+// String implements fmt.Stringer.
+func (l RefCounterLayout) String() string {
+	switch l {
+	case RefCounterLayoutFlat:
+		return "flat"
+	case RefCounterLayoutSharded:
+		return "sharded"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(l))
+	}
+}
+
+// refCounterPath returns the path of the refcounter of the contract with the
+// given name within dir according to the layout. The name of a contract is the
+// string representation of its ID.
+func (l RefCounterLayout) refCounterPath(dir, name string) string {
+	if l == RefCounterLayoutSharded && len(name) > refCounterShardPrefixLen {
+		return filepath.Join(dir, name[:refCounterShardPrefixLen], name+refCounterExtension)
+	}
+	return filepath.Join(dir, name+refCounterExtension)
+}
+
+// findRefCounterPath returns the path of the refcounter of the contract with
+// the given name. Both layouts are checked. If the refcounter doesn't exist
+// yet, the path according to the provided layout is returned.
+func findRefCounterPath(dir, name string, layout RefCounterLayout) string {
+	for _, l := range []RefCounterLayout{RefCounterLayoutSharded, RefCounterLayoutFlat} {
+		path := l.refCounterPath(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return layout.refCounterPath(dir, name)
+}
+
+// newRefCounterForContract creates a new refcounter for the contract with the
+// given name within dir. If the contract already has a refcounter, it is
+// overwritten in place. Otherwise it is created according to the layout.
+func newRefCounterForContract(dir, name string, numSec uint64, wal *writeaheadlog.WAL, layout RefCounterLayout) (*refCounter, error) {
+	return newRefCounterAt(findRefCounterPath(dir, name, layout), numSec, wal)
+}
+
+// newRefCounterAt creates a new refcounter at the given path and creates its
+// parent directory if necessary.
+func newRefCounterAt(path string, numSec uint64, wal *writeaheadlog.WAL) (*refCounter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.AddContext(err, "failed to create refcounter directory")
+	}
+	return newRefCounter(path, numSec, wal)
+}
+
+// MigrateRefCountersToShardedLayout moves all refcounters which are stored in
+// dir using the flat layout into the sharded layout. It must not be called
+// while a contract set is using dir and the contract set's WAL must not
+// contain unapplied refcounter updates since they reference the old paths.
+func MigrateRefCountersToShardedLayout(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		filename := fi.Name()
+		if fi.IsDir() || filepath.Ext(filename) != refCounterExtension {
+			continue
+		}
+		name := strings.TrimSuffix(filename, refCounterExtension)
+		oldPath := filepath.Join(dir, filename)
+		newPath := RefCounterLayoutSharded.refCounterPath(dir, name)
+		if newPath == oldPath {
+			continue
+		}
+		if err := migrateRefCounter(oldPath, newPath); err != nil {
+			return errors.AddContext(err, fmt.Sprintf("failed to migrate refcounter %v", filename))
+		}
+	}
+	return nil
+}
+
+// migrateRefCounter moves a single refcounter from oldPath to newPath. The
+// refcounter's lock is held during the move to make sure that it isn't in use.
+// Once the refcounter is moved, its old lock file is removed.
+func migrateRefCounter(oldPath, newPath string) (err error) {
+	lock, err := acquireRefCounterLock(oldPath, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Compose(err, lock.release(true))
+	}()
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("refcounter already exists at %v", newPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
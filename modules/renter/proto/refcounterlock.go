@@ -0,0 +1,165 @@
+package proto
+
+// refcounterlock protects refcounter files from being used by multiple
+// processes at the same time. Every refcounter has a sidecar lock file next to
+// it on which an advisory exclusive lock is held for as long as the refcounter
+// is open. The lock file contains the PID of the process holding the lock.
+//
+// The refcounter file itself is never locked, which means that the WAL
+// recovery, which opens refcounter files directly to apply their updates, is
+// not affected by the lock.
+//
+// Within a single process, the same refcounter may be opened more than once.
+// Locks are therefore tracked in a registry and the lock file is only unlocked
+// once the last holder released it.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/modules"
+)
+
+const (
+	// refCounterLockExtension is the extension appended to the path of a
+	// refcounter to get the path of its lock file.
+	refCounterLockExtension = ".lock"
+)
+
+var (
+	// ErrRefCounterLocked is returned when a refcounter is opened while its
+	// lock is held by another process.
+	ErrRefCounterLocked = errors.New("refcounter is locked by another process")
+
+	// errFileLocked is returned by the platform specific lockFile when the file
+	// is already locked.
+	errFileLocked = errors.New("file is already locked")
+
+	// refCounterLocks is the registry of the refcounter locks held by this
+	// process.
+	refCounterLocks = struct {
+		locks map[string]*refCounterLock
+		mu    sync.Mutex
+	}{
+		locks: make(map[string]*refCounterLock),
+	}
+)
+
+// refCounterLock is an exclusive lock on a refcounter's lock file.
+type refCounterLock struct {
+	f        *os.File
+	holders  int
+	path     string
+	registry bool
+}
+
+// acquireRefCounterLock acquires the lock for the refcounter at the given path.
+// If the lock is already held by this process, the existing lock is shared. If
+// bypassRegistry is set, the registry is ignored and the lock file is locked
+// as if by another process. That is only useful for testing.
+func acquireRefCounterLock(path string, bypassRegistry bool) (*refCounterLock, error) {
+	lockPath := path + refCounterLockExtension
+	if !bypassRegistry {
+		refCounterLocks.mu.Lock()
+		defer refCounterLocks.mu.Unlock()
+		if l, exists := refCounterLocks.locks[lockPath]; exists {
+			l.holders++
+			return l, nil
+		}
+	}
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, modules.DefaultFilePerm)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to open refcounter lock file")
+	}
+	err = lockFile(f)
+	if errors.Contains(err, errFileLocked) {
+		err = errors.AddContext(ErrRefCounterLocked, fmt.Sprintf("lock held by process with pid %v", readLockHolder(lockPath)))
+		return nil, errors.Compose(err, f.Close())
+	}
+	if err != nil {
+		err = errors.AddContext(err, "failed to lock refcounter lock file")
+		return nil, errors.Compose(err, f.Close())
+	}
+	// Record our PID in the lock file.
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	if err := f.Truncate(0); err != nil {
+		err = errors.AddContext(err, "failed to truncate refcounter lock file")
+		return nil, errors.Compose(err, unlockFile(f), f.Close())
+	}
+	if _, err := f.WriteAt(pid, 0); err != nil {
+		err = errors.AddContext(err, "failed to write refcounter lock file")
+		return nil, errors.Compose(err, unlockFile(f), f.Close())
+	}
+	l := &refCounterLock{
+		f:        f,
+		holders:  1,
+		path:     lockPath,
+		registry: !bypassRegistry,
+	}
+	if l.registry {
+		refCounterLocks.locks[lockPath] = l
+	}
+	return l, nil
+}
+
+// readLockHolder returns the PID stored in the lock file at the given path. If
+// the PID can't be read, "unknown" is returned.
+func readLockHolder(lockPath string) string {
+	b, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return "unknown"
+	}
+	pid := strings.TrimSpace(string(b))
+	if _, err := strconv.Atoi(pid); err != nil {
+		return "unknown"
+	}
+	return pid
+}
+
+// release releases the lock. Once all holders within this process released
+// the lock, the lock file is unlocked. If remove is set, the lock file is also
+// removed from disk. This is used when the refcounter is deleted.
+func (l *refCounterLock) release(remove bool) error {
+	if l.registry {
+		refCounterLocks.mu.Lock()
+		defer refCounterLocks.mu.Unlock()
+	}
+	l.holders--
+	if l.holders > 0 {
+		return nil
+	}
+	if l.registry {
+		delete(refCounterLocks.locks, l.path)
+	}
+	err := errors.Compose(unlockFile(l.f), l.f.Close())
+	if remove {
+		if errRemove := os.Remove(l.path); !os.IsNotExist(errRemove) {
+			err = errors.Compose(err, errRemove)
+		}
+	}
+	return err
+}
+
+// callClose releases the refcounter's lock and memory mapping. The refcounter
+// must not be used after it was closed.
+func (rc *refCounter) callClose() error {
+	if !rc.initialized() {
+		return ErrRefCounterNotInitialized
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	errMap := rc.mmap.unmap()
+	rc.mmap = nil
+	if rc.lock == nil {
+		return errMap
+	}
+	err := rc.lock.release(false)
+	rc.lock = nil
+	return errors.Compose(errMap, err)
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package proto
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an advisory exclusive lock on f without blocking. If the
+// file is already locked, errFileLocked is returned.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errFileLocked
+	}
+	return err
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
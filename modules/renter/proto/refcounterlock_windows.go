@@ -0,0 +1,56 @@
+//go:build windows
+// +build windows
+
+package proto
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// lockfileFailImmediately and lockfileExclusiveLock are the flags passed
+	// to LockFileEx.
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+
+	// errLockViolation is the error returned by LockFileEx if the region is
+	// already locked.
+	errLockViolation syscall.Errno = 33
+
+	// lockOffsetHigh is the high word of the offset of the locked byte.
+	// Windows locks are mandatory, so the lock is placed far beyond the end of
+	// the file to allow other processes to read the PID of the holder.
+	lockOffsetHigh = 0x7fffffff
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile acquires an exclusive lock on f without blocking. If the file is
+// already locked, errFileLocked is returned.
+func lockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if err == errLockViolation || err == syscall.ERROR_IO_PENDING {
+		return errFileLocked
+	}
+	return err
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: lockOffsetHigh}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
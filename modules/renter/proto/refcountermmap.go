@@ -0,0 +1,116 @@
+package proto
+
+// refcountermmap allows serving the reads of a refcounter from a memory mapping
+// of its file instead of issuing a ReadAt syscall for every read. This helps
+// with large refcounters which are read much more often than they are written,
+// e.g. during download scheduling and health sweeps which iterate over all of
+// the counts using callForEachCount or callStats.
+//
+// Writes still go through the WAL and are applied to the file using WriteAt.
+// The mapping is shared with the OS's page cache, which means that applied
+// writes are visible through the mapping right away. The file is remapped after
+// every applied transaction since the transaction might have changed its size.
+//
+// Platform caveats:
+//  - Memory mapping is only supported on unix-like platforms. On windows the
+//    option is ignored and the refcounter uses regular reads.
+//  - Reads from the mapping bypass the refcounter's modules.Dependencies, which
+//    means that disk faults injected by tests don't affect them.
+//  - Truncating a mapped refcounter file from outside of the refcounter causes
+//    a SIGBUS when the truncated region is read.
+
+import (
+	"os"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// errMmapNotSupported is returned by the platform specific mmapFile if
+	// memory mapping files isn't supported.
+	errMmapNotSupported = errors.New("memory mapping is not supported on this platform")
+)
+
+// refCounterMmap is a read-only memory mapping of a refcounter file.
+type refCounterMmap struct {
+	data []byte
+}
+
+// mapRefCounterFile maps the refcounter file at path into memory. The mapping
+// stays valid after the file is closed.
+func mapRefCounterFile(path string) (_ *refCounterMmap, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to open refcounter file")
+	}
+	defer func() {
+		err = errors.Compose(err, f.Close())
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read file stats")
+	}
+	// Empty files can't be mapped.
+	if fi.Size() == 0 {
+		return &refCounterMmap{}, nil
+	}
+	if int64(int(fi.Size())) != fi.Size() {
+		return nil, errors.New("refcounter file is too large to be mapped")
+	}
+	data, err := mmapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	return &refCounterMmap{data: data}, nil
+}
+
+// readAt copies the mapped bytes at off into b. It returns false without
+// touching b if the mapping is nil or doesn't cover the whole range.
+func (m *refCounterMmap) readAt(b []byte, off uint64) bool {
+	data, ok := m.slice(off, uint64(len(b)))
+	if !ok {
+		return false
+	}
+	copy(b, data)
+	return true
+}
+
+// slice returns the n mapped bytes at off without copying them. It returns
+// false if the mapping is nil or doesn't cover the whole range. The slice is
+// only valid until the mapping is released, so the caller needs to hold the
+// refcounter's lock while using it.
+func (m *refCounterMmap) slice(off, n uint64) ([]byte, bool) {
+	if m == nil || off+n < off || off+n > uint64(len(m.data)) {
+		return nil, false
+	}
+	return m.data[off : off+n], true
+}
+
+// unmap releases the mapping. Calling unmap on a nil mapping is a no-op.
+func (m *refCounterMmap) unmap() error {
+	if m == nil || m.data == nil {
+		return nil
+	}
+	err := munmapFile(m.data)
+	m.data = nil
+	return err
+}
+
+// remap replaces the refcounter's mapping with a new one which covers the
+// current size of the file. If the file can't be mapped, the refcounter falls
+// back to regular reads. Only failing to release the old mapping is reported
+// as an error.
+func (rc *refCounter) remap() error {
+	if !rc.staticMemoryMapped {
+		return nil
+	}
+	err := rc.mmap.unmap()
+	rc.mmap = nil
+	if rc.isDeleted {
+		return err
+	}
+	if mmap, errMap := mapRefCounterFile(rc.filepath); errMap == nil {
+		rc.mmap = mmap
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package proto
+
+import (
+	"os"
+)
+
+// mmapFile is not supported on windows.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapNotSupported
+}
+
+// munmapFile is not supported on windows.
+func munmapFile(data []byte) error {
+	return errMmapNotSupported
+}
@@ -0,0 +1,126 @@
+package proto
+
+import (
+	"time"
+)
+
+// The following constants are the operations that are recorded in a
+// refcounter's operation log.
+const (
+	refCounterOpAppend         = "Append"
+	refCounterOpApplyDelta     = "ApplyDelta"
+	refCounterOpCommitReserved = "CommitReserved"
+	refCounterOpConcat         = "Concat"
+	refCounterOpDecrement      = "Decrement"
+	refCounterOpDropSectors    = "DropSectors"
+	refCounterOpFill           = "Fill"
+	refCounterOpIncrement      = "Increment"
+	refCounterOpSetCount       = "SetCount"
+	refCounterOpSwap           = "Swap"
+)
+
+type (
+	// refCounterOptions contains optional settings for a refcounter which can
+	// be provided when the refcounter is created or loaded.
+	refCounterOptions struct {
+		// Mode is the mode of a newly created refcounter. It is ignored when
+		// loading a refcounter since the mode is stored in its header.
+		Mode RefCounterMode
+
+		// OperationLogSize is the maximum number of operations kept in the
+		// refcounter's operation log. The log is disabled if it is 0.
+		OperationLogSize int
+
+		// SaturatingMax is the value at which incrementing a counter
+		// saturates instead of failing. A saturated counter means that the
+		// sector has at least that many references. Saturation is disabled
+		// if it is 0, in which case incrementing a counter fails on overflow.
+		SaturatingMax uint16
+
+		// MemoryMapped serves reads from a memory mapping of the refcounter
+		// file instead of reading from the file. See refcountermmap.go for
+		// the platform caveats.
+		MemoryMapped bool
+	}
+
+	// refCounterOperation is a single record in a refcounter's operation log.
+	// It describes how a mutating operation changed the count of a sector.
+	//
+	// A Fill operation is recorded as a single record where Sector is the
+	// number of sectors that were filled. A Concat operation is recorded as a
+	// single record where Sector is the index of the first appended sector.
+	//
+	// NOTE: operations are recorded when the corresponding update is created
+	// within an update session, not when it is applied to disk.
+	refCounterOperation struct {
+		Timestamp time.Time
+		Op        string
+		Sector    uint64
+		OldCount  uint16
+		NewCount  uint16
+	}
+
+	// refCounterOperationLog is a bounded log of refcounter operations. It is
+	// implemented as a ring buffer, once the log is full, the oldest records
+	// are overwritten.
+	refCounterOperationLog struct {
+		entries []refCounterOperation
+		next    int
+		full    bool
+	}
+)
+
+// newRefCounterOperationLog creates a new operation log which holds up to size
+// records. If size is not positive, nil is returned which disables logging.
+func newRefCounterOperationLog(size int) *refCounterOperationLog {
+	if size <= 0 {
+		return nil
+	}
+	return &refCounterOperationLog{
+		entries: make([]refCounterOperation, size),
+	}
+}
+
+// add adds a record to the log, overwriting the oldest record if the log is
+// full. Calling add on a nil log is a no-op.
+func (l *refCounterOperationLog) add(op string, secIdx uint64, oldCount, newCount uint16) {
+	if l == nil {
+		return
+	}
+	l.entries[l.next] = refCounterOperation{
+		Timestamp: time.Now(),
+		Op:        op,
+		Sector:    secIdx,
+		OldCount:  oldCount,
+		NewCount:  newCount,
+	}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// records returns a copy of the records in the log, ordered from oldest to
+// newest.
+func (l *refCounterOperationLog) records() []refCounterOperation {
+	if l == nil {
+		return nil
+	}
+	if !l.full {
+		return append([]refCounterOperation{}, l.entries[:l.next]...)
+	}
+	records := make([]refCounterOperation, 0, len(l.entries))
+	records = append(records, l.entries[l.next:]...)
+	return append(records, l.entries[:l.next]...)
+}
+
+// callOperationLog returns the records of the refcounter's operation log,
+// ordered from oldest to newest. If the log is not enabled, nil is returned.
+func (rc *refCounter) callOperationLog() []refCounterOperation {
+	if !rc.initialized() {
+		return nil
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.opLog.records()
+}
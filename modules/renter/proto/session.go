@@ -22,6 +22,22 @@ import (
 	"go.sia.tech/siad/types"
 )
 
+var (
+	// errInvalidOldMerkleRoot is returned if the Merkle proof provided by the
+	// host doesn't match the contract's current Merkle root.
+	errInvalidOldMerkleRoot = errors.New("invalid Merkle proof for old root")
+
+	// errInvalidNewMerkleRoot is returned if the new Merkle root claimed by
+	// the host doesn't match the root computed from the old root and the
+	// locally computed roots of the uploaded sectors.
+	errInvalidNewMerkleRoot = errors.New("invalid Merkle proof for new root")
+
+	// errInvalidMerkleProofSize is returned if the Merkle proof provided by
+	// the host doesn't contain exactly the number of subtree hashes required
+	// for the sectors modified by the actions.
+	errInvalidMerkleProofSize = errors.New("Merkle proof has the wrong number of hashes")
+)
+
 // sessionDialTimeout determines how long a Session will try to dial a host
 // before aborting.
 var sessionDialTimeout = build.Select(build.Var{
@@ -322,20 +338,14 @@ func (s *Session) write(sc *SafeContract, actions []modules.LoopWriteAction) (_
 	if err := s.readResponse(&merkleResp, modules.RPCMinLen); err != nil {
 		return modules.RenterContract{}, err
 	}
-	// verify the proof, first by verifying the old Merkle root...
+	// verify the proof before signing the new Merkle root. If the host's
+	// claimed root is not consistent with the sectors we uploaded, the host
+	// is penalized by the deferred failed interaction and the upload fails
+	// which causes the pieces to be uploaded to a different host.
 	numSectors := contract.LastRevision().NewFileSize / modules.SectorSize
-	proofRanges := calculateProofRanges(actions, numSectors)
-	proofHashes := merkleResp.OldSubtreeHashes
-	leafHashes := merkleResp.OldLeafHashes
 	oldRoot, newRoot := contract.LastRevision().NewFileMerkleRoot, merkleResp.NewMerkleRoot
-	if !crypto.VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, oldRoot) {
-		return modules.RenterContract{}, errors.New("invalid Merkle proof for old root")
-	}
-	// ...then by modifying the leaves and verifying the new Merkle root
-	leafHashes = modifyLeaves(leafHashes, actions, numSectors)
-	proofRanges = modifyProofRanges(proofRanges, actions, numSectors)
-	if !crypto.VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, newRoot) {
-		return modules.RenterContract{}, errors.New("invalid Merkle proof for new root")
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, merkleResp); err != nil {
+		return modules.RenterContract{}, err
 	}
 
 	// update the revision, sign it, and send it
@@ -988,6 +998,74 @@ func modifyProofRanges(proofRanges []crypto.ProofRange, actions []modules.LoopWr
 	return proofRanges
 }
 
+// verifyWriteMerkleProof verifies that the new Merkle root claimed by the host
+// in merkleResp is the result of applying the actions to the contract with the
+// given old Merkle root and number of sectors. The roots of appended sectors
+// are computed locally from the uploaded data rather than trusting the host.
+func verifyWriteMerkleProof(oldRoot crypto.Hash, numSectors uint64, actions []modules.LoopWriteAction, merkleResp modules.LoopWriteMerkleProof) error {
+	// verify the proof, first by verifying the old Merkle root...
+	proofRanges := calculateProofRanges(actions, numSectors)
+	proofHashes := merkleResp.OldSubtreeHashes
+	leafHashes := merkleResp.OldLeafHashes
+	var numLeaves uint64
+	for _, r := range proofRanges {
+		numLeaves += r.End - r.Start
+	}
+	if uint64(len(leafHashes)) != numLeaves {
+		return errInvalidOldMerkleRoot
+	}
+	// The verification ignores trailing hashes, so the number of hashes needs
+	// to be checked separately.
+	if expected := diffProofSize(proofRanges, numSectors); uint64(len(proofHashes)) != expected {
+		return errors.AddContext(errInvalidMerkleProofSize, fmt.Sprintf("expected %v hashes but got %v", expected, len(proofHashes)))
+	}
+	if !crypto.VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, oldRoot) {
+		return errInvalidOldMerkleRoot
+	}
+	// ...then by modifying the leaves and verifying the new Merkle root
+	leafHashes = modifyLeaves(leafHashes, actions, numSectors)
+	proofRanges = modifyProofRanges(proofRanges, actions, numSectors)
+	if !crypto.VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, merkleResp.NewMerkleRoot) {
+		return errInvalidNewMerkleRoot
+	}
+	return nil
+}
+
+// diffProofSize returns the number of subtree hashes in a Merkle diff proof for
+// the given sorted proof ranges of a tree with numLeaves leaves. The proof
+// contains one hash for every maximal subtree which doesn't contain a leaf of
+// any of the ranges.
+func diffProofSize(proofRanges []crypto.ProofRange, numLeaves uint64) uint64 {
+	// subtreeSize returns the number of hashes within the perfect subtree
+	// spanning the leaves [start, end).
+	var subtreeSize func(start, end uint64) uint64
+	subtreeSize = func(start, end uint64) uint64 {
+		var intersects bool
+		for _, r := range proofRanges {
+			if r.Start < end && r.End > start {
+				if r.Start <= start && r.End >= end {
+					return 0 // covered by a range
+				}
+				intersects = true
+			}
+		}
+		if !intersects {
+			return 1
+		}
+		mid := start + (end-start)/2
+		return subtreeSize(start, mid) + subtreeSize(mid, end)
+	}
+	// The tree consists of perfect subtrees of decreasing size from left to
+	// right.
+	var size uint64
+	for start := uint64(0); start < numLeaves; {
+		end := start + 1<<(bits.Len64(numLeaves-start)-1)
+		size += subtreeSize(start, end)
+		start = end
+	}
+	return size
+}
+
 // modifyLeaves modifies the leaf hashes of a Merkle diff proof to verify a
 // post-modification Merkle diff proof for the specified actions.
 func modifyLeaves(leafHashes []crypto.Hash, actions []modules.LoopWriteAction, numSectors uint64) []crypto.Hash {
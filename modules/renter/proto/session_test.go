@@ -2,8 +2,12 @@ package proto
 
 import (
 	"reflect"
+	"sort"
 	"testing"
 
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
 )
@@ -248,3 +252,129 @@ func TestModifyLeafHashes(t *testing.T) {
 		})
 	}
 }
+
+// fakeHostWriteMerkleProof mimics the host's handling of a Write RPC. It
+// applies the actions to the roots and returns the Merkle proof that the host
+// sends to the renter. If smuggledData is set, the host stores it instead of the
+// data of the appended sectors.
+func fakeHostWriteMerkleProof(roots []crypto.Hash, actions []modules.LoopWriteAction, smuggledData []byte) modules.LoopWriteMerkleProof {
+	newRoots := append([]crypto.Hash(nil), roots...)
+	changed := make(map[uint64]struct{})
+	for _, action := range actions {
+		switch action.Type {
+		case modules.WriteActionAppend:
+			data := action.Data
+			if smuggledData != nil {
+				data = smuggledData
+			}
+			newRoots = append(newRoots, crypto.MerkleRoot(data))
+			changed[uint64(len(newRoots)-1)] = struct{}{}
+		case modules.WriteActionTrim:
+			for i := uint64(0); i < action.A; i++ {
+				changed[uint64(len(newRoots))-1-i] = struct{}{}
+			}
+			newRoots = newRoots[:uint64(len(newRoots))-action.A]
+		case modules.WriteActionSwap:
+			newRoots[action.A], newRoots[action.B] = newRoots[action.B], newRoots[action.A]
+			changed[action.A] = struct{}{}
+			changed[action.B] = struct{}{}
+		}
+	}
+	var proofRanges []crypto.ProofRange
+	for index := range changed {
+		if index < uint64(len(roots)) {
+			proofRanges = append(proofRanges, crypto.ProofRange{Start: index, End: index + 1})
+		}
+	}
+	sort.Slice(proofRanges, func(i, j int) bool {
+		return proofRanges[i].Start < proofRanges[j].Start
+	})
+	leafHashes := make([]crypto.Hash, len(proofRanges))
+	for i, r := range proofRanges {
+		leafHashes[i] = roots[r.Start]
+	}
+	return modules.LoopWriteMerkleProof{
+		OldSubtreeHashes: crypto.MerkleDiffProof(proofRanges, uint64(len(roots)), nil, roots),
+		OldLeafHashes:    leafHashes,
+		NewMerkleRoot:    cachedMerkleRoot(newRoots),
+	}
+}
+
+// TestVerifyWriteMerkleProof tests that the renter detects a host that claims a
+// new Merkle root which doesn't match the uploaded sectors.
+func TestVerifyWriteMerkleProof(t *testing.T) {
+	t.Parallel()
+
+	roots := make([]crypto.Hash, 5)
+	for i := range roots {
+		fastrand.Read(roots[i][:])
+	}
+	oldRoot := cachedMerkleRoot(roots)
+	numSectors := uint64(len(roots))
+	actions := []modules.LoopWriteAction{
+		{Type: modules.WriteActionSwap, A: 1, B: 4},
+		{Type: modules.WriteActionTrim, A: 1},
+		{Type: modules.WriteActionAppend, Data: fastrand.Bytes(64)},
+	}
+
+	// An honest host's proof is accepted.
+	resp := fakeHostWriteMerkleProof(roots, actions, nil)
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// A host that stores a different sector is caught.
+	resp = fakeHostWriteMerkleProof(roots, actions, fastrand.Bytes(64))
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, resp); !errors.Contains(err, errInvalidNewMerkleRoot) {
+		t.Fatal("expected errInvalidNewMerkleRoot, got", err)
+	}
+
+	// A host that lies about the old leaves is caught.
+	resp = fakeHostWriteMerkleProof(roots, actions, nil)
+	fastrand.Read(resp.OldLeafHashes[0][:])
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, resp); !errors.Contains(err, errInvalidOldMerkleRoot) {
+		t.Fatal("expected errInvalidOldMerkleRoot, got", err)
+	}
+
+	// A host that sends additional proof hashes is caught.
+	resp = fakeHostWriteMerkleProof(roots, actions, nil)
+	resp.OldSubtreeHashes = append(resp.OldSubtreeHashes, crypto.Hash{})
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, resp); !errors.Contains(err, errInvalidMerkleProofSize) {
+		t.Fatal("expected errInvalidMerkleProofSize, got", err)
+	}
+
+	// A host that sends too few leaves is caught.
+	resp = fakeHostWriteMerkleProof(roots, actions, nil)
+	resp.OldLeafHashes = resp.OldLeafHashes[:1]
+	if err := verifyWriteMerkleProof(oldRoot, numSectors, actions, resp); !errors.Contains(err, errInvalidOldMerkleRoot) {
+		t.Fatal("expected errInvalidOldMerkleRoot, got", err)
+	}
+}
+
+// TestDiffProofSize tests that diffProofSize matches the size of the proofs
+// created by crypto.MerkleDiffProof.
+func TestDiffProofSize(t *testing.T) {
+	t.Parallel()
+
+	for numLeaves := uint64(1); numLeaves < 70; numLeaves++ {
+		roots := make([]crypto.Hash, numLeaves)
+		for i := 0; i < 5; i++ {
+			// Pick random ranges of single leaves like calculateProofRanges.
+			indices := make(map[uint64]struct{})
+			for j := fastrand.Intn(5); j > 0; j-- {
+				indices[fastrand.Uint64n(numLeaves)] = struct{}{}
+			}
+			var ranges []crypto.ProofRange
+			for index := range indices {
+				ranges = append(ranges, crypto.ProofRange{Start: index, End: index + 1})
+			}
+			sort.Slice(ranges, func(i, j int) bool {
+				return ranges[i].Start < ranges[j].Start
+			})
+			expected := uint64(len(crypto.MerkleDiffProof(ranges, numLeaves, nil, roots)))
+			if size := diffProofSize(ranges, numLeaves); size != expected {
+				t.Fatalf("%v leaves, ranges %v: expected %v but got %v", numLeaves, ranges, expected, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package renter
+
+// rangeserver implements an http.Handler which serves the renter's files while
+// honoring the HTTP Range header. Every request opens a streamer for the file,
+// seeks to the start of the requested range and copies the reconstructed data
+// to the client as it becomes available. That allows media players to seek
+// within a file without downloading it entirely. Just like /renter/stream, the
+// reads don't show up in the renter's download history.
+//
+// Only single byte ranges are supported. Requests for multiple ranges are
+// answered with the whole file, which is permitted by RFC 7233.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem"
+)
+
+var (
+	// errInvalidRange is returned when a Range header can't be parsed.
+	errInvalidRange = errors.New("invalid range")
+
+	// errUnsatisfiableRange is returned when a Range header doesn't overlap
+	// with the file.
+	errUnsatisfiableRange = errors.New("range not satisfiable")
+)
+
+type (
+	// rangeStreamer is the subset of the renter's methods required by the
+	// range server.
+	rangeStreamer interface {
+		File(siaPath modules.SiaPath) (modules.FileInfo, error)
+		Streamer(siaPath modules.SiaPath, disableLocalFetch bool) (string, modules.Streamer, error)
+	}
+
+	// rangeServer is an http.Handler that serves files using streamers. The
+	// path of the request URL is interpreted as the siapath of the file.
+	rangeServer struct {
+		staticRenter rangeStreamer
+	}
+
+	// flushWriter is a writer that flushes the underlying http.ResponseWriter
+	// after every write to make sure that the data is sent to the client as
+	// soon as it is available.
+	flushWriter struct {
+		w http.ResponseWriter
+		f http.Flusher
+	}
+)
+
+// NewRangeServer returns an http.Handler that serves the files of the provided
+// renter and honors the HTTP Range header. The path of the request URL is
+// interpreted as the siapath of the requested file. The API mounts it at
+// /renter/range.
+func NewRangeServer(r modules.Renter) http.Handler {
+	return newRangeServer(r)
+}
+
+// newRangeServer creates a new rangeServer.
+func newRangeServer(r rangeStreamer) *rangeServer {
+	return &rangeServer{
+		staticRenter: r,
+	}
+}
+
+// Write writes b to the underlying writer and flushes it.
+func (fw flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// ServeHTTP implements http.Handler.
+func (rs *rangeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	siaPath, err := modules.NewSiaPath(strings.TrimPrefix(req.URL.Path, "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var disableLocalFetch bool
+	if dlf := req.FormValue("disablelocalfetch"); dlf != "" {
+		disableLocalFetch, err = strconv.ParseBool(dlf)
+		if err != nil {
+			http.Error(w, "unable to parse 'disablelocalfetch': "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	fi, err := rs.staticRenter.File(siaPath)
+	if errors.Contains(err, filesystem.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	size := fi.Filesize
+
+	// Figure out which bytes to serve.
+	offset, length := uint64(0), size
+	status := http.StatusOK
+	w.Header().Set("Accept-Ranges", "bytes")
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		offset, length, err = parseRange(rangeHeader, size)
+		if errors.Contains(err, errUnsatisfiableRange) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%v", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		} else if err != nil {
+			// Invalid and multi-range headers are ignored and the whole file
+			// is served.
+			offset, length = 0, size
+		} else {
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", offset, offset+length-1, size))
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(length))
+	if req.Method == http.MethodHead || length == 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	// Open a streamer at the start of the range and copy the range to the
+	// client.
+	_, streamer, err := rs.staticRenter.Streamer(siaPath, disableLocalFetch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = streamer.Close()
+	}()
+	if _, err := streamer.Seek(int64(offset), io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	// Once the header is written, errors can't be reported to the client
+	// anymore. The connection is closed early which is noticed by the client
+	// due to the mismatch with the Content-Length.
+	fw := flushWriter{w: w}
+	fw.f, _ = w.(http.Flusher)
+	_, _ = io.CopyN(fw, streamer, int64(length))
+}
+
+// parseRange parses the value of a Range header for a file of the given size
+// and returns the offset and length of the requested range. Only a single byte
+// range is supported, errInvalidRange is returned for everything else.
+func parseRange(s string, size uint64) (offset, length uint64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, errInvalidRange
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(s, prefix))
+	if strings.Contains(spec, ",") {
+		return 0, 0, errInvalidRange
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, errInvalidRange
+	}
+	startStr, endStr := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	// Suffix range, e.g. "bytes=-500" for the last 500 bytes.
+	if startStr == "" {
+		n, err := strconv.ParseUint(endStr, 10, 64)
+		if err != nil {
+			return 0, 0, errInvalidRange
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+	start, err := strconv.ParseUint(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, errInvalidRange
+	}
+	if start >= size {
+		return 0, 0, errUnsatisfiableRange
+	}
+	// Open range, e.g. "bytes=500-".
+	if endStr == "" {
+		return start, size - start, nil
+	}
+	end, err := strconv.ParseUint(endStr, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, errInvalidRange
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end - start + 1, nil
+}
@@ -0,0 +1,154 @@
+package renter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem"
+)
+
+// testRangeStreamer is a rangeStreamer which serves a single file from memory.
+type testRangeStreamer struct {
+	siaPath modules.SiaPath
+	data    []byte
+}
+
+// testStreamer is a modules.Streamer which returns its data in small pieces
+// to simulate the data becoming available chunk by chunk.
+type testStreamer struct {
+	*bytes.Reader
+}
+
+// File implements rangeStreamer.
+func (trs *testRangeStreamer) File(siaPath modules.SiaPath) (modules.FileInfo, error) {
+	if !siaPath.Equals(trs.siaPath) {
+		return modules.FileInfo{}, filesystem.ErrNotExist
+	}
+	return modules.FileInfo{SiaPath: siaPath, Filesize: uint64(len(trs.data))}, nil
+}
+
+// Streamer implements rangeStreamer.
+func (trs *testRangeStreamer) Streamer(siaPath modules.SiaPath, _ bool) (string, modules.Streamer, error) {
+	if !siaPath.Equals(trs.siaPath) {
+		return "", nil, filesystem.ErrNotExist
+	}
+	return siaPath.String(), testStreamer{bytes.NewReader(trs.data)}, nil
+}
+
+// Read implements io.Reader.
+func (ts testStreamer) Read(b []byte) (int, error) {
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	return ts.Reader.Read(b)
+}
+
+// Close implements io.Closer.
+func (ts testStreamer) Close() error { return nil }
+
+// TestRangeServer tests serving files with the rangeServer.
+func TestRangeServer(t *testing.T) {
+	t.Parallel()
+
+	siaPath, err := modules.NewSiaPath("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(100)
+	srv := httptest.NewServer(newRangeServer(&testRangeStreamer{siaPath: siaPath, data: data}))
+	defer srv.Close()
+
+	// get is a helper that performs a request with the given range header.
+	get := func(path, rangeHeader string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	// A request without a range returns the whole file.
+	resp, body := get("foo/bar", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", resp.StatusCode)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("wrong data")
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatal("missing Accept-Ranges header")
+	}
+
+	// Check the supported ranges.
+	tests := []struct {
+		rangeHeader string
+		start, end  int
+	}{
+		{"bytes=0-0", 0, 0},
+		{"bytes=10-19", 10, 19},
+		{"bytes=90-", 90, 99},
+		{"bytes=-5", 95, 99},
+		{"bytes=50-1000", 50, 99},
+		{"bytes=-1000", 0, 99},
+	}
+	for _, test := range tests {
+		resp, body := get("foo/bar", test.rangeHeader)
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatal(test.rangeHeader, "unexpected status", resp.StatusCode)
+		}
+		if !bytes.Equal(body, data[test.start:test.end+1]) {
+			t.Fatal(test.rangeHeader, "wrong data")
+		}
+		contentRange := fmt.Sprintf("bytes %v-%v/%v", test.start, test.end, len(data))
+		if cr := resp.Header.Get("Content-Range"); cr != contentRange {
+			t.Fatalf("%v: expected Content-Range %v, got %v", test.rangeHeader, contentRange, cr)
+		}
+	}
+
+	// Unsatisfiable ranges.
+	for _, rangeHeader := range []string{"bytes=100-", "bytes=-0"} {
+		resp, _ := get("foo/bar", rangeHeader)
+		if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatal(rangeHeader, "unexpected status", resp.StatusCode)
+		}
+		if cr := resp.Header.Get("Content-Range"); cr != "bytes */100" {
+			t.Fatal(rangeHeader, "unexpected Content-Range", cr)
+		}
+	}
+
+	// Invalid and multi-range headers are ignored.
+	for _, rangeHeader := range []string{"bytes=0-1,5-6", "items=0-1", "bytes=5-1"} {
+		resp, body := get("foo/bar", rangeHeader)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal(rangeHeader, "unexpected status", resp.StatusCode)
+		}
+		if !bytes.Equal(body, data) {
+			t.Fatal(rangeHeader, "wrong data")
+		}
+	}
+
+	// Unknown files are not found.
+	resp, _ = get("foo/baz", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("unexpected status", resp.StatusCode)
+	}
+}
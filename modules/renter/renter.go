@@ -45,6 +45,7 @@ import (
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/modules/renter/contractor"
 	"go.sia.tech/siad/modules/renter/filesystem"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
 	"go.sia.tech/siad/modules/renter/hostdb"
 	"go.sia.tech/siad/persist"
 	siasync "go.sia.tech/siad/sync"
@@ -225,6 +226,34 @@ type Renter struct {
 	// read registry stats
 	staticRRS *readRegistryStats
 
+	// staticPieceAvailabilityCache caches the results of HasSector queries so
+	// that concurrent downloads of the same chunks don't query the same hosts
+	// for the same roots over and over.
+	staticPieceAvailabilityCache *pieceAvailabilityCache
+
+	// staticEncodedChunkCache caches the erasure coded pieces of chunks
+	// which were fetched for a repair, so that repairing the same chunk again
+	// doesn't need to fetch and encode it again.
+	staticEncodedChunkCache *encodedChunkCache
+
+	// staticHostBlacklist contains the hosts which are excluded from uploads
+	// and downloads.
+	staticHostBlacklist *hostBlacklist
+
+	// staticDownloadChunkLimiter limits the number of chunks which are
+	// downloaded at the same time.
+	staticDownloadChunkLimiter *downloadChunkLimiter
+
+	// staticMetrics tracks the renter's upload and download throughput.
+	staticMetrics *renterMetrics
+
+	// staticClock is the source of the current time for the upload pacers.
+	staticClock clock
+
+	// staticUploadPacer limits the number of new sectors uploaded per second
+	// across all workers.
+	staticUploadPacer *uploadPacer
+
 	// Memory management
 	//
 	// registryMemoryManager is used for updating registry entries and reading
@@ -604,6 +633,9 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 {
 		return errors.New("bandwidth limits cannot be negative")
 	}
+	if err := validateDownloadConcurrencySettings(s); err != nil {
+		return err
+	}
 
 	// Set allowance.
 	err := r.hostContractor.SetAllowance(s.Allowance)
@@ -624,18 +656,135 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	id := r.mu.Lock()
 	r.persist.MaxDownloadSpeed = s.MaxDownloadSpeed
 	r.persist.MaxUploadSpeed = s.MaxUploadSpeed
+	r.persist.DownloadOverdrive = s.DownloadOverdrive
+	r.persist.MaxConcurrentDownloadChunks = s.MaxConcurrentDownloadChunks
+	r.persist.MaxDownloadWorkersPerChunk = s.MaxDownloadWorkersPerChunk
 	err = r.saveSync()
 	r.mu.Unlock(id)
 	if err != nil {
 		return err
 	}
 
+	// Apply the new chunk limit. Chunks which are already being downloaded
+	// keep their slots, the limit applies to the chunks scheduled next.
+	r.staticDownloadChunkLimiter.callSetLimit(s.MaxConcurrentDownloadChunks)
+
 	// Update the worker pool so that the changes are immediately apparent to
 	// users.
 	r.staticWorkerPool.callUpdate()
 	return nil
 }
 
+// SetDefaultErasureCode sets the erasure code parameters which are used for
+// uploads that don't specify an erasure code. The parameters are persisted.
+func (r *Renter) SetDefaultErasureCode(dataPieces, parityPieces int) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	// Validate the parameters by creating an erasure coder.
+	if _, err := modules.NewRSSubCode(dataPieces, parityPieces, crypto.SegmentSize); err != nil {
+		return errors.AddContext(err, "invalid erasure code parameters")
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.DefaultDataPieces = dataPieces
+	r.persist.DefaultParityPieces = parityPieces
+	return r.saveSync()
+}
+
+// DefaultErasureCode returns the erasure coder used for uploads that don't
+// specify an erasure code.
+func (r *Renter) DefaultErasureCode() (modules.ErasureCoder, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+	return r.managedDefaultErasureCode(), nil
+}
+
+// managedDefaultErasureCode returns the erasure coder used for uploads that
+// don't specify an erasure code.
+func (r *Renter) managedDefaultErasureCode() modules.ErasureCoder {
+	id := r.mu.RLock()
+	dataPieces, parityPieces := r.persist.DefaultDataPieces, r.persist.DefaultParityPieces
+	r.mu.RUnlock(id)
+	if dataPieces == 0 || parityPieces == 0 {
+		return modules.NewRSSubCodeDefault()
+	}
+	ec, err := modules.NewRSSubCode(dataPieces, parityPieces, crypto.SegmentSize)
+	if err != nil {
+		r.log.Printf("WARNING: invalid default erasure code %v-of-%v, using the built-in default: %v", dataPieces, dataPieces+parityPieces, err)
+		return modules.NewRSSubCodeDefault()
+	}
+	return ec
+}
+
+// SetDefaultRepairThreshold sets the repair threshold, expressed as a
+// redundancy multiplier, that is applied to new files. A threshold of 0 resets
+// it to the built-in default. Existing files are not affected.
+func (r *Renter) SetDefaultRepairThreshold(threshold float64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if threshold != 0 && !(threshold > 1) {
+		return errors.AddContext(siafile.ErrInvalidRepairThreshold, "threshold needs to be greater than 1")
+	}
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.DefaultRepairThreshold = threshold
+	return r.saveSync()
+}
+
+// SetFileRepairThreshold sets the repair threshold of a file, expressed as a
+// redundancy multiplier. The threshold needs to be reachable with the file's
+// erasure code. A threshold of 0 resets it to the built-in default.
+func (r *Renter) SetFileRepairThreshold(siaPath modules.SiaPath, threshold float64) (err error) {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Compose(err, entry.Close())
+	}()
+	if err := entry.SetRepairThreshold(threshold); err != nil {
+		return err
+	}
+	// The file's health changed. Reset the directory heap and bubble the
+	// file's directory to make the repair loop pick up the new health right
+	// away.
+	dirSiaPath, err := siaPath.Dir()
+	if err != nil {
+		return err
+	}
+	r.directoryHeap.managedReset()
+	_ = r.staticBubbleScheduler.callQueueBubble(dirSiaPath)
+	return nil
+}
+
+// managedApplyRepairThreshold applies the given repair threshold to a new
+// file. If the threshold is 0, the renter's default repair threshold is
+// applied. If the threshold can't be reached with the file's erasure code, the
+// file uses the built-in default instead.
+func (r *Renter) managedApplyRepairThreshold(entry *filesystem.FileNode, threshold float64) {
+	if threshold == 0 {
+		id := r.mu.RLock()
+		threshold = r.persist.DefaultRepairThreshold
+		r.mu.RUnlock(id)
+	}
+	if threshold == 0 {
+		return
+	}
+	if err := entry.SetRepairThreshold(threshold); err != nil {
+		r.log.Printf("WARNING: unable to apply repair threshold %v: %v", threshold, err)
+	}
+}
+
 // SetFileTrackingPath sets the on-disk location of an uploaded file to a new
 // value. Useful if files need to be moved on disk. SetFileTrackingPath will
 // check that a file exists at the new location and it ensures that it has the
@@ -817,6 +966,11 @@ func (r *Renter) Settings() (modules.RenterSettings, error) {
 		return modules.RenterSettings{}, errors.AddContext(err, "error getting IPViolationsCheck:")
 	}
 	paused, endTime := r.uploadHeap.managedPauseStatus()
+	id := r.mu.RLock()
+	overdrive := r.persist.DownloadOverdrive
+	maxChunks := r.persist.MaxConcurrentDownloadChunks
+	maxWorkers := r.persist.MaxDownloadWorkersPerChunk
+	r.mu.RUnlock(id)
 	return modules.RenterSettings{
 		Allowance:        r.hostContractor.Allowance(),
 		IPViolationCheck: enabled,
@@ -826,6 +980,9 @@ func (r *Renter) Settings() (modules.RenterSettings, error) {
 			Paused:       paused,
 			PauseEndTime: endTime,
 		},
+		DownloadOverdrive:           overdrive,
+		MaxConcurrentDownloadChunks: maxChunks,
+		MaxDownloadWorkersPerChunk:  maxWorkers,
 	}, nil
 }
 
@@ -928,6 +1085,12 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 	r.staticBubbleScheduler = newBubbleScheduler(r)
 	r.staticStreamBufferSet = newStreamBufferSet(&r.tg)
 	r.staticUploadChunkDistributionQueue = newUploadChunkDistributionQueue(r)
+	r.staticPieceAvailabilityCache = newPieceAvailabilityCache(pieceAvailabilityCacheTTL)
+	r.staticHostBlacklist = newHostBlacklist()
+	r.staticDownloadChunkLimiter = newDownloadChunkLimiter()
+	r.staticMetrics = newRenterMetrics()
+	r.staticClock = stdClock{}
+	r.staticUploadPacer = newUploadPacer(r.staticClock, maxSectorUploadsPerSecond, maxSectorUploadsPerSecond, 0)
 	r.staticRRS = newReadRegistryStats(ReadRegistryBackgroundTimeout, readRegistryStatsInterval, readRegistryStatsDecay, readRegistryStatsPercentile)
 	close(r.uploadHeap.pauseChan)
 
@@ -969,6 +1132,7 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 	r.userUploadMemoryManager = newMemoryManager(userUploadMemoryDefault, userUploadMemoryPriorityDefault, r.tg.StopChan())
 	r.userDownloadMemoryManager = newMemoryManager(userDownloadMemoryDefault, userDownloadMemoryPriorityDefault, r.tg.StopChan())
 	r.repairMemoryManager = newMemoryManager(repairMemoryDefault, repairMemoryPriorityDefault, r.tg.StopChan())
+	r.staticEncodedChunkCache = newEncodedChunkCache(encodedChunkCacheMaxSize, encodedChunkCacheTTL, r.repairMemoryManager)
 
 	r.staticFuseManager = newFuseManager(r)
 	r.stuckStack = callNewStuckStack()
@@ -979,6 +1143,17 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 		return nil, err
 	}
 
+	// Flush the bubbled metadata on shutdown. This needs to happen after the
+	// bubble scheduler's background thread stopped but before the WAL is
+	// closed.
+	err = r.tg.AfterStop(func() error {
+		_, err := r.staticBubbleScheduler.managedFlush()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// After persist is initialized, create the worker pool.
 	r.staticWorkerPool = r.newWorkerPool()
 
@@ -1038,6 +1213,7 @@ func renterAsyncStartup(r *Renter, cs modules.ConsensusSet) error {
 	if !r.deps.Disrupt("DisableRepairAndHealthLoops") {
 		go r.threadedUploadAndRepair()
 		go r.threadedStuckFileLoop()
+		go r.threadedPruneEncodedChunkCache()
 	}
 	// Spin up the snapshot synchronization thread.
 	if !r.deps.Disrupt("DisableSnapshotSync") {
@@ -0,0 +1,296 @@
+package renter
+
+// share implements the .sia share format. A share is a self-contained export
+// of a single siafile which allows another renter to download the file without
+// access to the exporting renter. It contains the file's metadata, its piece
+// table and the public keys of the hosts storing the pieces. Optionally, it
+// also contains the file's encryption key. The format replaces the legacy 0.4
+// share format which is still supported by the compat code.
+//
+// Shares which don't contain the encryption key can't be imported on their own.
+// Importing them fails with ErrShareKeyRequired, which signals the caller that
+// the user needs to be prompted for the key before calling
+// ImportSiaFileWithKey.
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/errors"
+
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
+)
+
+const (
+	// siaShareVersion is the current version of the share format.
+	siaShareVersion = 1
+
+	// siaShareMaxAlloc is the maximum number of bytes allocated when decoding a
+	// share.
+	siaShareMaxAlloc = 1 << 28 // 256 MiB
+)
+
+var (
+	// siaShareSpecifier is the specifier at the beginning of every share.
+	siaShareSpecifier = types.NewSpecifier("SiaShare")
+)
+
+var (
+	// ErrInvalidShare is returned when a share is malformed.
+	ErrInvalidShare = errors.New("invalid share")
+
+	// ErrShareKeyRequired is returned when a share without an encryption key
+	// is imported without providing the key.
+	ErrShareKeyRequired = errors.New("share doesn't contain an encryption key, the key needs to be provided")
+
+	// ErrUnsupportedShareVersion is returned when a share was created by a
+	// newer version of the renter.
+	ErrUnsupportedShareVersion = errors.New("unsupported share version")
+)
+
+type (
+	// siaShareHeader is the header of a share.
+	siaShareHeader struct {
+		Specifier types.Specifier
+		Version   uint64
+	}
+
+	// shareFile contains the information about the shared file.
+	shareFile struct {
+		FileSize     uint64
+		Mode         uint32
+		ECType       modules.ErasureCoderType
+		DataPieces   uint64
+		ParityPieces uint64
+		CipherType   crypto.CipherType
+		Key          []byte
+		HostKeys     []types.SiaPublicKey
+		Chunks       []shareChunk
+	}
+
+	// shareChunk contains the pieces of a single chunk of the shared file.
+	shareChunk struct {
+		Pieces []sharePiece
+	}
+
+	// sharePiece is a single piece of the shared file. The host is referenced
+	// by its index within the share's HostKeys.
+	sharePiece struct {
+		PieceIndex uint64
+		HostIndex  uint64
+		MerkleRoot crypto.Hash
+	}
+)
+
+// erasureCode returns the erasure coder of the shared file.
+func (sf shareFile) erasureCode() (modules.ErasureCoder, error) {
+	switch sf.ECType {
+	case modules.ECReedSolomon:
+		return modules.NewRSCode(int(sf.DataPieces), int(sf.ParityPieces))
+	case modules.ECReedSolomonSubShards64:
+		return modules.NewRSSubCode(int(sf.DataPieces), int(sf.ParityPieces), crypto.SegmentSize)
+	default:
+		return nil, errors.New("unknown erasure code type")
+	}
+}
+
+// ExportSiaFile writes the file at siaPath to w in the share format. If
+// includeKey is set, the share contains the file's encryption key which allows
+// anyone with access to the share to download and decrypt the file.
+func (r *Renter) ExportSiaFile(siaPath modules.SiaPath, w io.Writer, includeKey bool) (err error) {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to open file")
+	}
+	defer func() {
+		err = errors.Compose(err, entry.Close())
+	}()
+	// Pieces of partial chunks aren't stored in the file's piece table and
+	// can't be shared.
+	if len(entry.PartialChunks()) > 0 {
+		return errors.New("files with partial chunks can't be exported")
+	}
+
+	ec := entry.ErasureCode()
+	mk := entry.MasterKey()
+	sf := shareFile{
+		FileSize:     entry.Size(),
+		Mode:         uint32(entry.Mode()),
+		ECType:       ec.Type(),
+		DataPieces:   uint64(ec.MinPieces()),
+		ParityPieces: uint64(ec.NumPieces() - ec.MinPieces()),
+		CipherType:   mk.Type(),
+	}
+	if includeKey {
+		sf.Key = mk.Key()
+	}
+
+	// Build the piece table. Hosts are deduplicated by referencing them by
+	// their index.
+	hostIndices := make(map[string]uint64)
+	for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+		pieces, err := entry.Pieces(chunkIndex)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("unable to get pieces of chunk %v", chunkIndex))
+		}
+		var chunk shareChunk
+		for pieceIndex, pieceSet := range pieces {
+			for _, piece := range pieceSet {
+				hostIndex, exists := hostIndices[piece.HostPubKey.String()]
+				if !exists {
+					hostIndex = uint64(len(sf.HostKeys))
+					hostIndices[piece.HostPubKey.String()] = hostIndex
+					sf.HostKeys = append(sf.HostKeys, piece.HostPubKey)
+				}
+				chunk.Pieces = append(chunk.Pieces, sharePiece{
+					PieceIndex: uint64(pieceIndex),
+					HostIndex:  hostIndex,
+					MerkleRoot: piece.MerkleRoot,
+				})
+			}
+		}
+		sf.Chunks = append(sf.Chunks, chunk)
+	}
+
+	header := siaShareHeader{
+		Specifier: siaShareSpecifier,
+		Version:   siaShareVersion,
+	}
+	return encoding.NewEncoder(w).EncodeAll(header, sf)
+}
+
+// ImportSiaFile reads a share from r and adds the shared file to the renter at
+// destSiaPath. The file can be downloaded as long as the renter has contracts
+// with the hosts storing its pieces. If the share doesn't contain the
+// encryption key, ErrShareKeyRequired is returned and the import needs to be
+// retried with ImportSiaFileWithKey.
+func (r *Renter) ImportSiaFile(rd io.Reader, destSiaPath modules.SiaPath) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	return r.managedImportSiaFile(rd, destSiaPath, nil)
+}
+
+// ImportSiaFileWithKey imports a share like ImportSiaFile but uses the
+// provided encryption key. That allows for importing shares which were
+// exported without their key.
+func (r *Renter) ImportSiaFileWithKey(rd io.Reader, destSiaPath modules.SiaPath, key crypto.CipherKey) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if key == nil {
+		return errors.New("no encryption key provided")
+	}
+	return r.managedImportSiaFile(rd, destSiaPath, key)
+}
+
+// managedImportSiaFile imports a share. If key is nil, the key is read from
+// the share.
+func (r *Renter) managedImportSiaFile(rd io.Reader, destSiaPath modules.SiaPath, key crypto.CipherKey) (err error) {
+	sf, err := readShare(rd)
+	if err != nil {
+		return err
+	}
+
+	// Determine the key.
+	if key == nil && len(sf.Key) == 0 && sf.CipherType != crypto.TypePlain {
+		return ErrShareKeyRequired
+	} else if key == nil {
+		key, err = crypto.NewSiaKey(sf.CipherType, sf.Key)
+		if err != nil {
+			return errors.Compose(err, ErrInvalidShare)
+		}
+	} else if key.Type() != sf.CipherType {
+		return fmt.Errorf("provided key has type %v but the share requires type %v", key.Type(), sf.CipherType)
+	}
+	ec, err := sf.erasureCode()
+	if err != nil {
+		return errors.Compose(err, ErrInvalidShare)
+	}
+
+	// Check how many of the hosts the renter has contracts with. The file is
+	// imported either way since contracts might be formed later, but the user
+	// should know that the file can't be downloaded yet.
+	contractHosts := make(map[string]struct{})
+	for _, c := range r.hostContractor.Contracts() {
+		contractHosts[c.HostPublicKey.String()] = struct{}{}
+	}
+	var overlap int
+	for _, spk := range sf.HostKeys {
+		if _, exists := contractHosts[spk.String()]; exists {
+			overlap++
+		}
+	}
+	if overlap < len(sf.HostKeys) {
+		r.log.Printf("Imported file %v is stored on %v hosts, but the renter only has contracts with %v of them", destSiaPath, len(sf.HostKeys), overlap)
+	}
+
+	// Create the file and add the pieces.
+	err = r.staticFileSystem.NewSiaFile(destSiaPath, "", ec, key, sf.FileSize, os.FileMode(sf.Mode), true)
+	if err != nil {
+		return errors.AddContext(err, "unable to create file")
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(destSiaPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to open new file")
+	}
+	defer func() {
+		err = errors.Compose(err, entry.Close())
+		// Don't leave a broken file behind.
+		if err != nil {
+			err = errors.Compose(err, r.staticFileSystem.DeleteFile(destSiaPath))
+		}
+	}()
+	if uint64(len(sf.Chunks)) != entry.NumChunks() {
+		return errors.AddContext(ErrInvalidShare, fmt.Sprintf("share contains %v chunks but the file requires %v", len(sf.Chunks), entry.NumChunks()))
+	}
+	for chunkIndex, chunk := range sf.Chunks {
+		for _, piece := range chunk.Pieces {
+			if piece.PieceIndex >= uint64(ec.NumPieces()) || piece.HostIndex >= uint64(len(sf.HostKeys)) {
+				return errors.AddContext(ErrInvalidShare, fmt.Sprintf("invalid piece in chunk %v", chunkIndex))
+			}
+			err = entry.AddPiece(sf.HostKeys[piece.HostIndex], uint64(chunkIndex), piece.PieceIndex, piece.MerkleRoot)
+			if err != nil {
+				return errors.AddContext(err, "unable to add piece")
+			}
+		}
+	}
+
+	// Queue a bubble to update the directory's metadata.
+	dirSiaPath, err := destSiaPath.Dir()
+	if err != nil {
+		return err
+	}
+	_ = r.staticBubbleScheduler.callQueueBubble(dirSiaPath)
+	return nil
+}
+
+// readShare reads and validates a share from r.
+func readShare(r io.Reader) (shareFile, error) {
+	dec := encoding.NewDecoder(r, siaShareMaxAlloc)
+	var header siaShareHeader
+	if err := dec.Decode(&header); err != nil {
+		return shareFile{}, errors.Compose(err, ErrInvalidShare)
+	}
+	if header.Specifier != siaShareSpecifier {
+		return shareFile{}, errors.AddContext(ErrInvalidShare, "unknown specifier")
+	}
+	if header.Version != siaShareVersion {
+		return shareFile{}, errors.AddContext(ErrUnsupportedShareVersion, fmt.Sprintf("version %v", header.Version))
+	}
+	var sf shareFile
+	if err := dec.Decode(&sf); err != nil {
+		return shareFile{}, errors.Compose(err, ErrInvalidShare)
+	}
+	return sf, nil
+}
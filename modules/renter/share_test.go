@@ -0,0 +1,184 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/persist"
+	"go.sia.tech/siad/types"
+)
+
+// TestSiaFileShareRoundTrip tests exporting a file and importing it again.
+func TestSiaFileShareRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Create a file with 3 chunks and add pieces from a few hosts.
+	siaPath, ec := testingFileParamsCustom(2, 3)
+	mk := crypto.GenerateSiaKey(crypto.TypeDefaultRenter)
+	err = r.staticFileSystem.NewSiaFile(siaPath, "", ec, mk, 3*modules.SectorSize*uint64(ec.MinPieces()), persist.DefaultDiskPermissionsTest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []types.SiaPublicKey
+	for i := 0; i < 4; i++ {
+		hosts = append(hosts, types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: fastrand.Bytes(32)})
+	}
+	for chunkIndex := uint64(0); chunkIndex < sf.NumChunks(); chunkIndex++ {
+		for pieceIndex := 0; pieceIndex < ec.NumPieces(); pieceIndex++ {
+			var root crypto.Hash
+			fastrand.Read(root[:])
+			host := hosts[fastrand.Intn(len(hosts))]
+			if err := sf.AddPiece(host, chunkIndex, uint64(pieceIndex), root); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// compareFiles checks that the imported file matches the original.
+	compareFiles := func(importedPath modules.SiaPath) {
+		t.Helper()
+		orig, err := r.staticFileSystem.OpenSiaFile(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer orig.Close()
+		imported, err := r.staticFileSystem.OpenSiaFile(importedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer imported.Close()
+		if orig.Size() != imported.Size() || orig.NumChunks() != imported.NumChunks() {
+			t.Fatal("sizes don't match")
+		}
+		if orig.ErasureCode().Identifier() != imported.ErasureCode().Identifier() {
+			t.Fatal("erasure codes don't match")
+		}
+		if !bytes.Equal(orig.MasterKey().Key(), imported.MasterKey().Key()) || orig.MasterKey().Type() != imported.MasterKey().Type() {
+			t.Fatal("keys don't match")
+		}
+		for chunkIndex := uint64(0); chunkIndex < orig.NumChunks(); chunkIndex++ {
+			p1, err := orig.Pieces(chunkIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p2, err := imported.Pieces(chunkIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p1) != len(p2) {
+				t.Fatal("number of pieces doesn't match")
+			}
+			for i := range p1 {
+				if len(p1[i]) != len(p2[i]) {
+					t.Fatal("number of pieces doesn't match")
+				}
+				for j := range p1[i] {
+					if !p1[i][j].HostPubKey.Equals(p2[i][j].HostPubKey) || p1[i][j].MerkleRoot != p2[i][j].MerkleRoot {
+						t.Fatal("pieces don't match")
+					}
+				}
+			}
+		}
+	}
+
+	// Export the file including the key and import it again.
+	var buf bytes.Buffer
+	if err := r.ExportSiaFile(siaPath, &buf, true); err != nil {
+		t.Fatal(err)
+	}
+	importPath := modules.RandomSiaPath()
+	if err := r.ImportSiaFile(bytes.NewReader(buf.Bytes()), importPath); err != nil {
+		t.Fatal(err)
+	}
+	compareFiles(importPath)
+
+	// Importing to the same path again should fail.
+	if err := r.ImportSiaFile(bytes.NewReader(buf.Bytes()), importPath); err == nil {
+		t.Fatal("expected import to fail")
+	}
+
+	// Export the file without the key. Importing it requires the key.
+	buf.Reset()
+	if err := r.ExportSiaFile(siaPath, &buf, false); err != nil {
+		t.Fatal(err)
+	}
+	importPath = modules.RandomSiaPath()
+	if err := r.ImportSiaFile(bytes.NewReader(buf.Bytes()), importPath); !errors.Contains(err, ErrShareKeyRequired) {
+		t.Fatal("expected ErrShareKeyRequired, got", err)
+	}
+	if _, err := r.staticFileSystem.OpenSiaFile(importPath); err == nil {
+		t.Fatal("file shouldn't exist")
+	}
+	wrongKey := crypto.GenerateSiaKey(crypto.TypePlain)
+	if err := r.ImportSiaFileWithKey(bytes.NewReader(buf.Bytes()), importPath, wrongKey); err == nil {
+		t.Fatal("expected import with wrong key type to fail")
+	}
+	if err := r.ImportSiaFileWithKey(bytes.NewReader(buf.Bytes()), importPath, mk); err != nil {
+		t.Fatal(err)
+	}
+	compareFiles(importPath)
+}
+
+// TestReadShareVersion tests that shares with an unknown version or specifier
+// are rejected.
+func TestReadShareVersion(t *testing.T) {
+	t.Parallel()
+
+	sf := shareFile{
+		FileSize:     1,
+		ECType:       modules.ECReedSolomon,
+		DataPieces:   1,
+		ParityPieces: 1,
+		CipherType:   crypto.TypePlain,
+	}
+	share := func(header siaShareHeader) []byte {
+		return encoding.MarshalAll(header, sf)
+	}
+
+	// The current version is accepted.
+	_, err := readShare(bytes.NewReader(share(siaShareHeader{Specifier: siaShareSpecifier, Version: siaShareVersion})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Future versions are rejected.
+	_, err = readShare(bytes.NewReader(share(siaShareHeader{Specifier: siaShareSpecifier, Version: siaShareVersion + 1})))
+	if !errors.Contains(err, ErrUnsupportedShareVersion) {
+		t.Fatal("expected ErrUnsupportedShareVersion, got", err)
+	}
+	// Unknown specifiers are rejected.
+	_, err = readShare(bytes.NewReader(share(siaShareHeader{Specifier: types.NewSpecifier("foo"), Version: siaShareVersion})))
+	if !errors.Contains(err, ErrInvalidShare) {
+		t.Fatal("expected ErrInvalidShare, got", err)
+	}
+	// Truncated shares are rejected.
+	b := share(siaShareHeader{Specifier: siaShareSpecifier, Version: siaShareVersion})
+	_, err = readShare(bytes.NewReader(b[:len(b)-1]))
+	if !errors.Contains(err, ErrInvalidShare) {
+		t.Fatal("expected ErrInvalidShare, got", err)
+	}
+}
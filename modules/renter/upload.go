@@ -23,6 +23,10 @@ import (
 var (
 	// ErrUploadDirectory is returned if the user tries to upload a directory.
 	ErrUploadDirectory = errors.New("cannot upload directory")
+
+	// ErrSourceMutated is returned if the size or modification time of an
+	// upload's source file changed after the upload was started.
+	ErrSourceMutated = errors.New("source file was modified during upload")
 )
 
 // Upload instructs the renter to start tracking a file. The renter will
@@ -52,6 +56,13 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		return errors.AddContext(err, "unable to close file after checking permissions")
 	}
 
+	// Fill in any missing upload params with the directory and renter
+	// defaults.
+	up, err = r.managedApplyUploadDefaults(up)
+	if err != nil {
+		return err
+	}
+
 	// Delete existing file if overwrite flag is set. Ignore ErrUnknownPath.
 	if up.Force {
 		err := r.DeleteFile(up.SiaPath)
@@ -60,11 +71,6 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		}
 	}
 
-	// Fill in any missing upload params with sensible defaults.
-	if up.ErasureCode == nil {
-		up.ErasureCode = modules.NewRSSubCodeDefault()
-	}
-
 	// Check that we have contracts to upload to. We need at least data +
 	// parity/2 contracts. NumPieces is equal to data+parity, and min pieces is
 	// equal to parity. Therefore (NumPieces+MinPieces)/2 = (data+data+parity)/2
@@ -100,6 +106,15 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	if err != nil {
 		return errors.AddContext(err, "could not open the new sia file")
 	}
+	r.managedApplyRepairThreshold(entry, up.RepairThreshold)
+
+	// Make sure the source didn't change between the stat call and the
+	// creation of the siafile. Later changes are detected when the chunks are
+	// read since the source mustn't be modified after the siafile was
+	// created.
+	if err := checkSourceUnchanged(up.Source, sourceInfo); err != nil {
+		return errors.Compose(err, entry.Close(), r.DeleteFile(up.SiaPath))
+	}
 
 	// No need to upload zero-byte files.
 	if sourceInfo.Size() == 0 {
@@ -128,3 +143,19 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	}
 	return nil
 }
+
+// checkSourceUnchanged returns ErrSourceMutated if the size or modification
+// time of the file at the given path differ from the given file info.
+func checkSourceUnchanged(path string, info os.FileInfo) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return errors.AddContext(err, "unable to stat input file")
+	}
+	if fi.Size() != info.Size() {
+		return errors.AddContext(ErrSourceMutated, fmt.Sprintf("size changed from %v to %v", info.Size(), fi.Size()))
+	}
+	if !fi.ModTime().Equal(info.ModTime()) {
+		return errors.AddContext(ErrSourceMutated, fmt.Sprintf("modification time changed from %v to %v", info.ModTime(), fi.ModTime()))
+	}
+	return nil
+}
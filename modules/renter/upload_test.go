@@ -1,12 +1,24 @@
 package renter
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter/filesystem"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
 )
 
 // TestRenterUploadDirectory verifies that the renter returns an error if a
@@ -48,3 +60,728 @@ func TestRenterUploadDirectory(t *testing.T) {
 		t.Fatal("expected ErrUploadDirectory, got", err)
 	}
 }
+
+// TestRenterUploadSourceMutated verifies that reading the chunks of an upload
+// fails with ErrSourceMutated once the source file changes its size.
+func TestRenterUploadSourceMutated(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Upload a file that spans multiple chunks.
+	source := filepath.Join(r.staticFileSystem.Root(), t.Name())
+	if err := ioutil.WriteFile(source, fastrand.Bytes(int(3*modules.SectorSize/2)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := modules.NewRSSubCode(1, 1, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: ec,
+	}
+	if err := r.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if entry.NumChunks() < 2 {
+		t.Fatal("expected multiple chunks, got", entry.NumChunks())
+	}
+
+	// fetchChunks is a helper that reads the data of every chunk of the file
+	// from the source file.
+	fetchChunks := func() error {
+		for chunkIndex := uint64(0); chunkIndex < entry.NumChunks(); chunkIndex++ {
+			chunk, err := r.managedBuildUnfinishedChunk(entry, chunkIndex, nil, nil, false, nil, nil, r.repairMemoryManager)
+			if err != nil {
+				return err
+			}
+			if err := r.managedFetchLogicalChunkData(chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := fetchChunks(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append to the source file while the chunks are read.
+	done := make(chan error)
+	go func() {
+		f, err := os.OpenFile(source, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			done <- err
+			return
+		}
+		_, err = f.Write(fastrand.Bytes(100))
+		done <- errors.Compose(err, f.Close())
+	}()
+	err = build.Retry(100, 10*time.Millisecond, func() error {
+		if err := fetchChunks(); !errors.Contains(err, ErrSourceMutated) {
+			return fmt.Errorf("expected ErrSourceMutated, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Shrinking the file should be detected as well.
+	if err := os.Truncate(source, int64(modules.SectorSize)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchChunks(); !errors.Contains(err, ErrSourceMutated) {
+		t.Fatal("expected ErrSourceMutated, got", err)
+	}
+
+	// Modifying the file without changing its size is detected through its
+	// modification time.
+	if err := os.Truncate(source, int64(3*modules.SectorSize/2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchChunks(); !errors.Contains(err, ErrSourceMutated) {
+		t.Fatal("expected ErrSourceMutated, got", err)
+	}
+
+	// A new upload of the modified file succeeds.
+	up.SiaPath = modules.RandomSiaPath()
+	if err := r.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSourceFileReader verifies that a file which is uploaded as a stream is
+// read until the end if it doesn't change and that ErrSourceMutated is
+// returned if the file is modified while it is read.
+func TestSourceFileReader(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	dir := build.TempDir("renter", t.Name())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "source")
+	data := fastrand.Bytes(1000)
+
+	// readSource is a helper that reads the source in parts of 100 bytes
+	// like the upload streamer and calls modify after reading the first
+	// part.
+	readSource := func(modify func() error) ([]byte, error) {
+		if err := ioutil.WriteFile(source, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+		sfr, err := newSourceFileReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read []byte
+		for i := 0; ; i++ {
+			part := make([]byte, 100)
+			n, err := io.ReadFull(sfr, part)
+			read = append(read, part[:n]...)
+			if errors.Contains(err, io.EOF) {
+				return read, nil
+			} else if err != nil {
+				return read, err
+			}
+			if i == 0 {
+				if err := modify(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	// An unchanged file is read completely.
+	read, err := readSource(func() error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Fatal("wrong data was read")
+	}
+
+	// Growing, shrinking and modifying the file are detected.
+	modifications := map[string]func() error{
+		"grow": func() error {
+			f, err := os.OpenFile(source, os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = f.Write(fastrand.Bytes(100))
+			return errors.Compose(err, f.Close())
+		},
+		"shrink": func() error {
+			return os.Truncate(source, 500)
+		},
+		"modify": func() error {
+			return os.Chtimes(source, time.Now(), time.Now().Add(time.Second))
+		},
+	}
+	for name, modify := range modifications {
+		if _, err := readSource(modify); !errors.Contains(err, ErrSourceMutated) {
+			t.Fatalf("%v: expected ErrSourceMutated, got %v", name, err)
+		}
+	}
+}
+
+// countingErasureCoder is an erasure coder which counts how often it encodes
+// data.
+type countingErasureCoder struct {
+	modules.ErasureCoder
+	atomicEncodes uint64
+}
+
+// EncodeShards implements the modules.ErasureCoder interface.
+func (ec *countingErasureCoder) EncodeShards(pieces [][]byte) ([][]byte, error) {
+	atomic.AddUint64(&ec.atomicEncodes, 1)
+	return ec.ErasureCoder.EncodeShards(pieces)
+}
+
+// TestRenterRepairEncodedChunkCache verifies that repairing the same chunk
+// twice in a row only reads and encodes the chunk once and that the cached
+// pieces are dropped when the source file changes.
+func TestRenterRepairEncodedChunkCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Upload a file with a single chunk.
+	source := filepath.Join(r.staticFileSystem.Root(), t.Name())
+	if err := ioutil.WriteFile(source, fastrand.Bytes(int(modules.SectorSize)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ec, err := modules.NewRSSubCode(1, 1, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{
+		Source:      source,
+		SiaPath:     modules.RandomSiaPath(),
+		ErasureCode: ec,
+	}
+	if err := r.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// repairChunk is a helper that fetches the logical data of the chunk for
+	// a repair which already uploaded the piece with the given index. A
+	// unique chunk id makes sure that background repairs don't interfere.
+	coder := &countingErasureCoder{ErasureCoder: entry.ErasureCode()}
+	chunkID := uploadChunkID{fileUID: "chunk", index: 0}
+	repairChunk := func(uploaded int) [][]byte {
+		t.Helper()
+		chunk, err := r.managedBuildUnfinishedChunk(entry, 0, nil, nil, false, nil, nil, r.repairMemoryManager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk.id = chunkID
+		chunk.staticErasureCode = coder
+		chunk.pieceUsage[uploaded] = true
+		if err := r.managedFetchLogicalChunkData(chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.logicalChunkData[uploaded] != nil {
+			t.Fatal("uploaded piece wasn't dropped")
+		}
+		return chunk.logicalChunkData
+	}
+
+	// Repair the chunk for two different hosts back-to-back. The chunk
+	// should only be encoded once.
+	repairChunk(0)
+	pieces := repairChunk(1)
+	if encodes := atomic.LoadUint64(&coder.atomicEncodes); encodes != 1 {
+		t.Fatalf("expected the chunk to be encoded once but was encoded %v times", encodes)
+	}
+
+	// The pieces from the cache should match freshly encoded ones.
+	r.staticEncodedChunkCache.callRemove(chunkID)
+	if !bytes.Equal(repairChunk(1)[0], pieces[0]) {
+		t.Fatal("cached piece doesn't match encoded piece")
+	}
+	if encodes := atomic.LoadUint64(&coder.atomicEncodes); encodes != 2 {
+		t.Fatalf("expected the chunk to be encoded twice but was encoded %v times", encodes)
+	}
+
+	// Changing the modification time of the source file invalidates the
+	// cached pieces. The time is moved into the past since a source which was
+	// modified after the upload started isn't used for repairs.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(source, past, past); err != nil {
+		t.Fatal(err)
+	}
+	repairChunk(0)
+	if encodes := atomic.LoadUint64(&coder.atomicEncodes); encodes != 3 {
+		t.Fatalf("expected the chunk to be encoded three times but was encoded %v times", encodes)
+	}
+}
+
+// TestRenterDefaultErasureCode verifies that the default erasure code can be
+// changed, that it is persisted and that it is used for uploads without an
+// erasure code.
+func TestRenterDefaultErasureCode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Invalid parameters should be rejected.
+	if err := rt.renter.SetDefaultErasureCode(0, 1); err == nil {
+		t.Fatal("expected error for 0 data pieces")
+	}
+	if err := rt.renter.SetDefaultErasureCode(1, 0); err == nil {
+		t.Fatal("expected error for 0 parity pieces")
+	}
+
+	// Change the default and restart the renter.
+	dataPieces, parityPieces := 3, 5
+	if err := rt.renter.SetDefaultErasureCode(dataPieces, parityPieces); err != nil {
+		t.Fatal(err)
+	}
+	r, err := rt.reloadRenter(rt.renter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload a file without an erasure code.
+	source, err := rt.createZeroByteFileOnDisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{
+		Source:  source,
+		SiaPath: modules.RandomSiaPath(),
+	}
+	if err := r.Upload(up); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file should use the new default.
+	entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec := entry.ErasureCode()
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ec.MinPieces() != dataPieces || ec.NumPieces() != dataPieces+parityPieces {
+		t.Fatalf("expected %v-of-%v erasure code, got %v-of-%v", dataPieces, dataPieces+parityPieces, ec.MinPieces(), ec.NumPieces())
+	}
+}
+
+// TestRenterRepairThreshold tests setting the default repair threshold and the
+// repair threshold of individual files.
+func TestRenterRepairThreshold(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Invalid defaults should be rejected.
+	if err := r.SetDefaultRepairThreshold(1); !errors.Contains(err, siafile.ErrInvalidRepairThreshold) {
+		t.Fatal("expected ErrInvalidRepairThreshold, got", err)
+	}
+	if err := r.SetDefaultRepairThreshold(2.5); err != nil {
+		t.Fatal(err)
+	}
+
+	// upload is a helper that uploads a zero byte file with a 2-of-10 erasure
+	// code and returns the file's repair threshold.
+	ec, err := modules.NewRSSubCode(2, 8, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func() (modules.SiaPath, float64) {
+		t.Helper()
+		source, err := rt.createZeroByteFileOnDisk()
+		if err != nil {
+			t.Fatal(err)
+		}
+		up := modules.FileUploadParams{
+			Source:      source,
+			SiaPath:     modules.RandomSiaPath(),
+			ErasureCode: ec,
+		}
+		if err := r.Upload(up); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer entry.Close()
+		return up.SiaPath, entry.RepairThreshold()
+	}
+
+	// New files should use the default.
+	siaPath, threshold := upload()
+	if threshold != 2.5 {
+		t.Fatal("expected threshold 2.5, got", threshold)
+	}
+
+	// A default which can't be reached with the file's erasure code isn't
+	// applied.
+	if err := r.SetDefaultRepairThreshold(6); err != nil {
+		t.Fatal(err)
+	}
+	if _, threshold := upload(); threshold != 0 {
+		t.Fatal("expected threshold 0, got", threshold)
+	}
+
+	// Update the threshold of the first file.
+	if err := r.SetFileRepairThreshold(siaPath, 6); !errors.Contains(err, siafile.ErrInvalidRepairThreshold) {
+		t.Fatal("expected ErrInvalidRepairThreshold, got", err)
+	}
+	if err := r.SetFileRepairThreshold(siaPath, 4); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	if entry.RepairThreshold() != 4 {
+		t.Fatal("expected threshold 4, got", entry.RepairThreshold())
+	}
+}
+
+// TestRenterDirUploadDefaults tests that uploads inherit the upload defaults of
+// the nearest directory that sets them and that explicit upload parameters
+// take precedence.
+func TestRenterDirUploadDefaults(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Create three levels of nested directories with overrides at each level.
+	dirA, err := modules.NewSiaPath("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirB, err := dirA.Join("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirC, err := dirB.Join("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CreateDir(dirC, modules.DefaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	defaultsA := modules.DirUploadDefaults{
+		DataPieces:      2,
+		ParityPieces:    8,
+		RepairThreshold: 2.5,
+		ConflictMode:    modules.UploadConflictModeOverwrite,
+	}
+	defaultsB := modules.DirUploadDefaults{
+		DataPieces:   3,
+		ParityPieces: 6,
+	}
+	defaultsC := modules.DirUploadDefaults{
+		RepairThreshold: 2,
+		ConflictMode:    modules.UploadConflictModeFail,
+	}
+	for siaPath, defaults := range map[modules.SiaPath]modules.DirUploadDefaults{dirA: defaultsA, dirB: defaultsB, dirC: defaultsC} {
+		if err := r.SetDirUploadDefaults(siaPath, defaults); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Invalid defaults should be rejected.
+	invalid := []modules.DirUploadDefaults{
+		{DataPieces: 1},
+		{RepairThreshold: 1},
+		{ConflictMode: "skip"},
+	}
+	for _, defaults := range invalid {
+		if err := r.SetDirUploadDefaults(dirA, defaults); !errors.Contains(err, modules.ErrInvalidDirUploadDefaults) {
+			t.Fatalf("%+v: expected ErrInvalidDirUploadDefaults, got %v", defaults, err)
+		}
+	}
+
+	// The defaults should survive a bubble.
+	if err := rt.bubbleAll([]modules.SiaPath{dirC, dirB, dirA}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory info should report the set and the effective defaults.
+	dis, err := r.DirList(dirB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dis) != 2 {
+		t.Fatal("expected 2 directories, got", len(dis))
+	}
+	effectiveB := modules.DirUploadDefaults{
+		DataPieces:      3,
+		ParityPieces:    6,
+		RepairThreshold: 2.5,
+		ConflictMode:    modules.UploadConflictModeOverwrite,
+	}
+	effectiveC := modules.DirUploadDefaults{
+		DataPieces:      3,
+		ParityPieces:    6,
+		RepairThreshold: 2,
+		ConflictMode:    modules.UploadConflictModeFail,
+	}
+	if dis[0].UploadDefaults != defaultsB || dis[0].EffectiveUploadDefaults != effectiveB {
+		t.Fatalf("unexpected defaults for %v: %+v %+v", dirB, dis[0].UploadDefaults, dis[0].EffectiveUploadDefaults)
+	}
+	if dis[1].UploadDefaults != defaultsC || dis[1].EffectiveUploadDefaults != effectiveC {
+		t.Fatalf("unexpected defaults for %v: %+v %+v", dirC, dis[1].UploadDefaults, dis[1].EffectiveUploadDefaults)
+	}
+
+	// upload is a helper that uploads a zero byte file and returns the
+	// erasure code and repair threshold of the file.
+	upload := func(up modules.FileUploadParams) (modules.ErasureCoder, float64, error) {
+		t.Helper()
+		source, err := rt.createZeroByteFileOnDisk()
+		if err != nil {
+			t.Fatal(err)
+		}
+		up.Source = source
+		if err := r.Upload(up); err != nil {
+			return nil, 0, err
+		}
+		entry, err := r.staticFileSystem.OpenSiaFile(up.SiaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer entry.Close()
+		return entry.ErasureCode(), entry.RepairThreshold(), nil
+	}
+	explicitEC, err := modules.NewRSSubCode(4, 8, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		dir       modules.SiaPath
+		up        modules.FileUploadParams
+		data      int
+		num       int
+		threshold float64
+	}{
+		{"a", dirA, modules.FileUploadParams{}, 2, 10, 2.5},
+		{"b", dirB, modules.FileUploadParams{}, 3, 9, 2.5},
+		{"c", dirC, modules.FileUploadParams{}, 3, 9, 2},
+		{"nonexistent", dirC, modules.FileUploadParams{}, 3, 9, 2},
+		{"mixed", dirC, modules.FileUploadParams{ErasureCode: explicitEC, ConflictMode: modules.UploadConflictModeOverwrite}, 4, 12, 2},
+		{"threshold", dirB, modules.FileUploadParams{RepairThreshold: 2.8}, 3, 9, 2.8},
+	}
+	for _, test := range tests {
+		dir := test.dir
+		if test.name == "nonexistent" {
+			dir, err = dir.Join("d")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		test.up.SiaPath, err = dir.Join(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ec, threshold, err := upload(test.up)
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if ec.MinPieces() != test.data || ec.NumPieces() != test.num {
+			t.Fatalf("%v: expected %v-of-%v erasure code, got %v-of-%v", test.name, test.data, test.num, ec.MinPieces(), ec.NumPieces())
+		}
+		if threshold != test.threshold {
+			t.Fatalf("%v: expected threshold %v, got %v", test.name, test.threshold, threshold)
+		}
+	}
+
+	// Uploading to the same SiaPath again should overwrite the file in a and
+	// fail in c unless the upload overwrites explicitly.
+	siaPath, err := dirA.Join("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := upload(modules.FileUploadParams{SiaPath: siaPath}); err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err = dirC.Join("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := upload(modules.FileUploadParams{SiaPath: siaPath}); !errors.Contains(err, filesystem.ErrExists) {
+		t.Fatal("expected ErrExists, got", err)
+	}
+	if _, _, err := upload(modules.FileUploadParams{SiaPath: siaPath, ConflictMode: modules.UploadConflictModeOverwrite}); err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err = dirB.Join("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := upload(modules.FileUploadParams{SiaPath: siaPath, ConflictMode: modules.UploadConflictModeFail}); !errors.Contains(err, filesystem.ErrExists) {
+		t.Fatal("expected ErrExists, got", err)
+	}
+}
+
+// TestRenterConcurrentUploadDelete checks that uploading and deleting the same
+// SiaPath concurrently always leaves the file in a consistent state. Either
+// the delete succeeded and the file is gone or the delete failed and the
+// uploaded file exists.
+func TestRenterConcurrentUploadDelete(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Create a source file with some data.
+	source := filepath.Join(rt.dir, "source")
+	if err := ioutil.WriteFile(source, fastrand.Bytes(100), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		siaPath := modules.RandomSiaPath()
+		var uploadErr, deleteErr error
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			uploadErr = rt.renter.Upload(modules.FileUploadParams{
+				Source:      source,
+				SiaPath:     siaPath,
+				ErasureCode: modules.NewRSCodeDefault(),
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			deleteErr = rt.renter.DeleteFile(siaPath)
+		}()
+		close(start)
+		wg.Wait()
+
+		// Check the final state of the file.
+		entry, openErr := rt.renter.staticFileSystem.OpenSiaFile(siaPath)
+		exists := openErr == nil
+		if exists {
+			if err := entry.Close(); err != nil {
+				t.Fatal(err)
+			}
+		} else if !errors.Contains(openErr, filesystem.ErrNotExist) {
+			t.Fatal(openErr)
+		}
+		_, statErr := os.Stat(rt.renter.staticFileSystem.FilePath(siaPath))
+		if exists == os.IsNotExist(statErr) {
+			t.Fatalf("file exists %v but stat returned %v", exists, statErr)
+		}
+		if deleteErr == nil {
+			// The delete succeeded, the file must be gone.
+			if exists {
+				t.Fatal("file exists after successful delete")
+			}
+			continue
+		}
+		// The delete failed because the file didn't exist yet, the upload must
+		// have succeeded.
+		if !errors.Contains(deleteErr, filesystem.ErrNotExist) {
+			t.Fatal("unexpected delete error", deleteErr)
+		}
+		if uploadErr != nil || !exists {
+			t.Fatal("upload failed without successful delete", uploadErr, exists)
+		}
+	}
+}
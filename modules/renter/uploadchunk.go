@@ -49,6 +49,10 @@ type unfinishedUploadChunk struct {
 	staticSiaPath  string
 	staticPriority bool // indicates if the chunk should get access to priority memory
 
+	// staticErasureCode is the erasure coder which is used to encode and
+	// reconstruct the logical data of the chunk.
+	staticErasureCode modules.ErasureCoder
+
 	// The logical data is the data that is presented to the user when the user
 	// requests the chunk. The physical data is all of the pieces that get
 	// stored across the network.
@@ -330,7 +334,7 @@ func (r *Renter) managedDownloadLogicalChunkData(chunk *unfinishedUploadChunk) e
 	//
 	// TODO: Ideally there is a way to perform the reconstruction here such that
 	// only the necessary pieces are reconstructed.
-	err = chunk.fileEntry.ErasureCode().Reconstruct(chunk.logicalChunkData)
+	err = chunk.staticErasureCode.Reconstruct(chunk.logicalChunkData)
 	if err != nil {
 		return errors.AddContext(err, "unable to reconstruct the data downloaded from the network during repair")
 	}
@@ -363,7 +367,7 @@ func (r *Renter) threadedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 
 	// Calculate the amount of memory needed for erasure coding. This will need
 	// to be released if there's an error before erasure coding is complete.
-	erasureCodingMemory := chunk.fileEntry.PieceSize() * uint64(chunk.fileEntry.ErasureCode().MinPieces())
+	erasureCodingMemory := chunk.fileEntry.ChunkSize()
 
 	// Calculate the amount of memory to release due to already completed
 	// pieces. This memory gets released during encryption, but needs to be
@@ -393,7 +397,7 @@ func (r *Renter) threadedFetchAndRepairChunk(chunk *unfinishedUploadChunk) {
 		chunk.logicalChunkData = nil
 		// Set the error to indicate the failure happened when fetching the
 		// data.
-		err := fmt.Errorf("Unable to fetch the logical data for chunk %v of %s - marking as stuck: %v", chunk.staticIndex, chunk.staticSiaPath, err)
+		err = errors.AddContext(err, fmt.Sprintf("Unable to fetch the logical data for chunk %v of %s - marking as stuck", chunk.staticIndex, chunk.staticSiaPath))
 		chunk.err = err
 		chunk.mu.Unlock()
 
@@ -500,7 +504,7 @@ func (uc *unfinishedUploadChunk) staticReadLogicalData(r io.Reader) (uint64, err
 	// Encode the data pieces, forming the chunk's logical data.
 	//
 	// TODO: Ideally there is a way to only encode the shards that we need.
-	uc.logicalChunkData, _ = uc.fileEntry.ErasureCode().EncodeShards(dataPieces)
+	uc.logicalChunkData, _ = uc.staticErasureCode.EncodeShards(dataPieces)
 	return total, nil
 }
 
@@ -549,6 +553,12 @@ func (r *Renter) managedFetchLogicalChunkData(uc *unfinishedUploadChunk) error {
 		return nil
 	}
 
+	// Use the pieces of a previous repair of the chunk if they are cached.
+	fp := newEncodedChunkFingerprint(uc)
+	if r.managedFetchLogicalChunkDataFromCache(uc, fp) {
+		return nil
+	}
+
 	// No source reader available. Check if there's potentially a local file. If
 	// there is no local file, fall back to doing a remote repair.
 	// disk.
@@ -575,20 +585,82 @@ func (r *Renter) managedFetchLogicalChunkData(uc *unfinishedUploadChunk) error {
 			err = errors.Compose(err, osFile.Close())
 		}()
 		sr := io.NewSectionReader(osFile, uc.offset, int64(uc.length))
-		dataPieces, _, err := readDataPieces(sr, uc.fileEntry.ErasureCode(), uc.fileEntry.PieceSize())
+		dataPieces, n, err := readDataPieces(sr, uc.fileEntry.ErasureCode(), uc.fileEntry.PieceSize())
 		if err != nil {
 			return errors.AddContext(err, "unable to read the data from the local file")
 		}
-		uc.logicalChunkData, _ = uc.fileEntry.ErasureCode().EncodeShards(dataPieces)
+		err = uc.staticCheckSource(osFile, n)
+		if err != nil {
+			return err
+		}
+		uc.logicalChunkData, _ = uc.staticErasureCode.EncodeShards(dataPieces)
+		// Padding and encrypting the pieces modifies them in place, so the
+		// pieces for the cache need to be copied first.
+		encoded := copyPieces(uc.logicalChunkData)
 		err = uc.staticEncryptAndCheckIntegrity()
 		if err != nil {
 			return errors.AddContext(err, "local file failed the integrity check")
 		}
+		r.staticEncodedChunkCache.callPut(uc.id, fp, encoded)
 		return nil
 	}()
 	if err != nil {
 		r.log.Printf("falling back to remote download for repair: fetch from local file %v failed: %v", uc.fileEntry.LocalPath(), err)
-		return r.managedDownloadLogicalChunkData(uc)
+		errDownload := r.managedDownloadLogicalChunkData(uc)
+		if errDownload != nil && errors.Contains(err, ErrSourceMutated) {
+			// Report the mutation since there was no way to recover the
+			// original data.
+			return errors.Compose(err, errDownload)
+		}
+		return errDownload
+	}
+	return nil
+}
+
+// managedFetchLogicalChunkDataFromCache loads the logical data of the chunk
+// from the encoded chunk cache and checks its integrity. It returns false if
+// the chunk isn't cached or if the integrity check failed.
+func (r *Renter) managedFetchLogicalChunkDataFromCache(uc *unfinishedUploadChunk, fp encodedChunkFingerprint) bool {
+	pieces, cached := r.staticEncodedChunkCache.callGet(uc.id, fp)
+	if !cached {
+		return false
+	}
+	uc.logicalChunkData = pieces
+	if err := uc.staticEncryptAndCheckIntegrity(); err != nil {
+		r.repairLog.Printf("dropping cached pieces of chunk %v of %s: %v", uc.staticIndex, uc.staticSiaPath, err)
+		r.staticEncodedChunkCache.callRemove(uc.id)
+		uc.logicalChunkData = nil
+		return false
+	}
+	return true
+}
+
+// staticCheckSource checks that the local file of the chunk still has the size
+// that was recorded when the upload was started and that it wasn't modified
+// after the siafile was created. n is the number of bytes that were read for
+// the chunk. ErrSourceMutated is returned if the file grew, shrank or was
+// modified.
+func (uc *unfinishedUploadChunk) staticCheckSource(f *os.File, n uint64) error {
+	size := uc.fileEntry.Size()
+	var expected uint64
+	if uint64(uc.offset) < size {
+		expected = size - uint64(uc.offset)
+	}
+	if expected > uc.length {
+		expected = uc.length
+	}
+	if n != expected {
+		return errors.AddContext(ErrSourceMutated, fmt.Sprintf("read %v bytes of chunk %v but expected %v", n, uc.staticIndex, expected))
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.AddContext(err, "unable to stat the local file")
+	}
+	if fi.Size() != int64(size) {
+		return errors.AddContext(ErrSourceMutated, fmt.Sprintf("size changed from %v to %v", size, fi.Size()))
+	}
+	if created := uc.fileEntry.CreateTime(); fi.ModTime().After(created) {
+		return errors.AddContext(ErrSourceMutated, fmt.Sprintf("modified at %v after the upload started at %v", fi.ModTime(), created))
 	}
 	return nil
 }
@@ -747,6 +819,7 @@ func (r *Renter) managedUpdateUploadChunkStuckStatus(uc *unfinishedUploadChunk)
 	// Grab necessary information from upload chunk under lock
 	uc.mu.Lock()
 	index := uc.id.index
+	repairThreshold := uc.fileEntry.RepairThreshold()
 	stuck := uc.stuck
 	minimumPieces := uc.staticMinimumPieces
 	piecesCompleted := uc.piecesCompleted
@@ -756,6 +829,7 @@ func (r *Renter) managedUpdateUploadChunkStuckStatus(uc *unfinishedUploadChunk)
 
 	// Determine if repair was successful.
 	health := siafile.CalculateHealth(piecesCompleted, minimumPieces, piecesNeeded)
+	health = siafile.ScaleHealth(health, repairThreshold, minimumPieces, piecesNeeded)
 	successfulRepair := !modules.NeedsRepair(health)
 
 	// Check if renter is shutting down
@@ -0,0 +1,253 @@
+package renter
+
+// uploadencodedchunkcache implements a small LRU cache for the erasure coded
+// pieces of chunks that were read from the local file for a repair. A repair
+// usually only uploads some of the pieces of a chunk, e.g. because only some
+// hosts are available, and the next repair of the same chunk needs the same
+// logical data again. The cache allows the next repair to skip reading and
+// encoding the chunk. Chunks which were downloaded from the network are not
+// cached, since a repair must not succeed from memory once the hosts the data
+// was downloaded from are gone.
+//
+// The pieces are cached before they are padded and encrypted. Every entry
+// remembers a fingerprint of the file it was created from. If the file's size,
+// local path, local file or master key changed, the entry is dropped instead
+// of being returned. The memory of the cache is requested from the renter's
+// repair memory manager without blocking. If the memory isn't available, the
+// chunk is simply not cached. Whenever a repair has to wait for memory, the
+// cache evicts its least recently used entries to make room for the repair,
+// so cached chunks never hold back repairs. Expired entries are removed
+// periodically by a background thread and whenever a chunk is added, so that
+// their memory is returned to the repair memory manager even if they are never
+// accessed again.
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+
+	"go.sia.tech/siad/build"
+	"go.sia.tech/siad/crypto"
+)
+
+var (
+	// encodedChunkCacheMaxSize is the maximum number of bytes the cache holds.
+	encodedChunkCacheMaxSize = build.Select(build.Var{
+		Dev:      uint64(1 << 25), // 32 MiB
+		Standard: uint64(1 << 28), // 256 MiB
+		Testnet:  uint64(1 << 28), // 256 MiB
+		Testing:  uint64(1 << 15), // 32 KiB
+	}).(uint64)
+
+	// encodedChunkCacheTTL is the amount of time after which a cached chunk
+	// is dropped.
+	encodedChunkCacheTTL = build.Select(build.Var{
+		Dev:      time.Minute * 5,
+		Standard: time.Minute * 10,
+		Testnet:  time.Minute * 10,
+		Testing:  time.Minute,
+	}).(time.Duration)
+)
+
+type (
+	// encodedChunkCache caches the erasure coded pieces of chunks.
+	encodedChunkCache struct {
+		entries map[uploadChunkID]*list.Element
+		lru     *list.List // most recently used entry at the front
+		size    uint64
+
+		staticMaxSize       uint64
+		staticMemoryManager *memoryManager
+		staticTTL           time.Duration
+		mu                  sync.Mutex
+	}
+
+	// encodedChunkCacheEntry is a single chunk in the cache.
+	encodedChunkCacheEntry struct {
+		id          uploadChunkID
+		fingerprint encodedChunkFingerprint
+		pieces      [][]byte
+		size        uint64
+		expiry      time.Time
+	}
+
+	// encodedChunkFingerprint captures the properties of a file which
+	// invalidate its cached chunks when they change.
+	encodedChunkFingerprint struct {
+		fileSize      uint64
+		localPath     string
+		localSize     int64
+		localModTime  time.Time
+		masterKeyHash crypto.Hash
+	}
+)
+
+// newEncodedChunkCache returns a new, empty encoded chunk cache which requests
+// its memory from the given memory manager and releases it again when a
+// request of the memory manager blocks.
+func newEncodedChunkCache(maxSize uint64, ttl time.Duration, mm *memoryManager) *encodedChunkCache {
+	ecc := &encodedChunkCache{
+		entries:             make(map[uploadChunkID]*list.Element),
+		lru:                 list.New(),
+		staticMaxSize:       maxSize,
+		staticMemoryManager: mm,
+		staticTTL:           ttl,
+	}
+	mm.SetReclaimFunc(ecc.callEvict)
+	return ecc
+}
+
+// newEncodedChunkFingerprint returns the fingerprint of the chunk's file.
+func newEncodedChunkFingerprint(uc *unfinishedUploadChunk) encodedChunkFingerprint {
+	mk := uc.fileEntry.MasterKey()
+	fp := encodedChunkFingerprint{
+		fileSize:      uc.fileEntry.Size(),
+		localPath:     uc.fileEntry.LocalPath(),
+		masterKeyHash: crypto.HashAll(mk.Type(), mk.Key()),
+	}
+	if fp.localPath == "" {
+		return fp
+	}
+	// If the local file can't be accessed, its size and modification time are
+	// left empty. The fingerprint then changes once the local file becomes
+	// available again.
+	if fi, err := os.Stat(fp.localPath); err == nil {
+		fp.localSize = fi.Size()
+		fp.localModTime = fi.ModTime()
+	}
+	return fp
+}
+
+// callGet returns a copy of the cached pieces of the chunk with the given id.
+// Entries which expired or which were created from a file with a different
+// fingerprint are removed.
+func (ecc *encodedChunkCache) callGet(id uploadChunkID, fp encodedChunkFingerprint) ([][]byte, bool) {
+	ecc.mu.Lock()
+	defer ecc.mu.Unlock()
+	el, exists := ecc.entries[id]
+	if !exists {
+		return nil, false
+	}
+	entry := el.Value.(*encodedChunkCacheEntry)
+	if entry.fingerprint != fp || time.Now().After(entry.expiry) {
+		ecc.remove(el)
+		return nil, false
+	}
+	ecc.lru.MoveToFront(el)
+	return copyPieces(entry.pieces), true
+}
+
+// callPut adds a copy of the pieces of the chunk with the given id to the
+// cache, replacing any previous entry for the chunk. Least recently used
+// entries are evicted to make room for the new one. If the pieces don't fit
+// into the cache or the memory isn't available, they are not cached.
+func (ecc *encodedChunkCache) callPut(id uploadChunkID, fp encodedChunkFingerprint, pieces [][]byte) {
+	var size uint64
+	for _, piece := range pieces {
+		size += uint64(len(piece))
+	}
+	ecc.mu.Lock()
+	defer ecc.mu.Unlock()
+	ecc.pruneExpired(time.Now())
+	if el, exists := ecc.entries[id]; exists {
+		ecc.remove(el)
+	}
+	if size == 0 || size > ecc.staticMaxSize {
+		return
+	}
+	for ecc.size+size > ecc.staticMaxSize {
+		ecc.remove(ecc.lru.Back())
+	}
+	if !ecc.staticMemoryManager.TryRequest(size) {
+		return
+	}
+	entry := &encodedChunkCacheEntry{
+		id:          id,
+		fingerprint: fp,
+		pieces:      copyPieces(pieces),
+		size:        size,
+		expiry:      time.Now().Add(ecc.staticTTL),
+	}
+	ecc.entries[id] = ecc.lru.PushFront(entry)
+	ecc.size += size
+}
+
+// callRemove removes the chunk with the given id from the cache.
+func (ecc *encodedChunkCache) callRemove(id uploadChunkID) {
+	ecc.mu.Lock()
+	defer ecc.mu.Unlock()
+	if el, exists := ecc.entries[id]; exists {
+		ecc.remove(el)
+	}
+}
+
+// callEvict removes the least recently used entries from the cache until at
+// least the given amount of memory was returned or the cache is empty.
+func (ecc *encodedChunkCache) callEvict(amount uint64) {
+	ecc.mu.Lock()
+	defer ecc.mu.Unlock()
+	ecc.pruneExpired(time.Now())
+	var evicted uint64
+	for evicted < amount && ecc.lru.Len() > 0 {
+		el := ecc.lru.Back()
+		evicted += el.Value.(*encodedChunkCacheEntry).size
+		ecc.remove(el)
+	}
+}
+
+// callPruneExpired removes all expired entries from the cache.
+func (ecc *encodedChunkCache) callPruneExpired() {
+	ecc.mu.Lock()
+	defer ecc.mu.Unlock()
+	ecc.pruneExpired(time.Now())
+}
+
+// pruneExpired removes all entries which expired before now from the cache.
+func (ecc *encodedChunkCache) pruneExpired(now time.Time) {
+	for _, el := range ecc.entries {
+		if now.After(el.Value.(*encodedChunkCacheEntry).expiry) {
+			ecc.remove(el)
+		}
+	}
+}
+
+// remove removes an entry from the cache and returns its memory.
+func (ecc *encodedChunkCache) remove(el *list.Element) {
+	entry := ecc.lru.Remove(el).(*encodedChunkCacheEntry)
+	delete(ecc.entries, entry.id)
+	ecc.size -= entry.size
+	ecc.staticMemoryManager.Return(entry.size)
+}
+
+// copyPieces returns a deep copy of the given pieces. Pieces which are nil stay
+// nil.
+func copyPieces(pieces [][]byte) [][]byte {
+	cpy := make([][]byte, len(pieces))
+	for i, piece := range pieces {
+		if piece != nil {
+			cpy[i] = append([]byte(nil), piece...)
+		}
+	}
+	return cpy
+}
+
+// threadedPruneEncodedChunkCache periodically removes expired entries from the
+// renter's encoded chunk cache.
+func (r *Renter) threadedPruneEncodedChunkCache() {
+	if err := r.tg.Add(); err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	ticker := time.NewTicker(r.staticEncodedChunkCache.staticTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-ticker.C:
+		}
+		r.staticEncodedChunkCache.callPruneExpired()
+	}
+}
@@ -0,0 +1,173 @@
+package renter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestEncodedChunkCache tests adding, getting, invalidating and evicting
+// entries of the encoded chunk cache and that its memory is accounted for.
+func TestEncodedChunkCache(t *testing.T) {
+	t.Parallel()
+
+	mm := newMemoryManager(1000, 0, nil)
+	ecc := newEncodedChunkCache(100, time.Minute, mm)
+	fp := encodedChunkFingerprint{fileSize: 1, localPath: "foo"}
+	id := func(index uint64) uploadChunkID {
+		return uploadChunkID{fileUID: "file", index: index}
+	}
+
+	// add an entry and get it
+	pieces := [][]byte{fastrand.Bytes(20), nil, fastrand.Bytes(20)}
+	ecc.callPut(id(0), fp, pieces)
+	if ecc.size != 40 || mm.available != 960 {
+		t.Fatal("unexpected memory usage", ecc.size, mm.available)
+	}
+	cached, ok := ecc.callGet(id(0), fp)
+	if !ok {
+		t.Fatal("entry not found")
+	}
+	if len(cached) != 3 || !bytes.Equal(cached[0], pieces[0]) || cached[1] != nil || !bytes.Equal(cached[2], pieces[2]) {
+		t.Fatal("wrong pieces returned")
+	}
+	// the cache returns a copy
+	cached[0][0]++
+	if cached, _ := ecc.callGet(id(0), fp); !bytes.Equal(cached[0], pieces[0]) {
+		t.Fatal("cached pieces were modified")
+	}
+
+	// a different fingerprint invalidates the entry
+	if _, ok := ecc.callGet(id(0), encodedChunkFingerprint{fileSize: 2, localPath: "foo"}); ok {
+		t.Fatal("entry with different fingerprint was returned")
+	}
+	if _, ok := ecc.callGet(id(0), fp); ok || ecc.size != 0 || mm.available != 1000 {
+		t.Fatal("invalidated entry wasn't removed")
+	}
+
+	// fill the cache and add another entry, the least recently used entry
+	// is evicted
+	for i := uint64(0); i < 2; i++ {
+		ecc.callPut(id(i), fp, [][]byte{fastrand.Bytes(40)})
+	}
+	if _, ok := ecc.callGet(id(0), fp); !ok {
+		t.Fatal("entry not found")
+	}
+	ecc.callPut(id(2), fp, [][]byte{fastrand.Bytes(40)})
+	if _, ok := ecc.callGet(id(1), fp); ok {
+		t.Fatal("least recently used entry wasn't evicted")
+	}
+	if _, ok := ecc.callGet(id(0), fp); !ok {
+		t.Fatal("recently used entry was evicted")
+	}
+	if ecc.size != 80 || mm.available != 920 {
+		t.Fatal("unexpected memory usage", ecc.size, mm.available)
+	}
+
+	// entries which don't fit into the cache are not cached
+	ecc.callPut(id(3), fp, [][]byte{fastrand.Bytes(101)})
+	if _, ok := ecc.callGet(id(3), fp); ok {
+		t.Fatal("entry exceeding the cache size was cached")
+	}
+
+	// entries are not cached if the memory isn't available
+	ecc.callRemove(id(0))
+	ecc.callRemove(id(2))
+	if !mm.TryRequest(990) {
+		t.Fatal("failed to request memory")
+	}
+	ecc.callPut(id(4), fp, [][]byte{fastrand.Bytes(20)})
+	if _, ok := ecc.callGet(id(4), fp); ok {
+		t.Fatal("entry was cached without memory")
+	}
+	mm.Return(990)
+	if ecc.size != 0 || mm.available != 1000 {
+		t.Fatal("memory wasn't returned", ecc.size, mm.available)
+	}
+
+	// expired entries are removed
+	ecc = newEncodedChunkCache(100, 0, mm)
+	ecc.callPut(id(5), fp, [][]byte{fastrand.Bytes(20)})
+	time.Sleep(time.Millisecond)
+	if _, ok := ecc.callGet(id(5), fp); ok || mm.available != 1000 {
+		t.Fatal("expired entry wasn't removed")
+	}
+
+	// expired entries are pruned without being accessed
+	ecc.callPut(id(6), fp, [][]byte{fastrand.Bytes(20)})
+	time.Sleep(time.Millisecond)
+	ecc.callPruneExpired()
+	if len(ecc.entries) != 0 || ecc.lru.Len() != 0 || ecc.size != 0 || mm.available != 1000 {
+		t.Fatal("expired entry wasn't pruned", len(ecc.entries), ecc.size, mm.available)
+	}
+
+	// adding an entry prunes expired entries
+	ecc.callPut(id(7), fp, [][]byte{fastrand.Bytes(20)})
+	time.Sleep(time.Millisecond)
+	ecc.callPut(id(8), fp, [][]byte{fastrand.Bytes(20)})
+	if _, exists := ecc.entries[id(7)]; exists || ecc.size != 20 || mm.available != 980 {
+		t.Fatal("expired entry wasn't pruned", ecc.size, mm.available)
+	}
+}
+
+// TestEncodedChunkCacheEviction tests that the encoded chunk cache releases
+// its memory when a request of the memory manager blocks.
+func TestEncodedChunkCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	mm := newMemoryManager(1000, 0, nil)
+	ecc := newEncodedChunkCache(100, time.Minute, mm)
+	fp := encodedChunkFingerprint{fileSize: 1, localPath: "foo"}
+	id := func(index uint64) uploadChunkID {
+		return uploadChunkID{fileUID: "file", index: index}
+	}
+	for i := uint64(0); i < 4; i++ {
+		ecc.callPut(id(i), fp, [][]byte{fastrand.Bytes(20)})
+	}
+	if _, ok := ecc.callGet(id(0), fp); !ok {
+		t.Fatal("entry not found")
+	}
+	if ecc.size != 80 || mm.available != 920 {
+		t.Fatal("unexpected memory usage", ecc.size, mm.available)
+	}
+
+	// a request which fits into the available memory doesn't evict anything
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !mm.Request(ctx, 900, memoryPriorityLow) {
+		t.Fatal("failed to request memory")
+	}
+	if ecc.size != 80 || mm.available != 20 {
+		t.Fatal("unexpected memory usage", ecc.size, mm.available)
+	}
+
+	// a request which blocks evicts the least recently used entries until
+	// enough memory was released
+	if !mm.Request(ctx, 50, memoryPriorityLow) {
+		t.Fatal("repair didn't get the memory of the cache")
+	}
+	if ecc.size != 20 || mm.available != 30 {
+		t.Fatal("unexpected memory usage", ecc.size, mm.available)
+	}
+	if _, ok := ecc.callGet(id(0), fp); !ok {
+		t.Fatal("most recently used entry was evicted")
+	}
+	if _, ok := ecc.callGet(id(1), fp); ok {
+		t.Fatal("least recently used entry wasn't evicted")
+	}
+
+	// the last entry is evicted for a priority request as well
+	if !mm.Request(ctx, 40, memoryPriorityHigh) {
+		t.Fatal("repair didn't get the memory of the cache")
+	}
+	if ecc.size != 0 || ecc.lru.Len() != 0 || len(ecc.entries) != 0 || mm.available != 10 {
+		t.Fatal("cache wasn't emptied", ecc.size, mm.available)
+	}
+	mm.Return(990)
+	if mm.available != 1000 {
+		t.Fatal("memory wasn't returned", mm.available)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/modules/renter/filesystem"
+	"go.sia.tech/siad/modules/renter/filesystem/siafile"
 	"go.sia.tech/siad/types"
 )
 
@@ -246,6 +247,14 @@ func (uh *uploadHeap) managedLen() int {
 	return uhLen
 }
 
+// managedNumRepairingChunks returns the number of chunks that are currently
+// being uploaded.
+func (uh *uploadHeap) managedNumRepairingChunks() int {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	return len(uh.repairingChunks)
+}
+
 // managedPauseStatus will return whether or not the uploadheap is paused and
 // the duration of the pause
 func (uh *uploadHeap) managedPauseStatus() (bool, time.Time) {
@@ -534,8 +543,9 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 		onDisk:         onDisk,
 		staticPriority: priority,
 
-		staticIndex:   chunkIndex,
-		staticSiaPath: entryCopy.SiaFilePath(),
+		staticIndex:       chunkIndex,
+		staticSiaPath:     entryCopy.SiaFilePath(),
+		staticErasureCode: entryCopy.ErasureCode(),
 
 		staticMemoryManager: mm,
 
@@ -613,6 +623,7 @@ func (r *Renter) managedBuildUnfinishedChunk(entry *filesystem.FileNode, chunkIn
 	// Now that we have calculated the completed pieces for the chunk we can
 	// calculate the health of the chunk to avoid a call to ChunkHealth
 	uuc.health = 1 - (float64(uuc.piecesCompleted-uuc.staticMinimumPieces) / float64(uuc.staticPiecesNeeded-uuc.staticMinimumPieces))
+	uuc.health = siafile.ScaleHealth(uuc.health, uuc.fileEntry.RepairThreshold(), uuc.staticMinimumPieces, uuc.staticPiecesNeeded)
 	return uuc, nil
 }
 
@@ -1339,6 +1350,8 @@ func (r *Renter) managedRefreshHostsAndWorkers() map[string]struct{} {
 	for _, contract := range currentContracts {
 		hosts[contract.HostPublicKey.String()] = struct{}{}
 	}
+	// Blacklisted hosts are not used for uploads.
+	r.staticHostBlacklist.callFilter(hosts)
 	// Refresh the worker pool as well.
 	r.staticWorkerPool.callUpdate()
 	return hosts
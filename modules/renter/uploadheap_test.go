@@ -799,6 +799,7 @@ func testUploadHeapMaps(t *testing.T) {
 				index:   i,
 			},
 			fileEntry:                 sf.Copy(),
+			staticErasureCode:         sf.ErasureCode(),
 			stuck:                     stuck,
 			piecesCompleted:           1,
 			staticPiecesNeeded:        1,
@@ -1010,6 +1011,7 @@ func testManagedPushChunkForRepair(t *testing.T) {
 			index:   1,
 		},
 		fileEntry:           file.Copy(),
+		staticErasureCode:   file.ErasureCode(),
 		sourceReader:        sr,
 		piecesRegistered:    1, // This is so the chunk is viewed as incomplete
 		staticMemoryManager: rt.renter.repairMemoryManager,
@@ -1072,6 +1074,7 @@ func testManagedPushChunkForRepair(t *testing.T) {
 	localChunk := &unfinishedUploadChunk{
 		id:                  streamChunk.id,
 		fileEntry:           file.Copy(),
+		staticErasureCode:   file.ErasureCode(),
 		piecesRegistered:    1, // This is so the chunk is viewed as incomplete
 		staticMemoryManager: rt.renter.repairMemoryManager,
 	}
@@ -1167,6 +1170,7 @@ func testManagedTryUpdate(t *testing.T) {
 				index:   uint64(i),
 			},
 			fileEntry:           entry.Copy(),
+			staticErasureCode:   entry.ErasureCode(),
 			sourceReader:        test.existingChunkSR,
 			piecesRegistered:    1, // This is so the chunk is viewed as incomplete
 			staticMemoryManager: rt.renter.repairMemoryManager,
@@ -1253,7 +1257,7 @@ func (rt *renterTester) managedBlockUntilBubblesComplete() {
 		// go routine so we want to give it time to start.
 		time.Sleep(100 * time.Millisecond)
 		bs.mu.Lock()
-		if len(bs.bubbleUpdates) == 0 {
+		if len(bs.bubbleUpdates) == 0 && len(bs.unflushed) == 0 {
 			bs.mu.Unlock()
 			return
 		}
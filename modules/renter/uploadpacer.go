@@ -0,0 +1,169 @@
+package renter
+
+// uploadpacer spreads the upload of new sectors over time. Without pacing, the
+// repair loop uploads to every host at once after many hosts were added or
+// after the renter was offline for a while, which causes hosts to rate limit
+// the renter.
+//
+// The renter has a global pacer which limits the number of new sectors uploaded
+// per second across all hosts. Every worker has its own pacer which starts out
+// slow for a newly used host and increases its rate by a fixed amount after
+// every successful upload. If a host throttles an upload, the rate of its pacer
+// is halved and the worker backs off for a while. Throttled uploads are not
+// counted as failures and don't put the worker on cooldown.
+//
+// The pacers read the time from the renter's clock, which tests replace to
+// control the passage of time.
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// uploadThrottleErrStrings are the lowercase substrings of host errors
+	// which indicate that the host is rate limiting the renter.
+	uploadThrottleErrStrings = []string{
+		"rate limit",
+		"throttl",
+		"too many requests",
+	}
+)
+
+// uploadPacer is a token bucket which limits the number of uploads that are
+// started per second. Its rate increases after every successful upload and is
+// halved when an upload is throttled.
+type uploadPacer struct {
+	// rate is the current number of uploads per second. It always lies within
+	// [staticMinRate, staticMaxRate].
+	rate float64
+
+	// tokens is the number of uploads which can be started right away. It
+	// grows by rate tokens per second up to a burst of max(rate, 1). It can
+	// become negative if multiple threads start uploads at the same time.
+	tokens     float64
+	lastRefill time.Time
+
+	// consecutiveThrottles is the number of uploads that were throttled in a
+	// row. No uploads are started before throttledUntil.
+	consecutiveThrottles int
+	throttledUntil       time.Time
+
+	staticClock    clock
+	staticMinRate  float64
+	staticMaxRate  float64
+	staticIncrease float64
+	mu             sync.Mutex
+}
+
+// newUploadPacer creates a pacer which starts at minRate uploads per second and
+// increases its rate by increase after every successful upload up to maxRate.
+func newUploadPacer(c clock, minRate, maxRate, increase float64) *uploadPacer {
+	return &uploadPacer{
+		rate:           minRate,
+		tokens:         1,
+		staticClock:    c,
+		staticMinRate:  minRate,
+		staticMaxRate:  maxRate,
+		staticIncrease: increase,
+	}
+}
+
+// isUploadThrottleErr returns true if the error returned by a host indicates
+// that the host is rate limiting the renter.
+func isUploadThrottleErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := strings.ToLower(err.Error())
+	for _, s := range uploadThrottleErrStrings {
+		if strings.Contains(errStr, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// callStatus returns the current rate of the pacer and how long it is still
+// backing off from a throttled upload.
+func (p *uploadPacer) callStatus() (float64, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.staticClock.Now()
+	var throttled time.Duration
+	if now.Before(p.throttledUntil) {
+		throttled = p.throttledUntil.Sub(now)
+	}
+	return p.rate, throttled
+}
+
+// callSuccess increases the rate of the pacer after a successful upload.
+func (p *uploadPacer) callSuccess() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.consecutiveThrottles = 0
+	p.rate = math.Min(p.rate+p.staticIncrease, p.staticMaxRate)
+}
+
+// callTake accounts for an upload which is started now.
+func (p *uploadPacer) callTake() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refill(p.staticClock.Now())
+	p.tokens--
+}
+
+// callThrottled halves the rate of the pacer and makes it back off after an
+// upload was throttled. The backoff doubles for every consecutive throttled
+// upload.
+func (p *uploadPacer) callThrottled() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.staticClock.Now()
+	p.refill(now)
+	p.rate = math.Max(p.rate/2, p.staticMinRate)
+	p.tokens = math.Min(p.tokens, 0)
+
+	backoff := uploadThrottleBackoff
+	for i := 0; i < p.consecutiveThrottles && i < maxConsecutivePenalty; i++ {
+		backoff *= 2
+	}
+	p.consecutiveThrottles++
+	p.throttledUntil = now.Add(backoff)
+}
+
+// callWait returns how long to wait before the next upload can be started. It
+// returns 0 if an upload can be started right away.
+func (p *uploadPacer) callWait() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.staticClock.Now()
+	p.refill(now)
+	var wait time.Duration
+	if now.Before(p.throttledUntil) {
+		wait = p.throttledUntil.Sub(now)
+	}
+	if p.tokens < 1 {
+		tokenWait := time.Duration(math.Ceil((1 - p.tokens) / p.rate * float64(time.Second)))
+		if tokenWait > wait {
+			wait = tokenWait
+		}
+	}
+	return wait
+}
+
+// refill adds the tokens that accumulated since the last refill.
+func (p *uploadPacer) refill(now time.Time) {
+	if p.lastRefill.IsZero() {
+		p.lastRefill = now
+		return
+	}
+	if !now.After(p.lastRefill) {
+		return
+	}
+	p.tokens += now.Sub(p.lastRefill).Seconds() * p.rate
+	p.tokens = math.Min(p.tokens, math.Max(p.rate, 1))
+	p.lastRefill = now
+}
@@ -0,0 +1,137 @@
+package renter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a clock which only advances when told to.
+type testClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+// Now implements clock.
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// TestUploadPacerRampUp tests that the rate of an upload pacer starts out slow
+// and increases linearly with every successful upload up to the max.
+func TestUploadPacerRampUp(t *testing.T) {
+	t.Parallel()
+
+	c := &testClock{now: time.Unix(0, 0)}
+	p := newUploadPacer(c, 1, 4, 1)
+
+	// The first upload can start right away.
+	if wait := p.callWait(); wait != 0 {
+		t.Fatal("expected no wait, got", wait)
+	}
+	p.callTake()
+	if wait := p.callWait(); wait != time.Second {
+		t.Fatal("expected to wait 1s, got", wait)
+	}
+
+	// Every success increases the rate until the max is reached.
+	for _, expected := range []float64{2, 3, 4, 4, 4} {
+		p.callSuccess()
+		if rate, _ := p.callStatus(); rate != expected {
+			t.Fatalf("expected rate %v, got %v", expected, rate)
+		}
+	}
+	if wait := p.callWait(); wait != time.Second/4 {
+		t.Fatal("expected to wait 250ms, got", wait)
+	}
+
+	// After some time without uploads, the pacer allows a burst of one
+	// second's worth of uploads.
+	c.Advance(time.Minute)
+	for i := 0; i < 4; i++ {
+		if wait := p.callWait(); wait != 0 {
+			t.Fatalf("upload %v: expected no wait, got %v", i, wait)
+		}
+		p.callTake()
+	}
+	if wait := p.callWait(); wait != time.Second/4 {
+		t.Fatal("expected to wait 250ms, got", wait)
+	}
+}
+
+// TestUploadPacerThrottle tests that throttled uploads halve the rate of an
+// upload pacer and make it back off.
+func TestUploadPacerThrottle(t *testing.T) {
+	t.Parallel()
+
+	c := &testClock{now: time.Unix(0, 0)}
+	p := newUploadPacer(c, 1, 8, 1)
+	for i := 0; i < 7; i++ {
+		p.callSuccess()
+	}
+
+	// The backoff doubles for every consecutive throttled upload while the
+	// rate is halved down to the min rate.
+	backoff := uploadThrottleBackoff
+	for _, expected := range []float64{4, 2, 1, 1} {
+		p.callThrottled()
+		rate, throttled := p.callStatus()
+		if rate != expected {
+			t.Fatalf("expected rate %v, got %v", expected, rate)
+		}
+		if throttled != backoff {
+			t.Fatalf("expected backoff %v, got %v", backoff, throttled)
+		}
+		if wait := p.callWait(); wait < backoff {
+			t.Fatalf("expected to wait at least %v, got %v", backoff, wait)
+		}
+		backoff *= 2
+	}
+
+	// Once the backoff is over, uploads can start again.
+	c.Advance(backoff)
+	if wait := p.callWait(); wait != 0 {
+		t.Fatal("expected no wait, got", wait)
+	}
+	if _, throttled := p.callStatus(); throttled != 0 {
+		t.Fatal("pacer still throttled", throttled)
+	}
+
+	// A success resets the backoff.
+	p.callSuccess()
+	p.callThrottled()
+	if _, throttled := p.callStatus(); throttled != uploadThrottleBackoff {
+		t.Fatalf("expected backoff %v, got %v", uploadThrottleBackoff, throttled)
+	}
+}
+
+// TestIsUploadThrottleErr is a unit test for isUploadThrottleErr.
+func TestIsUploadThrottleErr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err      error
+		throttle bool
+	}{
+		{nil, false},
+		{errors.New("host is offline"), false},
+		{errors.New("host has reached its Rate Limit"), true},
+		{errors.New("429 Too Many Requests"), true},
+		{errors.New("renter is being throttled"), true},
+	}
+	for _, test := range tests {
+		if isUploadThrottleErr(test.err) != test.throttle {
+			t.Errorf("%v: expected %v", test.err, test.throttle)
+		}
+	}
+}
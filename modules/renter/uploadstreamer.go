@@ -3,6 +3,7 @@ package renter
 import (
 	"fmt"
 	"io"
+	"os"
 	"sync"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -117,6 +118,51 @@ func (ss *StreamShard) Read(b []byte) (int, error) {
 	return n + peekBytes, err
 }
 
+// sourceFileReader is a wrapper for a file which is uploaded as a stream. It
+// fails the upload with ErrSourceMutated if the size or modification time of
+// the file change while it is read.
+type sourceFileReader struct {
+	f         *os.File
+	info      os.FileInfo
+	bytesRead int64
+}
+
+// newSourceFileReader creates a new sourceFileReader for a file, remembering
+// its current size and modification time.
+func newSourceFileReader(f *os.File) (*sourceFileReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to stat the source file")
+	}
+	return &sourceFileReader{
+		f:    f,
+		info: info,
+	}, nil
+}
+
+// Read implements the io.Reader interface.
+func (sfr *sourceFileReader) Read(b []byte) (int, error) {
+	n, err := sfr.f.Read(b)
+	sfr.bytesRead += int64(n)
+	if err != nil && !errors.Contains(err, io.EOF) {
+		return n, err
+	}
+	fi, errStat := sfr.f.Stat()
+	if errStat != nil {
+		return n, errors.AddContext(errStat, "unable to stat the source file")
+	}
+	if fi.Size() != sfr.info.Size() || sfr.bytesRead > sfr.info.Size() {
+		return n, errors.AddContext(ErrSourceMutated, fmt.Sprintf("size changed from %v to %v after reading %v bytes", sfr.info.Size(), fi.Size(), sfr.bytesRead))
+	}
+	if !fi.ModTime().Equal(sfr.info.ModTime()) {
+		return n, errors.AddContext(ErrSourceMutated, fmt.Sprintf("modification time changed from %v to %v", sfr.info.ModTime(), fi.ModTime()))
+	}
+	if err != nil && sfr.bytesRead != sfr.info.Size() {
+		return n, errors.AddContext(ErrSourceMutated, fmt.Sprintf("read %v bytes but expected %v", sfr.bytesRead, sfr.info.Size()))
+	}
+	return n, err
+}
+
 // UploadStreamFromReader reads from the provided reader until io.EOF is reached and
 // upload the data to the Sia network.
 func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.Reader) error {
@@ -136,15 +182,17 @@ func (r *Renter) UploadStreamFromReader(up modules.FileUploadParams, reader io.R
 // managedInitUploadStream verifies the upload parameters and prepares an empty
 // SiaFile for the upload.
 func (r *Renter) managedInitUploadStream(up modules.FileUploadParams) (*filesystem.FileNode, error) {
-	siaPath, ec, force, repair, cipherType := up.SiaPath, up.ErasureCode, up.Force, up.Repair, up.CipherType
 	// Check if ec was set. If not use defaults.
 	var err error
-	if ec == nil && !repair {
-		ec = modules.NewRSSubCodeDefault()
-		up.ErasureCode = ec
-	} else if ec != nil && repair {
+	if up.ErasureCode != nil && up.Repair {
 		return nil, errors.New("can't provide erasure code settings when doing repairs")
+	} else if !up.Repair {
+		up, err = r.managedApplyUploadDefaults(up)
+		if err != nil {
+			return nil, err
+		}
 	}
+	siaPath, ec, force, repair, cipherType := up.SiaPath, up.ErasureCode, up.Force, up.Repair, up.CipherType
 
 	// Make sure that force and repair aren't both set.
 	if force && repair {
@@ -188,7 +236,12 @@ func (r *Renter) managedInitUploadStream(up modules.FileUploadParams) (*filesyst
 	if err != nil {
 		return nil, err
 	}
-	return r.staticFileSystem.OpenSiaFile(siaPath)
+	entry, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return nil, err
+	}
+	r.managedApplyRepairThreshold(entry, up.RepairThreshold)
+	return entry, nil
 }
 
 // callUploadStreamFromReader reads from the provided reader until io.EOF is
@@ -218,6 +271,14 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 		}
 	}()
 
+	// If the stream is a file, make sure it isn't modified while it is read.
+	if f, ok := reader.(*os.File); ok {
+		reader, err = newSourceFileReader(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if stream has at least one byte. No need to upload empty data.
 	peek := []byte{0}
 	_, err = io.ReadFull(reader, peek)
@@ -94,6 +94,10 @@ type (
 		uploadRecentFailure       time.Time     // How recent was the last failure?
 		uploadRecentFailureErr    error         // What was the reason for the last failure?
 		uploadTerminated          bool          // Have we stopped uploading?
+		uploadPacerWakeScheduled  bool          // Will the worker be woken once the upload pacers allow it to upload?
+
+		// staticUploadPacer paces the uploads to the worker's host.
+		staticUploadPacer *uploadPacer
 
 		// The staticAccount represent the renter's ephemeral account on the
 		// host. It keeps track of the available balance in the account, the
@@ -252,6 +256,7 @@ func (r *Renter) newWorker(hostPubKey types.SiaPublicKey) (*worker, error) {
 		},
 
 		unprocessedChunks: newUploadChunks(),
+		staticUploadPacer: newUploadPacer(r.staticClock, uploadPacerInitialHostRate, uploadPacerMaxHostRate, uploadPacerHostRateIncrease),
 		wakeChan:          make(chan struct{}, 1),
 		renter:            r,
 	}
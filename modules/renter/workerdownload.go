@@ -6,7 +6,9 @@ package renter
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/crypto"
@@ -22,6 +24,26 @@ const (
 	downloadGougingFractionDenom = 4
 )
 
+var (
+	// errWorkerBudget is added to the errors of workers that failed to fetch
+	// a piece because the renter couldn't pay for it.
+	errWorkerBudget = errors.New("worker can't be paid for the download")
+
+	// errWorkerOnCooldown is the error of workers which were dropped from a
+	// download because they were on cooldown.
+	errWorkerOnCooldown = errors.New("worker is on cooldown")
+)
+
+// isBudgetErr returns true if the error a host returned for a read indicates
+// that the renter's funds didn't cover it.
+func isBudgetErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	s := err.Error()
+	return strings.Contains(s, "balance was insufficient") || strings.Contains(s, "insufficient funds")
+}
+
 // segmentsForRecovery calculates the first segment and how many segments we
 // need in total to recover the requested data.
 func segmentsForRecovery(chunkFetchOffset, chunkFetchLength uint64, rs modules.ErasureCoder) (uint64, uint64) {
@@ -125,18 +147,31 @@ func (w *worker) threadedPerformDownloadChunkJob(udc *unfinishedDownloadChunk) {
 	err := checkDownloadGouging(allowance, &w.staticPriceTable().staticPriceTable)
 	if err != nil {
 		w.renter.log.Debugln("worker downloader is not being used because price gouging was detected:", err)
-		udc.managedUnregisterWorker(w)
+		udc.managedUnregisterWorker(w, errors.Extend(err, errWorkerBudget))
+		return
+	}
+
+	// Translate the range within the piece into a range within the sector
+	// using the file's sector packing. Every piece is uploaded to a sector of
+	// its own which means that it is stored in the first slot.
+	pieceOffset, pieceLength := sectorOffsetAndLength(udc.staticFetchOffset, udc.staticFetchLength, udc.erasureCode)
+	fetchOffset, fetchLength, err := udc.staticSectorPacking.SectorRange(0, pieceOffset, pieceLength)
+	if err != nil {
+		w.renter.log.Critical("worker failed to compute sector range:", err)
+		udc.managedUnregisterWorker(w, err)
 		return
 	}
 
 	// Fetch the sector. If fetching the sector fails, the worker needs to be
 	// unregistered with the chunk.
-	fetchOffset, fetchLength := sectorOffsetAndLength(udc.staticFetchOffset, udc.staticFetchLength, udc.erasureCode)
 	root := udc.staticChunkMap[w.staticHostPubKey.String()].root
 	pieceData, err := w.ReadSectorLowPrio(w.renter.tg.StopCtx(), udc.staticSpendingCategory, root, fetchOffset, fetchLength)
+	if isBudgetErr(err) {
+		err = errors.Extend(err, errWorkerBudget)
+	}
 	if err != nil {
 		w.renter.log.Debugln("worker failed to download sector:", err)
-		udc.managedUnregisterWorker(w)
+		udc.managedUnregisterWorker(w, err)
 		return
 	}
 
@@ -146,6 +181,7 @@ func (w *worker) threadedPerformDownloadChunkJob(udc *unfinishedDownloadChunk) {
 	// data sent to and received from the host (like signatures) that aren't
 	// actually payload data.
 	atomic.AddUint64(&udc.download.atomicTotalDataTransferred, udc.staticPieceSize)
+	w.renter.staticMetrics.callAddDownloaded(uint64(len(pieceData)))
 
 	// Decrypt the piece. This might introduce some overhead for downloads with
 	// a large overdrive. It shouldn't be a bottleneck though since bandwidth
@@ -155,9 +191,13 @@ func (w *worker) threadedPerformDownloadChunkJob(udc *unfinishedDownloadChunk) {
 	decryptedPiece, err := key.DecryptBytesInPlace(pieceData, uint64(fetchOffset/crypto.SegmentSize))
 	if err != nil {
 		w.renter.log.Debugln("worker failed to decrypt piece:", err)
-		udc.managedUnregisterWorker(w)
+		udc.managedUnregisterWorker(w, err)
 		return
 	}
+	// Add the piece to the piece cache if the whole sector was fetched.
+	if udc.staticPieceCache != nil && fetchOffset == 0 && fetchLength == modules.SectorSize {
+		udc.staticPieceCache.Put(udc.staticChunkIndex, pieceIndex, append([]byte(nil), decryptedPiece...))
+	}
 
 	// Mark the piece as completed. Perform chunk recovery if we newly have
 	// enough pieces to do so. Chunk recovery is an expensive operation that
@@ -168,10 +208,17 @@ func (w *worker) threadedPerformDownloadChunkJob(udc *unfinishedDownloadChunk) {
 	if udc.piecesCompleted <= udc.erasureCode.MinPieces() {
 		atomic.AddUint64(&udc.download.atomicDataReceived, udc.staticFetchLength/uint64(udc.erasureCode.MinPieces()))
 		udc.physicalChunkData[pieceIndex] = decryptedPiece
+		udc.setPieceProvenance(pieceIndex, &pieceProvenance{
+			fetchTime:     time.Now(),
+			host:          w.staticHostPubKey,
+			proofVerified: true,
+			root:          root,
+		})
 	} else {
 		// This worker's piece was not needed, another worker was faster. Nil
 		// the piece so the GC can find it faster.
 		decryptedPiece = nil
+		udc.download.managedMarkOverdriveDiscarded(udc.staticChunkIndex)
 	}
 	if udc.piecesCompleted == udc.erasureCode.MinPieces() {
 		// Uint division might not always cause atomicDataReceived to cleanly
@@ -195,14 +242,21 @@ func (w *worker) threadedPerformDownloadChunkJob(udc *unfinishedDownloadChunk) {
 
 // managedUnregisterWorker will remove the worker from an unfinished download
 // chunk, and then un-register the pieces that it grabbed. This function should
-// only be called when a worker download fails.
-func (udc *unfinishedDownloadChunk) managedUnregisterWorker(w *worker) {
+// only be called when a worker download fails. The error is remembered to
+// report it if the chunk fails.
+func (udc *unfinishedDownloadChunk) managedUnregisterWorker(w *worker, err error) {
 	udc.mu.Lock()
 	udc.piecesRegistered--
 	udc.pieceUsage[udc.staticChunkMap[w.staticHostPubKey.String()].index] = false
+	udc.addWorkerErr(w, err)
 	udc.mu.Unlock()
 }
 
+// addWorkerErr remembers why the worker failed to fetch its piece.
+func (udc *unfinishedDownloadChunk) addWorkerErr(w *worker, err error) {
+	udc.workerErrs = errors.Compose(udc.workerErrs, errors.AddContext(err, fmt.Sprintf("host %v", w.staticHostPubKey)))
+}
+
 // managedProcessDownloadChunk will take a potential download chunk, figure out
 // if there is work to do, and then perform any registration or processing with
 // the chunk before returning the chunk to the caller.
@@ -220,6 +274,9 @@ func (w *worker) managedProcessDownloadChunk(udc *unfinishedDownloadChunk) *unfi
 	pieceData, workerHasPiece := udc.staticChunkMap[w.staticHostPubKey.String()]
 	pieceCompleted := udc.completedPieces[pieceData.index]
 	if chunkComplete || chunkFailed || onCooldown || !workerHasPiece || pieceCompleted {
+		if onCooldown && workerHasPiece {
+			udc.addWorkerErr(w, errWorkerOnCooldown)
+		}
 		udc.mu.Unlock()
 		udc.managedRemoveWorker()
 
@@ -272,9 +329,15 @@ func (w *worker) managedProcessDownloadChunk(udc *unfinishedDownloadChunk) *unfi
 	// finished.
 	pieceTaken := udc.pieceUsage[pieceData.index]
 	piecesInProgress := udc.piecesRegistered + udc.piecesCompleted
-	desiredPiecesInProgress := udc.erasureCode.MinPieces() + udc.staticOverdrive
+	desiredPiecesInProgress := udc.erasureCode.MinPieces() + udc.overdrive
 	workersDesired := piecesInProgress < desiredPiecesInProgress && !pieceTaken
 
+	// The user may limit the number of workers fetching pieces of the chunk at
+	// the same time.
+	if udc.maxWorkers > 0 && udc.piecesRegistered >= udc.maxWorkers {
+		workersDesired = false
+	}
+
 	if workersDesired && meetsExtraCriteria {
 		// Worker can be useful. Register the worker and return the chunk for
 		// downloading.
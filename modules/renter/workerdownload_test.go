@@ -276,6 +276,27 @@ func TestProcessDownloadChunk(t *testing.T) {
 		t.Fatalf("expected 1 standby worker but got %v", len(udc.workersStandby))
 	}
 
+	// more pieces in progress than the max number of workers
+	udc = chunk()
+	udc.overdrive = 1
+	udc.maxWorkers = 1
+	udc.piecesRegistered = 1
+	c = wt.managedProcessDownloadChunk(udc)
+	if c != nil {
+		t.Fatal("c should be nil")
+	}
+	if len(udc.workersStandby) != 1 {
+		t.Fatalf("expected 1 standby worker but got %v", len(udc.workersStandby))
+	}
+	// the same chunk without a limit needs the worker for the overdrive
+	udc = chunk()
+	udc.overdrive = 1
+	udc.piecesRegistered = 1
+	c = wt.managedProcessDownloadChunk(udc)
+	if c == nil {
+		t.Fatal("c shouldn't be nil")
+	}
+
 	// helper to add jobs to the queue.
 	addBlankJobs := func(n int) {
 		for i := 0; i < n; i++ {
@@ -131,27 +131,42 @@ func (j *jobHasSector) callExpectedBandwidth() (ul, dl uint64) {
 	return hasSectorJobExpectedBandwidth(len(j.staticSectors))
 }
 
-// managedHasSector returns whether or not the host has a sector with given root
+// managedHasSector returns whether or not the host has a sector with given
+// root. Roots that have recently been looked up on the same host are served
+// from the renter's piece availability cache.
 func (j *jobHasSector) managedHasSector() ([]bool, error) {
+	w := j.staticQueue.staticWorker()
+	return w.renter.staticPieceAvailabilityCache.managedHasSectors(j.staticCtx, w.staticHostPubKeyStr, j.staticSectors, j.managedExecuteHasSector)
+}
+
+// managedExecuteHasSector executes a HasSector program on the host for the
+// given roots.
+func (j *jobHasSector) managedExecuteHasSector(roots []crypto.Hash) ([]bool, error) {
 	w := j.staticQueue.staticWorker()
 	// Create the program.
 	pt := w.staticPriceTable().staticPriceTable
 	pb := modules.NewProgramBuilder(&pt, 0) // 0 duration since HasSector doesn't depend on it.
-	for _, sector := range j.staticSectors {
+	for _, sector := range roots {
 		pb.AddHasSectorInstruction(sector)
 	}
 	program, programData := pb.Program()
-	cost, _, _ := pb.Cost(true)
 
-	// take into account bandwidth costs
-	ulBandwidth, dlBandwidth := j.callExpectedBandwidth()
-	bandwidthCost := modules.MDMBandwidthCost(pt, ulBandwidth, dlBandwidth)
-	cost = cost.Add(bandwidthCost)
+	// estimateCost computes the cost of the program including bandwidth
+	// costs.
+	estimateCost := func(pt *modules.RPCPriceTable) types.Currency {
+		pb := modules.NewProgramBuilder(pt, 0)
+		for _, sector := range roots {
+			pb.AddHasSectorInstruction(sector)
+		}
+		cost, _, _ := pb.Cost(true)
+		ulBandwidth, dlBandwidth := hasSectorJobExpectedBandwidth(len(roots))
+		return cost.Add(modules.MDMBandwidthCost(*pt, ulBandwidth, dlBandwidth))
+	}
 
 	// Execute the program and parse the responses.
 	hasSectors := make([]bool, 0, len(program))
 	var responses []programResponse
-	responses, _, err := w.managedExecuteProgram(program, programData, types.FileContractID{}, categoryDownload, cost)
+	responses, _, err := w.managedExecuteProgramWithRetry(program, programData, types.FileContractID{}, categoryDownload, estimateCost, w.staticCheckDownloadGouging)
 	if err != nil {
 		return nil, errors.AddContext(err, "unable to execute program for has sector job")
 	}
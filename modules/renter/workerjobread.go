@@ -156,9 +156,9 @@ func (j *jobRead) callExpectedBandwidth() (ul, dl uint64) {
 
 // managedRead returns the sector data for the given read program and the merkle
 // proof.
-func (j *jobRead) managedRead(w *worker, program modules.Program, programData []byte, cost types.Currency) ([]programResponse, error) {
+func (j *jobRead) managedRead(w *worker, program modules.Program, programData []byte, estimateCost programCostFunc) ([]programResponse, error) {
 	// execute it
-	responses, _, err := w.managedExecuteProgram(program, programData, w.staticCache().staticContractID, j.staticJobReadMetadata().staticSpendingCategory, cost)
+	responses, _, err := w.managedExecuteProgramWithRetry(program, programData, w.staticCache().staticContractID, j.staticJobReadMetadata().staticSpendingCategory, estimateCost, w.staticCheckDownloadGouging)
 	if err != nil {
 		return []programResponse{}, err
 	}
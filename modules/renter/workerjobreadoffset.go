@@ -8,6 +8,7 @@ import (
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
 )
 
 type (
@@ -39,15 +40,9 @@ func (j *jobReadOffset) managedReadOffset() ([]byte, error) {
 	pb.AddRevisionInstruction()
 	pb.AddReadOffsetInstruction(j.staticLength, j.staticOffset, true)
 	program, programData := pb.Program()
-	cost, _, _ := pb.Cost(true)
-
-	// take into account bandwidth costs
-	ulBandwidth, dlBandwidth := j.callExpectedBandwidth()
-	bandwidthCost := modules.MDMBandwidthCost(pt, ulBandwidth, dlBandwidth)
-	cost = cost.Add(bandwidthCost)
 
 	// Read responses.
-	responses, err := j.jobRead.managedRead(w, program, programData, cost)
+	responses, err := j.jobRead.managedRead(w, program, programData, j.staticCost)
 	if err != nil {
 		return nil, errors.AddContext(err, "jobReadOffset: failed to execute managedRead")
 	}
@@ -97,6 +92,17 @@ func (j *jobReadOffset) managedReadOffset() ([]byte, error) {
 	return downloadResponse.Output, nil
 }
 
+// staticCost returns the cost of the job's program, including bandwidth costs,
+// using the given price table.
+func (j *jobReadOffset) staticCost(pt *modules.RPCPriceTable) types.Currency {
+	pb := modules.NewProgramBuilder(pt, 0)
+	pb.AddRevisionInstruction()
+	pb.AddReadOffsetInstruction(j.staticLength, j.staticOffset, true)
+	cost, _, _ := pb.Cost(true)
+	ulBandwidth, dlBandwidth := j.callExpectedBandwidth()
+	return cost.Add(modules.MDMBandwidthCost(*pt, ulBandwidth, dlBandwidth))
+}
+
 // ReadOffset is a helper method to run a ReadOffset job on a worker.
 func (w *worker) ReadOffset(ctx context.Context, category spendingCategory, offset, length uint64) ([]byte, error) {
 	readOffsetRespChan := make(chan *jobReadResponse)
@@ -7,6 +7,7 @@ import (
 	"gitlab.com/NebulousLabs/errors"
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
 )
 
 type (
@@ -38,14 +39,8 @@ func (j *jobReadSector) managedReadSector() ([]byte, error) {
 	pb := modules.NewProgramBuilder(&pt, 0) // 0 duration since ReadSector doesn't depend on it.
 	pb.AddReadSectorInstruction(j.staticLength, j.staticOffset, j.staticSector, true)
 	program, programData := pb.Program()
-	cost, _, _ := pb.Cost(true)
-
-	// take into account bandwidth costs
-	ulBandwidth, dlBandwidth := j.callExpectedBandwidth()
-	bandwidthCost := modules.MDMBandwidthCost(pt, ulBandwidth, dlBandwidth)
-	cost = cost.Add(bandwidthCost)
 
-	responses, err := j.jobRead.managedRead(w, program, programData, cost)
+	responses, err := j.jobRead.managedRead(w, program, programData, j.staticCost)
 	if err != nil {
 		return nil, errors.AddContext(err, "jobReadSector: failed to execute managedRead")
 	}
@@ -61,6 +56,16 @@ func (j *jobReadSector) managedReadSector() ([]byte, error) {
 	return data, nil
 }
 
+// staticCost returns the cost of the job's program, including bandwidth costs,
+// using the given price table.
+func (j *jobReadSector) staticCost(pt *modules.RPCPriceTable) types.Currency {
+	pb := modules.NewProgramBuilder(pt, 0)
+	pb.AddReadSectorInstruction(j.staticLength, j.staticOffset, j.staticSector, true)
+	cost, _, _ := pb.Cost(true)
+	ulBandwidth, dlBandwidth := j.callExpectedBandwidth()
+	return cost.Add(modules.MDMBandwidthCost(*pt, ulBandwidth, dlBandwidth))
+}
+
 // newJobReadSector creates a new read sector job.
 func (w *worker) newJobReadSector(ctx context.Context, queue *jobReadQueue, respChan chan *jobReadResponse, category spendingCategory, root crypto.Hash, offset, length uint64) *jobReadSector {
 	return &jobReadSector{
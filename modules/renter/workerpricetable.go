@@ -50,6 +50,20 @@ var (
 		Testing:  1 * time.Minute,
 	}).(time.Duration)
 
+	// errPriceTableNotRefreshed is returned when waiting for a price table
+	// update that was never scheduled, e.g. because the last forced update
+	// happened too recently.
+	errPriceTableNotRefreshed = errors.New("price table update was not scheduled")
+
+	// priceTableRefreshTimeout is the maximum amount of time a worker waits
+	// for a scheduled price table update to finish.
+	priceTableRefreshTimeout = build.Select(build.Var{
+		Standard: time.Minute,
+		Testnet:  time.Minute,
+		Dev:      30 * time.Second,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
 	// minInitialEstimate is the minimum job time estimate that's set on the HS
 	// and RJ queue in case we fail to update the price table successfully
 	minInitialEstimate = time.Second
@@ -157,6 +171,33 @@ func (w *worker) staticTryForcePriceTableUpdate() {
 	w.staticSchedulePriceTableUpdate(true)
 }
 
+// managedAwaitPriceTableUpdate waits for the scheduled update of the price
+// table old to finish and returns the updated price table. It returns early if
+// the update failed or if no update is scheduled.
+func (w *worker) managedAwaitPriceTableUpdate(old *workerPriceTable) (*workerPriceTable, error) {
+	start := time.Now()
+	timeout := time.After(priceTableRefreshTimeout)
+	for {
+		current := w.staticPriceTable()
+		if current.staticPriceTable.UID != old.staticPriceTable.UID && current.staticValid() {
+			return current, nil
+		}
+		if current.staticRecentErrTime.After(start) {
+			return nil, errors.AddContext(current.staticRecentErr, "price table update failed")
+		}
+		if !current.staticNeedsToUpdate() {
+			return nil, errPriceTableNotRefreshed
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			return nil, errors.New("timed out waiting for price table update")
+		case <-w.renter.tg.StopChan():
+			return nil, errors.New("renter shut down while waiting for price table update")
+		}
+	}
+}
+
 // staticValid will return true if the latest price table that we have is still
 // valid for the host.
 //
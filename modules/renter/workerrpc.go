@@ -39,12 +39,18 @@ var (
 	renewGougingFeeMultiplier = types.NewCurrency64(5)
 )
 
-// programResponse is a helper struct that wraps the RPCExecuteProgramResponse
-// alongside the data output
-type programResponse struct {
-	modules.RPCExecuteProgramResponse
-	Output []byte
-}
+type (
+	// programResponse is a helper struct that wraps the
+	// RPCExecuteProgramResponse alongside the data output
+	programResponse struct {
+		modules.RPCExecuteProgramResponse
+		Output []byte
+	}
+
+	// programCostFunc computes the cost of executing a program, including
+	// its bandwidth costs, using the given price table.
+	programCostFunc func(pt *modules.RPCPriceTable) types.Currency
+)
 
 // managedExecuteProgram performs the ExecuteProgramRPC on the host
 func (w *worker) managedExecuteProgram(p modules.Program, data []byte, fcid types.FileContractID, category spendingCategory, cost types.Currency) (responses []programResponse, limit mux.BandwidthLimit, err error) {
@@ -56,6 +62,13 @@ func (w *worker) managedExecuteProgram(p modules.Program, data []byte, fcid type
 		}
 	}()
 
+	// make sure the host supports all instructions of the program before
+	// paying for it.
+	err = modules.ValidateProgram(&w.staticPriceTable().staticPriceTable, p)
+	if err != nil {
+		return
+	}
+
 	// track the withdrawal
 	var refund types.Currency
 	w.staticAccount.managedTrackWithdrawal(cost)
@@ -162,6 +175,52 @@ func (w *worker) managedExecuteProgram(p modules.Program, data []byte, fcid type
 	return
 }
 
+// managedExecuteProgramWithRetry executes the program like
+// managedExecuteProgram, using estimateCost to compute its cost from the
+// worker's price table. If the host rejects the program because it deems the
+// price table invalid, the worker waits for the price table to be refreshed,
+// checks the refreshed price table for gouging, re-estimates the cost and
+// retries the program once. The new cost needs to fit into the available
+// balance of the worker's account.
+//
+// NOTE: the host rejects the price table before it processes the payment, so
+// the withdrawal of a rejected attempt is never tracked as spending.
+func (w *worker) managedExecuteProgramWithRetry(p modules.Program, data []byte, fcid types.FileContractID, category spendingCategory, estimateCost programCostFunc, checkGouging func(modules.RPCPriceTable) error) ([]programResponse, mux.BandwidthLimit, error) {
+	wpt := w.staticPriceTable()
+	responses, limit, err := w.managedExecuteProgram(p, data, fcid, category, estimateCost(&wpt.staticPriceTable))
+	if !modules.IsPriceTableInvalidErr(err) {
+		return responses, limit, err
+	}
+
+	// managedExecuteProgram scheduled a price table update, wait for it and
+	// re-estimate the cost before retrying.
+	retryErr := func() error {
+		wpt, err := w.managedAwaitPriceTableUpdate(wpt)
+		if err != nil {
+			return errors.AddContext(err, "failed to refresh price table")
+		}
+		if err := checkGouging(wpt.staticPriceTable); err != nil {
+			return errors.AddContext(err, "refreshed price table failed gouging check")
+		}
+		cost := estimateCost(&wpt.staticPriceTable)
+		if balance := w.staticAccount.managedAvailableBalance(); balance.Cmp(cost) < 0 {
+			return fmt.Errorf("program cost %v exceeds the available balance %v", cost.HumanString(), balance.HumanString())
+		}
+		responses, limit, err = w.managedExecuteProgram(p, data, fcid, category, cost)
+		return err
+	}()
+	if retryErr != nil {
+		return nil, limit, errors.Compose(err, errors.AddContext(retryErr, "retry after price table refresh failed"))
+	}
+	return responses, limit, nil
+}
+
+// staticCheckDownloadGouging checks the price table for download gouging
+// using the worker's allowance.
+func (w *worker) staticCheckDownloadGouging(pt modules.RPCPriceTable) error {
+	return checkProjectDownloadGouging(pt, w.staticCache().staticRenterAllowance)
+}
+
 // staticNewStream returns a new stream to the worker's host
 func (w *worker) staticNewStream() (siamux.Stream, error) {
 	// If disrupt is called we sleep for the specified 'defaultNewStreamTimeout'
@@ -4,11 +4,15 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
+	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/crypto"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/siatest/dependencies"
 	"go.sia.tech/siad/types"
 )
 
@@ -201,3 +205,112 @@ func testExecuteProgramUsedBandwidthReadSector(t *testing.T, wt *workerTester) {
 	// log the bandwidth used
 	t.Logf("Used bandwidth (read sector program): %v down, %v up", limit.Downloaded(), limit.Uploaded())
 }
+
+// TestExecuteProgramWithRetry verifies that a program which the host rejects
+// due to an expired price table is retried once using a refreshed price table.
+func TestExecuteProgramWithRetry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// create a new worker tester with a host that expires price tables
+	deps := dependencies.NewDependencyHostExpirePriceTable()
+	wt, err := newWorkerTesterCustomDependency(t.Name(), modules.ProdDependencies, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := wt.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	w := wt.worker
+
+	// wait until the account is funded
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if w.staticAccount.managedAvailableBalance().IsZero() {
+			return errors.New("account not funded yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// allowForcedUpdate resets the time of the last forced price table update
+	// to allow forcing another one right away.
+	allowForcedUpdate := func() {
+		update := *w.staticPriceTable()
+		update.staticLastForcedUpdate = time.Time{}
+		w.staticSetPriceTable(&update)
+	}
+
+	// create a dummy program and keep track of the price tables its cost is
+	// estimated with
+	pt := w.staticPriceTable().staticPriceTable
+	pb := modules.NewProgramBuilder(&pt, 0)
+	pb.AddHasSectorInstruction(crypto.Hash{})
+	p, data := pb.Program()
+	var estimates []modules.UniqueID
+	var costs []types.Currency
+	estimateCost := func(pt *modules.RPCPriceTable) types.Currency {
+		pb := modules.NewProgramBuilder(pt, 0)
+		pb.AddHasSectorInstruction(crypto.Hash{})
+		cost, _, _ := pb.Cost(true)
+		ulBandwidth, dlBandwidth := hasSectorJobExpectedBandwidth(1)
+		cost = cost.Add(modules.MDMBandwidthCost(*pt, ulBandwidth, dlBandwidth))
+		estimates = append(estimates, pt.UID)
+		costs = append(costs, cost)
+		return cost
+	}
+	noGouging := func(modules.RPCPriceTable) error { return nil }
+
+	// the host rejects the first price table, the retry should succeed using
+	// the refreshed one
+	allowForcedUpdate()
+	uid := w.staticPriceTable().staticPriceTable.UID
+	spendingBefore := w.staticAccount.callSpendingDetails().downloads
+	deps.Fail()
+	responses, _, err := w.managedExecuteProgramWithRetry(p, data, types.FileContractID{}, categoryDownload, estimateCost, noGouging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Fatal("unexpected responses", responses)
+	}
+	if len(estimates) != 2 || estimates[0] != uid || estimates[1] == uid {
+		t.Fatal("expected the cost to be estimated with the old and the refreshed price table", estimates, uid)
+	}
+	if w.staticPriceTable().staticPriceTable.UID == uid {
+		t.Fatal("price table wasn't refreshed")
+	}
+	// only the retry should be tracked as spending
+	spent := w.staticAccount.callSpendingDetails().downloads.Sub(spendingBefore)
+	if !spent.Equals(costs[1]) {
+		t.Fatalf("expected %v to be spent but was %v", costs[1], spent)
+	}
+
+	// if the refreshed price table fails the gouging check, both errors are
+	// returned
+	allowForcedUpdate()
+	errGouging := errors.New("gouging")
+	deps.Fail()
+	_, _, err = w.managedExecuteProgramWithRetry(p, data, types.FileContractID{}, categoryDownload, estimateCost, func(modules.RPCPriceTable) error { return errGouging })
+	if !errors.Contains(err, errGouging) || !modules.IsPriceTableInvalidErr(err) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// if the price table can't be refreshed because an update was forced
+	// too recently, the program isn't retried
+	numEstimates := len(estimates)
+	deps.Fail()
+	_, _, err = w.managedExecuteProgramWithRetry(p, data, types.FileContractID{}, categoryDownload, estimateCost, noGouging)
+	if !errors.Contains(err, errPriceTableNotRefreshed) || !modules.IsPriceTableInvalidErr(err) {
+		t.Fatal("unexpected error", err)
+	}
+	if len(estimates) != numEstimates+1 {
+		t.Fatal("program was retried")
+	}
+}
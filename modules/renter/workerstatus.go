@@ -25,6 +25,7 @@ func (w *worker) callStatus() modules.WorkerStatus {
 	defer w.mu.Unlock()
 
 	uploadOnCoolDown, uploadCoolDownTime := w.onUploadCooldown()
+	uploadPacerRate, uploadThrottledTime := w.staticUploadPacer.callStatus()
 	var uploadCoolDownErr string
 	if w.uploadRecentFailureErr != nil {
 		uploadCoolDownErr = w.uploadRecentFailureErr.Error()
@@ -58,6 +59,8 @@ func (w *worker) callStatus() modules.WorkerStatus {
 		UploadOnCoolDown:    uploadOnCoolDown,
 		UploadQueueSize:     w.unprocessedChunks.Len(),
 		UploadTerminated:    w.uploadTerminated,
+		UploadPacerRate:     uploadPacerRate,
+		UploadThrottledTime: uploadThrottledTime,
 
 		// Job Queues
 		DownloadSnapshotJobQueueSize: int(w.staticJobDownloadSnapshotQueue.callStatus().size),
@@ -335,8 +335,9 @@ func TestWorkerHasSectorJobStatus(t *testing.T) {
 	current = atomic.LoadUint64(&w.staticLoopState.atomicReadDataOutstanding)
 	atomic.StoreUint64(&w.staticLoopState.atomicReadDataOutstanding, limit+1)
 
-	// add another job to the worker
-	jhs = w.newJobHasSector(context.Background(), hsRespChan, crypto.Hash{})
+	// add another job to the worker, use a different root to make sure the
+	// result isn't served from the piece availability cache
+	jhs = w.newJobHasSector(context.Background(), hsRespChan, crypto.Hash{1})
 	if !w.staticJobHasSectorQueue.callAdd(jhs) {
 		t.Fatal("Could not add job to queue")
 	}
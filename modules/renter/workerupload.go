@@ -140,11 +140,32 @@ func (w *worker) callQueueUploadChunk(uc *unfinishedUploadChunk) bool {
 }
 
 // managedHasUploadJob returns true if there is upload work available for the
-// worker.
+// worker and the upload pacers allow the worker to start an upload. If the
+// pacers require the worker to wait, the worker is woken once it can upload
+// again.
 func (w *worker) managedHasUploadJob() bool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.unprocessedChunks.Len() > 0
+	if w.unprocessedChunks.Len() == 0 {
+		return false
+	}
+	wait := w.staticUploadPacer.callWait()
+	if renterWait := w.renter.staticUploadPacer.callWait(); renterWait > wait {
+		wait = renterWait
+	}
+	if wait == 0 {
+		return true
+	}
+	if !w.uploadPacerWakeScheduled {
+		w.uploadPacerWakeScheduled = true
+		time.AfterFunc(wait, func() {
+			w.mu.Lock()
+			w.uploadPacerWakeScheduled = false
+			w.mu.Unlock()
+			w.staticWake()
+		})
+	}
+	return false
 }
 
 // managedPerformUploadChunkJob will perform some upload work.
@@ -180,7 +201,10 @@ func (w *worker) managedPerformUploadChunkJob() {
 	}
 	// Open an editing connection to the host.
 	e, err := w.renter.hostContractor.Editor(w.staticHostPubKey, w.renter.tg.StopChan())
-	if err != nil {
+	if isUploadThrottleErr(err) {
+		w.managedUploadThrottled(uc, pieceIndex, fmt.Errorf("Worker was throttled while acquiring an editor: %v", err))
+		return
+	} else if err != nil {
 		failureErr := fmt.Errorf("Worker failed to acquire an editor: %v", err)
 		w.managedUploadFailed(uc, pieceIndex, failureErr)
 		return
@@ -202,13 +226,18 @@ func (w *worker) managedPerformUploadChunkJob() {
 	}
 
 	// Perform the upload, and update the failure stats based on the success of
-	// the upload attempt.
+	// the upload attempt. Throttled uploads only affect the upload pacer.
 	//
 	// Ignore the error if it's a ErrMaxVirtualSectors coming from a pre-1.5.5
 	// host.
+	w.staticUploadPacer.callTake()
+	w.renter.staticUploadPacer.callTake()
 	root, err := e.Upload(uc.physicalChunkData[pieceIndex])
 	ignoreErr := build.VersionCmp(hostSettings.Version, "1.5.5") < 0 && err != nil && strings.Contains(err.Error(), modules.ErrMaxVirtualSectors.Error())
-	if err != nil && !ignoreErr {
+	if isUploadThrottleErr(err) {
+		w.managedUploadThrottled(uc, pieceIndex, fmt.Errorf("Worker was throttled while uploading via the editor: %v", err))
+		return
+	} else if err != nil && !ignoreErr {
 		failureErr := fmt.Errorf("Worker failed to upload root %v via the editor: %v", root, err)
 		w.managedUploadFailed(uc, pieceIndex, failureErr)
 		return
@@ -216,6 +245,11 @@ func (w *worker) managedPerformUploadChunkJob() {
 	w.mu.Lock()
 	w.uploadConsecutiveFailures = 0
 	w.mu.Unlock()
+	w.staticUploadPacer.callSuccess()
+
+	// The host has the sector now, make sure the piece availability cache
+	// doesn't report otherwise.
+	w.renter.staticPieceAvailabilityCache.callSet(w.staticHostPubKeyStr, root, true)
 
 	// Add piece to renterFile
 	err = uc.fileEntry.AddPiece(w.staticHostPubKey, uc.staticIndex, pieceIndex, root)
@@ -239,6 +273,7 @@ func (w *worker) managedPerformUploadChunkJob() {
 	uc.chunkSuccessProcessTimes = append(uc.chunkSuccessProcessTimes, time.Now())
 	uc.mu.Unlock()
 	uc.staticMemoryManager.Return(uint64(releaseSize))
+	w.renter.staticMetrics.callAddUploaded(uint64(releaseSize))
 	w.renter.managedCleanUpUploadChunk(uc)
 }
 
@@ -326,8 +361,25 @@ func (w *worker) managedUploadFailed(uc *unfinishedUploadChunk, pieceIndex uint6
 		w.uploadConsecutiveFailures++
 		w.mu.Unlock()
 	}
+	w.managedUnregisterUploadPiece(uc, pieceIndex)
 
-	// Unregister the piece from the chunk and hunt for a replacement.
+	// Because the worker is now on cooldown, drop all remaining chunks.
+	w.managedDropUploadChunks()
+}
+
+// managedUploadThrottled is called if the host throttled the upload of a piece
+// of an unfinished chunk. Unlike managedUploadFailed, it doesn't put the
+// worker on cooldown. Instead the worker's upload pacer backs off and the
+// worker keeps its remaining chunks.
+func (w *worker) managedUploadThrottled(uc *unfinishedUploadChunk, pieceIndex uint64, throttleErr error) {
+	w.renter.repairLog.Printf("Worker upload throttled. Worker: %v, Chunk: %v of %s, Error: %v", w.staticHostPubKey, uc.staticIndex, uc.staticSiaPath, throttleErr)
+	w.staticUploadPacer.callThrottled()
+	w.managedUnregisterUploadPiece(uc, pieceIndex)
+}
+
+// managedUnregisterUploadPiece unregisters a piece which the worker didn't
+// upload from the chunk, so that another worker can upload it.
+func (w *worker) managedUnregisterUploadPiece(uc *unfinishedUploadChunk, pieceIndex uint64) {
 	uc.mu.Lock()
 	uc.piecesRegistered--
 	uc.pieceUsage[pieceIndex] = false
@@ -337,7 +389,4 @@ func (w *worker) managedUploadFailed(uc *unfinishedUploadChunk, pieceIndex uint6
 	// Notify the standby workers of the chunk
 	uc.managedNotifyStandbyWorkers()
 	w.renter.managedCleanUpUploadChunk(uc)
-
-	// Because the worker is now on cooldown, drop all remaining chunks.
-	w.managedDropUploadChunks()
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"gitlab.com/NebulousLabs/errors"
+
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/siatest/dependencies"
 	"go.sia.tech/siad/types"
@@ -609,3 +611,84 @@ func TestProcessUploadChunk(t *testing.T) {
 		testProcessUploadChunkNotGoodForUpload(t, chunk)
 	})
 }
+
+// TestUploadThrottled tests that a throttled upload makes the worker's upload
+// pacer back off without counting as a failure.
+func TestUploadThrottled(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTesterCustomDependency(t.Name(), &dependencies.DependencyDisableWorker{}, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	pieces := 10
+	uuc := &unfinishedUploadChunk{
+		unusedHosts: map[string]struct{}{
+			wt.staticHostPubKey.String(): {},
+		},
+		staticPiecesNeeded:        pieces,
+		pieceUsage:                make([]bool, pieces),
+		released:                  true,
+		workersRemaining:          1,
+		physicalChunkData:         make([][]byte, pieces),
+		logicalChunkData:          make([][]byte, pieces),
+		staticAvailableChan:       make(chan struct{}),
+		staticUploadCompletedChan: make(chan struct{}),
+		staticMemoryNeeded:        uint64(pieces) * modules.SectorSize,
+		staticMemoryManager:       wt.renter.repairMemoryManager,
+	}
+	// The chunk returns the memory of the pieces it doesn't need anymore, so
+	// it has to be acquired first.
+	if !wt.renter.repairMemoryManager.Request(context.Background(), uuc.staticMemoryNeeded, memoryPriorityHigh) {
+		t.Fatal("failed to acquire memory for the chunk")
+	}
+	wt.mu.Lock()
+	wt.unprocessedChunks.PushBack(uuc)
+	wt.mu.Unlock()
+	nc, pieceIndex := wt.managedProcessUploadChunk(uuc)
+	if nc == nil {
+		t.Fatal("next chunk shouldn't be nil")
+	}
+
+	// Throttle the upload.
+	wt.managedUploadThrottled(nc, pieceIndex, errors.New("too many requests"))
+
+	// The worker shouldn't be on cooldown and should keep its queued chunks.
+	wt.mu.Lock()
+	failures := wt.uploadConsecutiveFailures
+	onCooldown, _ := wt.onUploadCooldown()
+	queued := wt.unprocessedChunks.Len()
+	wt.mu.Unlock()
+	if failures != 0 || onCooldown {
+		t.Fatalf("throttled upload counted as failure: %v failures, on cooldown %v", failures, onCooldown)
+	}
+	if queued != 1 {
+		t.Fatalf("expected 1 queued chunk, got %v", queued)
+	}
+	// The piece should be available to other workers again.
+	uuc.mu.Lock()
+	registered := uuc.piecesRegistered
+	uuc.mu.Unlock()
+	if registered != 0 {
+		t.Fatalf("expected 0 registered pieces, got %v", registered)
+	}
+	// The pacer should back off and the status should report it.
+	if _, throttled := wt.staticUploadPacer.callStatus(); throttled <= 0 {
+		t.Fatal("upload pacer isn't backing off")
+	}
+	if wt.managedHasUploadJob() {
+		t.Fatal("worker shouldn't upload while backing off")
+	}
+	if status := wt.callStatus(); status.UploadThrottledTime <= 0 || status.UploadPacerRate != uploadPacerInitialHostRate {
+		t.Fatalf("unexpected status %v %v", status.UploadThrottledTime, status.UploadPacerRate)
+	}
+}
@@ -174,6 +174,11 @@ type RPCPriceTable struct {
 	// Registry related fields.
 	RegistryEntriesLeft  uint64 `json:"registryentriesleft"`
 	RegistryEntriesTotal uint64 `json:"registryentriestotal"`
+
+	// SupportedInstructions lists the specifiers of the MDM instructions the
+	// host supports. If it is empty, the host is assumed to support all
+	// instructions.
+	SupportedInstructions []types.Specifier `json:"supportedinstructions,omitempty"`
 }
 
 var (
@@ -23,6 +23,9 @@ var (
 	ErrInvalidSiaPath = errors.New("invalid SiaPath")
 	// ErrInvalidPathString is the error for an invalid path
 	ErrInvalidPathString = errors.New("invalid path string")
+	// ErrPathOutsideBase is the error for a path which is not within the base
+	// it is supposed to be relative to
+	ErrPathOutsideBase = errors.New("path is not within base")
 
 	// SiaDirExtension is the extension for siadir metadata files on disk
 	SiaDirExtension = ".siadir"
@@ -117,6 +120,42 @@ func newSiaPath(s string) (SiaPath, error) {
 	return sp, sp.Validate(false)
 }
 
+// SiaPathFromLocal returns the SiaPath of the local file or directory at full
+// when the local directory base is mapped to prefix. e.g. the local path
+// '/home/me/photos/2020/a.jpg' with base '/home/me/photos' and prefix 'backup'
+// results in 'backup/2020/a.jpg'. Paths which are not within base are
+// rejected.
+func SiaPathFromLocal(base, full string, prefix SiaPath) (SiaPath, error) {
+	rel, err := filepath.Rel(base, full)
+	if err != nil {
+		return SiaPath{}, errors.Compose(err, ErrPathOutsideBase)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return SiaPath{}, errors.AddContext(ErrPathOutsideBase, fmt.Sprintf("%v is not within %v", full, base))
+	}
+	if rel == "." {
+		return prefix, nil
+	}
+	return prefix.Join(rel)
+}
+
+// LocalPathFromSiaPath is the inverse of SiaPathFromLocal. It returns the local
+// path of the file or directory at sp when prefix is mapped to the local
+// directory base. SiaPaths which are not within prefix are rejected.
+func LocalPathFromSiaPath(base string, sp, prefix SiaPath) (string, error) {
+	var rel string
+	switch {
+	case sp.Equals(prefix):
+	case prefix.IsRoot():
+		rel = sp.Path
+	case strings.HasPrefix(sp.Path, prefix.Path+"/"):
+		rel = strings.TrimPrefix(sp.Path, prefix.Path+"/")
+	default:
+		return "", errors.AddContext(ErrPathOutsideBase, fmt.Sprintf("%v is not within %v", sp, prefix))
+	}
+	return filepath.Join(base, filepath.FromSlash(rel)), nil
+}
+
 // AddSuffix adds a numeric suffix to the end of the SiaPath.
 func (sp SiaPath) AddSuffix(suffix uint) SiaPath {
 	return SiaPath{
@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"path/filepath"
 	"runtime"
 	"testing"
 
@@ -253,6 +254,68 @@ func TestSiapathRebase(t *testing.T) {
 	}
 }
 
+// TestSiaPathFromLocal tests converting between local paths and SiaPaths.
+func TestSiaPathFromLocal(t *testing.T) {
+	base := filepath.Join(string(filepath.Separator), "home", "me", "photos")
+	var tests = []struct {
+		full    string
+		prefix  string
+		siaPath string
+	}{
+		{filepath.Join(base, "a.jpg"), "", "a.jpg"},                           // root prefix
+		{filepath.Join(base, "2020", "a.jpg"), "backup", "backup/2020/a.jpg"}, // nested file
+		{filepath.Join(base, "2020"), "backup/photos", "backup/photos/2020"},  // dir
+		{base, "backup", "backup"},                                            // base itself
+	}
+	for _, test := range tests {
+		prefix := RootSiaPath()
+		if test.prefix != "" {
+			var err error
+			prefix, err = NewSiaPath(test.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		sp, err := SiaPathFromLocal(base, test.full, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sp.String() != test.siaPath {
+			t.Fatalf("expected %v, got %v", test.siaPath, sp)
+		}
+		// Convert it back.
+		local, err := LocalPathFromSiaPath(base, sp, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if local != filepath.Clean(test.full) {
+			t.Fatalf("expected %v, got %v", filepath.Clean(test.full), local)
+		}
+	}
+
+	// Paths outside of base are rejected.
+	for _, full := range []string{filepath.Dir(base), filepath.Join(base, "..", "videos", "a.mp4")} {
+		if _, err := SiaPathFromLocal(base, full, RootSiaPath()); !errors.Contains(err, ErrPathOutsideBase) {
+			t.Fatalf("%v: expected ErrPathOutsideBase, got %v", full, err)
+		}
+	}
+	// SiaPaths outside of the prefix are rejected. That includes siblings
+	// which share a common string prefix with it.
+	prefix, err := NewSiaPath("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"other/a.jpg", "backups/a.jpg"} {
+		sp, err := NewSiaPath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LocalPathFromSiaPath(base, sp, prefix); !errors.Contains(err, ErrPathOutsideBase) {
+			t.Fatalf("%v: expected ErrPathOutsideBase, got %v", s, err)
+		}
+	}
+}
+
 // TestSiapathDir probes the Dir function for SiaPaths.
 func TestSiapathDir(t *testing.T) {
 	var pathtests = []struct {
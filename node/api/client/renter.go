@@ -413,6 +413,25 @@ func (c *Client) RenterDownloadsRootGet() (rdq api.RenterDownloadQueue, err erro
 	return
 }
 
+// RenterDownloadDiscardGet uses the /renter/download endpoint to download a
+// file and discard its data. This verifies that the file can be recovered
+// without storing it.
+func (c *Client) RenterDownloadDiscardGet(siaPath modules.SiaPath, offset, length uint64, async, disableLocalFetch, root bool) (modules.DownloadID, error) {
+	sp := escapeSiaPath(siaPath)
+	values := url.Values{}
+	values.Set("discard", fmt.Sprint(true))
+	values.Set("disablelocalfetch", fmt.Sprint(disableLocalFetch))
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("length", fmt.Sprint(length))
+	values.Set("async", fmt.Sprint(async))
+	values.Set("root", fmt.Sprint(root))
+	h, _, err := c.getRawResponse(fmt.Sprintf("/renter/download/%s?%s", sp, values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	return modules.DownloadID(h.Get("ID")), nil
+}
+
 // RenterDownloadHTTPResponseGet uses the /renter/download endpoint to download
 // a file and return its data.
 func (c *Client) RenterDownloadHTTPResponseGet(siaPath modules.SiaPath, offset, length uint64, disableLocalFetch, root bool) (modules.DownloadID, []byte, error) {
@@ -525,6 +544,17 @@ func (c *Client) RenterSetCheckIPViolationPost(enabled bool) (err error) {
 	return
 }
 
+// RenterSetDownloadConcurrencyPost uses the /renter endpoint to change the
+// renter's download overdrive and download concurrency limits.
+func (c *Client) RenterSetDownloadConcurrencyPost(overdrive, maxChunks, maxWorkersPerChunk int) (err error) {
+	values := url.Values{}
+	values.Set("downloadoverdrive", fmt.Sprint(overdrive))
+	values.Set("maxconcurrentdownloadchunks", fmt.Sprint(maxChunks))
+	values.Set("maxdownloadworkersperchunk", fmt.Sprint(maxWorkersPerChunk))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
 // RenterStreamGet uses the /renter/stream endpoint to download data as a
 // stream.
 func (c *Client) RenterStreamGet(siaPath modules.SiaPath, disableLocalFetch, root bool) (resp []byte, err error) {
@@ -547,6 +577,17 @@ func (c *Client) RenterStreamPartialGet(siaPath modules.SiaPath, start, end uint
 	return
 }
 
+// RenterRangeGet uses the /renter/range endpoint to download the range
+// [start;end) of a file.
+func (c *Client) RenterRangeGet(siaPath modules.SiaPath, start, end uint64, disableLocalFetch, root bool) (resp []byte, err error) {
+	values := url.Values{}
+	values.Set("disablelocalfetch", fmt.Sprint(disableLocalFetch))
+	values.Set("root", fmt.Sprint(root))
+	sp := escapeSiaPath(siaPath)
+	resp, err = c.getRawPartialResponse(fmt.Sprintf("/renter/range/%s?%s", sp, values.Encode()), start, end)
+	return
+}
+
 // RenterSetRepairPathPost uses the /renter/tracking endpoint to set the repair
 // path of a file to a new location. The file at newPath must exists.
 func (c *Client) RenterSetRepairPathPost(siaPath modules.SiaPath, newPath string) (err error) {
@@ -661,6 +702,20 @@ func (c *Client) RenterDirRenamePost(siaPath, newSiaPath modules.SiaPath) (err e
 	return
 }
 
+// RenterDirSetUploadDefaultsPost uses the /renter/dir/ endpoint to set the
+// upload defaults of a directory.
+func (c *Client) RenterDirSetUploadDefaultsPost(siaPath modules.SiaPath, defaults modules.DirUploadDefaults) (err error) {
+	sp := escapeSiaPath(siaPath)
+	values := url.Values{}
+	values.Set("action", "setuploaddefaults")
+	values.Set("datapieces", strconv.Itoa(defaults.DataPieces))
+	values.Set("paritypieces", strconv.Itoa(defaults.ParityPieces))
+	values.Set("repairthreshold", strconv.FormatFloat(defaults.RepairThreshold, 'f', -1, 64))
+	values.Set("conflictmode", string(defaults.ConflictMode))
+	err = c.post(fmt.Sprintf("/renter/dir/%s", sp), values.Encode(), nil)
+	return
+}
+
 // RenterDirRootGet uses the /renter/dir/ endpoint to query a directory,
 // starting from the root path.
 func (c *Client) RenterDirRootGet(siaPath modules.SiaPath) (rd api.RenterDirectory, err error) {
@@ -782,3 +837,40 @@ func (c *Client) RenterFileHosts(siaPath modules.SiaPath) (hosts []modules.HostD
 	err = c.get("/renter/hosts/"+sp, &hosts)
 	return
 }
+
+// RenterFileLayoutGet requests the /renter/layout/*siapath endpoint to get the
+// layout of a file.
+func (c *Client) RenterFileLayoutGet(siaPath modules.SiaPath) (fl modules.FileLayout, err error) {
+	sp := escapeSiaPath(siaPath)
+	err = c.get("/renter/layout/"+sp, &fl)
+	return
+}
+
+// RenterMetricsGet requests the /renter/metrics endpoint to get the renter's
+// upload and download throughput counters.
+func (c *Client) RenterMetricsGet() (rm modules.RenterMetrics, err error) {
+	err = c.get("/renter/metrics", &rm)
+	return
+}
+
+// RenterFileManifestGet requests the /renter/manifest/*siapath endpoint to get
+// the checksum manifest of a file.
+func (c *Client) RenterFileManifestGet(siaPath modules.SiaPath, stream bool) (fm modules.FileManifest, err error) {
+	sp := escapeSiaPath(siaPath)
+	values := url.Values{}
+	values.Set("stream", strconv.FormatBool(stream))
+	err = c.get(fmt.Sprintf("/renter/manifest/%s?%s", sp, values.Encode()), &fm)
+	return
+}
+
+// RenterFileManifestSHA256SumsGet requests the /renter/manifest/*siapath
+// endpoint to get the checksum manifest of a file in the sha256sum compatible
+// text form.
+func (c *Client) RenterFileManifestSHA256SumsGet(siaPath modules.SiaPath, stream bool) (string, error) {
+	sp := escapeSiaPath(siaPath)
+	values := url.Values{}
+	values.Set("stream", strconv.FormatBool(stream))
+	values.Set("format", "sha256sum")
+	_, b, err := c.getRawResponse(fmt.Sprintf("/renter/manifest/%s?%s", sp, values.Encode()))
+	return string(b), err
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -258,6 +259,17 @@ type (
 		StartTime            time.Time `json:"starttime"`            // The time when the download was started.
 		StartTimeUnix        int64     `json:"starttimeunix"`        // The time when the download was started in unix format.
 		TotalDataTransferred uint64    `json:"totaldatatransferred"` // The total amount of data transferred, including negotiation, overdrive etc.
+
+		ErrorCategory modules.DownloadErrorCategory `json:"errorcategory"` // The machine readable category of Error.
+
+		Provenance *modules.DownloadProvenance `json:"provenance,omitempty"` // Which hosts served the pieces used to recover the data.
+	}
+
+	// DownloadError is the error response of a failed download. In addition
+	// to the message it contains the machine readable category of the error.
+	DownloadError struct {
+		Error
+		Category modules.DownloadErrorCategory `json:"category"`
 	}
 )
 
@@ -959,6 +971,32 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		settings.IPViolationCheck = ipviolationcheck
 	}
 
+	// Scan the download concurrency settings. (optional parameters)
+	if o := req.FormValue("downloadoverdrive"); o != "" {
+		var overdrive int
+		if _, err := fmt.Sscan(o, &overdrive); err != nil {
+			WriteError(w, Error{"unable to parse downloadoverdrive: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.DownloadOverdrive = overdrive
+	}
+	if c := req.FormValue("maxconcurrentdownloadchunks"); c != "" {
+		var maxChunks int
+		if _, err := fmt.Sscan(c, &maxChunks); err != nil {
+			WriteError(w, Error{"unable to parse maxconcurrentdownloadchunks: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.MaxConcurrentDownloadChunks = maxChunks
+	}
+	if mw := req.FormValue("maxdownloadworkersperchunk"); mw != "" {
+		var maxWorkers int
+		if _, err := fmt.Sscan(mw, &maxWorkers); err != nil {
+			WriteError(w, Error{"unable to parse maxdownloadworkersperchunk: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.MaxDownloadWorkersPerChunk = maxWorkers
+	}
+
 	// Set the settings in the renter.
 	err = api.renter.SetSettings(settings)
 	if err != nil {
@@ -1301,6 +1339,8 @@ func (api *API) renterDownloadsHandler(w http.ResponseWriter, req *http.Request,
 			StartTime:            di.StartTime,
 			StartTimeUnix:        di.StartTimeUnix,
 			TotalDataTransferred: di.TotalDataTransferred,
+
+			ErrorCategory: di.ErrorCategory,
 		})
 	}
 	WriteJSON(w, RenterDownloadQueue{
@@ -1337,6 +1377,9 @@ func (api *API) renterDownloadByUIDHandlerGET(w http.ResponseWriter, _ *http.Req
 		StartTime:            di.StartTime,
 		StartTimeUnix:        di.StartTimeUnix,
 		TotalDataTransferred: di.TotalDataTransferred,
+
+		ErrorCategory: di.ErrorCategory,
+		Provenance:    di.Provenance,
 	})
 }
 
@@ -1519,6 +1562,107 @@ func (api *API) renterFileHandlerGET(w http.ResponseWriter, req *http.Request, p
 	})
 }
 
+// renterFileLayoutHandlerGET handles the API call to get the layout of a file
+// which maps the file's chunks to the pieces and sectors storing them.
+func (api *API) renterFileLayoutHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siaPath, err := modules.NewSiaPath(ps.ByName("siapath"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	root, err := isCalledWithRootFlag(req)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if !root {
+		siaPath, err = rebaseInputSiaPath(siaPath)
+		if err != nil {
+			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	fl, err := api.renter.FileLayout(siaPath)
+	if errors.Contains(err, renter.ErrLayoutPartialChunks) {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, fl)
+}
+
+// renterMetricsHandlerGET handles the API call to get the renter's upload and
+// download throughput counters.
+func (api *API) renterMetricsHandlerGET(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	metrics, err := api.renter.Metrics()
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, metrics)
+}
+
+// renterFileManifestHandlerGET handles the API call to get the checksum
+// manifest of a file. The manifest is returned as JSON unless the 'format'
+// parameter is set to 'sha256sum', in which case it is returned as text that
+// can be verified with 'sha256sum --check'.
+func (api *API) renterFileManifestHandlerGET(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siaPath, err := modules.NewSiaPath(ps.ByName("siapath"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	root, err := isCalledWithRootFlag(req)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if !root {
+		siaPath, err = rebaseInputSiaPath(siaPath)
+		if err != nil {
+			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	// Streaming the file is expensive so it has to be requested explicitly.
+	var stream bool
+	if streamStr := req.FormValue("stream"); streamStr != "" {
+		stream, err = scanBool(streamStr)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'stream' arg: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	format := req.FormValue("format")
+	if format != "" && format != "json" && format != "sha256sum" {
+		WriteError(w, Error{"invalid 'format' arg, must be 'json' or 'sha256sum'"}, http.StatusBadRequest)
+		return
+	}
+
+	fm, err := api.renter.FileManifest(siaPath, stream)
+	if errors.Contains(err, renter.ErrManifestRequiresStream) {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if errors.Contains(err, renter.ErrManifestMissingChunks) {
+		WriteError(w, Error{err.Error()}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if format == "sha256sum" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(fm.SHA256Sums()))
+		return
+	}
+	WriteJSON(w, fm)
+}
+
 // renterFileHandler handles POST requests to the /renter/file/:siapath API endpoint.
 func (api *API) renterFileHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	newTrackingPath := req.FormValue("trackingpath")
@@ -1762,14 +1906,14 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 		id, start, err = api.renter.Download(params)
 	}
 	if err != nil {
-		WriteError(w, Error{"download creation failed: " + err.Error()}, http.StatusInternalServerError)
+		writeDownloadError(w, "download creation failed: ", err)
 		return
 	}
 	// Set ID before starting download.
 	w.Header().Set("ID", string(id))
 	// Start download.
 	if err := start(); err != nil {
-		WriteError(w, Error{"download failed: " + err.Error()}, http.StatusInternalServerError)
+		writeDownloadError(w, "download failed: ", err)
 		return
 	}
 	if params.Httpwriter == nil {
@@ -1781,6 +1925,38 @@ func (api *API) renterDownloadHandler(w http.ResponseWriter, req *http.Request,
 	}
 }
 
+// downloadErrorStatus returns the http status code of a download error's
+// category.
+func downloadErrorStatus(category modules.DownloadErrorCategory) int {
+	switch category {
+	case modules.DownloadErrorCategoryFileNotFound:
+		return http.StatusNotFound
+	case modules.DownloadErrorCategoryInsufficientHosts, modules.DownloadErrorCategoryInsufficientRedundancy:
+		return http.StatusServiceUnavailable
+	case modules.DownloadErrorCategoryCancelled:
+		return http.StatusConflict
+	case modules.DownloadErrorCategoryBudgetExhausted:
+		return http.StatusPaymentRequired
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeDownloadError writes the error of a failed download together with its
+// category. The status code is determined by the category.
+func writeDownloadError(w http.ResponseWriter, prefix string, err error) {
+	category := modules.ClassifyDownloadError(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(downloadErrorStatus(category))
+	encodingErr := json.NewEncoder(w).Encode(DownloadError{
+		Error:    Error{prefix + err.Error()},
+		Category: category,
+	})
+	if _, isJsonErr := encodingErr.(*json.SyntaxError); isJsonErr {
+		build.Critical("failed to encode API error response:", encodingErr)
+	}
+}
+
 // renterDownloadAsyncHandler handles the API call to download a file asynchronously.
 func (api *API) renterDownloadAsyncHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	req.ParseForm()
@@ -1813,6 +1989,10 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 	// disk if available.
 	disablelocalfetchparam := req.FormValue("disablelocalfetch")
 
+	// discardparam determines whether the downloaded data is discarded after
+	// it was recovered.
+	discardparam := req.FormValue("discard")
+
 	// Parse the offset and length parameters.
 	var offset, length uint64
 	if len(offsetparam) > 0 {
@@ -1867,9 +2047,21 @@ func parseDownloadParameters(w http.ResponseWriter, req *http.Request, ps httpro
 		}
 	}
 
+	var discard bool
+	if discardparam != "" {
+		discard, err = scanBool(discardparam)
+		if err != nil {
+			return modules.RenterDownloadParameters{}, errors.AddContext(err, "error parsing the discard flag")
+		}
+	}
+	if discard && disablelocalfetchparam != "" && !disableLocalFetch {
+		return modules.RenterDownloadParameters{}, errors.New("discarded downloads can't be fetched from disk")
+	}
+
 	dp := modules.RenterDownloadParameters{
 		Destination:      destination,
 		DisableDiskFetch: disableLocalFetch,
+		Discard:          discard,
 		Async:            async,
 		Length:           length,
 		Offset:           offset,
@@ -1914,8 +2106,7 @@ func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps
 	}
 	fileName, streamer, err := api.renter.Streamer(siaPath, disableLocalFetch)
 	if err != nil {
-		WriteError(w, Error{fmt.Sprintf("failed to create download streamer: %v", err)},
-			http.StatusInternalServerError)
+		writeDownloadError(w, "failed to create download streamer: ", err)
 		return
 	}
 	defer func() {
@@ -1924,6 +2115,36 @@ func (api *API) renterStreamHandler(w http.ResponseWriter, req *http.Request, ps
 	http.ServeContent(w, req, fileName, time.Time{}, streamer)
 }
 
+// renterRangeHandler handles downloads from the /renter/range endpoint. The
+// request is served by the renter's range server which honors the Range
+// header.
+func (api *API) renterRangeHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	siaPath, err := modules.NewSiaPath(ps.ByName("siapath"))
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	root, err := scanBool(req.FormValue("root"))
+	if err != nil {
+		err = errors.AddContext(err, "error parsing the root flag")
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if !root {
+		siaPath, err = rebaseInputSiaPath(siaPath)
+		if err != nil {
+			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	// The range server expects the siapath as the path of the request.
+	rangeReq := req.WithContext(req.Context())
+	rangeURL := *req.URL
+	rangeURL.Path = "/" + siaPath.String()
+	rangeReq.URL = &rangeURL
+	renter.NewRangeServer(api.renter).ServeHTTP(w, rangeReq)
+}
+
 // renterUploadHandler handles the API call to upload a file.
 func (api *API) renterUploadHandler(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Get the source path.
@@ -1993,8 +2214,13 @@ func (api *API) renterUploadReadyHandler(w http.ResponseWriter, req *http.Reques
 	}
 	// Check if we need to set to defaults
 	if dataPieces == 0 && parityPieces == 0 {
-		dataPieces = modules.RenterDefaultDataPieces
-		parityPieces = modules.RenterDefaultParityPieces
+		ec, err := api.renter.DefaultErasureCode()
+		if err != nil {
+			WriteError(w, Error{"failed to get the default erasure code: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		dataPieces = ec.MinPieces()
+		parityPieces = ec.NumPieces() - ec.MinPieces()
 	}
 	contractsNeeded := dataPieces + parityPieces
 
@@ -2193,7 +2419,8 @@ func (api *API) renterDirHandlerGET(w http.ResponseWriter, req *http.Request, ps
 }
 
 // renterDirHandlerPOST handles POST requests to /renter/dir/:siapath?action=<>
-// in order to create, delete, and rename a directory
+// in order to create, delete, and rename a directory and to set its upload
+// defaults
 func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 	// Parse action
 	action := req.FormValue("action")
@@ -2270,6 +2497,42 @@ func (api *API) renterDirHandlerPOST(w http.ResponseWriter, req *http.Request, p
 		WriteSuccess(w)
 		return
 	}
+	if action == "setuploaddefaults" {
+		var defaults modules.DirUploadDefaults
+		if dp := req.FormValue("datapieces"); dp != "" {
+			defaults.DataPieces, err = strconv.Atoi(dp)
+			if err != nil {
+				WriteError(w, Error{"unable to parse datapieces: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		if pp := req.FormValue("paritypieces"); pp != "" {
+			defaults.ParityPieces, err = strconv.Atoi(pp)
+			if err != nil {
+				WriteError(w, Error{"unable to parse paritypieces: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		if rt := req.FormValue("repairthreshold"); rt != "" {
+			defaults.RepairThreshold, err = strconv.ParseFloat(rt, 64)
+			if err != nil {
+				WriteError(w, Error{"unable to parse repairthreshold: " + err.Error()}, http.StatusBadRequest)
+				return
+			}
+		}
+		defaults.ConflictMode = modules.UploadConflictMode(req.FormValue("conflictmode"))
+		if err := defaults.Validate(); err != nil {
+			WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+			return
+		}
+		err = api.renter.SetDirUploadDefaults(siaPath, defaults)
+		if err != nil {
+			WriteError(w, Error{"failed to set upload defaults: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		WriteSuccess(w)
+		return
+	}
 
 	// Report that no calls were made
 	WriteError(w, Error{"no calls were made, please check your submission and try again"}, http.StatusInternalServerError)
@@ -2,9 +2,12 @@ package api
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -18,6 +21,7 @@ import (
 
 	"go.sia.tech/siad/build"
 	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/modules/renter"
 	"go.sia.tech/siad/modules/renter/contractor"
 	"go.sia.tech/siad/modules/renter/filesystem"
 	"go.sia.tech/siad/modules/renter/filesystem/siafile"
@@ -816,6 +820,100 @@ func TestRenterHandlerGetAndPost(t *testing.T) {
 	if err == nil {
 		t.Errorf("expected error to be 'download/upload rate limit...'; got %v", err)
 	}
+
+	// Set the download concurrency settings.
+	concurrencyValues := url.Values{}
+	concurrencyValues.Set("downloadoverdrive", "5")
+	concurrencyValues.Set("maxconcurrentdownloadchunks", "4")
+	concurrencyValues.Set("maxdownloadworkersperchunk", "8")
+	if err = st.stdPostAPI("/renter", concurrencyValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.getAPI("/renter", &get); err != nil {
+		t.Fatal(err)
+	}
+	if get.Settings.DownloadOverdrive != 5 || get.Settings.MaxConcurrentDownloadChunks != 4 || get.Settings.MaxDownloadWorkersPerChunk != 8 {
+		t.Fatalf("download concurrency settings weren't set: %+v", get.Settings)
+	}
+	// Try to set an out of bounds overdrive.
+	concurrencyValues.Set("downloadoverdrive", "-1")
+	if err = st.stdPostAPI("/renter", concurrencyValues); err == nil {
+		t.Error("expected negative download overdrive to fail")
+	}
+}
+
+// TestRenterUploadReadyDefaultErasureCode checks that /renter/uploadready uses
+// the renter's configured default erasure code if no erasure code is given.
+func TestRenterUploadReadyDefaultErasureCode(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, err := createServerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.panicClose()
+
+	if err := st.renter.SetDefaultErasureCode(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	var rur RenterUploadReadyGet
+	if err := st.getAPI("/renter/uploadready", &rur); err != nil {
+		t.Fatal(err)
+	}
+	if rur.DataPieces != 2 || rur.ParityPieces != 3 || rur.ContractsNeeded != 5 {
+		t.Fatalf("default erasure code wasn't used: %+v", rur)
+	}
+
+	// Explicit parameters take precedence.
+	if err := st.getAPI("/renter/uploadready?datapieces=4&paritypieces=6", &rur); err != nil {
+		t.Fatal(err)
+	}
+	if rur.DataPieces != 4 || rur.ParityPieces != 6 || rur.ContractsNeeded != 10 {
+		t.Fatalf("explicit erasure code wasn't used: %+v", rur)
+	}
+}
+
+// TestRenterFileManifest checks that the /renter/manifest endpoint only
+// streams a file if that is requested explicitly.
+func TestRenterFileManifest(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	st, path := setupTestDownload(t, 1024, "test.dat", true)
+	defer st.server.panicClose()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without stream the manifest isn't computed.
+	resp, err := HttpGET("http://" + st.server.listener.Addr().String() + "/renter/manifest/test.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiErr := decodeError(resp)
+	if err := resp.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("unexpected status", resp.StatusCode)
+	}
+	if apiErr == nil || apiErr.Error() != renter.ErrManifestRequiresStream.Error() {
+		t.Fatal("expected ErrManifestRequiresStream, got", apiErr)
+	}
+
+	// With stream the manifest contains the hash of the file.
+	var fm modules.FileManifest
+	if err := st.getAPI("/renter/manifest/test.dat?stream=true", &fm); err != nil {
+		t.Fatal(err)
+	}
+	fileHash := sha256.Sum256(data)
+	if fm.Filesize != uint64(len(data)) || fm.SHA256 != hex.EncodeToString(fileHash[:]) {
+		t.Fatalf("unexpected manifest %+v", fm)
+	}
 }
 
 // TestRenterLoadNonexistent checks that attempting to upload or download a
@@ -868,6 +966,12 @@ func TestRenterLoadNonexistent(t *testing.T) {
 		t.Error("should not be able to download non-existent file")
 	}
 
+	// Discarded downloads can't be fetched from disk.
+	err = st.stdGetAPI("/renter/download/dne?discard=true&disablelocalfetch=false")
+	if err == nil || !strings.Contains(err.Error(), "can't be fetched from disk") {
+		t.Error("expected discarded download with local fetch to fail, got", err)
+	}
+
 	// The renter's downloads queue should be empty.
 	var queue RenterDownloadQueue
 	if err = st.getAPI("/renter/downloads", &queue); err != nil {
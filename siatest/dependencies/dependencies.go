@@ -341,6 +341,12 @@ func NewDependencyHostBlockRPC() *DependencyWithDisableAndEnable {
 	return newDependencywithDisableAndEnable("HostBlockRPC")
 }
 
+// NewDependencyHostExpirePriceTable creates a dependency, that causes the host
+// to act as if the next price table it looks up has expired.
+func NewDependencyHostExpirePriceTable() *DependencyInterruptOnceOnKeyword {
+	return newDependencyInterruptOnceOnKeyword("HostExpirePriceTable")
+}
+
 // NewDependencyHostLosePriceTable creates a dependency, that causes
 // the host to act is if it can not find a price table for given UID.
 func NewDependencyHostLosePriceTable() *DependencyWithDisableAndEnable {
@@ -40,6 +40,18 @@ func (d *DependencyDisableRepairAndHealthLoops) Disrupt(s string) bool {
 	return s == "DisableRepairAndHealthLoops"
 }
 
+// DependencyDisableBubbleBatching makes the renter write the bubbled metadata
+// of a directory to disk right away instead of batching it with the metadata
+// of other directories. It also disables the repair and health loops.
+type DependencyDisableBubbleBatching struct {
+	modules.ProductionDependencies
+}
+
+// Disrupt will disable bubble batching and the repair and health loops.
+func (d *DependencyDisableBubbleBatching) Disrupt(s string) bool {
+	return s == "DisableRepairAndHealthLoops" || s == "DisableBubbleBatching"
+}
+
 // DependencyDisableRepairAndHealthLoopsMulti prevents the background loops for
 // repairs and updating directory metadata from running in multiple places. This
 // includes threadedUploadAndRepair, threadedStuckLoop, and
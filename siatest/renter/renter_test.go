@@ -5769,3 +5769,139 @@ func TestRenterFileHosts(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestRenterMetrics tests that the renter's metrics reflect uploads and
+// downloads.
+func TestRenterMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	params := siatest.GroupParams{
+		Hosts:   3,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), params)
+	if err != nil {
+		t.Fatal("failed to create group:", err)
+	}
+	t.Cleanup(func() { tg.Close() })
+	renter := tg.Renters()[0]
+
+	// Upload a file.
+	fileSize := int(10 * modules.SectorSize)
+	_, rf, err := renter.UploadNewFileBlocking(fileSize, 1, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		rm, err := renter.Client.RenterMetricsGet()
+		if err != nil {
+			return err
+		}
+		if rm.TotalBytesUploaded < uint64(fileSize) {
+			return fmt.Errorf("expected at least %v bytes uploaded, got %v", fileSize, rm.TotalBytesUploaded)
+		}
+		if rm.ActiveUploads != 0 {
+			return fmt.Errorf("expected 0 active uploads, got %v", rm.ActiveUploads)
+		}
+		if rm.UploadBandwidthBps <= 0 {
+			return errors.New("expected upload bandwidth to be positive")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the file.
+	if _, _, err := renter.DownloadByStream(rf); err != nil {
+		t.Fatal(err)
+	}
+	rm, err := renter.Client.RenterMetricsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.TotalBytesDownloaded < uint64(fileSize) {
+		t.Fatalf("expected at least %v bytes downloaded, got %v", fileSize, rm.TotalBytesDownloaded)
+	}
+	if rm.ActiveDownloads != 0 {
+		t.Fatalf("expected 0 active downloads, got %v", rm.ActiveDownloads)
+	}
+}
+
+// TestDownloadProvenance tests that the provenance of a download names the
+// hosts which actually served the pieces used for recovery.
+func TestDownloadProvenance(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	params := siatest.GroupParams{
+		Hosts:   2,
+		Renters: 1,
+		Miners:  1,
+	}
+	tg, err := siatest.NewGroupFromTemplate(renterTestDir(t.Name()), params)
+	if err != nil {
+		t.Fatal("failed to create group:", err)
+	}
+	t.Cleanup(func() { tg.Close() })
+	renter := tg.Renters()[0]
+
+	// Upload a file with one piece per chunk on each host.
+	_, rf, err := renter.UploadNewFileBlocking(int(2*modules.SectorSize), 1, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Take one of the hosts offline. The download needs to fail over to the
+	// other one.
+	hosts := tg.Hosts()
+	offlineHost, err := hosts[0].HostPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	onlineHost, err := hosts[1].HostPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tg.RemoveNode(hosts[0]); err != nil {
+		t.Fatal(err)
+	}
+	uid, _, err := renter.DownloadToDisk(rf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every chunk should have been recovered from the piece of the online
+	// host.
+	di, err := renter.RenterDownloadInfoGet(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := di.Provenance
+	if p == nil || len(p.Chunks) == 0 {
+		t.Fatalf("download has no provenance: %+v", p)
+	}
+	if len(p.Hosts) != 1 || !p.Hosts[0].Equals(onlineHost) {
+		t.Fatalf("expected provenance to only contain host %v but got %v", onlineHost, p.Hosts)
+	}
+	for _, chunk := range p.Chunks {
+		if len(chunk.Pieces) != 1 {
+			t.Fatalf("expected chunk %v to be recovered from 1 piece but got %v", chunk.ChunkIndex, len(chunk.Pieces))
+		}
+		piece := chunk.Pieces[0]
+		if piece.HostIndex != 0 || !piece.ProofVerified || piece.FetchTime.IsZero() || piece.SectorRoot == (crypto.Hash{}) {
+			t.Fatalf("unexpected piece provenance for chunk %v: %+v", chunk.ChunkIndex, piece)
+		}
+	}
+	for _, host := range p.Hosts {
+		if host.Equals(offlineHost) {
+			t.Fatal("provenance contains the offline host")
+		}
+	}
+}
@@ -179,6 +179,7 @@ func TestRenterStream(t *testing.T) {
 	// Specify subtests to run
 	subTests := []siatest.SubTest{
 		{Name: "TestStreamLargeFile", Test: testStreamLargeFile},
+		{Name: "TestRangeServer", Test: testRangeServer},
 		{Name: "TestStreamRepair", Test: testStreamRepair},
 		{Name: "TestUploadStreaming", Test: testUploadStreaming},
 		{Name: "TestUploadStreamingWithBadDeps", Test: testUploadStreamingWithBadDeps},
@@ -215,6 +216,53 @@ func testStreamLargeFile(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testRangeServer tests that the /renter/range endpoint serves the requested
+// ranges of a file without adding them to the download history.
+func testRangeServer(t *testing.T, tg *siatest.TestGroup) {
+	// Grab the first of the group's renters
+	renter := tg.Renters()[0]
+	// Upload a file spanning multiple chunks.
+	dataPieces := uint64(2)
+	parityPieces := uint64(len(tg.Hosts())) - dataPieces
+	ct := crypto.TypeDefaultRenter
+	fileSize := int(3 * siatest.ChunkSize(dataPieces, ct))
+	localFile, remoteFile, err := renter.UploadNewFileBlocking(fileSize, dataPieces, parityPieces, false)
+	if err != nil {
+		t.Fatal("Failed to upload a file for testing: ", err)
+	}
+	data, err := localFile.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdg, err := renter.RenterDownloadsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	numDownloads := len(rdg.Downloads)
+
+	// Request a few ranges. At least 1 byte is requested.
+	for i := 0; i < 5; i++ {
+		from := fastrand.Intn(fileSize - 1)             // [0..fileSize-2]
+		to := from + 1 + fastrand.Intn(fileSize-from-1) // [from+1..fileSize-1]
+		b, err := renter.RenterRangeGet(remoteFile.SiaPath(), uint64(from), uint64(to), true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data[from:to]) {
+			t.Fatalf("range %v-%v doesn't match the uploaded data", from, to)
+		}
+	}
+
+	// The range reads shouldn't show up in the download history.
+	rdg, err = renter.RenterDownloadsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rdg.Downloads) != numDownloads {
+		t.Fatalf("expected %v downloads in the history but got %v", numDownloads, len(rdg.Downloads))
+	}
+}
+
 // testStreamRepair tests if repairing a file using the streaming endpoint
 // works.
 func testStreamRepair(t *testing.T, tg *siatest.TestGroup) {